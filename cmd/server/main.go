@@ -47,22 +47,46 @@ func main() {
 	defer gcsClient.Close()
 
 	// Initialize services
-	templateService := services.NewTemplateService(gcsClient)
+	snippetService := services.NewSnippetService(gcsClient)
 
-	// Initialize PDF service with configurable timeout
-	pdfService, err := services.NewPDFService(cfg.Gotenberg.URL, cfg.Gotenberg.Timeout)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize PDF service: %v", err)
-		pdfService = nil // Continue without PDF service
-	} else {
+	// Legacy .doc and .rtf uploads and extra output formats are converted with a local LibreOffice
+	converter := services.NewLibreOfficeConverter(cfg.LibreOffice.Path, cfg.LibreOffice.Pdftoppm, cfg.LibreOffice.Pdfunite, cfg.LibreOffice.Timeout)
+	if !converter.Available() {
+		log.Printf("Warning: LibreOffice not found at %s; .doc and .rtf uploads and extra output formats will fail", cfg.LibreOffice.Path)
+	}
+
+	// PDFs come from Gotenberg, the local LibreOffice or a fake, as configured
+	var pdfConverter services.PDFConverter
+	switch cfg.PDF.Converter {
+	case "libreoffice":
+		pdfConverter = converter
+		log.Printf("PDF converter: local LibreOffice at %s, timeout: %s", cfg.LibreOffice.Path, cfg.LibreOffice.Timeout)
+	case "fake":
+		pdfConverter = services.NewFakePDFConverter()
+		log.Printf("Warning: PDF converter is fake; PDFs only name the converted file")
+	case "gotenberg":
+		pdfService, err := services.NewPDFService(cfg.Gotenberg.URL, cfg.Gotenberg.Timeout)
+		if err != nil {
+			log.Printf("Warning: Failed to initialize PDF service: %v", err)
+			break // Continue without PDF service
+		}
+		pdfConverter = pdfService
 		log.Printf("PDF service initialized with URL: %s, timeout: %s", cfg.Gotenberg.URL, cfg.Gotenberg.Timeout)
+	default:
+		log.Fatalf("Unknown PDF_CONVERTER %q; use gotenberg, libreoffice or fake", cfg.PDF.Converter)
 	}
 
-	documentService := services.NewDocumentService(gcsClient, templateService, pdfService)
+	templateService := services.NewTemplateService(gcsClient, snippetService, pdfConverter, converter)
+
+	documentService := services.NewDocumentService(gcsClient, templateService, snippetService, pdfConverter, converter)
+	documentService.StartPDFWorkers(cfg.PDF.Workers)
+	packetService := services.NewPacketService(gcsClient, templateService, documentService, pdfConverter)
 	activityLogService := services.NewActivityLogService()
 
 	// Initialize handlers
 	docxHandler := handlers.NewDocxHandler(templateService, documentService)
+	snippetHandler := handlers.NewSnippetHandler(snippetService)
+	packetHandler := handlers.NewPacketHandler(packetService)
 	logsHandler := handlers.NewLogsHandler(activityLogService)
 
 	// Initialize Gin router
@@ -116,10 +140,21 @@ func main() {
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
+		status := "healthy"
+		var converterHealth *services.ConverterHealth
+		if pdfConverter != nil {
+			health := pdfConverter.Health()
+			converterHealth = &health
+			// Documents are still filled while the converter is down, without PDFs
+			if !health.Available() {
+				status = "degraded"
+			}
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"timestamp": time.Now().UTC().Format(time.RFC3339),
-			"version":   "2.0.0-cloud",
+			"status":        status,
+			"timestamp":     time.Now().UTC().Format(time.RFC3339),
+			"version":       "2.0.0-cloud",
+			"pdf_converter": converterHealth,
 		})
 	})
 
@@ -131,11 +166,42 @@ func main() {
 		v1.GET("/templates", docxHandler.GetAllTemplates)
 		v1.GET("/templates/:templateId/placeholders", docxHandler.GetPlaceholders)
 		v1.GET("/templates/:templateId/positions", docxHandler.GetPlaceholderPositions)
+		v1.GET("/templates/:templateId/structure", docxHandler.GetTemplateStructure)
+		v1.GET("/templates/:templateId/pages/:page/overlay.svg", docxHandler.GetPageOverlaySVG)
+		v1.GET("/templates/:templateId/pages/:page/overlay.png", docxHandler.GetPageOverlayPNG)
+		v1.POST("/templates/:templateId/edits", docxHandler.EditTemplate)
+		v1.GET("/templates/:templateId/versions", docxHandler.GetTemplateVersions)
+		v1.GET("/templates/:templateId/computed-fields", docxHandler.GetComputedFields)
+		v1.PUT("/templates/:templateId/computed-fields", docxHandler.UpdateComputedFields)
+		v1.GET("/templates/:templateId/numbering", docxHandler.GetNumberingRules)
+		v1.PUT("/templates/:templateId/numbering", docxHandler.UpdateNumberingRules)
+		v1.GET("/templates/:templateId/properties", docxHandler.GetDocumentProperties)
+		v1.PUT("/templates/:templateId/properties", docxHandler.UpdateDocumentProperties)
+		v1.GET("/templates/:templateId/page-setup", docxHandler.GetPageSetup)
+		v1.PUT("/templates/:templateId/page-setup", docxHandler.UpdatePageSetup)
+		v1.GET("/templates/:templateId/pdf-options", docxHandler.GetPDFOptions)
+		v1.PUT("/templates/:templateId/pdf-options", docxHandler.UpdatePDFOptions)
+		v1.GET("/templates/:templateId/original", docxHandler.DownloadOriginal)
+
+		// Reusable snippets for {{> name}} includes
+		v1.POST("/snippets", snippetHandler.UploadSnippet)
+		v1.GET("/snippets", snippetHandler.GetAllSnippets)
+		v1.DELETE("/snippets/:name", snippetHandler.DeleteSnippet)
 
 		// Document processing and download
 		v1.POST("/templates/:templateId/process", docxHandler.ProcessDocument)
+		v1.GET("/documents/:documentId", docxHandler.GetDocumentStatus)
 		v1.GET("/documents/:documentId/download", docxHandler.DownloadDocument)
 
+		// Packets of templates rendered from one submission into one PDF
+		v1.POST("/packets", packetHandler.CreatePacket)
+		v1.GET("/packets", packetHandler.GetAllPackets)
+		v1.GET("/packets/:packetId", packetHandler.GetPacket)
+		v1.DELETE("/packets/:packetId", packetHandler.DeletePacket)
+		v1.POST("/packets/:packetId/process", packetHandler.ProcessPacket)
+		v1.GET("/packet-submissions/:submissionId", packetHandler.GetSubmissionStatus)
+		v1.GET("/packet-submissions/:submissionId/download", packetHandler.DownloadSubmission)
+
 		// Activity logs
 		v1.GET("/logs", logsHandler.GetAllLogs)
 		v1.GET("/logs/stats", logsHandler.GetLogStats)
@@ -151,7 +217,7 @@ func main() {
 		Addr:         fmt.Sprintf("0.0.0.0:%s", cfg.Server.Port), // Listen on all interfaces for Cloud Run
 		Handler:      r,
 		ReadTimeout:  60 * time.Second,  // Increased from 30s
-		WriteTimeout: 150 * time.Second, // Increased from 30s to handle PDF conversion
+		WriteTimeout: 150 * time.Second, // Covers rendering and long-polling document status
 		IdleTimeout:  60 * time.Second,
 	}
 
@@ -179,15 +245,24 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Finish queued PDF conversions and packets before the database closes. Packets wait for
+	// the PDFs of their forms, so they stop first while the workers still run.
+	if err := packetService.Stop(ctx); err != nil {
+		log.Printf("Error stopping packet builds: %v", err)
+	}
+	if err := documentService.StopPDFWorkers(ctx); err != nil {
+		log.Printf("Error stopping PDF workers: %v", err)
+	}
+
 	// Close database connection
 	if err := internal.CloseDB(); err != nil {
 		log.Printf("Error closing database: %v", err)
 	}
 
-	// Close PDF service
-	if pdfService != nil {
-		if err := pdfService.Close(); err != nil {
-			log.Printf("Error closing PDF service: %v", err)
+	// Close PDF converter
+	if pdfConverter != nil {
+		if err := pdfConverter.Close(); err != nil {
+			log.Printf("Error closing PDF converter: %v", err)
 		}
 	}
 
@@ -4,16 +4,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server    ServerConfig    `json:"server"`
-	Database  DatabaseConfig  `json:"database"`
-	GCS       GCSConfig       `json:"gcs"`
-	Gotenberg GotenbergConfig `json:"gotenberg"`
+	Server      ServerConfig      `json:"server"`
+	Database    DatabaseConfig    `json:"database"`
+	GCS         GCSConfig         `json:"gcs"`
+	Gotenberg   GotenbergConfig   `json:"gotenberg"`
+	LibreOffice LibreOfficeConfig `json:"libreoffice"`
+	PDF         PDFConfig         `json:"pdf"`
 }
 
 type ServerConfig struct {
@@ -42,6 +45,23 @@ type GotenbergConfig struct {
 	Timeout string `json:"timeout"`
 }
 
+// LibreOfficeConfig locates the local LibreOffice used to convert legacy uploads to DOCX and
+// documents to other formats, pdftoppm which renders PDF pages as images and pdfunite which
+// merges PDFs
+type LibreOfficeConfig struct {
+	Path     string `json:"path"`
+	Pdftoppm string `json:"pdftoppm"`
+	Pdfunite string `json:"pdfunite"`
+	Timeout  string `json:"timeout"`
+}
+
+// PDFConfig picks the PDF converter: "gotenberg", "libreoffice" (local soffice) or "fake",
+// and how many documents are converted at once in the background
+type PDFConfig struct {
+	Converter string `json:"converter"`
+	Workers   int    `json:"workers"`
+}
+
 func (d *DatabaseConfig) DSN() string {
 	// Cloud SQL Unix socket support
 	if len(d.Host) > 0 && d.Host[0] == '/' {
@@ -92,6 +112,12 @@ func Load() (*Config, error) {
 		fmt.Printf("Failed to load .env file from any location, using system environment variables\n")
 	}
 
+	pdfWorkers, err := strconv.Atoi(getEnv("PDF_WORKERS", "2"))
+	if err != nil || pdfWorkers < 1 {
+		fmt.Printf("Warning: invalid PDF_WORKERS, using 2\n")
+		pdfWorkers = 2
+	}
+
 	config := &Config{
 		Server: ServerConfig{
 			Port:         getEnv("SERVER_PORT", "8081"),
@@ -115,6 +141,16 @@ func Load() (*Config, error) {
 			URL:     getEnv("GOTENBERG_URL", "http://localhost:3000"),
 			Timeout: getEnv("GOTENBERG_TIMEOUT", "30s"), // Faster timeout for optimized Gotenberg
 		},
+		LibreOffice: LibreOfficeConfig{
+			Path:     getEnv("LIBREOFFICE_PATH", "soffice"),
+			Pdftoppm: getEnv("PDFTOPPM_PATH", "pdftoppm"),
+			Pdfunite: getEnv("PDFUNITE_PATH", "pdfunite"),
+			Timeout:  getEnv("LIBREOFFICE_TIMEOUT", "60s"),
+		},
+		PDF: PDFConfig{
+			Converter: strings.ToLower(getEnv("PDF_CONVERTER", "gotenberg")),
+			Workers:   pdfWorkers,
+		},
 	}
 
 	return config, nil
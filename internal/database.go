@@ -50,10 +50,20 @@ func autoMigrate() error {
             description longtext,
             author longtext,
             gcs_path_docx longtext,
+            gcs_path_normalized longtext,
+            gcs_path_original longtext,
             file_size bigint,
             mime_type longtext,
             placeholders json,
             positions json,
+            sections json,
+            computed_fields json,
+            numbering_rules json,
+            doc_props json,
+            revisions json,
+            page_setup json,
+            pdf_options json,
+            version int DEFAULT 1,
             created_at datetime(3) NULL,
             updated_at datetime(3) NULL,
             deleted_at datetime(3) NULL,
@@ -88,19 +98,29 @@ func autoMigrate() error {
 	}
 
 	ensureDocumentTemplateColumns := map[string]string{
-		"filename":      "ALTER TABLE document_templates ADD COLUMN filename longtext",
-		"original_name": "ALTER TABLE document_templates ADD COLUMN original_name longtext",
-		"display_name":  "ALTER TABLE document_templates ADD COLUMN display_name longtext",
-		"description":   "ALTER TABLE document_templates ADD COLUMN description longtext",
-		"author":        "ALTER TABLE document_templates ADD COLUMN author longtext",
-		"gcs_path_docx": "ALTER TABLE document_templates ADD COLUMN gcs_path_docx longtext",
-		"file_size":     "ALTER TABLE document_templates ADD COLUMN file_size bigint",
-		"mime_type":     "ALTER TABLE document_templates ADD COLUMN mime_type longtext",
-		"placeholders":  "ALTER TABLE document_templates ADD COLUMN placeholders json",
-		"positions":     "ALTER TABLE document_templates ADD COLUMN positions json",
-		"created_at":    "ALTER TABLE document_templates ADD COLUMN created_at datetime(3) NULL",
-		"updated_at":    "ALTER TABLE document_templates ADD COLUMN updated_at datetime(3) NULL",
-		"deleted_at":    "ALTER TABLE document_templates ADD COLUMN deleted_at datetime(3) NULL",
+		"filename":            "ALTER TABLE document_templates ADD COLUMN filename longtext",
+		"original_name":       "ALTER TABLE document_templates ADD COLUMN original_name longtext",
+		"display_name":        "ALTER TABLE document_templates ADD COLUMN display_name longtext",
+		"description":         "ALTER TABLE document_templates ADD COLUMN description longtext",
+		"author":              "ALTER TABLE document_templates ADD COLUMN author longtext",
+		"gcs_path_docx":       "ALTER TABLE document_templates ADD COLUMN gcs_path_docx longtext",
+		"gcs_path_normalized": "ALTER TABLE document_templates ADD COLUMN gcs_path_normalized longtext",
+		"gcs_path_original":   "ALTER TABLE document_templates ADD COLUMN gcs_path_original longtext",
+		"file_size":           "ALTER TABLE document_templates ADD COLUMN file_size bigint",
+		"mime_type":           "ALTER TABLE document_templates ADD COLUMN mime_type longtext",
+		"placeholders":        "ALTER TABLE document_templates ADD COLUMN placeholders json",
+		"positions":           "ALTER TABLE document_templates ADD COLUMN positions json",
+		"sections":            "ALTER TABLE document_templates ADD COLUMN sections json",
+		"computed_fields":     "ALTER TABLE document_templates ADD COLUMN computed_fields json",
+		"numbering_rules":     "ALTER TABLE document_templates ADD COLUMN numbering_rules json",
+		"doc_props":           "ALTER TABLE document_templates ADD COLUMN doc_props json",
+		"revisions":           "ALTER TABLE document_templates ADD COLUMN revisions json",
+		"page_setup":          "ALTER TABLE document_templates ADD COLUMN page_setup json",
+		"pdf_options":         "ALTER TABLE document_templates ADD COLUMN pdf_options json",
+		"version":             "ALTER TABLE document_templates ADD COLUMN version int DEFAULT 1",
+		"created_at":          "ALTER TABLE document_templates ADD COLUMN created_at datetime(3) NULL",
+		"updated_at":          "ALTER TABLE document_templates ADD COLUMN updated_at datetime(3) NULL",
+		"deleted_at":          "ALTER TABLE document_templates ADD COLUMN deleted_at datetime(3) NULL",
 	}
 
 	for column, stmt := range ensureDocumentTemplateColumns {
@@ -109,6 +129,23 @@ func autoMigrate() error {
 		}
 	}
 
+	fmt.Println("Creating document_template_versions table if not exists...")
+	result = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS document_template_versions (
+            id varchar(191) PRIMARY KEY,
+            template_id varchar(191) NOT NULL,
+            version int NOT NULL,
+            gcs_path_docx longtext,
+            file_size bigint,
+            edits json,
+            created_at datetime(3) NULL,
+            INDEX idx_document_template_versions_template_id (template_id)
+        )
+    `)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create document_template_versions table: %w", result.Error)
+	}
+
 	fmt.Println("Creating documents table if not exists...")
 	result = DB.Exec(`
         CREATE TABLE IF NOT EXISTS documents (
@@ -120,6 +157,11 @@ func autoMigrate() error {
             file_size bigint,
             mime_type longtext,
             data json,
+            sequence_numbers json,
+            outputs json,
+            pdf_status varchar(32),
+            pdf_error longtext,
+            pdf_stale_at datetime(3) NULL,
             status varchar(191) DEFAULT 'completed',
             created_at datetime(3) NULL,
             updated_at datetime(3) NULL,
@@ -156,16 +198,21 @@ func autoMigrate() error {
 	}
 
 	ensureDocumentsColumns := map[string]string{
-		"filename":      "ALTER TABLE documents ADD COLUMN filename longtext",
-		"gcs_path_docx": "ALTER TABLE documents ADD COLUMN gcs_path_docx longtext",
-		"gcs_path_pdf":  "ALTER TABLE documents ADD COLUMN gcs_path_pdf longtext",
-		"file_size":     "ALTER TABLE documents ADD COLUMN file_size bigint",
-		"mime_type":     "ALTER TABLE documents ADD COLUMN mime_type longtext",
-		"data":          "ALTER TABLE documents ADD COLUMN data json",
-		"status":        "ALTER TABLE documents ADD COLUMN status varchar(191) DEFAULT 'completed'",
-		"created_at":    "ALTER TABLE documents ADD COLUMN created_at datetime(3) NULL",
-		"updated_at":    "ALTER TABLE documents ADD COLUMN updated_at datetime(3) NULL",
-		"deleted_at":    "ALTER TABLE documents ADD COLUMN deleted_at datetime(3) NULL",
+		"filename":         "ALTER TABLE documents ADD COLUMN filename longtext",
+		"gcs_path_docx":    "ALTER TABLE documents ADD COLUMN gcs_path_docx longtext",
+		"gcs_path_pdf":     "ALTER TABLE documents ADD COLUMN gcs_path_pdf longtext",
+		"file_size":        "ALTER TABLE documents ADD COLUMN file_size bigint",
+		"mime_type":        "ALTER TABLE documents ADD COLUMN mime_type longtext",
+		"data":             "ALTER TABLE documents ADD COLUMN data json",
+		"sequence_numbers": "ALTER TABLE documents ADD COLUMN sequence_numbers json",
+		"outputs":          "ALTER TABLE documents ADD COLUMN outputs json",
+		"pdf_status":       "ALTER TABLE documents ADD COLUMN pdf_status varchar(32)",
+		"pdf_error":        "ALTER TABLE documents ADD COLUMN pdf_error longtext",
+		"pdf_stale_at":     "ALTER TABLE documents ADD COLUMN pdf_stale_at datetime(3) NULL",
+		"status":           "ALTER TABLE documents ADD COLUMN status varchar(191) DEFAULT 'completed'",
+		"created_at":       "ALTER TABLE documents ADD COLUMN created_at datetime(3) NULL",
+		"updated_at":       "ALTER TABLE documents ADD COLUMN updated_at datetime(3) NULL",
+		"deleted_at":       "ALTER TABLE documents ADD COLUMN deleted_at datetime(3) NULL",
 	}
 
 	for column, stmt := range ensureDocumentsColumns {
@@ -174,6 +221,81 @@ func autoMigrate() error {
 		}
 	}
 
+	fmt.Println("Creating document_counters table if not exists...")
+	result = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS document_counters (
+            counter_key varchar(191) PRIMARY KEY,
+            template_id varchar(191),
+            placeholder varchar(191),
+            scope varchar(191),
+            period varchar(16),
+            value bigint NOT NULL DEFAULT 0,
+            created_at datetime(3) NULL,
+            updated_at datetime(3) NULL,
+            INDEX idx_document_counters_template_id (template_id)
+        )
+    `)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create document_counters table: %w", result.Error)
+	}
+
+	fmt.Println("Creating document_snippets table if not exists...")
+	result = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS document_snippets (
+            id varchar(191) PRIMARY KEY,
+            name varchar(191) NOT NULL,
+            filename longtext NOT NULL,
+            description longtext,
+            gcs_path longtext,
+            file_size bigint,
+            placeholders json,
+            created_at datetime(3) NULL,
+            updated_at datetime(3) NULL,
+            UNIQUE INDEX idx_document_snippets_name (name)
+        )
+    `)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create document_snippets table: %w", result.Error)
+	}
+
+	fmt.Println("Creating document_packets table if not exists...")
+	result = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS document_packets (
+            id varchar(191) PRIMARY KEY,
+            name longtext NOT NULL,
+            description longtext,
+            templates json,
+            cover_page boolean DEFAULT false,
+            bookmarks boolean DEFAULT false,
+            created_at datetime(3) NULL,
+            updated_at datetime(3) NULL,
+            deleted_at datetime(3) NULL,
+            INDEX idx_document_packets_deleted_at (deleted_at)
+        )
+    `)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create document_packets table: %w", result.Error)
+	}
+
+	fmt.Println("Creating document_packet_submissions table if not exists...")
+	result = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS document_packet_submissions (
+            id varchar(191) PRIMARY KEY,
+            packet_id varchar(191) NOT NULL,
+            documents json,
+            gcs_path_pdf longtext,
+            pdf_status varchar(32),
+            pdf_error longtext,
+            status varchar(191) DEFAULT 'completed',
+            created_at datetime(3) NULL,
+            updated_at datetime(3) NULL,
+            INDEX idx_document_packet_submissions_packet_id (packet_id)
+        )
+    `)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create document_packet_submissions table: %w", result.Error)
+	}
+
 	fmt.Println("Creating activity_logs table if not exists...")
 	result = DB.Exec(`
         CREATE TABLE IF NOT EXISTS activity_logs (
@@ -0,0 +1,352 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxSteps bounds the work done by a single evaluation, including list traversal
+const MaxSteps = 100000
+
+// MaxStringLength bounds the text an expression may build, in bytes, so that fields built from
+// earlier fields cannot double a string at every step
+const MaxStringLength = 100000
+
+// MaxListLength bounds the lists an expression may build by walking into a list
+const MaxListLength = 10000
+
+// checkLength fails when built text exceeds MaxStringLength
+func checkLength(s string) (interface{}, error) {
+	if len(s) > MaxStringLength {
+		return nil, fmt.Errorf("text exceeds %d bytes", MaxStringLength)
+	}
+	return s, nil
+}
+
+type evalContext struct {
+	vars  map[string]interface{}
+	steps int
+}
+
+func (ctx *evalContext) step(n int) error {
+	ctx.steps += n
+	if ctx.steps > MaxSteps {
+		return fmt.Errorf("expression evaluation exceeded %d steps", MaxSteps)
+	}
+	return nil
+}
+
+// Evaluate runs the expression against the given variables.
+// Values follow JSON decoding: float64, string, bool, nil, []interface{} and map[string]interface{}.
+func (e *Expression) Evaluate(vars map[string]interface{}) (interface{}, error) {
+	ctx := &evalContext{vars: vars}
+	return e.root.eval(ctx)
+}
+
+func (n *literalNode) eval(ctx *evalContext) (interface{}, error) {
+	return n.value, ctx.step(1)
+}
+
+func (n *identNode) eval(ctx *evalContext) (interface{}, error) {
+	if err := ctx.step(1); err != nil {
+		return nil, err
+	}
+
+	value, ok := ctx.vars[n.path[0]]
+	if !ok {
+		return nil, nil
+	}
+	return resolvePath(ctx, value, n.path[1:])
+}
+
+// resolvePath walks object fields; walking into a list projects the field over every item,
+// so `items.amount` yields the list of amounts.
+func resolvePath(ctx *evalContext, value interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return resolvePath(ctx, v[path[0]], path[1:])
+	case []interface{}:
+		if len(v) > MaxListLength {
+			return nil, fmt.Errorf("list exceeds %d items", MaxListLength)
+		}
+		if err := ctx.step(len(v)); err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			resolved, err := resolvePath(ctx, item, path)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, resolved)
+		}
+		return result, nil
+	}
+
+	return nil, nil
+}
+
+func (n *unaryNode) eval(ctx *evalContext) (interface{}, error) {
+	operand, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.step(1); err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "-":
+		num, err := toNumber(operand)
+		if err != nil {
+			return nil, err
+		}
+		return -num, nil
+	case "!":
+		return !toBool(operand), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n *binaryNode) eval(ctx *evalContext) (interface{}, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logical operators
+	switch n.op {
+	case "&&":
+		if !toBool(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right), nil
+	case "||":
+		if toBool(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(right), nil
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.step(1); err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "+":
+		// String concatenation wins whenever either side is text
+		_, leftIsString := left.(string)
+		_, rightIsString := right.(string)
+		if leftIsString || rightIsString {
+			return checkLength(FormatValue(left) + FormatValue(right))
+		}
+		return arithmetic(n.op, left, right)
+	case "-", "*", "/", "%":
+		return arithmetic(n.op, left, right)
+	case "==":
+		return equals(left, right), nil
+	case "!=":
+		return !equals(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n *callNode) eval(ctx *evalContext) (interface{}, error) {
+	if fn, ok := lazyFunctions[n.name]; ok {
+		if err := ctx.step(1); err != nil {
+			return nil, err
+		}
+		result, err := fn(ctx, n.args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		return result, nil
+	}
+
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	if err := ctx.step(1); err != nil {
+		return nil, err
+	}
+
+	result, err := functions[n.name](ctx, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return result, nil
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	a, err := toNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toNumber(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func equals(left, right interface{}) bool {
+	if a, err := toNumber(left); err == nil {
+		if b, err := toNumber(right); err == nil {
+			_, leftIsString := left.(string)
+			_, rightIsString := right.(string)
+			if !leftIsString || !rightIsString {
+				return a == b
+			}
+		}
+	}
+	return FormatValue(left) == FormatValue(right)
+}
+
+func compare(op string, left, right interface{}) (interface{}, error) {
+	var cmp int
+
+	a, errA := toNumber(left)
+	b, errB := toNumber(right)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(FormatValue(left), FormatValue(right))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func toNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		trimmed := strings.TrimSpace(strings.ReplaceAll(v, ",", ""))
+		if trimmed == "" {
+			return 0, nil
+		}
+		num, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return num, nil
+	}
+	return 0, fmt.Errorf("cannot use %T as a number", value)
+}
+
+func toBool(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false" && v != "0"
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// FormatValue renders a value the way it should appear in a document
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, FormatValue(item))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprintf("%v", value)
+}
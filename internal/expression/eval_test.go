@@ -0,0 +1,108 @@
+package expression
+
+import (
+	"strings"
+	"testing"
+)
+
+func evaluate(t *testing.T, source string, vars map[string]interface{}) (interface{}, error) {
+	t.Helper()
+	expr, err := Parse(source)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", source, err)
+	}
+	return expr.Evaluate(vars)
+}
+
+func TestEvaluate(t *testing.T) {
+	vars := map[string]interface{}{
+		"firstName": "Ada",
+		"lastName":  "Lovelace",
+		"items": []interface{}{
+			map[string]interface{}{"amount": float64(10)},
+			map[string]interface{}{"amount": float64(2.5)},
+		},
+	}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`firstName + " " + lastName`, "Ada Lovelace"},
+		{`sum(items.amount)`, "12.5"},
+		{`count(items)`, "2"},
+		{`upper(lastName)`, "LOVELACE"},
+		{`if(sum(items.amount) > 10, "high", "low")`, "high"},
+		{`coalesce(missing, "none")`, "none"},
+	}
+	for _, tt := range tests {
+		got, err := evaluate(t, tt.source, vars)
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if FormatValue(got) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.source, FormatValue(got), tt.want)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	if _, err := Parse(strings.Repeat("1+", MaxExpressionLength) + "1"); err == nil {
+		t.Error("expected an expression longer than the limit to be refused")
+	}
+	if _, err := Parse(strings.Repeat("1+", MaxNodes/2+1) + "1"); err == nil {
+		t.Error("expected an expression with too many nodes to be refused")
+	}
+	if _, err := Parse(`exec("rm")`); err == nil {
+		t.Error("expected an unknown function to be refused")
+	}
+}
+
+func TestEvaluateStepLimit(t *testing.T) {
+	items := make([]interface{}, MaxListLength)
+	for i := range items {
+		items[i] = map[string]interface{}{"amount": float64(1)}
+	}
+	source := "sum(items.amount)" + strings.Repeat(" + sum(items.amount)", MaxSteps/MaxListLength)
+	_, err := evaluate(t, source, map[string]interface{}{"items": items})
+	if err == nil || !strings.Contains(err.Error(), "steps") {
+		t.Errorf("expected the step limit to stop the evaluation, got %v", err)
+	}
+}
+
+func TestEvaluateSizeLimits(t *testing.T) {
+	long := strings.Repeat("x", MaxStringLength/2+1)
+	for _, source := range []string{`text + text`, `concat(text, text)`, `join(list, "")`} {
+		_, err := evaluate(t, source, map[string]interface{}{"text": long, "list": []interface{}{long, long}})
+		if err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Errorf("%s: expected the text limit to stop the evaluation, got %v", source, err)
+		}
+	}
+
+	items := make([]interface{}, MaxListLength+1)
+	for i := range items {
+		items[i] = map[string]interface{}{"amount": float64(1)}
+	}
+	if _, err := evaluate(t, `sum(items.amount)`, map[string]interface{}{"items": items}); err == nil {
+		t.Error("expected a list past the limit to be refused")
+	}
+}
+
+func TestIfEvaluatesOnlyTheBranchTaken(t *testing.T) {
+	vars := map[string]interface{}{"qty": float64(0), "total": float64(10)}
+	got, err := evaluate(t, `if(qty > 0, total / qty, 0)`, vars)
+	if err != nil {
+		t.Fatalf("the branch not taken was evaluated: %v", err)
+	}
+	if got != float64(0) {
+		t.Errorf("got %v, want 0", got)
+	}
+
+	vars["qty"] = float64(4)
+	if got, err := evaluate(t, `if(qty > 0, total / qty, 0)`, vars); err != nil || got != 2.5 {
+		t.Errorf("got %v, %v; want 2.5", got, err)
+	}
+	if got, err := evaluate(t, `coalesce(name, total / 0)`, map[string]interface{}{"name": "Ada"}); err != nil || got != "Ada" {
+		t.Errorf("coalesce evaluated past its first value: %v, %v", got, err)
+	}
+}
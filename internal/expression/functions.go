@@ -0,0 +1,314 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type function func(ctx *evalContext, args []interface{}) (interface{}, error)
+
+// functions and lazyFunctions are the complete set of callables; expressions cannot reach anything else
+var functions = map[string]function{
+	"sum":    fnSum,
+	"count":  fnCount,
+	"avg":    fnAvg,
+	"min":    fnMin,
+	"max":    fnMax,
+	"round":  fnRound,
+	"fixed":  fnFixed,
+	"upper":  fnUpper,
+	"lower":  fnLower,
+	"trim":   fnTrim,
+	"concat": fnConcat,
+	"join":   fnJoin,
+	"len":    fnLen,
+}
+
+// lazyFunction receives its arguments unevaluated
+type lazyFunction func(ctx *evalContext, args []Node) (interface{}, error)
+
+// lazyFunctions evaluate only the arguments they use, so the branch that is not taken in
+// if(qty > 0, total / qty, 0) cannot fail the expression
+var lazyFunctions = map[string]lazyFunction{
+	"if":       fnIf,
+	"coalesce": fnCoalesce,
+}
+
+// Functions returns the names of the available functions
+func Functions() []string {
+	names := make([]string, 0, len(functions)+len(lazyFunctions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	for name := range lazyFunctions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// flatten expands list arguments so sum(items.amount) and sum(a, b) behave alike
+func flatten(ctx *evalContext, args []interface{}) ([]interface{}, error) {
+	var values []interface{}
+	for _, arg := range args {
+		if list, ok := arg.([]interface{}); ok {
+			if err := ctx.step(len(list)); err != nil {
+				return nil, err
+			}
+			nested, err := flatten(ctx, list)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, nested...)
+			continue
+		}
+		values = append(values, arg)
+	}
+	return values, nil
+}
+
+func numbers(ctx *evalContext, args []interface{}) ([]float64, error) {
+	values, err := flatten(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	nums := make([]float64, 0, len(values))
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		num, err := toNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+func expectArgs(args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		if min == max {
+			return fmt.Errorf("expects %d argument(s), got %d", min, len(args))
+		}
+		return fmt.Errorf("expects between %d and %d arguments, got %d", min, max, len(args))
+	}
+	return nil
+}
+
+func fnSum(ctx *evalContext, args []interface{}) (interface{}, error) {
+	nums, err := numbers(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return total, nil
+}
+
+func fnCount(ctx *evalContext, args []interface{}) (interface{}, error) {
+	values, err := flatten(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, value := range values {
+		if value != nil && value != "" {
+			count++
+		}
+	}
+	return float64(count), nil
+}
+
+func fnAvg(ctx *evalContext, args []interface{}) (interface{}, error) {
+	nums, err := numbers(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return 0.0, nil
+	}
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return total / float64(len(nums)), nil
+}
+
+func fnMin(ctx *evalContext, args []interface{}) (interface{}, error) {
+	nums, err := numbers(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, nil
+	}
+	result := nums[0]
+	for _, n := range nums[1:] {
+		result = math.Min(result, n)
+	}
+	return result, nil
+}
+
+func fnMax(ctx *evalContext, args []interface{}) (interface{}, error) {
+	nums, err := numbers(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, nil
+	}
+	result := nums[0]
+	for _, n := range nums[1:] {
+		result = math.Max(result, n)
+	}
+	return result, nil
+}
+
+func decimalsArg(args []interface{}) (int, error) {
+	if len(args) < 2 {
+		return 0, nil
+	}
+	places, err := toNumber(args[1])
+	if err != nil {
+		return 0, err
+	}
+	if places < 0 || places > 10 {
+		return 0, fmt.Errorf("decimal places must be between 0 and 10")
+	}
+	return int(places), nil
+}
+
+func fnRound(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	num, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	places, err := decimalsArg(args)
+	if err != nil {
+		return nil, err
+	}
+	factor := math.Pow(10, float64(places))
+	return math.Round(num*factor) / factor, nil
+}
+
+// fixed formats a number with exactly n decimal places, e.g. fixed(total, 2) -> "12.50"
+func fnFixed(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	num, err := toNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+	places, err := decimalsArg(args)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(num, 'f', places, 64), nil
+}
+
+func fnUpper(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(FormatValue(args[0])), nil
+}
+
+func fnLower(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return strings.ToLower(FormatValue(args[0])), nil
+}
+
+func fnTrim(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return strings.TrimSpace(FormatValue(args[0])), nil
+}
+
+func fnConcat(ctx *evalContext, args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(FormatValue(arg))
+		if sb.Len() > MaxStringLength {
+			break
+		}
+	}
+	return checkLength(sb.String())
+}
+
+func fnJoin(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	separator := ", "
+	if len(args) == 2 {
+		separator = FormatValue(args[1])
+	}
+	values, err := flatten(ctx, args[:1])
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if text := FormatValue(value); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return checkLength(strings.Join(parts, separator))
+}
+
+func fnIf(ctx *evalContext, args []Node) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("expects between 2 and 3 arguments, got %d", len(args))
+	}
+	condition, err := args[0].eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if toBool(condition) {
+		return args[1].eval(ctx)
+	}
+	if len(args) == 3 {
+		return args[2].eval(ctx)
+	}
+	return nil, nil
+}
+
+func fnCoalesce(ctx *evalContext, args []Node) (interface{}, error) {
+	for _, arg := range args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil && value != "" {
+			return value, nil
+		}
+	}
+	return nil, nil
+}
+
+func fnLen(ctx *evalContext, args []interface{}) (interface{}, error) {
+	if err := expectArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	case nil:
+		return 0.0, nil
+	}
+	return float64(len([]rune(FormatValue(args[0])))), nil
+}
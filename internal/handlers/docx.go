@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
+	"strconv"
 	"time"
 
 	"DF-PLCH/internal/models"
@@ -33,6 +34,7 @@ type PlaceholderResponse struct {
 
 type PlaceholderPositionResponse struct {
 	Placeholders []processor.PlaceholderPosition `json:"placeholders"`
+	Sections     []processor.Section             `json:"sections"`
 }
 
 type TemplatesResponse struct {
@@ -40,24 +42,109 @@ type TemplatesResponse struct {
 }
 
 type ProcessRequest struct {
-	Data map[string]string `json:"data"`
+	Data    map[string]interface{} `json:"data"`
+	Options services.RenderOptions `json:"options"`
+}
+
+type ComputedFieldsRequest struct {
+	ComputedFields []models.ComputedField `json:"computed_fields"`
+}
+
+type ComputedFieldsResponse struct {
+	TemplateID     string                 `json:"template_id"`
+	ComputedFields []models.ComputedField `json:"computed_fields"`
+}
+
+type NumberingRulesRequest struct {
+	NumberingRules []models.NumberingRule `json:"numbering_rules"`
+}
+
+type NumberingRulesResponse struct {
+	TemplateID     string                 `json:"template_id"`
+	NumberingRules []models.NumberingRule `json:"numbering_rules"`
+}
+
+type DocumentPropertiesRequest struct {
+	DocumentProperties models.DocumentProperties `json:"document_properties"`
+}
+
+type PageSetupRequest struct {
+	PageSetup models.PageSetup `json:"page_setup"`
+}
+
+type PageSetupResponse struct {
+	TemplateID string           `json:"template_id"`
+	PageSetup  models.PageSetup `json:"page_setup"`
+}
+
+type PDFOptionsRequest struct {
+	PDFOptions models.PDFOptions `json:"pdf_options"`
+}
+
+type PDFOptionsResponse struct {
+	TemplateID string            `json:"template_id"`
+	PDFOptions models.PDFOptions `json:"pdf_options"`
+}
+
+type DocumentPropertiesResponse struct {
+	TemplateID         string                    `json:"template_id"`
+	DocumentProperties models.DocumentProperties `json:"document_properties"`
+}
+
+type TemplateEditsRequest struct {
+	Edits []services.TemplateEdit `json:"edits"`
+}
+
+type TemplateEditsResponse struct {
+	TemplateID   string                          `json:"template_id"`
+	Version      int                             `json:"version"`
+	Placeholders []string                        `json:"placeholders"`
+	Positions    []processor.PlaceholderPosition `json:"positions"`
+	Sections     []processor.Section             `json:"sections"`
+	Message      string                          `json:"message"`
+}
+
+type TemplateVersionsResponse struct {
+	TemplateID string                   `json:"template_id"`
+	Version    int                      `json:"version"` // Current version
+	Versions   []models.TemplateVersion `json:"versions"`
 }
 
 type UploadResponse struct {
-	TemplateID   string   `json:"template_id"`
-	FileName     string   `json:"file_name"`
-	Description  string   `json:"description"`
-	Author       string   `json:"author"`
-	Placeholders []string `json:"placeholders"`
-	Message      string   `json:"message"`
+	TemplateID    string                   `json:"template_id"`
+	FileName      string                   `json:"file_name"`
+	Description   string                   `json:"description"`
+	Author        string                   `json:"author"`
+	Placeholders  []string                 `json:"placeholders"`
+	Revisions     processor.RevisionReport `json:"revisions"`
+	ConvertedFrom string                   `json:"converted_from,omitempty"` // Format of the upload when it was converted to DOCX
+	Message       string                   `json:"message"`
+	Warning       string                   `json:"warning,omitempty"`
 }
 
 type ProcessResponse struct {
-	DocumentID     string `json:"document_id"`
-	DownloadURL    string `json:"download_url"`
-	DownloadPDFURL string `json:"download_pdf_url,omitempty"`
-	ExpiresAt      string `json:"expires_at"`
-	Message        string `json:"message"`
+	DocumentID      string            `json:"document_id"`
+	DownloadURL     string            `json:"download_url"`
+	SequenceNumbers map[string]string `json:"sequence_numbers,omitempty"`
+	PDFStatus       string            `json:"pdf_status"`
+	StatusURL       string            `json:"status_url"` // Poll until pdf_status is no longer pending
+	ExpiresAt       string            `json:"expires_at"`
+	Message         string            `json:"message"`
+	Warning         string            `json:"warning,omitempty"`
+}
+
+// DocumentStatusResponse reports a document and which of its files can be downloaded
+type DocumentStatusResponse struct {
+	DocumentID     string              `json:"document_id"`
+	TemplateID     string              `json:"template_id"`
+	Status         string              `json:"status"`
+	PDFStatus      string              `json:"pdf_status"`
+	PDFReady       bool                `json:"pdf_ready"`
+	PDFError       string              `json:"pdf_error,omitempty"`
+	DownloadURL    string              `json:"download_url"`
+	DownloadPDFURL string              `json:"download_pdf_url,omitempty"`
+	OutputURLs     map[string][]string `json:"output_urls,omitempty"`
+	CreatedAt      string              `json:"created_at"`
 }
 
 func (h *DocxHandler) UploadTemplate(c *gin.Context) {
@@ -68,8 +155,8 @@ func (h *DocxHandler) UploadTemplate(c *gin.Context) {
 	}
 	defer file.Close()
 
-	if filepath.Ext(header.Filename) != ".docx" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .docx files are supported"})
+	if format := processor.FileFormat(header.Filename); !processor.IsTemplateFormat(format) && !processor.IsLegacyFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only " + processor.TemplateFormats() + " files are supported"})
 		return
 	}
 
@@ -91,12 +178,122 @@ func (h *DocxHandler) UploadTemplate(c *gin.Context) {
 		return
 	}
 
-	template, err := h.templateService.UploadTemplateWithMetadata(c.Request.Context(), file, header, fileName, description, author)
+	// Optional computed fields as a JSON array of {"name", "expression"}
+	var computedFields []models.ComputedField
+	if raw := c.PostForm("computedFields"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &computedFields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "computedFields must be a JSON array"})
+			return
+		}
+		if _, err := services.ValidateComputedFields(computedFields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Optional acceptRevisions=true accepts tracked changes and removes comments before storing
+	var options services.UploadOptions
+	if raw := c.PostForm("acceptRevisions"); raw != "" {
+		accept, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "acceptRevisions must be true or false"})
+			return
+		}
+		options.AcceptRevisions = accept
+	}
+
+	// Optional convertToDocx=true stores an .odt upload as DOCX; .doc and .rtf are always converted
+	if raw := c.PostForm("convertToDocx"); raw != "" {
+		convert, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "convertToDocx must be true or false"})
+			return
+		}
+		if convert && processor.FileFormat(header.Filename) != processor.FormatOdt && !processor.IsLegacyFormat(processor.FileFormat(header.Filename)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "convertToDocx applies to .odt, .doc and .rtf uploads only"})
+			return
+		}
+		options.ConvertToDocx = convert
+	}
+
+	// Optional pageSetup JSON object with the paper size and margins of HTML templates
+	var pageSetup *models.PageSetup
+	if raw := c.PostForm("pageSetup"); raw != "" {
+		if !processor.IsHTMLFormat(processor.FileFormat(header.Filename)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageSetup applies to HTML templates only"})
+			return
+		}
+		if err := json.Unmarshal([]byte(raw), &pageSetup); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pageSetup must be a JSON object"})
+			return
+		}
+		if _, err := services.ValidatePageSetup(*pageSetup); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Optional pdfOptions JSON object with the template's default PDF conversion options
+	var pdfOptions *models.PDFOptions
+	if raw := c.PostForm("pdfOptions"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &pdfOptions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pdfOptions must be a JSON object"})
+			return
+		}
+		normalized, err := services.ValidatePDFOptions(*pdfOptions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Converted uploads are stored as DOCX
+		format := processor.FileFormat(header.Filename)
+		if processor.IsLegacyFormat(format) || options.ConvertToDocx {
+			format = processor.FormatDocx
+		}
+		if err := services.CheckPDFOptions(format, normalized); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	template, err := h.templateService.UploadTemplateWithMetadata(c.Request.Context(), file, header, fileName, description, author, options)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidHTMLTemplate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrConversionFailed) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload template: %v", err)})
 		return
 	}
 
+	if pageSetup != nil {
+		template, err = h.templateService.UpdatePageSetup(template.ID, *pageSetup)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save page setup: %v", err)})
+			return
+		}
+	}
+
+	if pdfOptions != nil {
+		template, err = h.templateService.UpdatePDFOptions(template.ID, *pdfOptions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save PDF options: %v", err)})
+			return
+		}
+	}
+
+	if len(computedFields) > 0 {
+		template, err = h.templateService.UpdateComputedFields(template.ID, computedFields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save computed fields: %v", err)})
+			return
+		}
+	}
+
 	// Parse placeholders from JSON
 	var placeholders []string
 	if err := json.Unmarshal([]byte(template.Placeholders), &placeholders); err != nil {
@@ -104,13 +301,24 @@ func (h *DocxHandler) UploadTemplate(c *gin.Context) {
 		return
 	}
 
+	revisions, err := services.ParseRevisionReport(template.Revisions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse revisions"})
+		return
+	}
+
 	response := UploadResponse{
 		TemplateID:   template.ID,
 		FileName:     template.DisplayName,
 		Description:  template.Description,
 		Author:       template.Author,
 		Placeholders: placeholders,
+		Revisions:    revisions,
 		Message:      "Template uploaded successfully",
+		Warning:      services.RevisionWarning(revisions),
+	}
+	if template.OriginalName != template.Filename {
+		response.ConvertedFrom = processor.FileFormat(template.OriginalName)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -163,13 +371,461 @@ func (h *DocxHandler) GetPlaceholderPositions(c *gin.Context) {
 		return
 	}
 
+	sections, err := h.templateService.GetSections(templateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	response := PlaceholderPositionResponse{
 		Placeholders: positions,
+		Sections:     sections,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GetTemplateStructure returns the sections, paragraphs, runs and tables of a template
+func (h *DocxHandler) GetTemplateStructure(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	structure, err := h.templateService.GetStructure(c.Request.Context(), templateID)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, structure)
+}
+
+// EditTemplate applies placeholder edits to a stored template and stores the result as a new version
+func (h *DocxHandler) EditTemplate(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req TemplateEditsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.EditTemplate(c.Request.Context(), templateID, req.Edits)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidEdit), errors.Is(err, services.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrEditConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	placeholders, err := h.templateService.GetPlaceholders(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse placeholders"})
+		return
+	}
+	positions, err := h.templateService.GetPlaceholderPositions(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse positions"})
+		return
+	}
+	sections, err := h.templateService.GetSections(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse sections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TemplateEditsResponse{
+		TemplateID:   template.ID,
+		Version:      template.Version,
+		Placeholders: placeholders,
+		Positions:    positions,
+		Sections:     sections,
+		Message:      "Template edited successfully",
+	})
+}
+
+// GetTemplateVersions lists the versions of a template produced by edits
+func (h *DocxHandler) GetTemplateVersions(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	template, err := h.templateService.GetTemplate(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	versions, err := h.templateService.GetTemplateVersions(templateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, TemplateVersionsResponse{
+		TemplateID: templateID,
+		Version:    template.Version,
+		Versions:   versions,
+	})
+}
+
+// GetPageOverlaySVG returns labelled placeholder rectangles for one page as SVG
+func (h *DocxHandler) GetPageOverlaySVG(c *gin.Context) {
+	overlay, ok := h.pageOverlay(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml", overlay.SVG())
+}
+
+// GetPageOverlayPNG returns the placeholder rectangles of one page as a transparent PNG
+func (h *DocxHandler) GetPageOverlayPNG(c *gin.Context) {
+	overlay, ok := h.pageOverlay(c)
+	if !ok {
+		return
+	}
+	data, err := overlay.PNG()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// pageOverlay reads the template, page and dpi of an overlay request and writes the error response itself
+func (h *DocxHandler) pageOverlay(c *gin.Context) (*processor.PageOverlay, bool) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return nil, false
+	}
+
+	page, err := strconv.Atoi(c.Param("page"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Page must be a positive number"})
+		return nil, false
+	}
+
+	dpi, err := strconv.ParseFloat(c.DefaultQuery("dpi", "96"), 64)
+	if err != nil || dpi < 18 || dpi > 300 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dpi must be a number between 18 and 300"})
+		return nil, false
+	}
+
+	overlay, err := h.templateService.GetPageOverlay(templateID, page, dpi)
+	if err != nil {
+		if errors.Is(err, services.ErrPageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return nil, false
+	}
+	return overlay, true
+}
+
+func (h *DocxHandler) GetComputedFields(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	fields, err := h.templateService.GetComputedFields(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ComputedFieldsResponse{
+		TemplateID:     templateID,
+		ComputedFields: fields,
+	})
+}
+
+func (h *DocxHandler) UpdateComputedFields(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req ComputedFieldsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.UpdateComputedFields(templateID, req.ComputedFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields, err := services.ParseComputedFields(template.ComputedFields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse computed fields"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ComputedFieldsResponse{
+		TemplateID:     template.ID,
+		ComputedFields: fields,
+	})
+}
+
+func (h *DocxHandler) GetNumberingRules(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	rules, err := h.templateService.GetNumberingRules(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NumberingRulesResponse{
+		TemplateID:     templateID,
+		NumberingRules: rules,
+	})
+}
+
+func (h *DocxHandler) UpdateNumberingRules(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req NumberingRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.UpdateNumberingRules(templateID, req.NumberingRules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules, err := services.ParseNumberingRules(template.NumberingRules)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse numbering rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, NumberingRulesResponse{
+		TemplateID:     template.ID,
+		NumberingRules: rules,
+	})
+}
+
+func (h *DocxHandler) GetDocumentProperties(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	props, err := h.templateService.GetDocumentProperties(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DocumentPropertiesResponse{
+		TemplateID:         templateID,
+		DocumentProperties: props,
+	})
+}
+
+func (h *DocxHandler) UpdateDocumentProperties(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req DocumentPropertiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.UpdateDocumentProperties(templateID, req.DocumentProperties)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	props, err := services.ParseDocumentProperties(template.DocProps)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse document properties"})
+		return
+	}
+
+	c.JSON(http.StatusOK, DocumentPropertiesResponse{
+		TemplateID:         template.ID,
+		DocumentProperties: props,
+	})
+}
+
+func (h *DocxHandler) GetPageSetup(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	setup, err := h.templateService.GetPageSetup(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PageSetupResponse{
+		TemplateID: templateID,
+		PageSetup:  setup,
+	})
+}
+
+func (h *DocxHandler) UpdatePageSetup(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req PageSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.UpdatePageSetup(templateID, req.PageSetup)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup, err := services.ParsePageSetup(template.PageSetup)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse page setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PageSetupResponse{
+		TemplateID: template.ID,
+		PageSetup:  setup,
+	})
+}
+
+func (h *DocxHandler) GetPDFOptions(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	options, err := h.templateService.GetPDFOptions(templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PDFOptionsResponse{
+		TemplateID: templateID,
+		PDFOptions: options,
+	})
+}
+
+func (h *DocxHandler) UpdatePDFOptions(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	var req PDFOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if _, err := h.templateService.GetTemplate(templateID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	template, err := h.templateService.UpdatePDFOptions(templateID, req.PDFOptions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, err := services.ParsePDFOptions(template.PDFOptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse PDF options"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PDFOptionsResponse{
+		TemplateID: template.ID,
+		PDFOptions: options,
+	})
+}
+
 func (h *DocxHandler) ProcessDocument(c *gin.Context) {
 	templateID := c.Param("templateId")
 	if templateID == "" {
@@ -183,26 +839,95 @@ func (h *DocxHandler) ProcessDocument(c *gin.Context) {
 		return
 	}
 
-	document, err := h.documentService.ProcessDocument(c.Request.Context(), templateID, req.Data)
+	document, err := h.documentService.ProcessDocument(c.Request.Context(), templateID, req.Data, req.Options)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidRenderOptions) || errors.Is(err, services.ErrInvalidChartData) || errors.Is(err, services.ErrInvalidHTMLTemplate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process document: %v", err)})
 		return
 	}
 
 	// Create temporary download link that expires in 24 hours
+	// The PDF and extra formats are converted in the background
 	expiresAt := time.Now().Add(24 * time.Hour)
 	response := ProcessResponse{
 		DocumentID:  document.ID,
 		DownloadURL: fmt.Sprintf("/api/v1/documents/%s/download", document.ID),
+		PDFStatus:   document.PDFStatus,
+		StatusURL:   fmt.Sprintf("/api/v1/documents/%s", document.ID),
 		ExpiresAt:   expiresAt.Format(time.RFC3339),
 		Message:     "Document processed successfully",
 	}
+	if document.PDFStatus == models.PDFStatusFailed {
+		response.Warning = "No PDF will be generated: " + document.PDFError
+	}
+
+	if document.SequenceNumbers != "" {
+		if err := json.Unmarshal([]byte(document.SequenceNumbers), &response.SequenceNumbers); err != nil {
+			fmt.Printf("Warning: failed to parse sequence numbers for document %s: %v\n", document.ID, err)
+		}
+	}
 
-	// Add PDF download URL if PDF was generated
-	if document.GCSPathPdf != "" {
+	c.JSON(http.StatusOK, response)
+}
+
+// maxStatusWait caps how long GetDocumentStatus waits for a pending PDF
+const maxStatusWait = 60
+
+// GetDocumentStatus reports whether a document's PDF is ready. With ?wait=<seconds> it waits
+// up to that long for a pending PDF before answering.
+func (h *DocxHandler) GetDocumentStatus(c *gin.Context) {
+	documentID := c.Param("documentId")
+	if documentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document ID is required"})
+		return
+	}
+
+	wait, err := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if err != nil || wait < 0 || wait > maxStatusWait {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("wait must be between 0 and %d seconds", maxStatusWait)})
+		return
+	}
+
+	document, err := h.documentService.WaitForDocument(c.Request.Context(), documentID, time.Duration(wait)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	response := DocumentStatusResponse{
+		DocumentID:  document.ID,
+		TemplateID:  document.TemplateID,
+		Status:      document.Status,
+		PDFStatus:   document.PDFStatus,
+		PDFReady:    document.PDFReady,
+		PDFError:    document.PDFError,
+		DownloadURL: fmt.Sprintf("/api/v1/documents/%s/download", document.ID),
+		CreatedAt:   document.CreatedAt.Format(time.RFC3339),
+	}
+	if document.PDFReady {
 		response.DownloadPDFURL = fmt.Sprintf("/api/v1/documents/%s/download?format=pdf", document.ID)
 	}
 
+	outputs, err := services.ParseDocumentOutputs(document.Outputs)
+	if err != nil {
+		fmt.Printf("Warning: failed to parse outputs for document %s: %v\n", document.ID, err)
+	}
+	for format, files := range outputs {
+		if response.OutputURLs == nil {
+			response.OutputURLs = make(map[string][]string)
+		}
+		for i := range files {
+			url := fmt.Sprintf("/api/v1/documents/%s/download?format=%s", document.ID, format)
+			if format == processor.FormatPng {
+				url += fmt.Sprintf("&page=%d", i+1)
+			}
+			response.OutputURLs[format] = append(response.OutputURLs[format], url)
+		}
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
@@ -215,9 +940,16 @@ func (h *DocxHandler) DownloadDocument(c *gin.Context) {
 
 	format := c.DefaultQuery("format", "docx")
 
-	reader, filename, mimeType, err := h.documentService.GetDocumentReader(c.Request.Context(), documentID, format)
+	// PNG output has one file per page
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a number"})
+		return
+	}
+
+	reader, filename, mimeType, err := h.documentService.GetDocumentReader(c.Request.Context(), documentID, format, page)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Document not found: %v", err)})
 		return
 	}
 	defer reader.Close()
@@ -238,12 +970,37 @@ func (h *DocxHandler) DownloadDocument(c *gin.Context) {
 	// After successful download, delete the processed DOCX file from GCS
 	// but keep the document record in database with user data
 	go func() {
-		if err := h.documentService.DeleteProcessedFile(c.Request.Context(), documentID, format); err != nil {
+		if err := h.documentService.DeleteProcessedFile(c.Request.Context(), documentID, format, page); err != nil {
 			fmt.Printf("Warning: failed to delete processed file for document %s: %v\n", documentID, err)
 		}
 	}()
 }
 
+// DownloadOriginal returns the .doc, .rtf or .odt file a template was converted from
+func (h *DocxHandler) DownloadOriginal(c *gin.Context) {
+	templateID := c.Param("templateId")
+	if templateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		return
+	}
+
+	reader, filename, mimeType, err := h.templateService.GetOriginalReader(c.Request.Context(), templateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Original not found: %v", err)})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("Content-Type", mimeType)
+
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		fmt.Printf("Error streaming file: %v\n", err)
+	}
+}
+
 // Legacy functions for backward compatibility - these will be removed
 func UploadTemplate(c *gin.Context) {
 	c.JSON(http.StatusInternalServerError, gin.H{"error": "This endpoint is deprecated. Use dependency injection instead."})
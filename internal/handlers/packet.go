@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PacketHandler struct {
+	packetService *services.PacketService
+}
+
+func NewPacketHandler(packetService *services.PacketService) *PacketHandler {
+	return &PacketHandler{
+		packetService: packetService,
+	}
+}
+
+type PacketsResponse struct {
+	Packets []models.Packet `json:"packets"`
+}
+
+type PacketProcessRequest struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+type PacketProcessResponse struct {
+	SubmissionID string `json:"submission_id"`
+	PacketID     string `json:"packet_id"`
+	PDFStatus    string `json:"pdf_status"`
+	StatusURL    string `json:"status_url"` // Poll until pdf_status is no longer pending
+	Message      string `json:"message"`
+	Warning      string `json:"warning,omitempty"`
+}
+
+// PacketSubmissionResponse reports a packet submission and whether its PDF can be downloaded
+type PacketSubmissionResponse struct {
+	SubmissionID   string   `json:"submission_id"`
+	PacketID       string   `json:"packet_id"`
+	DocumentIDs    []string `json:"document_ids"` // Documents of the forms in packet order, once rendered
+	Status         string   `json:"status"`
+	PDFStatus      string   `json:"pdf_status"`
+	PDFError       string   `json:"pdf_error,omitempty"`
+	DownloadPDFURL string   `json:"download_pdf_url,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+}
+
+func (h *PacketHandler) CreatePacket(c *gin.Context) {
+	var req services.PacketDefinition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	packet, err := h.packetService.CreatePacket(req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPacket) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create packet: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"packet":  packet,
+		"message": "Packet created successfully",
+	})
+}
+
+func (h *PacketHandler) GetAllPackets(c *gin.Context) {
+	packets, err := h.packetService.GetAllPackets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get packets: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, PacketsResponse{Packets: packets})
+}
+
+func (h *PacketHandler) GetPacket(c *gin.Context) {
+	packet, err := h.packetService.GetPacket(c.Param("packetId"))
+	if err != nil {
+		if errors.Is(err, services.ErrPacketNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Packet not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get packet: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, packet)
+}
+
+func (h *PacketHandler) DeletePacket(c *gin.Context) {
+	if err := h.packetService.DeletePacket(c.Param("packetId")); err != nil {
+		if errors.Is(err, services.ErrPacketNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Packet not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete packet: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Packet deleted successfully"})
+}
+
+// ProcessPacket accepts a submission of a packet; its forms are rendered and merged in the
+// background
+func (h *PacketHandler) ProcessPacket(c *gin.Context) {
+	var req PacketProcessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	submission, err := h.packetService.ProcessPacket(c.Request.Context(), c.Param("packetId"), req.Data)
+	if err != nil {
+		if errors.Is(err, services.ErrPacketNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Packet not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process packet: %v", err)})
+		return
+	}
+
+	response := PacketProcessResponse{
+		SubmissionID: submission.ID,
+		PacketID:     submission.PacketID,
+		PDFStatus:    submission.PDFStatus,
+		StatusURL:    fmt.Sprintf("/api/v1/packet-submissions/%s", submission.ID),
+		Message:      "Packet accepted",
+	}
+	if submission.PDFStatus == models.PDFStatusFailed {
+		response.Warning = "No PDF will be generated: " + submission.PDFError
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSubmissionStatus reports whether a packet's merged PDF is ready. With ?wait=<seconds> it
+// waits up to that long for a pending PDF before answering.
+func (h *PacketHandler) GetSubmissionStatus(c *gin.Context) {
+	wait, err := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if err != nil || wait < 0 || wait > maxStatusWait {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("wait must be between 0 and %d seconds", maxStatusWait)})
+		return
+	}
+
+	submission, err := h.packetService.WaitForSubmission(c.Request.Context(), c.Param("submissionId"), time.Duration(wait)*time.Second)
+	if err != nil {
+		if errors.Is(err, services.ErrSubmissionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Packet submission not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get packet submission: %v", err)})
+		return
+	}
+
+	documentIDs, err := services.ParsePacketDocuments(submission.Documents)
+	if err != nil {
+		fmt.Printf("Warning: failed to parse documents of packet submission %s: %v\n", submission.ID, err)
+	}
+	response := PacketSubmissionResponse{
+		SubmissionID: submission.ID,
+		PacketID:     submission.PacketID,
+		DocumentIDs:  documentIDs,
+		Status:       submission.Status,
+		PDFStatus:    submission.PDFStatus,
+		PDFError:     submission.PDFError,
+		CreatedAt:    submission.CreatedAt.Format(time.RFC3339),
+	}
+	if submission.GCSPathPdf != "" {
+		response.DownloadPDFURL = fmt.Sprintf("/api/v1/packet-submissions/%s/download", submission.ID)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadSubmission streams the merged PDF of a packet, which is deleted once downloaded
+func (h *PacketHandler) DownloadSubmission(c *gin.Context) {
+	submissionID := c.Param("submissionId")
+
+	reader, filename, err := h.packetService.GetSubmissionReader(c.Request.Context(), submissionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Packet PDF not found: %v", err)})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Header("Content-Type", "application/pdf")
+
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		// If streaming fails, don't delete the file
+		fmt.Printf("Error streaming file: %v\n", err)
+		return
+	}
+
+	// Like documents, the merged PDF can be downloaded once
+	go func() {
+		if err := h.packetService.DeleteSubmissionPDF(c.Request.Context(), submissionID); err != nil {
+			fmt.Printf("Warning: failed to delete PDF of packet submission %s: %v\n", submissionID, err)
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SnippetHandler struct {
+	snippetService *services.SnippetService
+}
+
+func NewSnippetHandler(snippetService *services.SnippetService) *SnippetHandler {
+	return &SnippetHandler{
+		snippetService: snippetService,
+	}
+}
+
+type SnippetsResponse struct {
+	Snippets []models.Snippet `json:"snippets"`
+}
+
+func (h *SnippetHandler) UploadSnippet(c *gin.Context) {
+	file, header, err := c.Request.FormFile("snippet")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if filepath.Ext(header.Filename) != ".docx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .docx files are supported"})
+		return
+	}
+
+	name := c.PostForm("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	snippet, err := h.snippetService.UploadSnippet(c.Request.Context(), file, header, name, c.PostForm("description"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload snippet: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"snippet": snippet,
+		"include": fmt.Sprintf("{{> %s}}", snippet.Name),
+		"message": "Snippet uploaded successfully",
+	})
+}
+
+func (h *SnippetHandler) GetAllSnippets(c *gin.Context) {
+	snippets, err := h.snippetService.GetAllSnippets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get snippets: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, SnippetsResponse{Snippets: snippets})
+}
+
+func (h *SnippetHandler) DeleteSnippet(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := h.snippetService.DeleteSnippet(c.Request.Context(), name); err != nil {
+		if errors.Is(err, services.ErrSnippetNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snippet not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete snippet: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Snippet deleted successfully"})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// NumberingRule configures a server-allocated sequential number for one placeholder.
+// With Prefix "REG-", Padding 4 and YearReset the numbers run REG-2025-0001, REG-2025-0002, ...
+type NumberingRule struct {
+	Placeholder string `json:"placeholder"`            // Placeholder to fill, e.g. "registrationNo"
+	Prefix      string `json:"prefix"`                 // Text placed before the number
+	Padding     int    `json:"padding"`                // Minimum digits, zero padded
+	YearReset   bool   `json:"year_reset"`             // Include the year and restart at Start every January
+	Start       int64  `json:"start,omitempty"`        // First number handed out (defaults to 1)
+	CounterName string `json:"counter_name,omitempty"` // Share one counter across templates using the same name
+	ScopeField  string `json:"scope_field,omitempty"`  // Keep a separate counter per value of this field, e.g. "regisOffice"
+}
+
+// DocumentCounter holds the last allocated value for one numbering sequence
+type DocumentCounter struct {
+	CounterKey  string    `gorm:"column:counter_key;primaryKey" json:"counter_key"`
+	TemplateID  string    `json:"template_id"`
+	Placeholder string    `json:"placeholder"`
+	Scope       string    `json:"scope"`
+	Period      string    `json:"period"`
+	Value       int64     `gorm:"not null;default:0" json:"value"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (DocumentCounter) TableName() string {
+	return "document_counters"
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Packet is an ordered list of templates rendered from one submission and merged into one PDF
+type Packet struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description"`
+	Templates   string         `gorm:"type:json" json:"templates"` // JSON array of packet templates in order
+	CoverPage   bool           `json:"cover_page"`                 // Start the PDF with a page listing the forms
+	Bookmarks   bool           `json:"bookmarks"`                  // Add a bookmark for the first page of each form
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (Packet) TableName() string {
+	return "document_packets"
+}
+
+// PacketTemplate is one form of a packet. Title names it on the cover page and in bookmarks,
+// and defaults to the template's display name.
+type PacketTemplate struct {
+	TemplateID string `json:"template_id"`
+	Title      string `json:"title,omitempty"`
+}
+
+// PacketSubmission is one processing of a packet: the documents generated for each template and
+// the PDF they are merged into
+type PacketSubmission struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	PacketID   string    `gorm:"not null;index" json:"packet_id"`
+	Documents  string    `gorm:"type:json" json:"documents"` // JSON array of document IDs in packet order
+	GCSPathPdf string    `json:"gcs_path_pdf,omitempty"`
+	PDFStatus  string    `json:"pdf_status"`          // pending while the forms are merged, then ready or failed
+	PDFError   string    `json:"pdf_error,omitempty"` // Why no PDF was made
+	Status     string    `gorm:"default:'completed'" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (PacketSubmission) TableName() string {
+	return "document_packet_submissions"
+}
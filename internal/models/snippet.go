@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Snippet is a reusable DOCX fragment merged into templates through {{> name}} includes
+type Snippet struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"size:191;uniqueIndex;not null" json:"name"`
+	Filename     string    `gorm:"not null" json:"filename"`
+	Description  string    `json:"description"`
+	GCSPath      string    `gorm:"column:gcs_path" json:"gcs_path"`
+	FileSize     int64     `json:"file_size"`
+	Placeholders string    `gorm:"type:json" json:"placeholders"` // JSON array of placeholders inside the snippet
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (Snippet) TableName() string {
+	return "document_snippets"
+}
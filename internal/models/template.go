@@ -7,20 +7,30 @@ import (
 )
 
 type Template struct {
-	ID           string         `gorm:"primaryKey" json:"id"`
-	Filename     string         `gorm:"not null" json:"filename"`
-	OriginalName string         `json:"original_name"`
-	DisplayName  string         `json:"display_name"`
-	Description  string         `json:"description"`
-	Author       string         `json:"author"`
-	GCSPath      string         `gorm:"column:gcs_path_docx" json:"gcs_path"`
-	FileSize     int64          `json:"file_size"`
-	MimeType     string         `json:"mime_type"`
-	Placeholders string         `gorm:"type:json" json:"placeholders"` // JSON array of placeholder strings
-	Positions    string         `gorm:"type:json" json:"positions"`    // JSON array of placeholder positions
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID             string         `gorm:"primaryKey" json:"id"`
+	Filename       string         `gorm:"not null" json:"filename"`
+	OriginalName   string         `json:"original_name"`
+	DisplayName    string         `json:"display_name"`
+	Description    string         `json:"description"`
+	Author         string         `json:"author"`
+	GCSPath        string         `gorm:"column:gcs_path_docx" json:"gcs_path"`
+	NormalizedPath string         `gorm:"column:gcs_path_normalized" json:"gcs_path_normalized,omitempty"` // Copy with placeholders kept in single runs
+	OriginalPath   string         `gorm:"column:gcs_path_original" json:"gcs_path_original,omitempty"`     // Uploaded file the template was converted from
+	FileSize       int64          `json:"file_size"`
+	MimeType       string         `json:"mime_type"`
+	Placeholders   string         `gorm:"type:json" json:"placeholders"`    // JSON array of placeholder strings
+	Positions      string         `gorm:"type:json" json:"positions"`       // JSON array of placeholder positions
+	Sections       string         `gorm:"type:json" json:"sections"`        // JSON array of section page layouts
+	ComputedFields string         `gorm:"type:json" json:"computed_fields"` // JSON array of computed field definitions
+	NumberingRules string         `gorm:"type:json" json:"numbering_rules"` // JSON array of sequential numbering rules
+	DocProps       string         `gorm:"type:json" json:"doc_props"`       // JSON object of document property settings
+	Revisions      string         `gorm:"type:json" json:"revisions"`       // JSON object of tracked changes and comments found at upload
+	PageSetup      string         `gorm:"type:json" json:"page_setup"`      // JSON object of the paper and margins HTML templates are printed with
+	PDFOptions     string         `gorm:"type:json" json:"pdf_options"`     // JSON object of the default PDF conversion options
+	Version        int            `gorm:"default:1" json:"version"`         // Incremented by every edit made through the API
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	Documents []Document `gorm:"foreignKey:TemplateID" json:"documents,omitempty"`
 }
@@ -29,21 +39,101 @@ func (Template) TableName() string {
 	return "document_templates"
 }
 
+// TemplateVersion records a template file produced by edits made through the API
+type TemplateVersion struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	TemplateID string    `gorm:"not null;index" json:"template_id"`
+	Version    int       `gorm:"not null" json:"version"`
+	GCSPath    string    `gorm:"column:gcs_path_docx" json:"gcs_path"`
+	FileSize   int64     `json:"file_size"`
+	Edits      string    `gorm:"type:json" json:"edits"` // JSON array of the edits applied to the previous version
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (TemplateVersion) TableName() string {
+	return "document_template_versions"
+}
+
+// ComputedField is a placeholder whose value is derived from other submitted values,
+// e.g. Name "fullName" with Expression `firstName + " " + lastName`
+type ComputedField struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// DocumentProperties configures the core and custom properties written into generated files.
+// Values may contain placeholders such as "Contract {{registrationNo}}".
+type DocumentProperties struct {
+	Title       string            `json:"title,omitempty"`
+	Subject     string            `json:"subject,omitempty"`
+	Author      string            `json:"author,omitempty"`
+	Keywords    string            `json:"keywords,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Custom      map[string]string `json:"custom,omitempty"`
+	EmbedData   bool              `json:"embed_data"` // Store the submitted data as a customXml part
+}
+
+// PageSetup is the paper size and margins an HTML template is printed with. Lengths are in Unit.
+type PageSetup struct {
+	Paper     string       `json:"paper,omitempty"`  // A3, A4, A5, A6, Letter, Legal or Tabloid; defaults to A4
+	Width     float64      `json:"width,omitempty"`  // Custom paper size, used instead of paper when set
+	Height    float64      `json:"height,omitempty"` // with width
+	Margins   *PageMargins `json:"margins,omitempty"`
+	Unit      string       `json:"unit,omitempty"` // in, mm, cm or pt; defaults to mm
+	Landscape bool         `json:"landscape"`
+	Scale     float64      `json:"scale,omitempty"` // Zoom from 0.1 to 2; defaults to 1
+}
+
+// PageMargins are the margins of a PageSetup
+type PageMargins struct {
+	Top    float64 `json:"top"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+	Right  float64 `json:"right"`
+}
+
+// PDFOptions control how a document is converted to PDF. Templates keep defaults that a process
+// request can override. Paper size and margins apply to DOCX templates, in Unit.
+type PDFOptions struct {
+	PDFA            string       `json:"pdfa,omitempty"`        // PDF/A-1b, PDF/A-2b or PDF/A-3b for archiving
+	PDFUA           *bool        `json:"pdfua,omitempty"`       // Tagged PDF/UA for accessibility
+	PageRanges      string       `json:"page_ranges,omitempty"` // Pages to keep, e.g. "1-3,5"; all by default
+	Paper           string       `json:"paper,omitempty"`       // A3, A4, A5, A6, Letter, Legal or Tabloid
+	Width           float64      `json:"width,omitempty"`       // Custom paper size, used instead of paper when set
+	Height          float64      `json:"height,omitempty"`      // with width
+	Margins         *PageMargins `json:"margins,omitempty"`
+	Unit            string       `json:"unit,omitempty"`             // in, mm, cm or pt; defaults to mm
+	ExportBookmarks *bool        `json:"export_bookmarks,omitempty"` // Headings as PDF bookmarks; on by default
+	LosslessImages  *bool        `json:"lossless_images,omitempty"`  // PNG instead of JPEG compression for images
+}
+
+// PDF statuses of a document
+const (
+	PDFStatusPending = "pending"
+	PDFStatusReady   = "ready"
+	PDFStatusFailed  = "failed"
+)
+
 type Document struct {
-	ID          string         `gorm:"primaryKey" json:"id"`
-	TemplateID  string         `gorm:"not null;index" json:"template_id"`
-	Filename    string         `gorm:"not null" json:"filename"`
-	GCSPathDocx string         `json:"gcs_path_docx"`
-	GCSPathPdf  string         `json:"gcs_path_pdf,omitempty"`
-	TempPDFPath string         `gorm:"-" json:"-"` // Temp PDF file path (not stored in DB)
-	PDFReady    bool           `gorm:"-" json:"pdf_ready"` // PDF availability flag (not stored in DB)
-	FileSize    int64          `json:"file_size"`
-	MimeType    string         `json:"mime_type"`
-	Data        string         `gorm:"type:json" json:"data"` // JSON object of placeholder data used
-	Status      string         `gorm:"default:'completed'" json:"status"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID              string         `gorm:"primaryKey" json:"id"`
+	TemplateID      string         `gorm:"not null;index" json:"template_id"`
+	Filename        string         `gorm:"not null" json:"filename"`
+	GCSPathDocx     string         `json:"gcs_path_docx"`
+	GCSPathPdf      string         `json:"gcs_path_pdf,omitempty"`
+	PDFStatus       string         `json:"pdf_status,omitempty"` // pending while the PDF is converted in the background, then ready or failed
+	PDFError        string         `json:"pdf_error,omitempty"`  // Why no PDF was made
+	PDFStaleAt      *time.Time     `json:"-"`                    // When a pending PDF is given up on, set from its place in the queue and again when a worker takes it up
+	PDFReady        bool           `gorm:"-" json:"pdf_ready"`   // PDF availability flag (not stored in DB)
+	FileSize        int64          `json:"file_size"`
+	MimeType        string         `json:"mime_type"`
+	Data            string         `gorm:"type:json" json:"data"`                       // JSON object of placeholder data used
+	SequenceNumbers string         `gorm:"type:json" json:"sequence_numbers,omitempty"` // JSON object of allocated sequential numbers
+	Outputs         string         `gorm:"type:json" json:"outputs,omitempty"`          // JSON object of extra output formats and their files, one per page for png
+	Status          string         `gorm:"default:'completed'" json:"status"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	Template Template `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
 }
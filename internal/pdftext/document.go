@@ -0,0 +1,313 @@
+// Package pdftext reads the text layer of a PDF: every glyph with its page, position and size.
+// It understands what LibreOffice and Chromium write (classic and compressed object storage,
+// Flate streams, simple and composite fonts with ToUnicode maps) and does not render anything.
+// It can also append bookmarks to a PDF as an incremental update.
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+var objectHeaderPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// document holds every indirect object of a PDF file
+type document struct {
+	objects map[int]interface{}
+	root    dict
+	rootRef ref  // Object number of root, when the trailer refers to it
+	trailer dict // Trailer or cross-reference stream dictionary that names root
+}
+
+// Page is one page of text
+type Page struct {
+	Number int     // 1-based
+	Width  float64 // Points
+	Height float64 // Points
+	Glyphs []Glyph
+}
+
+// Glyph is one shown character code with its box in points, measured from the page's top-left corner
+type Glyph struct {
+	Text   string
+	X      float64 // Left edge
+	Y      float64 // Top edge
+	Width  float64
+	Height float64
+	Size   float64 // Effective font size
+}
+
+// Extract reads the glyphs of every page in data
+func Extract(data []byte) ([]Page, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pagesRoot, ok := doc.resolve(doc.root["Pages"]).(dict)
+	if !ok {
+		return nil, fmt.Errorf("document has no page tree")
+	}
+
+	var pages []Page
+	err = doc.walkPages(pagesRoot, pageAttrs{}, 0, func(page dict, attrs pageAttrs) error {
+		box := attrs.mediaBox
+		if box == nil {
+			box = []float64{0, 0, 612, 792}
+		}
+		p := Page{
+			Number: len(pages) + 1,
+			Width:  box[2] - box[0],
+			Height: box[3] - box[1],
+		}
+
+		content, err := doc.pageContent(page)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", p.Number, err)
+		}
+		interp := newInterpreter(doc, box)
+		interp.run(content, attrs.resources, 0)
+		p.Glyphs = interp.glyphs
+		pages = append(pages, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// parseDocument finds every "n g obj" in the file; later definitions win, as with incremental updates
+func parseDocument(data []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+
+	doc := &document{objects: make(map[int]interface{})}
+	var objectStreams []stream
+	var trailers []dict
+
+	for _, match := range objectHeaderPattern.FindAllSubmatchIndex(data, -1) {
+		// Only accept headers at the start of a line
+		if match[0] > 0 && !isWhitespace(data[match[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		l := &lexer{data: data, pos: match[1], refs: true}
+		obj, ok, err := l.next()
+		if err != nil || !ok {
+			continue
+		}
+
+		if d, isDict := obj.(dict); isDict {
+			l.skipSpace()
+			if bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+				s := stream{dict: d, data: streamData(data, l.pos+len("stream"), d)}
+				obj = s
+				switch d["Type"] {
+				case name("ObjStm"):
+					objectStreams = append(objectStreams, s)
+				case name("XRef"):
+					trailers = append(trailers, d)
+				}
+			}
+		}
+		doc.objects[num] = obj
+	}
+
+	// Objects stored inside object streams
+	for _, s := range objectStreams {
+		decoded, err := doc.decodeStream(s)
+		if err != nil {
+			continue
+		}
+		doc.loadObjectStream(s.dict, decoded)
+	}
+
+	for _, idx := range regexp.MustCompile(`trailer\s*<<`).FindAllIndex(data, -1) {
+		l := &lexer{data: data, pos: idx[1] - 2, refs: true}
+		if obj, ok, err := l.next(); err == nil && ok {
+			if d, isDict := obj.(dict); isDict {
+				trailers = append(trailers, d)
+			}
+		}
+	}
+	for i := len(trailers) - 1; i >= 0 && doc.root == nil; i-- {
+		doc.root, _ = doc.resolve(trailers[i]["Root"]).(dict)
+		doc.rootRef, _ = trailers[i]["Root"].(ref)
+		doc.trailer = trailers[i]
+	}
+	if doc.root == nil {
+		for _, obj := range doc.objects {
+			if d, ok := obj.(dict); ok && d["Type"] == name("Catalog") {
+				doc.root = d
+				break
+			}
+		}
+	}
+	if doc.root == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+	return doc, nil
+}
+
+// streamData cuts the raw bytes of a stream that starts after the "stream" keyword
+func streamData(data []byte, pos int, d dict) []byte {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+
+	// A direct Length is trusted when "endstream" follows it; otherwise search for the keyword
+	if length, ok := d["Length"].(float64); ok && length >= 0 {
+		end := pos + int(length)
+		if end >= pos && end <= len(data) {
+			rest := bytes.TrimLeft(data[end:min(end+20, len(data))], "\r\n \t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				return data[pos:end]
+			}
+		}
+	}
+	end := bytes.Index(data[pos:], []byte("endstream"))
+	if end == -1 {
+		return data[pos:]
+	}
+	return bytes.TrimRight(data[pos:pos+end], "\r\n")
+}
+
+func (doc *document) loadObjectStream(d dict, decoded []byte) {
+	count := int(number(d["N"]))
+	first := int(number(d["First"]))
+	if first < 0 || first > len(decoded) {
+		return
+	}
+
+	header := &lexer{data: decoded[:first]}
+	for i := 0; i < count; i++ {
+		numObj, ok1, _ := header.next()
+		offObj, ok2, _ := header.next()
+		if !ok1 || !ok2 {
+			return
+		}
+		num := int(number(numObj))
+		offset := int(number(offObj))
+		if _, exists := doc.objects[num]; exists || offset < 0 {
+			continue
+		}
+		l := &lexer{data: decoded, pos: first + offset, refs: true}
+		if obj, ok, err := l.next(); err == nil && ok {
+			doc.objects[num] = obj
+		}
+	}
+}
+
+// resolve follows indirect references
+func (doc *document) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		r, ok := obj.(ref)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[r.num]
+	}
+	return nil
+}
+
+func (doc *document) dictValue(d dict, key name) dict {
+	v, _ := doc.resolve(d[key]).(dict)
+	return v
+}
+
+// decodeStream applies the stream's filters
+func (doc *document) decodeStream(s stream) ([]byte, error) {
+	var filters []interface{}
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []interface{}{f}
+	case array:
+		filters = f
+	}
+
+	data := s.data
+	for _, f := range filters {
+		switch doc.resolve(f) {
+		case name("FlateDecode"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("flate: %w", err)
+			}
+			decoded, err := io.ReadAll(r)
+			if err != nil && len(decoded) == 0 {
+				return nil, fmt.Errorf("flate: %w", err)
+			}
+			data = decoded
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// pageAttrs are the inheritable page attributes
+type pageAttrs struct {
+	resources dict
+	mediaBox  []float64
+}
+
+func (doc *document) walkPages(node dict, inherited pageAttrs, depth int, visit func(dict, pageAttrs) error) error {
+	if depth > 64 {
+		return fmt.Errorf("page tree too deep")
+	}
+	attrs := inherited
+	if res := doc.dictValue(node, "Resources"); res != nil {
+		attrs.resources = res
+	}
+	if box, ok := doc.resolve(node["MediaBox"]).(array); ok && len(box) == 4 {
+		attrs.mediaBox = []float64{number(doc.resolve(box[0])), number(doc.resolve(box[1])), number(doc.resolve(box[2])), number(doc.resolve(box[3]))}
+	}
+
+	if node["Type"] == name("Page") || node["Kids"] == nil {
+		return visit(node, attrs)
+	}
+	kids, _ := doc.resolve(node["Kids"]).(array)
+	for _, kid := range kids {
+		if child, ok := doc.resolve(kid).(dict); ok {
+			if err := doc.walkPages(child, attrs, depth+1, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pageContent joins and decodes a page's content streams
+func (doc *document) pageContent(page dict) ([]byte, error) {
+	var parts []interface{}
+	switch c := doc.resolve(page["Contents"]).(type) {
+	case stream:
+		parts = []interface{}{c}
+	case array:
+		parts = c
+	}
+
+	var content bytes.Buffer
+	for _, part := range parts {
+		s, ok := doc.resolve(part).(stream)
+		if !ok {
+			continue
+		}
+		decoded, err := doc.decodeStream(s)
+		if err != nil {
+			return nil, err
+		}
+		content.Write(decoded)
+		content.WriteByte('\n')
+	}
+	return content.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package pdftext
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// buildPDF writes a PDF with one line of Helvetica text per page, a document information
+// dictionary and a classic cross-reference table. extra objects are appended as they are.
+func buildPDF(texts []string, extra ...string) []byte {
+	kids := make([]string, len(texts))
+	for i := range texts {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(texts)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (Test document) /Producer (pdftext) >>",
+	}
+	for i, text := range texts {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 770 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+	objects = append(objects, extra...)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func pageText(page Page) string {
+	var sb strings.Builder
+	for _, glyph := range page.Glyphs {
+		sb.WriteString(glyph.Text)
+	}
+	return sb.String()
+}
+
+func TestExtract(t *testing.T) {
+	pages, err := Extract(buildPDF([]string{"First page", "Second page"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	if pages[0].Width != 595 || pages[0].Height != 842 {
+		t.Errorf("page 1 is %vx%v, want 595x842", pages[0].Width, pages[0].Height)
+	}
+	for i, want := range []string{"First page", "Second page"} {
+		if got := pageText(pages[i]); got != want {
+			t.Errorf("page %d reads %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestObjectStreamWithNegativeOffset(t *testing.T) {
+	header := "20 0"
+	for _, first := range []int{-5, len(header) + 1} {
+		objStm := fmt.Sprintf("<< /Type /ObjStm /N 1 /First %d /Length %d >>\nstream\n%s\nendstream", first, len(header), header)
+		if _, err := Extract(buildPDF([]string{"Page"}, objStm)); err != nil {
+			t.Errorf("/First %d: %v", first, err)
+		}
+	}
+
+	// An object offset before the first object is skipped too
+	header = "20 -4 (x)"
+	objStm := fmt.Sprintf("<< /Type /ObjStm /N 1 /First 6 /Length %d >>\nstream\n%s\nendstream", len(header), header)
+	if _, err := Extract(buildPDF([]string{"Page"}, objStm)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamWithNegativeLength(t *testing.T) {
+	data := buildPDF([]string{"Page"})
+	data = regexp.MustCompile(`/Length \d+`).ReplaceAll(data, []byte("/Length -100000"))
+	if !bytes.Contains(data, []byte("/Length -100000")) {
+		t.Fatal("the content stream has no length to replace")
+	}
+	pages, err := Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pageText(pages[0]); got != "Page" {
+		t.Errorf("page reads %q, want the stream found through endstream", got)
+	}
+}
@@ -0,0 +1,245 @@
+package pdftext
+
+import (
+	"unicode/utf16"
+)
+
+// font decodes character codes of one font resource into text and advance widths
+type font struct {
+	codeBytes    int             // 1 for simple fonts, usually 2 for composite fonts
+	widths       map[int]float64 // Glyph space units
+	defaultWidth float64         // Width of codes missing from widths
+	toUnicode    map[int]string  // From the ToUnicode CMap
+	scale        float64         // Glyph space to text space, 0.001 except for Type3 fonts
+	ascent       float64         // Glyph space units above the baseline
+	descent      float64         // Glyph space units below the baseline (negative)
+	simple       bool            // Single-byte font where code 32 gets word spacing
+}
+
+// winAnsiHigh maps the 0x80-0x9F range of WinAnsiEncoding; other codes are Latin-1
+var winAnsiHigh = map[int]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰',
+	0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '\'', 0x92: '\'', 0x93: '"', 0x94: '"', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// loadFont reads a font dictionary
+func (doc *document) loadFont(d dict) *font {
+	f := &font{
+		codeBytes: 1,
+		widths:    make(map[int]float64),
+		scale:     0.001,
+		ascent:    800,
+		descent:   -200,
+		simple:    true,
+	}
+
+	descriptor := doc.dictValue(d, "FontDescriptor")
+
+	switch d["Subtype"] {
+	case name("Type0"):
+		f.codeBytes = 2
+		f.simple = false
+		f.defaultWidth = 1000
+		if descendants, ok := doc.resolve(d["DescendantFonts"]).(array); ok && len(descendants) > 0 {
+			if cid, ok := doc.resolve(descendants[0]).(dict); ok {
+				descriptor = doc.dictValue(cid, "FontDescriptor")
+				if dw, ok := doc.resolve(cid["DW"]).(float64); ok {
+					f.defaultWidth = dw
+				}
+				f.loadCIDWidths(doc, cid)
+			}
+		}
+
+	default:
+		first := int(number(doc.resolve(d["FirstChar"])))
+		if widths, ok := doc.resolve(d["Widths"]).(array); ok {
+			for i, w := range widths {
+				f.widths[first+i] = number(doc.resolve(w))
+			}
+		} else {
+			f.defaultWidth = 500 // Standard 14 fonts without widths; a rough average
+		}
+		if d["Subtype"] == name("Type3") {
+			if matrix, ok := doc.resolve(d["FontMatrix"]).(array); ok && len(matrix) == 6 {
+				f.scale = number(doc.resolve(matrix[0]))
+			}
+		}
+	}
+
+	if descriptor != nil {
+		if missing, ok := doc.resolve(descriptor["MissingWidth"]).(float64); ok && f.simple {
+			f.defaultWidth = missing
+		}
+		if ascent, ok := doc.resolve(descriptor["Ascent"]).(float64); ok && ascent != 0 {
+			f.ascent = ascent
+		}
+		if descent, ok := doc.resolve(descriptor["Descent"]).(float64); ok && descent != 0 {
+			f.descent = descent
+		}
+	}
+
+	if s, ok := doc.resolve(d["ToUnicode"]).(stream); ok {
+		if data, err := doc.decodeStream(s); err == nil {
+			f.toUnicode, f.codeBytes = parseToUnicode(data, f.codeBytes)
+		}
+	}
+
+	return f
+}
+
+// loadCIDWidths reads the W array of a CID font: "c [w1 w2 ...]" and "cfirst clast w" entries
+func (f *font) loadCIDWidths(doc *document, cid dict) {
+	w, ok := doc.resolve(cid["W"]).(array)
+	if !ok {
+		return
+	}
+	for i := 0; i < len(w); {
+		first := int(number(doc.resolve(w[i])))
+		if i+1 >= len(w) {
+			return
+		}
+		if list, ok := doc.resolve(w[i+1]).(array); ok {
+			for j, width := range list {
+				f.widths[first+j] = number(doc.resolve(width))
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last := int(number(doc.resolve(w[i+1])))
+		width := number(doc.resolve(w[i+2]))
+		for c := first; c <= last && c-first < 65536; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+// codes splits a shown string into character codes
+func (f *font) codes(s []byte) []int {
+	codes := make([]int, 0, len(s)/f.codeBytes+1)
+	for i := 0; i+f.codeBytes <= len(s); i += f.codeBytes {
+		code := 0
+		for j := 0; j < f.codeBytes; j++ {
+			code = code<<8 | int(s[i+j])
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+func (f *font) text(code int) string {
+	if text, ok := f.toUnicode[code]; ok {
+		return text
+	}
+	if !f.simple {
+		return "�"
+	}
+	if r, ok := winAnsiHigh[code]; ok {
+		return string(r)
+	}
+	return string(rune(code))
+}
+
+func (f *font) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.defaultWidth
+}
+
+// parseToUnicode reads bfchar and bfrange mappings of a ToUnicode CMap. The code length comes
+// from the codespace range when present, otherwise defaultBytes is kept.
+func parseToUnicode(data []byte, defaultBytes int) (map[int]string, int) {
+	mapping := make(map[int]string)
+	codeBytes := defaultBytes
+	l := &lexer{data: data}
+
+	var operands []interface{}
+	for {
+		obj, ok, err := l.next()
+		if err != nil || !ok {
+			break
+		}
+		k, isKeyword := obj.(keyword)
+		if !isKeyword {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch k {
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if lo, ok := operands[0].(pdfStr); ok && len(lo) > 0 {
+					codeBytes = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfStr)
+				dst, ok2 := operands[i+1].(pdfStr)
+				if ok1 && ok2 {
+					mapping[bytesToCode(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfStr)
+				hi, ok2 := operands[i+1].(pdfStr)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := bytesToCode(lo), bytesToCode(hi)
+				if end-start > 65535 {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfStr:
+					for c := start; c <= end; c++ {
+						mapping[c] = utf16BE(incrementLast(dst, c-start))
+					}
+				case array:
+					for j, item := range dst {
+						if s, ok := item.(pdfStr); ok && start+j <= end {
+							mapping[start+j] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return mapping, codeBytes
+}
+
+func bytesToCode(b []byte) int {
+	code := 0
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+// incrementLast adds n to the last byte pair of a UTF-16BE destination, as bfrange requires
+func incrementLast(dst []byte, n int) []byte {
+	out := append([]byte{}, dst...)
+	if len(out) < 2 {
+		return out
+	}
+	last := int(out[len(out)-2])<<8 | int(out[len(out)-1])
+	last += n
+	out[len(out)-2] = byte(last >> 8)
+	out[len(out)-1] = byte(last)
+	return out
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
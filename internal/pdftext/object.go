@@ -0,0 +1,297 @@
+package pdftext
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// PDF object model. Numbers are float64, strings are raw bytes and operators in
+// content streams are keywords.
+type (
+	name    string
+	keyword string
+	pdfStr  []byte
+	array   []interface{}
+	dict    map[name]interface{}
+	ref     struct{ num, gen int }
+	stream  struct {
+		dict dict
+		data []byte // Raw, still encoded
+	}
+)
+
+// lexer reads PDF objects from a byte slice
+type lexer struct {
+	data []byte
+	pos  int
+	refs bool // Treat "n g R" as an indirect reference (off in content streams)
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) != -1
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// next returns the next object, with ok=false at the end of data
+func (l *lexer) next() (interface{}, bool, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false, nil
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.readName(), true, nil
+	case c == '(':
+		s, err := l.readLiteral()
+		return s, true, err
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			d, err := l.readDict()
+			return d, true, err
+		}
+		s, err := l.readHex()
+		return s, true, err
+	case c == '[':
+		l.pos++
+		a, err := l.readArray()
+		return a, true, err
+	case c == ']' || c == '>' || c == '}' || c == '{':
+		l.pos++
+		if c == '>' && l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return keyword(">>"), true, nil
+		}
+		return keyword(string(c)), true, nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), true, nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, true, nil
+	case "false":
+		return false, true, nil
+	case "null":
+		return nil, true, nil
+	}
+	return keyword(word), true, nil
+}
+
+func (l *lexer) readName() name {
+	l.pos++ // '/'
+	var sb bytes.Buffer
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				sb.WriteByte(byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	return name(sb.String())
+}
+
+func (l *lexer) readNumber() interface{} {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && (l.data[l.pos] == '.' || l.data[l.pos] == '-' || (l.data[l.pos] >= '0' && l.data[l.pos] <= '9')) {
+		l.pos++
+	}
+	value, _ := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+
+	// "num gen R" is an indirect reference
+	if l.refs && bytes.IndexByte(l.data[start:l.pos], '.') == -1 {
+		save := l.pos
+		l.skipSpace()
+		genStart := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > genStart {
+			gen, _ := strconv.Atoi(string(l.data[genStart:l.pos]))
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 >= len(l.data) || isWhitespace(l.data[l.pos+1]) || isDelimiter(l.data[l.pos+1])) {
+				l.pos++
+				return ref{num: int(value), gen: gen}
+			}
+		}
+		l.pos = save
+	}
+	return value
+}
+
+func (l *lexer) readLiteral() (pdfStr, error) {
+	l.pos++ // '('
+	var sb bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfStr(sb.Bytes()), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					sb.WriteByte(byte(v))
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func (l *lexer) readHex() (pdfStr, error) {
+	l.pos++ // '<'
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		c := l.data[l.pos]
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("unterminated hex string")
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex string")
+		}
+		out[i] = byte(v)
+	}
+	return pdfStr(out), nil
+}
+
+func (l *lexer) readArray() (array, error) {
+	var a array
+	for {
+		obj, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if k, isKeyword := obj.(keyword); isKeyword && k == "]" {
+			return a, nil
+		}
+		a = append(a, obj)
+	}
+}
+
+func (l *lexer) readDict() (dict, error) {
+	d := make(dict)
+	for {
+		obj, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unterminated dictionary")
+		}
+		if k, isKeyword := obj.(keyword); isKeyword && k == ">>" {
+			return d, nil
+		}
+		key, isName := obj.(name)
+		if !isName {
+			continue
+		}
+		value, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unterminated dictionary")
+		}
+		if k, isKeyword := value.(keyword); isKeyword && k == ">>" {
+			return d, nil
+		}
+		d[key] = value
+	}
+}
+
+// number converts a numeric object, returning 0 for anything else
+func number(obj interface{}) float64 {
+	if v, ok := obj.(float64); ok {
+		return v
+	}
+	return 0
+}
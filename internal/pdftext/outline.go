@@ -0,0 +1,310 @@
+package pdftext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+var startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// OutlineEntry is a bookmark to the top of a page
+type OutlineEntry struct {
+	Title string
+	Page  int // 1-based
+}
+
+// PageCount returns the number of pages of a PDF
+func PageCount(data []byte) (int, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return 0, err
+	}
+	pages, err := doc.pageRefs()
+	if err != nil {
+		return 0, err
+	}
+	return len(pages), nil
+}
+
+// xrefOnlyKeys describe a cross-reference section rather than the document, so they are not
+// carried into the trailer of an update
+var xrefOnlyKeys = map[name]bool{
+	"Prev": true, "Size": true, "XRefStm": true,
+	"Type": true, "W": true, "Index": true, "Length": true, "Filter": true, "DecodeParms": true,
+	"F": true, "FFilter": true, "FDecodeParms": true, "DL": true,
+}
+
+// AddOutline replaces the bookmarks of a PDF with one top-level bookmark per entry. The
+// change is appended as an incremental update, so the original bytes are kept as they are.
+func AddOutline(data []byte, entries []OutlineEntry) ([]byte, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.rootRef.num == 0 {
+		return nil, fmt.Errorf("document catalog is not an indirect object")
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, fmt.Errorf("encrypted documents cannot be bookmarked")
+	}
+	matches := startxrefPattern.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("document has no cross-reference offset")
+	}
+	prev, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+
+	pages, err := doc.pageRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Page < 1 || entry.Page > len(pages) {
+			return nil, fmt.Errorf("bookmark %q points to page %d of %d", entry.Title, entry.Page, len(pages))
+		}
+	}
+
+	// New objects are numbered after every existing one
+	next := int(number(doc.trailer["Size"]))
+	for num := range doc.objects {
+		next = max(next, num+1)
+	}
+	outlinesNum := next
+	objects := map[int]interface{}{}
+
+	catalog := dict{}
+	for key, value := range doc.root {
+		catalog[key] = value
+	}
+	delete(catalog, "Outlines")
+	if len(entries) > 0 {
+		catalog["Outlines"] = ref{num: outlinesNum}
+		catalog["PageMode"] = name("UseOutlines")
+
+		objects[outlinesNum] = dict{
+			"Type":  name("Outlines"),
+			"First": ref{num: outlinesNum + 1},
+			"Last":  ref{num: outlinesNum + len(entries)},
+			"Count": float64(len(entries)),
+		}
+		for i, entry := range entries {
+			item := dict{
+				"Title":  textString(entry.Title),
+				"Parent": ref{num: outlinesNum},
+				"Dest":   array{pages[entry.Page-1], name("Fit")},
+			}
+			if i > 0 {
+				item["Prev"] = ref{num: outlinesNum + i}
+			}
+			if i < len(entries)-1 {
+				item["Next"] = ref{num: outlinesNum + i + 2}
+			}
+			objects[outlinesNum+1+i] = item
+		}
+		next += 1 + len(entries)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	offsets := map[int]int{doc.rootRef.num: buf.Len()}
+	fmt.Fprintf(&buf, "%d %d obj\n", doc.rootRef.num, doc.rootRef.gen)
+	writeObject(&buf, catalog)
+	buf.WriteString("\nendobj\n")
+	for num := outlinesNum; num < next; num++ {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", num)
+		writeObject(&buf, objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	// An update's trailer repeats the previous one, keeping /Info and /ID
+	trailer := dict{}
+	for key, value := range doc.trailer {
+		if !xrefOnlyKeys[key] {
+			trailer[key] = value
+		}
+	}
+	trailer["Root"] = doc.rootRef
+	trailer["Prev"] = float64(prev)
+	if bytes.HasPrefix(data[min(prev, len(data)):], []byte("xref")) {
+		writeXRefTable(&buf, offsets, doc.rootRef, trailer, next)
+	} else {
+		// A file indexed by a cross-reference stream is updated with one
+		writeXRefStream(&buf, offsets, doc.rootRef, trailer, next)
+	}
+	return buf.Bytes(), nil
+}
+
+// pageRefs lists the page objects in page order
+func (doc *document) pageRefs() ([]ref, error) {
+	var pages []ref
+	var walk func(node interface{}, depth int) error
+	walk = func(node interface{}, depth int) error {
+		if depth > 64 {
+			return fmt.Errorf("page tree too deep")
+		}
+		d, ok := doc.resolve(node).(dict)
+		if !ok {
+			return nil
+		}
+		if d["Type"] == name("Page") || d["Kids"] == nil {
+			if r, isRef := node.(ref); isRef {
+				pages = append(pages, r)
+			}
+			return nil
+		}
+		kids, _ := doc.resolve(d["Kids"]).(array)
+		for _, kid := range kids {
+			if err := walk(kid, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(doc.root["Pages"], 0); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("document has no pages")
+	}
+	return pages, nil
+}
+
+// writeXRefTable ends an incremental update with a classic cross-reference table
+func writeXRefTable(buf *bytes.Buffer, offsets map[int]int, root ref, trailer dict, size int) {
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	for _, section := range xrefSections(offsets) {
+		fmt.Fprintf(buf, "%d %d\n", section[0], section[1])
+		for num := section[0]; num < section[0]+section[1]; num++ {
+			gen := 0
+			if num == root.num {
+				gen = root.gen
+			}
+			fmt.Fprintf(buf, "%010d %05d n \n", offsets[num], gen)
+		}
+	}
+	trailer["Size"] = float64(size)
+	buf.WriteString("trailer\n")
+	writeObject(buf, trailer)
+	fmt.Fprintf(buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+}
+
+// writeXRefStream ends an incremental update with a cross-reference stream, which takes the
+// next object number
+func writeXRefStream(buf *bytes.Buffer, offsets map[int]int, root ref, trailer dict, size int) {
+	xrefNum := size
+	offsets[xrefNum] = buf.Len()
+
+	var entries bytes.Buffer
+	index := array{}
+	for _, section := range xrefSections(offsets) {
+		index = append(index, float64(section[0]), float64(section[1]))
+		for num := section[0]; num < section[0]+section[1]; num++ {
+			gen := 0
+			if num == root.num {
+				gen = root.gen
+			}
+			entries.WriteByte(1)
+			binary.Write(&entries, binary.BigEndian, uint32(offsets[num]))
+			binary.Write(&entries, binary.BigEndian, uint16(gen))
+		}
+	}
+
+	trailer["Type"] = name("XRef")
+	trailer["Size"] = float64(xrefNum + 1)
+	trailer["W"] = array{float64(1), float64(4), float64(2)}
+	trailer["Index"] = index
+	trailer["Length"] = float64(entries.Len())
+	fmt.Fprintf(buf, "%d 0 obj\n", xrefNum)
+	writeObject(buf, trailer)
+	buf.WriteString("\nstream\n")
+	buf.Write(entries.Bytes())
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[xrefNum])
+}
+
+// xrefSections groups object numbers into runs of [first, count]
+func xrefSections(offsets map[int]int) [][2]int {
+	nums := make([]int, 0, len(offsets))
+	for num := range offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	var sections [][2]int
+	for _, num := range nums {
+		if n := len(sections); n > 0 && sections[n-1][0]+sections[n-1][1] == num {
+			sections[n-1][1]++
+			continue
+		}
+		sections = append(sections, [2]int{num, 1})
+	}
+	return sections
+}
+
+// textString encodes text as a UTF-16 PDF string, which readers show in any script
+func textString(text string) pdfStr {
+	s := pdfStr{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		s = append(s, byte(unit>>8), byte(unit))
+	}
+	return s
+}
+
+// writeObject serializes a parsed object
+func writeObject(buf *bytes.Buffer, obj interface{}) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case name:
+		buf.WriteByte('/')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c <= ' ' || c > '~' || c == '#' || isDelimiter(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+				continue
+			}
+			buf.WriteByte(c)
+		}
+	case pdfStr:
+		fmt.Fprintf(buf, "<%X>", []byte(v))
+	case ref:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case keyword:
+		buf.WriteString(string(v))
+	case array:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case dict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, key := range keys {
+			writeObject(buf, name(key))
+			buf.WriteByte(' ')
+			writeObject(buf, v[name(key)])
+		}
+		buf.WriteString(">>")
+	}
+}
@@ -0,0 +1,73 @@
+package pdftext
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAddOutline(t *testing.T) {
+	data := buildPDF([]string{"One", "Two", "Three"})
+	updated, err := AddOutline(data, []OutlineEntry{{Title: "Intro", Page: 1}, {Title: "Ending", Page: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(updated, data) {
+		t.Fatal("the update does not keep the original bytes")
+	}
+	if count, err := PageCount(updated); err != nil || count != 3 {
+		t.Fatalf("PageCount = %d, %v; want 3", count, err)
+	}
+
+	// Every entry of the appended table points at its object
+	update := updated[len(data):]
+	section := regexp.MustCompile(`(?s)xref\n(.*)trailer`).FindSubmatch(update)
+	if section == nil {
+		t.Fatal("the update has no cross-reference table")
+	}
+	lines := strings.Split(strings.TrimSpace(string(section[1])), "\n")
+	for i := 0; i < len(lines); {
+		var first, count int
+		fmt.Sscanf(lines[i], "%d %d", &first, &count)
+		for num := first; num < first+count; num++ {
+			i++
+			offset, _ := strconv.Atoi(lines[i][:10])
+			if want := fmt.Sprintf("%d 0 obj", num); !bytes.HasPrefix(updated[offset:], []byte(want)) {
+				t.Errorf("object %d: offset %d does not start %q", num, offset, want)
+			}
+		}
+		i++
+	}
+
+	doc, err := parseDocument(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.trailer["Info"] != (ref{num: 4}) {
+		t.Errorf("the update's trailer has /Info %v, want 4 0 R", doc.trailer["Info"])
+	}
+	if prev := int(number(doc.trailer["Prev"])); !bytes.HasPrefix(updated[prev:], []byte("xref")) {
+		t.Errorf("/Prev %d does not point at the original table", prev)
+	}
+	outlines, ok := doc.resolve(doc.root["Outlines"]).(dict)
+	if !ok {
+		t.Fatal("the catalog has no outline")
+	}
+	first, _ := doc.resolve(outlines["First"]).(dict)
+	if string(first["Title"].(pdfStr)) != string(textString("Intro")) {
+		t.Errorf("first bookmark is %q, want Intro", first["Title"])
+	}
+	last, _ := doc.resolve(outlines["Last"]).(dict)
+	if dest, _ := last["Dest"].(array); len(dest) == 0 || dest[0] != (ref{num: 9}) {
+		t.Errorf("last bookmark points to %v, want page 3 (9 0 R)", last["Dest"])
+	}
+}
+
+func TestAddOutlineRejectsMissingPage(t *testing.T) {
+	if _, err := AddOutline(buildPDF([]string{"Only"}), []OutlineEntry{{Title: "Gone", Page: 2}}); err == nil {
+		t.Error("expected a bookmark past the last page to be refused")
+	}
+}
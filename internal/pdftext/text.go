@@ -0,0 +1,355 @@
+package pdftext
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// matrix is a PDF transformation [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(tx, ty float64) matrix {
+	return matrix{1, 0, 0, 1, tx, ty}
+}
+
+// graphicsState holds the parts of the PDF graphics state that position text
+type graphicsState struct {
+	ctm         matrix
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+	font        *font
+	fontSize    float64
+}
+
+type interpreter struct {
+	doc      *document
+	box      []float64 // Page MediaBox
+	state    graphicsState
+	stack    []graphicsState
+	tm, tlm  matrix
+	fonts    map[interface{}]*font
+	glyphs   []Glyph
+	maxDepth int
+}
+
+func newInterpreter(doc *document, box []float64) *interpreter {
+	return &interpreter{
+		doc:      doc,
+		box:      box,
+		state:    graphicsState{ctm: identity, hScale: 1},
+		fonts:    make(map[interface{}]*font),
+		maxDepth: 8,
+	}
+}
+
+// run interprets a content stream with the given resources; depth counts nested form XObjects
+func (in *interpreter) run(content []byte, resources dict, depth int) {
+	l := &lexer{data: content}
+	var operands []interface{}
+
+	for {
+		obj, ok, err := l.next()
+		if err != nil || !ok {
+			return
+		}
+		op, isOperator := obj.(keyword)
+		if !isOperator {
+			operands = append(operands, obj)
+			continue
+		}
+
+		in.execute(string(op), operands, resources, depth, l)
+		operands = operands[:0]
+	}
+}
+
+func (in *interpreter) execute(op string, args []interface{}, resources dict, depth int, l *lexer) {
+	num := func(i int) float64 {
+		if i < len(args) {
+			return number(args[i])
+		}
+		return 0
+	}
+	matrixArg := func() matrix {
+		return matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+	}
+
+	switch op {
+	case "q":
+		in.stack = append(in.stack, in.state)
+	case "Q":
+		if len(in.stack) > 0 {
+			in.state = in.stack[len(in.stack)-1]
+			in.stack = in.stack[:len(in.stack)-1]
+		}
+	case "cm":
+		if len(args) == 6 {
+			in.state.ctm = matrixArg().multiply(in.state.ctm)
+		}
+	case "BT":
+		in.tm, in.tlm = identity, identity
+	case "Tc":
+		in.state.charSpacing = num(0)
+	case "Tw":
+		in.state.wordSpacing = num(0)
+	case "Tz":
+		in.state.hScale = num(0) / 100
+	case "TL":
+		in.state.leading = num(0)
+	case "Ts":
+		in.state.rise = num(0)
+	case "Tf":
+		if len(args) == 2 {
+			in.state.font = in.font(resources, args[0])
+			in.state.fontSize = num(1)
+		}
+	case "Td":
+		in.tlm = translate(num(0), num(1)).multiply(in.tlm)
+		in.tm = in.tlm
+	case "TD":
+		in.state.leading = -num(1)
+		in.tlm = translate(num(0), num(1)).multiply(in.tlm)
+		in.tm = in.tlm
+	case "Tm":
+		if len(args) == 6 {
+			in.tlm = matrixArg()
+			in.tm = in.tlm
+		}
+	case "T*":
+		in.nextLine()
+	case "Tj":
+		if len(args) == 1 {
+			in.show(args[0])
+		}
+	case "'":
+		in.nextLine()
+		if len(args) == 1 {
+			in.show(args[0])
+		}
+	case "\"":
+		if len(args) == 3 {
+			in.state.wordSpacing = num(0)
+			in.state.charSpacing = num(1)
+			in.nextLine()
+			in.show(args[2])
+		}
+	case "TJ":
+		if len(args) == 1 {
+			items, _ := args[0].(array)
+			for _, item := range items {
+				if adjust, ok := item.(float64); ok {
+					tx := -adjust / 1000 * in.state.fontSize * in.state.hScale
+					in.tm = translate(tx, 0).multiply(in.tm)
+					continue
+				}
+				in.show(item)
+			}
+		}
+	case "Do":
+		if len(args) == 1 && depth < in.maxDepth {
+			in.drawForm(resources, args[0], depth)
+		}
+	case "BI":
+		skipInlineImage(l)
+	}
+}
+
+func (in *interpreter) nextLine() {
+	in.tlm = translate(0, -in.state.leading).multiply(in.tlm)
+	in.tm = in.tlm
+}
+
+// font returns the font resource called fontName, loading it once
+func (in *interpreter) font(resources dict, fontName interface{}) *font {
+	fonts := in.doc.dictValue(resources, "Font")
+	key, _ := fontName.(name)
+	if fonts == nil {
+		return nil
+	}
+	raw := fonts[key]
+	if f, ok := in.fonts[raw]; ok {
+		return f
+	}
+	d, ok := in.doc.resolve(raw).(dict)
+	if !ok {
+		return nil
+	}
+	f := in.doc.loadFont(d)
+	if _, isRef := raw.(ref); isRef {
+		in.fonts[raw] = f
+	}
+	return f
+}
+
+// show records the glyphs of a shown string and advances the text matrix
+func (in *interpreter) show(obj interface{}) {
+	s, ok := obj.(pdfStr)
+	f := in.state.font
+	if !ok || f == nil {
+		return
+	}
+
+	fs := in.state.fontSize
+	for _, code := range f.codes(s) {
+		advance := f.width(code)*f.scale*fs + in.state.charSpacing
+		if f.simple && code == 32 {
+			advance += in.state.wordSpacing
+		}
+		advance *= in.state.hScale
+
+		trm := matrix{fs * in.state.hScale, 0, 0, fs, 0, in.state.rise}.multiply(in.tm).multiply(in.state.ctm)
+		device := in.tm.multiply(in.state.ctm)
+		xScale := math.Hypot(device[0], device[1])
+		yScale := math.Hypot(device[2], device[3])
+
+		size := fs * yScale
+		x := trm[4] - in.box[0]
+		baseline := in.box[3] - trm[5]
+		in.glyphs = append(in.glyphs, Glyph{
+			Text:   f.text(code),
+			X:      x,
+			Y:      baseline - f.ascent*f.scale*size,
+			Width:  advance * xScale,
+			Height: (f.ascent - f.descent) * f.scale * size,
+			Size:   size,
+		})
+
+		in.tm = translate(advance, 0).multiply(in.tm)
+	}
+}
+
+// drawForm interprets a form XObject with its own resources and matrix
+func (in *interpreter) drawForm(resources dict, xobjectName interface{}, depth int) {
+	xobjects := in.doc.dictValue(resources, "XObject")
+	key, _ := xobjectName.(name)
+	if xobjects == nil {
+		return
+	}
+	s, ok := in.doc.resolve(xobjects[key]).(stream)
+	if !ok || s.dict["Subtype"] != name("Form") {
+		return
+	}
+	content, err := in.doc.decodeStream(s)
+	if err != nil {
+		return
+	}
+
+	saved, savedTm, savedTlm := in.state, in.tm, in.tlm
+	if m, ok := in.doc.resolve(s.dict["Matrix"]).(array); ok && len(m) == 6 {
+		var fm matrix
+		for i := range fm {
+			fm[i] = number(in.doc.resolve(m[i]))
+		}
+		in.state.ctm = fm.multiply(in.state.ctm)
+	}
+	formResources := in.doc.dictValue(s.dict, "Resources")
+	if formResources == nil {
+		formResources = resources
+	}
+	in.run(content, formResources, depth+1)
+	in.state, in.tm, in.tlm = saved, savedTm, savedTlm
+}
+
+// skipInlineImage moves past the binary data of an inline image (BI ... ID data EI)
+func skipInlineImage(l *lexer) {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx == -1 {
+		l.pos = len(l.data)
+		return
+	}
+	pos := l.pos + idx + 3
+	for pos+2 < len(l.data) {
+		end := bytes.Index(l.data[pos:], []byte("EI"))
+		if end == -1 {
+			break
+		}
+		end += pos
+		if isWhitespace(l.data[end-1]) && (end+2 >= len(l.data) || isWhitespace(l.data[end+2])) {
+			l.pos = end + 2
+			return
+		}
+		pos = end + 2
+	}
+	l.pos = len(l.data)
+}
+
+// TextMatch is a run of glyphs that matched a search, with the box around them
+type TextMatch struct {
+	Text   string
+	Page   int
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// Search finds pattern in the page text. Glyphs on different baselines are separated by a
+// line break, so a match never spans lines.
+func (p Page) Search(pattern *regexp.Regexp) []TextMatch {
+	var text strings.Builder
+	offsets := make([]int, len(p.Glyphs))
+	for i, g := range p.Glyphs {
+		if i > 0 {
+			prev := p.Glyphs[i-1]
+			if math.Abs((prev.Y+prev.Height)-(g.Y+g.Height)) > g.Size/2 || g.X < prev.X-g.Size {
+				text.WriteByte('\n')
+			}
+		}
+		offsets[i] = text.Len()
+		text.WriteString(g.Text)
+	}
+
+	var matches []TextMatch
+	pageText := text.String()
+	for _, loc := range pattern.FindAllStringIndex(pageText, -1) {
+		first, last := -1, -1
+		for i, offset := range offsets {
+			if offset >= loc[0] && offset < loc[1] {
+				if first == -1 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first == -1 {
+			continue
+		}
+
+		left, top := p.Glyphs[first].X, p.Glyphs[first].Y
+		right, bottom := left, top
+		for _, g := range p.Glyphs[first : last+1] {
+			left = math.Min(left, g.X)
+			top = math.Min(top, g.Y)
+			right = math.Max(right, g.X+g.Width)
+			bottom = math.Max(bottom, g.Y+g.Height)
+		}
+		matches = append(matches, TextMatch{
+			Text:   pageText[loc[0]:loc[1]],
+			Page:   p.Number,
+			X:      left,
+			Y:      top,
+			Width:  right - left,
+			Height: bottom - top,
+		})
+	}
+	return matches
+}
@@ -0,0 +1,535 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	RelTypeChart     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart"
+	RelTypePackage   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/package"
+	RelTypeWorksheet = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
+	RelTypeTable     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"
+)
+
+// ChartSeries is one named row of values plotted in a chart
+type ChartSeries struct {
+	Name   string
+	Values []float64
+}
+
+// ChartData replaces the categories and series of a chart
+type ChartData struct {
+	Categories []string
+	Series     []ChartSeries
+}
+
+// chartBinding is a chart whose alt text holds a placeholder
+type chartBinding struct {
+	placeholder string
+	chartPart   string
+}
+
+// ChartPlaceholders returns the placeholders written in the alt text (title or description) of charts.
+// Such a placeholder binds the chart to a submitted value instead of being replaced as text.
+func (dp *DocxProcessor) ChartPlaceholders() ([]string, error) {
+	bindings, err := dp.chartBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var placeholders []string
+	for _, binding := range bindings {
+		if !seen[binding.placeholder] {
+			seen[binding.placeholder] = true
+			placeholders = append(placeholders, binding.placeholder)
+		}
+	}
+	return placeholders, nil
+}
+
+// ApplyChartData rewrites every chart bound to a placeholder in values: the cached categories and
+// series in the chart XML and the embedded workbook that Word opens for editing. The placeholder is
+// removed from the chart's alt text. It returns the number of charts updated.
+func (dp *DocxProcessor) ApplyChartData(values map[string]ChartData) (int, error) {
+	bindings, err := dp.chartBindings()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, binding := range bindings {
+		data, ok := values[binding.placeholder]
+		if !ok {
+			continue
+		}
+		fmt.Printf("[DEBUG] Updating chart %s from %s (%d categories, %d series)\n", binding.chartPart, binding.placeholder, len(data.Categories), len(data.Series))
+		if err := dp.updateChart(binding.chartPart, data); err != nil {
+			return updated, fmt.Errorf("failed to update chart %s: %w", binding.chartPart, err)
+		}
+		updated++
+	}
+
+	// Clear the bindings from the alt text so they do not show to screen readers
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return updated, err
+		}
+		cleaned := content
+		for _, docPr := range findElements(content, "wp:docPr") {
+			tag := docPr.StartTag(content)
+			newTag := tag
+			for _, attr := range []string{"descr", "title"} {
+				value := unescapeXMLText(tagAttr(newTag, attr))
+				if stripped := placeholderSpanPattern.ReplaceAllStringFunc(value, func(p string) string {
+					if _, ok := values[p]; ok {
+						return ""
+					}
+					return p
+				}); stripped != value {
+					newTag = setTagAttr(newTag, attr, EscapeXMLText(strings.TrimSpace(stripped)))
+				}
+			}
+			if newTag != tag {
+				cleaned = strings.Replace(cleaned, tag, newTag, 1)
+			}
+		}
+		if cleaned != content {
+			if err := dp.writePart(part, []byte(cleaned)); err != nil {
+				return updated, err
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+// chartBindings finds the charts in the document's stories whose drawing alt text contains a placeholder
+func (dp *DocxProcessor) chartBindings() ([]chartBinding, error) {
+	var bindings []chartBinding
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(content, "<c:chart") {
+			continue
+		}
+
+		rels, err := readRelationships(dp.tempDir, relsPathFor(part))
+		if err != nil {
+			return nil, err
+		}
+		chartParts := make(map[string]string)
+		for _, rel := range rels {
+			if chartPart, ok := partTarget(part, rel.Target); ok && rel.Type == RelTypeChart {
+				chartParts[rel.ID] = chartPart
+			}
+		}
+
+		for _, drawing := range findElements(content, "w:drawing") {
+			fragment := drawing.Outer(content)
+			docPrs := findElements(fragment, "wp:docPr")
+			charts := findElements(fragment, "c:chart")
+			if len(docPrs) == 0 || len(charts) == 0 {
+				continue
+			}
+			chartPart, ok := chartParts[tagAttr(charts[0].StartTag(fragment), "r:id")]
+			if !ok {
+				continue
+			}
+
+			tag := docPrs[0].StartTag(fragment)
+			altText := unescapeXMLText(tagAttr(tag, "title") + " " + tagAttr(tag, "descr"))
+			for _, placeholder := range placeholderSpanPattern.FindAllString(altText, -1) {
+				bindings = append(bindings, chartBinding{placeholder: placeholder, chartPart: chartPart})
+			}
+		}
+	}
+	return bindings, nil
+}
+
+// updateChart writes data into a chart part's series caches and its embedded workbook
+func (dp *DocxProcessor) updateChart(chartPart string, data ChartData) error {
+	content, err := dp.readPart(chartPart)
+	if err != nil {
+		return err
+	}
+
+	series := findElements(content, "c:ser")
+	if len(series) == 0 {
+		return fmt.Errorf("chart has no series")
+	}
+
+	// Formulas keep pointing at the sheet the chart was built on
+	sheetName := "Sheet1"
+	if formulas := findElements(content, "c:f"); len(formulas) > 0 {
+		if ref := unescapeXMLText(formulas[0].Inner(content)); strings.Contains(ref, "!") {
+			sheetName = strings.Trim(ref[:strings.LastIndex(ref, "!")], "'")
+		}
+	}
+
+	points := len(data.Categories)
+	for _, s := range data.Series {
+		if len(s.Values) > points {
+			points = len(s.Values)
+		}
+	}
+
+	// Extra series copy the template's last series without its colors, so Word picks the next theme color
+	last := series[len(series)-1]
+	if len(data.Series) > len(series) {
+		nextIdx := maxAttrValue(content, "c:idx", "val") + 1
+		nextOrder := maxAttrValue(content, "c:order", "val") + 1
+		var clones strings.Builder
+		for i := len(series); i < len(data.Series); i++ {
+			clone := last.Outer(content)
+			clone = removeElements(clone, "c:spPr")
+			clone = removeElements(clone, "c:dPt")
+			clone = setChildVal(clone, "c:idx", nextIdx+i-len(series))
+			clone = setChildVal(clone, "c:order", nextOrder+i-len(series))
+			clones.WriteString(chartSeriesXML(clone, data, i, sheetName, points))
+		}
+		content = content[:last.End] + clones.String() + content[last.End:]
+	}
+
+	for i := len(series) - 1; i >= 0; i-- {
+		replacement := ""
+		if i < len(data.Series) {
+			replacement = chartSeriesXML(series[i].Outer(content), data, i, sheetName, points)
+		}
+		content = content[:series[i].Start] + replacement + content[series[i].End:]
+	}
+
+	if err := dp.writePart(chartPart, []byte(content)); err != nil {
+		return err
+	}
+
+	return dp.updateChartWorkbook(chartPart, sheetName, data, points)
+}
+
+// chartSeriesXML rewrites the name, categories and values of one c:ser element
+func chartSeriesXML(ser string, data ChartData, index int, sheetName string, points int) string {
+	column := columnName(index + 1)
+	sheetRef := EscapeXMLText(quoteSheetName(sheetName))
+	s := data.Series[index]
+
+	var tx strings.Builder
+	tx.WriteString(fmt.Sprintf(`<c:tx><c:strRef><c:f>%s!$%s$1</c:f><c:strCache><c:ptCount val="1"/>`, sheetRef, column))
+	tx.WriteString(fmt.Sprintf(`<c:pt idx="0"><c:v>%s</c:v></c:pt></c:strCache></c:strRef></c:tx>`, EscapeXMLText(s.Name)))
+
+	var cat strings.Builder
+	cat.WriteString(fmt.Sprintf(`<c:cat><c:strRef><c:f>%s!$A$2:$A$%d</c:f><c:strCache><c:ptCount val="%d"/>`, sheetRef, points+1, points))
+	for i, category := range data.Categories {
+		cat.WriteString(fmt.Sprintf(`<c:pt idx="%d"><c:v>%s</c:v></c:pt>`, i, EscapeXMLText(category)))
+	}
+	cat.WriteString(`</c:strCache></c:strRef></c:cat>`)
+
+	formatCode := "General"
+	if val, ok := childElement(ser, fragmentRoot(ser), "c:val"); ok {
+		if codes := findElements(val.Outer(ser), "c:formatCode"); len(codes) > 0 {
+			formatCode = codes[0].Inner(val.Outer(ser))
+		}
+	}
+
+	var val strings.Builder
+	val.WriteString(fmt.Sprintf(`<c:val><c:numRef><c:f>%s!$%s$2:$%s$%d</c:f><c:numCache><c:formatCode>%s</c:formatCode><c:ptCount val="%d"/>`,
+		sheetRef, column, column, points+1, formatCode, points))
+	for i, v := range s.Values {
+		val.WriteString(fmt.Sprintf(`<c:pt idx="%d"><c:v>%s</c:v></c:pt>`, i, strconv.FormatFloat(v, 'f', -1, 64)))
+	}
+	val.WriteString(`</c:numCache></c:numRef></c:val>`)
+
+	ser = replaceChild(ser, "c:tx", tx.String(), "c:order")
+	ser = replaceChild(ser, "c:cat", cat.String(), "")
+	return replaceChild(ser, "c:val", val.String(), "")
+}
+
+// fragmentRoot returns the element that spans a whole XML fragment
+func fragmentRoot(fragment string) xmlElement {
+	return xmlElement{Start: 0, End: len(fragment), InnerStart: tagEnd(fragment, 0), InnerEnd: strings.LastIndex(fragment, "</")}
+}
+
+// replaceChild swaps a direct child of the root element in fragment for replacement. A missing child is
+// inserted after the child called after, or before the end tag when after is empty or missing.
+func replaceChild(fragment, name, replacement, after string) string {
+	root := fragmentRoot(fragment)
+
+	if child, ok := childElement(fragment, root, name); ok {
+		return fragment[:child.Start] + replacement + fragment[child.End:]
+	}
+
+	// Scatter and bubble charts use xVal/yVal in place of cat/val
+	switch name {
+	case "c:cat":
+		if child, ok := childElement(fragment, root, "c:xVal"); ok {
+			return fragment[:child.Start] + replacement + fragment[child.End:]
+		}
+	case "c:val":
+		if child, ok := childElement(fragment, root, "c:yVal"); ok {
+			return fragment[:child.Start] + replacement + fragment[child.End:]
+		}
+	}
+
+	if name == "c:cat" {
+		// Categories precede the values
+		if val, ok := childElement(fragment, root, "c:val"); ok {
+			return fragment[:val.Start] + replacement + fragment[val.Start:]
+		}
+	}
+	if after != "" {
+		if sibling, ok := childElement(fragment, root, after); ok {
+			return fragment[:sibling.End] + replacement + fragment[sibling.End:]
+		}
+	}
+	return fragment[:root.InnerEnd] + replacement + fragment[root.InnerEnd:]
+}
+
+// setChildVal sets the val attribute of a direct child such as c:idx
+func setChildVal(fragment, name string, value int) string {
+	child, ok := childElement(fragment, fragmentRoot(fragment), name)
+	if !ok {
+		return fragment
+	}
+	tag := child.StartTag(fragment)
+	return fragment[:child.Start] + setTagAttr(tag, "val", strconv.Itoa(value)) + fragment[child.Start+len(tag):]
+}
+
+// updateChartWorkbook rewrites the embedded workbook behind a chart so editing the chart in Word shows the new data
+func (dp *DocxProcessor) updateChartWorkbook(chartPart, sheetName string, data ChartData, points int) error {
+	rels, err := readRelationships(dp.tempDir, relsPathFor(chartPart))
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range rels {
+		if rel.Type != RelTypePackage || rel.TargetMode == "External" {
+			continue
+		}
+		workbookPart, ok := partTarget(chartPart, rel.Target)
+		if !ok {
+			return fmt.Errorf("chart %s embeds %s, which is outside the package", chartPart, rel.Target)
+		}
+		if path.Ext(workbookPart) != ".xlsx" {
+			fmt.Printf("Warning: chart %s embeds %s, which is not a workbook; only the chart cache was updated\n", chartPart, workbookPart)
+			return nil
+		}
+
+		workbook, err := readPackagePart(dp.tempDir, workbookPart)
+		if err != nil {
+			return fmt.Errorf("failed to read embedded workbook: %w", err)
+		}
+		updated, err := rewriteChartWorkbook([]byte(workbook), sheetName, data, points)
+		if err != nil {
+			return fmt.Errorf("failed to update embedded workbook: %w", err)
+		}
+		return writePackagePart(dp.tempDir, workbookPart, updated)
+	}
+
+	return nil
+}
+
+// rewriteChartWorkbook replaces the cells of the chart's sheet: categories in column A,
+// one column per series with its name in row 1. A table over the data is resized to match.
+func rewriteChartWorkbook(workbook []byte, sheetName string, data ChartData, points int) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = string(content)
+	}
+
+	sheetPart, err := workbookSheetPart(files, sheetName)
+	if err != nil {
+		return nil, err
+	}
+	sheet := files[sheetPart]
+
+	lastColumn := columnName(len(data.Series))
+	ref := fmt.Sprintf("A1:%s%d", lastColumn, points+1)
+
+	// A table's header cells must match its column names
+	var tablePart string
+	firstHeader := ""
+	for _, rel := range parseRelationships(files[relsPathFor(sheetPart)]) {
+		if rel.Type == RelTypeTable {
+			tablePart, _ = partTarget(sheetPart, rel.Target)
+			break
+		}
+	}
+	if table, ok := files[tablePart]; ok {
+		if columns := findElements(table, "tableColumn"); len(columns) > 0 {
+			firstHeader = unescapeXMLText(tagAttr(columns[0].StartTag(table), "name"))
+		}
+		files[tablePart] = resizeChartTable(table, firstHeader, data, ref)
+	}
+
+	var rows strings.Builder
+	rows.WriteString(`<sheetData><row r="1">`)
+	if firstHeader != "" {
+		rows.WriteString(inlineStringCell("A1", firstHeader))
+	}
+	for i, s := range data.Series {
+		rows.WriteString(inlineStringCell(fmt.Sprintf("%s1", columnName(i+1)), s.Name))
+	}
+	rows.WriteString(`</row>`)
+	for p := 0; p < points; p++ {
+		rowNumber := p + 2
+		rows.WriteString(fmt.Sprintf(`<row r="%d">`, rowNumber))
+		if p < len(data.Categories) {
+			rows.WriteString(inlineStringCell(fmt.Sprintf("A%d", rowNumber), data.Categories[p]))
+		}
+		for i, s := range data.Series {
+			if p < len(s.Values) {
+				rows.WriteString(fmt.Sprintf(`<c r="%s%d"><v>%s</v></c>`, columnName(i+1), rowNumber, strconv.FormatFloat(s.Values[p], 'f', -1, 64)))
+			}
+		}
+		rows.WriteString(`</row>`)
+	}
+	rows.WriteString(`</sheetData>`)
+
+	if existing := findElements(sheet, "sheetData"); len(existing) > 0 {
+		sheet = sheet[:existing[0].Start] + rows.String() + sheet[existing[0].End:]
+	} else {
+		return nil, fmt.Errorf("sheet %s has no sheetData", sheetPart)
+	}
+	if dimensions := findElements(sheet, "dimension"); len(dimensions) > 0 {
+		d := dimensions[0]
+		sheet = sheet[:d.Start] + setTagAttr(d.StartTag(sheet), "ref", ref) + sheet[d.Start+len(d.StartTag(sheet)):]
+	}
+	files[sheetPart] = sheet
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// [Content_Types].xml is conventionally the first entry
+		if (names[i] == "[Content_Types].xml") != (names[j] == "[Content_Types].xml") {
+			return names[i] == "[Content_Types].xml"
+		}
+		return names[i] < names[j]
+	})
+
+	var out bytes.Buffer
+	writer := zip.NewWriter(&out)
+	for _, name := range names {
+		w, err := writer.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// workbookSheetPart returns the worksheet part of the sheet called name, or of the first sheet
+func workbookSheetPart(files map[string]string, name string) (string, error) {
+	workbook, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("workbook.xml not found")
+	}
+	targets := make(map[string]string)
+	for _, rel := range parseRelationships(files["xl/_rels/workbook.xml.rels"]) {
+		if part, ok := partTarget("xl/workbook.xml", rel.Target); ok && rel.Type == RelTypeWorksheet {
+			targets[rel.ID] = part
+		}
+	}
+
+	sheets := findElements(workbook, "sheet")
+	if len(sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+	chosen := sheets[0].StartTag(workbook)
+	for _, sheet := range sheets {
+		if unescapeXMLText(tagAttr(sheet.StartTag(workbook), "name")) == name {
+			chosen = sheet.StartTag(workbook)
+			break
+		}
+	}
+	partName, ok := targets[tagAttr(chosen, "r:id")]
+	if !ok {
+		return "", fmt.Errorf("worksheet for sheet %q not found", name)
+	}
+	if _, ok := files[partName]; !ok {
+		return "", fmt.Errorf("%s not found", partName)
+	}
+	return partName, nil
+}
+
+// resizeChartTable points a table at the new data range and renames its columns after the series
+func resizeChartTable(table, firstHeader string, data ChartData, ref string) string {
+	if tables := findElements(table, "table"); len(tables) > 0 {
+		tag := tables[0].StartTag(table)
+		table = strings.Replace(table, tag, setTagAttr(tag, "ref", ref), 1)
+	}
+	if filters := findElements(table, "autoFilter"); len(filters) > 0 {
+		tag := filters[0].StartTag(table)
+		table = strings.Replace(table, tag, setTagAttr(tag, "ref", ref), 1)
+	}
+
+	columns := findElements(table, "tableColumns")
+	if len(columns) == 0 {
+		return table
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<tableColumns count="%d">`, len(data.Series)+1))
+	sb.WriteString(fmt.Sprintf(`<tableColumn id="1" name="%s"/>`, EscapeXMLText(firstHeader)))
+	for i, s := range data.Series {
+		sb.WriteString(fmt.Sprintf(`<tableColumn id="%d" name="%s"/>`, i+2, EscapeXMLText(s.Name)))
+	}
+	sb.WriteString(`</tableColumns>`)
+	return table[:columns[0].Start] + sb.String() + table[columns[0].End:]
+}
+
+func inlineStringCell(ref, text string) string {
+	return fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, EscapeXMLText(text))
+}
+
+// columnName converts a zero-based column index to its spreadsheet letters: 0 -> A, 26 -> AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// quoteSheetName quotes a sheet name for use in a formula when it is not a plain identifier
+func quoteSheetName(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+		}
+	}
+	return name
+}
@@ -3,11 +3,11 @@ package processor
 import (
 	"archive/zip"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type PlaceholderPosition struct {
@@ -20,21 +20,26 @@ type PlaceholderPosition struct {
 	XMLEndPos     int     `json:"xml_end_pos"`
 	X             float64 `json:"x"`             // X coordinate in points (1 point = 1/72 inch)
 	Y             float64 `json:"y"`             // Y coordinate in points
-	Width         float64 `json:"width"`         // Estimated width in points
-	Height        float64 `json:"height"`        // Estimated height in points
+	Width         float64 `json:"width"`         // Width in points
+	Height        float64 `json:"height"`        // Height in points
 	PageNumber    int     `json:"page_number"`   // Page number (1-based)
+	Section       int     `json:"section"`       // Section number (1-based)
 	ParagraphId   string  `json:"paragraph_id"`  // Paragraph identifier
+	Container     string  `json:"container,omitempty"` // "textbox" for text in floating text boxes and shapes
+	Measured      bool    `json:"measured,omitempty"`  // Position comes from a rendered PDF rather than the layout estimate
 }
 
 type DocumentLayout struct {
-	PageWidth    float64 // Page width in points
-	PageHeight   float64 // Page height in points
-	LeftMargin   float64 // Left margin in points
-	RightMargin  float64 // Right margin in points
-	TopMargin    float64 // Top margin in points
-	BottomMargin float64 // Bottom margin in points
-	LineHeight   float64 // Default line height in points
-	Landscape    bool    // True if page is in landscape orientation
+	PageWidth    float64 `json:"page_width"`    // Page width in points
+	PageHeight   float64 `json:"page_height"`   // Page height in points
+	LeftMargin   float64 `json:"left_margin"`   // Left margin in points
+	RightMargin  float64 `json:"right_margin"`  // Right margin in points
+	TopMargin    float64 `json:"top_margin"`    // Top margin in points
+	BottomMargin float64 `json:"bottom_margin"` // Bottom margin in points
+	LineHeight   float64 `json:"line_height"`   // Default line height in points
+	Landscape    bool    `json:"landscape"`     // True if page is in landscape orientation
+	Columns      int     `json:"columns"`       // Number of text columns
+	ColumnSpace  float64 `json:"column_space"`  // Space between columns in points
 }
 
 type ParagraphInfo struct {
@@ -94,29 +99,7 @@ func (dp *DocxProcessor) UnzipDocx() error {
 }
 
 func (dp *DocxProcessor) extractFile(file *zip.File) error {
-	rc, err := file.Open()
-	if err != nil {
-		return err
-	}
-	defer rc.Close()
-
-	path := filepath.Join(dp.tempDir, file.Name)
-
-	if file.FileInfo().IsDir() {
-		os.MkdirAll(path, file.FileInfo().Mode())
-		return nil
-	}
-
-	os.MkdirAll(filepath.Dir(path), 0755)
-
-	outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.FileInfo().Mode())
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
-
-	_, err = io.Copy(outFile, rc)
-	return err
+	return extractPackageFile(dp.tempDir, file)
 }
 
 func (dp *DocxProcessor) FindAndReplaceInDocument(placeholders map[string]string) error {
@@ -275,45 +258,12 @@ func (dp *DocxProcessor) checkPlaceholderMatch(content string, startPos int, pla
 }
 
 func (dp *DocxProcessor) ReZipDocx() error {
-	outputFile, err := os.Create(dp.outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outputFile.Close()
-
-	zipWriter := zip.NewWriter(outputFile)
-	defer zipWriter.Close()
-
-	return filepath.Walk(dp.tempDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		relPath, err := filepath.Rel(dp.tempDir, path)
-		if err != nil {
-			return err
-		}
-
-		relPath = filepath.ToSlash(relPath)
-
-		zipFile, err := zipWriter.Create(relPath)
-		if err != nil {
-			return err
-		}
-
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
+	return dp.ReZipDocxTo(dp.outputFile)
+}
 
-		_, err = io.Copy(zipFile, file)
-		return err
-	})
+// ReZipDocxTo zips the current contents of the working directory to path
+func (dp *DocxProcessor) ReZipDocxTo(path string) error {
+	return zipPackage(dp.tempDir, path)
 }
 
 func (dp *DocxProcessor) Cleanup() {
@@ -351,10 +301,15 @@ func (dp *DocxProcessor) DetectOrientation() (bool, error) {
 		return false, fmt.Errorf("failed to read document.xml: %w", err)
 	}
 
-	contentStr := string(contentBytes)
-	layout := dp.parseDocumentLayout(contentStr)
+	// Converting with a single orientation would turn every page; documents whose sections
+	// differ keep each section's own page size instead
+	sections := dp.parseSections(string(contentBytes))
+	if MixedOrientation(sections) {
+		fmt.Printf("[DEBUG] Document has %d sections with mixed orientation\n", len(sections))
+		return false, nil
+	}
 
-	return layout.Landscape, nil
+	return sections[0].Layout.Landscape, nil
 }
 
 func (dp *DocxProcessor) ExtractPlaceholdersWithPositions() ([]PlaceholderPosition, error) {
@@ -372,10 +327,10 @@ func (dp *DocxProcessor) ExtractPlaceholdersWithPositions() ([]PlaceholderPositi
 	cleanText := dp.removeXMLTags(contentStr)
 	fmt.Printf("[DEBUG] XML tags removed, clean text size: %d characters\n", len(cleanText))
 
-	// Parse document layout information
+	// Parse the layout of every section
 	fmt.Printf("[DEBUG] Parsing document layout...\n")
-	layout := dp.parseDocumentLayout(contentStr)
-	fmt.Printf("[DEBUG] Document layout parsed successfully\n")
+	sections := dp.parseSections(contentStr)
+	fmt.Printf("[DEBUG] Document layout parsed successfully, %d sections\n", len(sections))
 
 	var positions []PlaceholderPosition
 	cleanStart := 0
@@ -395,14 +350,37 @@ func (dp *DocxProcessor) ExtractPlaceholdersWithPositions() ([]PlaceholderPositi
 
 		placeholder := cleanText[startIndex:endIndex]
 
+		// {{> snippet}} includes are resolved before rendering and are not data fields
+		if IsInclude(placeholder) {
+			cleanStart = endIndex
+			continue
+		}
+
 		// Calculate line and column for start position
 		startLine, startColumn := dp.calculateLineColumn(cleanText, startIndex)
 
 		// Find XML positions
 		xmlStartPos, xmlEndPos := dp.findXMLPositions(contentStr, cleanText, startIndex, endIndex)
 
-		// Calculate coordinates
-		x, y, pageNumber, paragraphId := dp.calculateCoordinates(contentStr, xmlStartPos, layout)
+		// Text boxes are stored twice (DrawingML and a VML fallback); report each placeholder once
+		if xmlStartPos != -1 && isInFallback(contentStr, xmlStartPos) {
+			cleanStart = endIndex
+			continue
+		}
+
+		// Calculate coordinates within the section that holds the placeholder
+		section := sectionAt(sections, xmlStartPos)
+		layout := section.Layout
+		x, y, pageNumber, paragraphId := dp.calculateCoordinates(contentStr, xmlStartPos, section)
+
+		// Text box content is placed by the anchor of its shape rather than the body flow
+		container := ""
+		if xmlStartPos != -1 {
+			if boxX, boxY, ok := dp.textBoxCoordinates(contentStr, xmlStartPos, layout, y); ok {
+				x, y = boxX, boxY
+				container = "textbox"
+			}
+		}
 
 		// Estimate dimensions
 		fontSize := 12.0 // Default font size - could be extracted from XML
@@ -422,7 +400,9 @@ func (dp *DocxProcessor) ExtractPlaceholdersWithPositions() ([]PlaceholderPositi
 			Width:       width,
 			Height:      height,
 			PageNumber:  pageNumber,
+			Section:     section.Number,
 			ParagraphId: paragraphId,
+			Container:   container,
 		}
 
 		positions = append(positions, position)
@@ -467,11 +447,11 @@ func (dp *DocxProcessor) findXMLPositions(xmlContent, cleanText string, cleanSta
 			if cleanPos == cleanStart && xmlStart == -1 {
 				xmlStart = xmlPos
 			}
-			if cleanPos == cleanEnd-1 {
-				xmlEnd = xmlPos + 1
+			if cleanPos+utf8.RuneLen(char) >= cleanEnd {
+				xmlEnd = xmlPos + utf8.RuneLen(char)
 				break
 			}
-			cleanPos++
+			cleanPos += utf8.RuneLen(char) // cleanText offsets are bytes, not runes
 		}
 	}
 
@@ -480,6 +460,11 @@ func (dp *DocxProcessor) findXMLPositions(xmlContent, cleanText string, cleanSta
 
 // Default document layout based on standard A4 page with normal margins
 func (dp *DocxProcessor) getDefaultLayout() DocumentLayout {
+	return DefaultLayout()
+}
+
+// DefaultLayout is the page setup assumed where a document does not specify one
+func DefaultLayout() DocumentLayout {
 	return DocumentLayout{
 		PageWidth:    612,  // 8.5 inches * 72 points/inch (A4 width)
 		PageHeight:   792,  // 11 inches * 72 points/inch (A4 height)
@@ -488,102 +473,13 @@ func (dp *DocxProcessor) getDefaultLayout() DocumentLayout {
 		TopMargin:    72,   // 1 inch
 		BottomMargin: 72,   // 1 inch
 		LineHeight:   14.4, // 12pt font with 1.2 line spacing
+		Columns:      1,
 	}
 }
 
-// Parse document layout from document.xml sectPr elements
+// parseDocumentLayout returns the layout of the first section
 func (dp *DocxProcessor) parseDocumentLayout(content string) DocumentLayout {
-	layout := dp.getDefaultLayout()
-
-	// Look for section properties (w:sectPr)
-	if sectStart := strings.Index(content, "<w:sectPr"); sectStart != -1 {
-		sectEnd := strings.Index(content[sectStart:], "</w:sectPr>")
-		if sectEnd != -1 {
-			sectContent := content[sectStart : sectStart+sectEnd]
-
-			// Parse page size (w:pgSz)
-			if pgSzStart := strings.Index(sectContent, "<w:pgSz"); pgSzStart != -1 {
-				pgSzEnd := strings.Index(sectContent[pgSzStart:], "/>")
-				if pgSzEnd != -1 {
-					pgSzTag := sectContent[pgSzStart : pgSzStart+pgSzEnd]
-
-					// Extract width and height attributes (in twentieths of a point)
-					if wStart := strings.Index(pgSzTag, `w:w="`); wStart != -1 {
-						wStart += 5
-						wEnd := strings.Index(pgSzTag[wStart:], `"`)
-						if wEnd != -1 {
-							if width := dp.parseFloatFromTwips(pgSzTag[wStart:wStart+wEnd]); width > 0 {
-								layout.PageWidth = width
-							}
-						}
-					}
-
-					if hStart := strings.Index(pgSzTag, `w:h="`); hStart != -1 {
-						hStart += 5
-						hEnd := strings.Index(pgSzTag[hStart:], `"`)
-						if hEnd != -1 {
-							if height := dp.parseFloatFromTwips(pgSzTag[hStart:hStart+hEnd]); height > 0 {
-								layout.PageHeight = height
-							}
-						}
-					}
-				}
-			}
-
-			// Parse page margins (w:pgMar)
-			if pgMarStart := strings.Index(sectContent, "<w:pgMar"); pgMarStart != -1 {
-				pgMarEnd := strings.Index(sectContent[pgMarStart:], "/>")
-				if pgMarEnd != -1 {
-					pgMarTag := sectContent[pgMarStart : pgMarStart+pgMarEnd]
-
-					margins := map[string]*float64{
-						"left":   &layout.LeftMargin,
-						"right":  &layout.RightMargin,
-						"top":    &layout.TopMargin,
-						"bottom": &layout.BottomMargin,
-					}
-
-					for attr, ptr := range margins {
-						if start := strings.Index(pgMarTag, fmt.Sprintf(`w:%s="`, attr)); start != -1 {
-							start += len(attr) + 4
-							end := strings.Index(pgMarTag[start:], `"`)
-							if end != -1 {
-								if value := dp.parseFloatFromTwips(pgMarTag[start:start+end]); value > 0 {
-									*ptr = value
-								}
-							}
-						}
-					}
-				}
-			}
-
-			// Check for explicit orientation setting (w:orient attribute in w:pgSz)
-			if pgSzStart := strings.Index(sectContent, "<w:pgSz"); pgSzStart != -1 {
-				pgSzEnd := strings.Index(sectContent[pgSzStart:], "/>")
-				if pgSzEnd != -1 {
-					pgSzTag := sectContent[pgSzStart : pgSzStart+pgSzEnd]
-
-					// Check for w:orient attribute
-					if orientStart := strings.Index(pgSzTag, `w:orient="`); orientStart != -1 {
-						orientStart += 10
-						orientEnd := strings.Index(pgSzTag[orientStart:], `"`)
-						if orientEnd != -1 {
-							orientation := pgSzTag[orientStart : orientStart+orientEnd]
-							layout.Landscape = orientation == "landscape"
-						}
-					}
-				}
-			}
-		}
-	}
-
-	// If no explicit orientation was found, determine by width vs height ratio
-	if layout.PageWidth > 0 && layout.PageHeight > 0 && !layout.Landscape {
-		// Only override if not already set to landscape
-		layout.Landscape = layout.PageWidth > layout.PageHeight
-	}
-
-	return layout
+	return dp.parseSections(content)[0].Layout
 }
 
 // Convert twentieths of a point to points
@@ -631,25 +527,22 @@ func (dp *DocxProcessor) parseFloatFromTwips(s string) float64 {
 }
 
 // Calculate coordinates based on XML position and document structure
-func (dp *DocxProcessor) calculateCoordinates(xmlContent string, xmlPos int, layout DocumentLayout) (float64, float64, int, string) {
+func (dp *DocxProcessor) calculateCoordinates(xmlContent string, xmlPos int, section Section) (float64, float64, int, string) {
+	layout := section.Layout
+
 	// Find the paragraph containing this position
 	paragraphInfo := dp.findContainingParagraph(xmlContent, xmlPos)
 
-	// Calculate Y position based on paragraph line number
-	y := layout.TopMargin + (float64(paragraphInfo.LineNumber-1) * layout.LineHeight)
+	// Calculate Y position and page from the paragraph's line within its section
+	line := paragraphInfo.LineNumber - section.paragraphsBefore
+	if line < 1 {
+		line = 1
+	}
+	y, pageNumber := section.flow(float64(line-1) * layout.LineHeight)
 
 	// Calculate X position (simplified - assumes left-aligned text)
 	x := layout.LeftMargin + paragraphInfo.X
 
-	// Estimate page number based on Y position
-	pageNumber := int(y/layout.PageHeight) + 1
-	if pageNumber < 1 {
-		pageNumber = 1
-	}
-
-	// Adjust Y for page offset
-	y = y - (float64(pageNumber-1) * layout.PageHeight)
-
 	return x, y, pageNumber, paragraphInfo.ParagraphId
 }
 
@@ -667,14 +560,19 @@ func (dp *DocxProcessor) findContainingParagraph(content string, xmlPos int) Par
 		ParagraphId: "p1",
 	}
 
-	// Count paragraphs before this position
+	// Count paragraphs before this position; text box paragraphs are not part of the body flow
 	paragraphCount := 0
 	searchPos := 0
+	floating := floatingContentRanges(content)
 
 	for searchPos < xmlPos && searchPos < len(content) {
-		// Look for paragraph tags
-		if pStart := strings.Index(content[searchPos:], "<w:p "); pStart != -1 {
+		// Look for paragraph tags, skipping w:pPr and the like
+		if pStart := strings.Index(content[searchPos:], "<w:p"); pStart != -1 {
 			pStart += searchPos
+			if pStart < xmlPos && (!isTagAt(content, pStart, "w:p") || inRanges(floating, pStart)) {
+				searchPos = pStart + 1
+				continue
+			}
 			if pStart < xmlPos {
 				paragraphCount++
 
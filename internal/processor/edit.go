@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// InsertText inserts text into run number run (0-based, as in Structure) of the paragraph with
+// the given id, offset characters into the run's text. An empty paragraph gets a new run.
+func (dp *DocxProcessor) InsertText(paragraphID string, run, offset int, text string) error {
+	content, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return err
+	}
+
+	floating := floatingContentRanges(content)
+	starts := bodyParagraphStarts(content, 0, len(content), floating)
+	number, err := strconv.Atoi(strings.TrimPrefix(paragraphID, "p"))
+	if err != nil || !strings.HasPrefix(paragraphID, "p") || number < 1 || number > len(starts) {
+		return fmt.Errorf("paragraph %q not found", paragraphID)
+	}
+	paragraph, ok := matchElement(content, starts[number-1], len(content), "w:p")
+	if !ok {
+		return fmt.Errorf("paragraph %q is malformed", paragraphID)
+	}
+
+	var runs []xmlElement
+	for _, r := range findElementsIn(content, paragraph.InnerStart, paragraph.InnerEnd, "w:r") {
+		if !inRanges(floating, r.Start) {
+			runs = append(runs, r)
+		}
+	}
+
+	textRun := `<w:r><w:t xml:space="preserve">` + EscapeXMLText(text) + `</w:t></w:r>`
+	switch {
+	case len(runs) == 0 && run == 0 && offset == 0:
+		// Self-closing paragraphs have no room for a run yet
+		if paragraph.InnerStart == paragraph.End {
+			startTag := strings.TrimSuffix(strings.TrimSuffix(paragraph.StartTag(content), "/>"), " ") + ">"
+			content = content[:paragraph.Start] + startTag + textRun + "</w:p>" + content[paragraph.End:]
+		} else {
+			content = content[:paragraph.InnerEnd] + textRun + content[paragraph.InnerEnd:]
+		}
+		return dp.writePart("word/document.xml", []byte(content))
+	case run < 0 || run >= len(runs):
+		return fmt.Errorf("paragraph %q has no run %d", paragraphID, run)
+	}
+
+	r := runs[run]
+	var texts []xmlElement
+	for _, t := range findElementsIn(content, r.InnerStart, r.InnerEnd, "w:t") {
+		if !inRanges(floating, t.Start) {
+			texts = append(texts, t)
+		}
+	}
+
+	// Find the w:t holding the offset; an offset at the end of the run goes into the last one
+	remaining := offset
+	for i, t := range texts {
+		value := unescapeXMLText(t.Inner(content))
+		length := utf8.RuneCountInString(value)
+		if remaining > length && i < len(texts)-1 {
+			remaining -= length
+			continue
+		}
+		if remaining > length || remaining < 0 {
+			break
+		}
+		split := len(string([]rune(value)[:remaining]))
+		inner := EscapeXMLText(value[:split] + text + value[split:])
+		tag := setTagAttr(t.StartTag(content), "xml:space", "preserve")
+		content = content[:t.Start] + tag + inner + "</w:t>" + content[t.End:]
+		return dp.writePart("word/document.xml", []byte(content))
+	}
+
+	if len(texts) == 0 && offset == 0 {
+		t := `<w:t xml:space="preserve">` + EscapeXMLText(text) + `</w:t>`
+		content = content[:r.InnerEnd] + t + content[r.InnerEnd:]
+		return dp.writePart("word/document.xml", []byte(content))
+	}
+	return fmt.Errorf("offset %d is outside run %d of paragraph %q", offset, run, paragraphID)
+}
+
+// ReplaceText replaces every occurrence of old in the text of the body, headers, footers and
+// notes, also where old is split across runs. The replacement takes the formatting of the run
+// in which the occurrence starts. It returns the number of occurrences replaced.
+func (dp *DocxProcessor) ReplaceText(old, replacement string) (int, error) {
+	if old == "" {
+		return 0, fmt.Errorf("text to replace is empty")
+	}
+
+	total := 0
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return total, err
+		}
+		updated, count := replaceInText(content, old, replacement)
+		if count == 0 {
+			continue
+		}
+		if err := dp.writePart(part, []byte(updated)); err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// RenamePlaceholder replaces placeholder old with new in all text and in the alt text of
+// drawings, where charts are bound. It returns the number of occurrences renamed.
+func (dp *DocxProcessor) RenamePlaceholder(old, new string) (int, error) {
+	total, err := dp.ReplaceText(old, new)
+	if err != nil {
+		return total, err
+	}
+
+	content, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return total, err
+	}
+	escapedOld, escapedNew := EscapeXMLText(old), EscapeXMLText(new)
+	docPrs := findElements(content, "wp:docPr")
+	changed := false
+	for i := len(docPrs) - 1; i >= 0; i-- {
+		tag := docPrs[i].StartTag(content)
+		updated := tag
+		for _, attr := range []string{"descr", "title"} {
+			if value := tagAttr(updated, attr); strings.Contains(value, escapedOld) {
+				total += strings.Count(value, escapedOld)
+				updated = setTagAttr(updated, attr, strings.ReplaceAll(value, escapedOld, escapedNew))
+			}
+		}
+		if updated != tag {
+			content = content[:docPrs[i].Start] + updated + content[docPrs[i].Start+len(tag):]
+			changed = true
+		}
+	}
+	if changed {
+		if err := dp.writePart("word/document.xml", []byte(content)); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// textSegment is one w:t element and its unescaped text
+type textSegment struct {
+	element xmlElement
+	text    string
+}
+
+// replaceInText replaces old in the w:t text of content. Matches may span the w:t elements of
+// one paragraph but never cross a paragraph boundary.
+func replaceInText(content, old, replacement string) (string, int) {
+	texts := findElements(content, "w:t")
+	if len(texts) == 0 {
+		return content, 0
+	}
+
+	// Group the text elements of each paragraph
+	var groups [][]textSegment
+	var group []textSegment
+	for i, t := range texts {
+		if i > 0 {
+			between := content[texts[i-1].End:t.Start]
+			if strings.Contains(between, "</w:p>") || strings.Contains(between, "<w:p>") || strings.Contains(between, "<w:p ") {
+				groups = append(groups, group)
+				group = nil
+			}
+		}
+		group = append(group, textSegment{element: t, text: unescapeXMLText(t.Inner(content))})
+	}
+	groups = append(groups, group)
+
+	count := 0
+	var changed []textSegment
+	for _, segments := range groups {
+		n := replaceInSegments(segments, old, replacement)
+		if n == 0 {
+			continue
+		}
+		count += n
+		changed = append(changed, segments...)
+	}
+
+	// Rewrite from the end so earlier offsets stay valid
+	for i := len(changed) - 1; i >= 0; i-- {
+		segment := changed[i]
+		original := unescapeXMLText(segment.element.Inner(content))
+		if segment.text == original {
+			continue
+		}
+		tag := setTagAttr(segment.element.StartTag(content), "xml:space", "preserve")
+		content = content[:segment.element.Start] + tag + EscapeXMLText(segment.text) + "</w:t>" + content[segment.element.End:]
+	}
+	return content, count
+}
+
+// replaceInSegments replaces old in the joined text of segments, editing the segment texts in place
+func replaceInSegments(segments []textSegment, old, replacement string) int {
+	var joined strings.Builder
+	for _, segment := range segments {
+		joined.WriteString(segment.text)
+	}
+	text := joined.String()
+
+	var matches []int
+	for pos := 0; ; {
+		idx := strings.Index(text[pos:], old)
+		if idx == -1 {
+			break
+		}
+		matches = append(matches, pos+idx)
+		pos += idx + len(old)
+	}
+
+	for i := len(matches) - 1; i >= 0; i-- {
+		start, end := matches[i], matches[i]+len(old)
+		offset := 0
+		first := true
+		for j := range segments {
+			segStart, segEnd := offset, offset+len(segments[j].text)
+			offset = segEnd
+			if segEnd <= start || segStart >= end {
+				continue
+			}
+			from := max(start, segStart) - segStart
+			to := min(end, segEnd) - segStart
+			inserted := ""
+			if first {
+				inserted = replacement
+				first = false
+			}
+			segments[j].text = segments[j].text[:from] + inserted + segments[j].text[to:]
+		}
+	}
+	return len(matches)
+}
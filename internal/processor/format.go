@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Template file formats, named by their file extension
+const (
+	FormatDocx = "docx"
+	FormatXlsx = "xlsx"
+	FormatPptx = "pptx"
+	FormatOdt  = "odt"
+	FormatHTML = "html"
+	FormatZip  = "zip" // HTML template bundled with its assets
+	FormatDoc  = "doc"
+	FormatRtf  = "rtf"
+	FormatTxt  = "txt"
+	FormatPng  = "png"
+)
+
+// templateFormats are the formats templates can be uploaded in
+var templateFormats = []string{FormatDocx, FormatXlsx, FormatPptx, FormatOdt, FormatHTML, FormatZip}
+
+// legacyFormats are converted to DOCX at upload
+var legacyFormats = []string{FormatDoc, FormatRtf}
+
+var formatMimeTypes = map[string]string{
+	FormatDocx: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	FormatXlsx: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatPptx: "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	FormatOdt:  "application/vnd.oasis.opendocument.text",
+	FormatHTML: "text/html; charset=utf-8",
+	FormatZip:  "application/zip",
+	FormatDoc:  "application/msword",
+	FormatRtf:  "application/rtf",
+	FormatTxt:  "text/plain; charset=utf-8",
+	FormatPng:  "image/png",
+}
+
+// FileFormat returns the format of a file from its extension, e.g. "xlsx" for "Budget.XLSX"
+func FileFormat(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// IsTemplateFormat reports whether templates can be uploaded in format
+func IsTemplateFormat(format string) bool {
+	return slices.Contains(templateFormats, format)
+}
+
+// IsLegacyFormat reports whether uploads in format are converted to DOCX
+func IsLegacyFormat(format string) bool {
+	return slices.Contains(legacyFormats, format)
+}
+
+// TemplateFormats lists the accepted upload extensions for messages, e.g. ".docx, .xlsx, .pptx"
+func TemplateFormats() string {
+	var extensions []string
+	for _, format := range slices.Concat(templateFormats, legacyFormats) {
+		extensions = append(extensions, "."+format)
+	}
+	return strings.Join(extensions, ", ")
+}
+
+// IsHTMLFormat reports whether templates in format are HTML pages printed through Chromium
+func IsHTMLFormat(format string) bool {
+	return format == FormatHTML || format == FormatZip
+}
+
+// MimeType returns the content type of files in format
+func MimeType(format string) string {
+	if mimeType, ok := formatMimeTypes[format]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,273 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// HTMLIndex is the page of an HTML template bundle that is rendered
+const HTMLIndex = "index.html"
+
+// HTMLBundle is an HTML template written for Go's html/template, with the images, stylesheets
+// and fonts it references. Assets are keyed by file name: Chromium receives them in one folder,
+// so the page refers to them by name only.
+type HTMLBundle struct {
+	Index  string
+	Assets map[string][]byte
+}
+
+// ReadHTMLBundle reads a .html template, or a .zip holding index.html and its assets. The
+// shallowest index.html of the zip is the page; folders are flattened.
+func ReadHTMLBundle(filePath, format string) (*HTMLBundle, error) {
+	if format == FormatHTML {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML template: %w", err)
+		}
+		return &HTMLBundle{Index: string(content), Assets: map[string][]byte{}}, nil
+	}
+
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer reader.Close()
+
+	var index *zip.File
+	for _, file := range reader.File {
+		if path.Base(file.Name) == HTMLIndex && (index == nil || strings.Count(file.Name, "/") < strings.Count(index.Name, "/")) {
+			index = file
+		}
+	}
+	if index == nil {
+		return nil, fmt.Errorf("bundle has no %s", HTMLIndex)
+	}
+
+	bundle := &HTMLBundle{Assets: map[string][]byte{}}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(path.Base(file.Name), ".") || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		if file == index {
+			bundle.Index = string(content)
+			continue
+		}
+		name := path.Base(file.Name)
+		if _, exists := bundle.Assets[name]; exists || name == HTMLIndex {
+			return nil, fmt.Errorf("bundle has more than one file named %s", name)
+		}
+		bundle.Assets[name] = content
+	}
+	return bundle, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Write stores the bundle as a .html file, or as a .zip with the page and assets at its root
+func (b *HTMLBundle) Write(filePath, format string) error {
+	if format == FormatHTML {
+		return os.WriteFile(filePath, []byte(b.Index), 0644)
+	}
+
+	outputFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	zipWriter := zip.NewWriter(outputFile)
+	files := map[string][]byte{HTMLIndex: []byte(b.Index)}
+	for name, content := range b.Assets {
+		files[name] = content
+	}
+	for name, content := range files {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+// parse compiles the page
+func (b *HTMLBundle) parse() (*template.Template, error) {
+	tmpl, err := template.New(HTMLIndex).Parse(b.Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Placeholders returns the data fields the page uses as {{name}}. Fields used inside range or
+// with over a field are listed below it, e.g. {{range .items}}{{.price}}{{end}} gives
+// {{items.price}}.
+func (b *HTMLBundle) Placeholders() ([]string, error) {
+	tmpl, err := b.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var placeholders []string
+	seen := make(map[string]bool)
+	add := func(field string) {
+		if placeholder := "{{" + field + "}}"; field != "" && !seen[placeholder] {
+			placeholders = append(placeholders, placeholder)
+			seen[placeholder] = true
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.Root != nil {
+			collectTemplateFields(t.Tree.Root, "", true, add)
+		}
+	}
+	return placeholders, nil
+}
+
+// collectTemplateFields walks a template tree calling add for every field used. dot is the
+// field path of dot, or known is false where dot is not a data field.
+func collectTemplateFields(node parse.Node, dot string, known bool, add func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, dot, known, add)
+		}
+	case *parse.ActionNode:
+		collectPipeFields(n.Pipe, dot, known, add)
+	case *parse.IfNode:
+		collectPipeFields(n.Pipe, dot, known, add)
+		collectTemplateFields(n.List, dot, known, add)
+		collectTemplateFields(n.ElseList, dot, known, add)
+	case *parse.RangeNode:
+		inner, innerKnown := pipeField(n.Pipe, dot, known)
+		collectTemplateFields(n.List, inner, innerKnown, add)
+		collectTemplateFields(n.ElseList, dot, known, add)
+	case *parse.WithNode:
+		inner, innerKnown := pipeField(n.Pipe, dot, known)
+		collectTemplateFields(n.List, inner, innerKnown, add)
+		collectTemplateFields(n.ElseList, dot, known, add)
+	case *parse.TemplateNode:
+		collectPipeFields(n.Pipe, dot, known, add)
+	}
+}
+
+// collectPipeFields adds the fields read by the commands of a pipeline
+func collectPipeFields(pipe *parse.PipeNode, dot string, known bool, add func(string)) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				if known {
+					add(joinField(dot, a.Ident))
+				}
+			case *parse.DotNode:
+				if known {
+					add(dot)
+				}
+			case *parse.VariableNode:
+				if len(a.Ident) > 1 && a.Ident[0] == "$" {
+					add(joinField("", a.Ident[1:]))
+				}
+			case *parse.PipeNode:
+				collectPipeFields(a, dot, known, add)
+			}
+		}
+	}
+}
+
+// pipeField returns the field a range or with pipeline moves dot to
+func pipeField(pipe *parse.PipeNode, dot string, known bool) (string, bool) {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return "", false
+	}
+	switch a := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		return joinField(dot, a.Ident), known
+	case *parse.DotNode:
+		return dot, known
+	case *parse.VariableNode:
+		if len(a.Ident) > 1 && a.Ident[0] == "$" {
+			return joinField("", a.Ident[1:]), true
+		}
+	}
+	return "", false
+}
+
+func joinField(dot string, ident []string) string {
+	field := strings.Join(ident, ".")
+	if dot == "" {
+		return field
+	}
+	return dot + "." + field
+}
+
+// Render executes the page against data and returns the bundle with the rendered page. Numbers
+// are printed without an exponent.
+func (b *HTMLBundle) Render(data map[string]interface{}) (*HTMLBundle, error) {
+	tmpl, err := b.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, templateData(data)); err != nil {
+		return nil, fmt.Errorf("failed to render HTML template: %w", err)
+	}
+	return &HTMLBundle{Index: out.String(), Assets: b.Assets}, nil
+}
+
+// templateNumber is a number decoded from JSON. It prints 1000000 rather than 1e+06 and still
+// formats with printf verbs such as %.2f.
+type templateNumber float64
+
+func (n templateNumber) String() string {
+	return strconv.FormatFloat(float64(n), 'f', -1, 64)
+}
+
+// templateData wraps the float64 numbers of data in templateNumber
+func templateData(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = templateData(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = templateData(item)
+		}
+		return converted
+	case float64:
+		return templateNumber(v)
+	}
+	return value
+}
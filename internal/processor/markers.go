@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MarkerPattern matches the text written by PlaceholderMarker; the first group is the occurrence index
+var MarkerPattern = regexp.MustCompile(`QX(\d{4})Xx*`)
+
+const minMarkerLength = 7
+
+// PlaceholderMarker returns unique plain text for occurrence index of placeholder. It is padded
+// to the placeholder's length so that the rendered marker takes about the same room.
+func PlaceholderMarker(index int, placeholder string) string {
+	marker := fmt.Sprintf("QX%04dX", index%10000)
+	if pad := utf8.RuneCountInString(placeholder) - len(marker); pad > 0 {
+		marker += strings.Repeat("x", pad)
+	}
+	return marker
+}
+
+// MarkerIndex reads the occurrence index back from a matched marker
+func MarkerIndex(marker string) (int, bool) {
+	match := MarkerPattern.FindStringSubmatch(marker)
+	if match == nil {
+		return 0, false
+	}
+	index, err := strconv.Atoi(match[1])
+	return index, err == nil
+}
+
+// WriteMarkedDocx writes a copy of the document to path in which every occurrence in positions
+// is replaced with its PlaceholderMarker. The working directory is left unchanged.
+func (dp *DocxProcessor) WriteMarkedDocx(path string, positions []PlaceholderPosition) error {
+	if len(positions) > 10000 {
+		return fmt.Errorf("too many placeholders to mark: %d", len(positions))
+	}
+
+	original, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return err
+	}
+
+	marked := original
+	for i := len(positions) - 1; i >= 0; i-- {
+		pos := positions[i]
+		if pos.XMLStartPos < 0 || pos.XMLEndPos > len(marked) || pos.XMLStartPos >= pos.XMLEndPos {
+			continue
+		}
+		// A placeholder split across runs keeps the markup between its pieces
+		span := marked[pos.XMLStartPos:pos.XMLEndPos]
+		marked = marked[:pos.XMLStartPos] + PlaceholderMarker(i, pos.Placeholder) + markupOnly(span) + marked[pos.XMLEndPos:]
+	}
+
+	if err := dp.writePart("word/document.xml", []byte(marked)); err != nil {
+		return err
+	}
+	zipErr := dp.ReZipDocxTo(path)
+	if err := dp.writePart("word/document.xml", []byte(original)); err != nil {
+		return err
+	}
+	return zipErr
+}
+
+// markupOnly drops the text between the tags of an XML fragment
+func markupOnly(fragment string) string {
+	var sb strings.Builder
+	for {
+		start := strings.Index(fragment, "<")
+		if start == -1 {
+			return sb.String()
+		}
+		end := strings.Index(fragment[start:], ">")
+		if end == -1 {
+			return sb.String()
+		}
+		sb.WriteString(fragment[start : start+end+1])
+		fragment = fragment[start+end+1:]
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	rsidAttrPattern        = regexp.MustCompile(`\s+w:rsid[A-Za-z]*="[^"]*"`)
+	placeholderSpanPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+)
+
+// textRun is a run that holds nothing but optional run properties and text
+type textRun struct {
+	element  xmlElement
+	startTag string
+	rPr      string
+	text     string
+}
+
+// NormalizeRuns cleans up the run structure Word leaves behind so every placeholder sits in a single run:
+// proofing marks and rsid attributes are dropped, adjacent runs with identical formatting are merged,
+// and a placeholder split across differently formatted runs takes the formatting of the run it starts in.
+// It returns the number of placeholders that were split across runs before normalization.
+func (dp *DocxProcessor) NormalizeRuns() (int, error) {
+	collapsed := 0
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return collapsed, err
+		}
+
+		updated := removeElements(content, "w:proofErr")
+		updated = rsidAttrPattern.ReplaceAllString(updated, "")
+		updated, count := mergeTextRuns(updated)
+		collapsed += count
+
+		if updated != content {
+			if err := dp.writePart(part, []byte(updated)); err != nil {
+				return collapsed, err
+			}
+		}
+	}
+	return collapsed, nil
+}
+
+// mergeTextRuns rewrites every sequence of adjacent text runs and returns the number of placeholders it joined
+func mergeTextRuns(content string) (string, int) {
+	var groups [][]textRun
+	var group []textRun
+	for _, e := range findElements(content, "w:r") {
+		run, ok := parseTextRun(content, e)
+		if !ok {
+			continue
+		}
+		if len(group) > 0 && strings.TrimSpace(content[group[len(group)-1].element.End:e.Start]) != "" {
+			groups = append(groups, group)
+			group = nil
+		}
+		group = append(group, run)
+	}
+	groups = append(groups, group)
+
+	collapsed := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		runs := groups[i]
+		if len(runs) < 2 {
+			continue
+		}
+		merged, count := rebuildTextRuns(runs)
+		collapsed += count
+		content = content[:runs[0].element.Start] + merged + content[runs[len(runs)-1].element.End:]
+	}
+	return content, collapsed
+}
+
+// parseTextRun reads a run made only of w:rPr and w:t children
+func parseTextRun(content string, e xmlElement) (textRun, bool) {
+	run := textRun{element: e, startTag: e.StartTag(content)}
+	if e.InnerStart == e.End {
+		return run, false
+	}
+
+	pos := e.InnerStart
+	if rPr, ok := directChild(content, e, "w:rPr"); ok {
+		run.rPr = rPr.Outer(content)
+		pos = rPr.End
+	}
+
+	var text strings.Builder
+	hasText := false
+	for {
+		for pos < e.InnerEnd && strings.ContainsRune(" \t\r\n", rune(content[pos])) {
+			pos++
+		}
+		if pos >= e.InnerEnd {
+			break
+		}
+		if !isTagAt(content, pos, "w:t") {
+			return run, false
+		}
+		t, ok := matchElement(content, pos, e.InnerEnd, "w:t")
+		if !ok {
+			return run, false
+		}
+		if t.InnerStart != t.End {
+			text.WriteString(unescapeXMLText(t.Inner(content)))
+		}
+		hasText = true
+		pos = t.End
+	}
+
+	run.text = text.String()
+	return run, hasText
+}
+
+// rebuildTextRuns writes a sequence of adjacent text runs back with placeholders kept whole
+// and neighbouring runs of identical formatting merged
+func rebuildTextRuns(runs []textRun) (string, int) {
+	var full strings.Builder
+	var owner []int
+	for i, run := range runs {
+		full.WriteString(run.text)
+		for range run.text {
+			owner = append(owner, i)
+		}
+	}
+	joined := full.String()
+	text := []rune(joined)
+
+	// Move each placeholder that crosses run boundaries into the run where it starts
+	collapsed := 0
+	for _, match := range placeholderSpanPattern.FindAllStringIndex(joined, -1) {
+		start := utf8.RuneCountInString(joined[:match[0]])
+		end := start + utf8.RuneCountInString(joined[match[0]:match[1]])
+		if owner[start] != owner[end-1] {
+			collapsed++
+		}
+		for k := start; k < end; k++ {
+			owner[k] = owner[start]
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(text); {
+		run := runs[owner[start]]
+		end := start + 1
+		for end < len(text) && runs[owner[end]].rPr == run.rPr {
+			end++
+		}
+		out.WriteString(textRunXML(run, string(text[start:end])))
+		start = end
+	}
+	return out.String(), collapsed
+}
+
+func textRunXML(run textRun, text string) string {
+	tTag := "<w:t>"
+	if strings.TrimSpace(text) != text {
+		tTag = `<w:t xml:space="preserve">`
+	}
+	return run.startTag + run.rPr + tTag + EscapeXMLText(text) + "</w:t></w:r>"
+}
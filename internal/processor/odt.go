@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// odtParts are the parts of an OpenDocument text that hold placeholders: the body, and the
+// headers and footers of the master pages
+var odtParts = []string{"content.xml", "styles.xml"}
+
+// OdtProcessor fills {{placeholders}} in an OpenDocument text (.odt)
+type OdtProcessor struct {
+	inputFile  string
+	outputFile string
+	tempDir    string
+}
+
+func NewOdtProcessor(inputFile, outputFile string) *OdtProcessor {
+	return &OdtProcessor{
+		inputFile:  inputFile,
+		outputFile: outputFile,
+		tempDir:    fmt.Sprintf("temp_odt_%d", time.Now().UnixNano()),
+	}
+}
+
+func (op *OdtProcessor) UnzipOdt() error {
+	return unzipPackage(op.inputFile, op.tempDir)
+}
+
+func (op *OdtProcessor) ReZipOdt() error {
+	return zipPackage(op.tempDir, op.outputFile)
+}
+
+func (op *OdtProcessor) Cleanup() {
+	os.RemoveAll(op.tempDir)
+}
+
+// ExtractPlaceholders returns the distinct placeholders of the body, headers and footers, also
+// where a placeholder is split across text:span elements
+func (op *OdtProcessor) ExtractPlaceholders() ([]string, error) {
+	var placeholders []string
+	seen := make(map[string]bool)
+	for _, part := range odtParts {
+		content, err := readPackagePart(op.tempDir, part)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, segments := range odtParagraphTexts(content) {
+			text := ""
+			for _, segment := range segments {
+				text += segment.text
+			}
+			for _, placeholder := range placeholderSpanPattern.FindAllString(text, -1) {
+				if !seen[placeholder] && !IsInclude(placeholder) {
+					placeholders = append(placeholders, placeholder)
+					seen[placeholder] = true
+				}
+			}
+		}
+	}
+	return placeholders, nil
+}
+
+// FindAndReplaceInDocument replaces placeholders with the values keyed by placeholder. A
+// placeholder split across spans takes the formatting of its first character.
+func (op *OdtProcessor) FindAndReplaceInDocument(values map[string]string) error {
+	for _, part := range odtParts {
+		content, err := readPackagePart(op.tempDir, part)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		var changed []textSegment
+		for _, segments := range odtParagraphTexts(content) {
+			text := ""
+			for _, segment := range segments {
+				text += segment.text
+			}
+			replaced := false
+			for _, placeholder := range placeholderSpanPattern.FindAllString(text, -1) {
+				if value, ok := values[placeholder]; ok && replaceInSegments(segments, placeholder, value) > 0 {
+					replaced = true
+				}
+			}
+			if replaced {
+				changed = append(changed, segments...)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		// Paragraphs nest, so order the text nodes before rewriting from the end
+		sort.Slice(changed, func(i, j int) bool { return changed[i].element.Start < changed[j].element.Start })
+		for i := len(changed) - 1; i >= 0; i-- {
+			node := changed[i].element
+			if changed[i].text == unescapeXMLText(node.Inner(content)) {
+				continue
+			}
+			content = content[:node.Start] + EscapeXMLText(changed[i].text) + content[node.End:]
+		}
+		if err := writePackagePart(op.tempDir, part, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// odtParagraphTexts returns the text nodes of every text:p and text:h, grouped by paragraph.
+// Text of paragraphs nested in frames or notes belongs to the inner paragraph only.
+func odtParagraphTexts(content string) [][]textSegment {
+	var groups [][]textSegment
+	var stack []int // Indexes into groups of the open paragraphs
+	for pos := 0; pos < len(content); {
+		if content[pos] != '<' {
+			next := strings.IndexByte(content[pos:], '<')
+			if next == -1 {
+				next = len(content) - pos
+			}
+			if len(stack) > 0 {
+				node := xmlElement{Start: pos, End: pos + next, InnerStart: pos, InnerEnd: pos + next}
+				top := stack[len(stack)-1]
+				groups[top] = append(groups[top], textSegment{element: node, text: unescapeXMLText(node.Inner(content))})
+			}
+			pos += next
+			continue
+		}
+
+		end := tagEnd(content, pos)
+		switch {
+		case isTagAt(content, pos, "text:p"), isTagAt(content, pos, "text:h"):
+			if !strings.HasSuffix(content[pos:end], "/>") {
+				groups = append(groups, nil)
+				stack = append(stack, len(groups)-1)
+			}
+		case strings.HasPrefix(content[pos:], "</text:p>"), strings.HasPrefix(content[pos:], "</text:h>"):
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		pos = end
+	}
+	return groups
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+// OverlayBox is the rectangle of one placeholder occurrence, in pixels
+type OverlayBox struct {
+	Index       int     `json:"index"` // Position of the occurrence in the template's position list
+	Placeholder string  `json:"placeholder"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Measured    bool    `json:"measured"`
+}
+
+// PageOverlay holds the placeholder rectangles of one page at a resolution, ready to be laid
+// over an image of that page rendered at the same DPI
+type PageOverlay struct {
+	Page   int          `json:"page"`
+	DPI    float64      `json:"dpi"`
+	Width  float64      `json:"width"`  // Page width in pixels
+	Height float64      `json:"height"` // Page height in pixels
+	Boxes  []OverlayBox `json:"boxes"`
+}
+
+// NewPageOverlay scales the positions on page to pixels at dpi
+func (dp *DocxProcessor) NewPageOverlay(page int, layout DocumentLayout, positions []PlaceholderPosition, dpi float64) PageOverlay {
+	if dpi <= 0 {
+		dpi = 96
+	}
+	overlay := PageOverlay{
+		Page:   page,
+		DPI:    dpi,
+		Width:  dp.PointsToPixels(layout.PageWidth, dpi),
+		Height: dp.PointsToPixels(layout.PageHeight, dpi),
+		Boxes:  []OverlayBox{},
+	}
+
+	for i, position := range positions {
+		if position.PageNumber != page {
+			continue
+		}
+		x, y, width, height := dp.GetSVGCoordinates(position, dpi)
+		overlay.Boxes = append(overlay.Boxes, OverlayBox{
+			Index:       i,
+			Placeholder: position.Placeholder,
+			X:           x,
+			Y:           y,
+			Width:       width,
+			Height:      height,
+			Measured:    position.Measured,
+		})
+	}
+	return overlay
+}
+
+// SVG draws each box as a labelled rectangle on a transparent page-sized canvas. Every box is a
+// group carrying data-placeholder and data-index so a client can react to clicks.
+func (o PageOverlay) SVG() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`,
+		svgNumber(o.Width), svgNumber(o.Height), svgNumber(o.Width), svgNumber(o.Height))
+	buf.WriteString(`<style>.placeholder rect{fill:rgba(33,150,243,0.15);stroke:#2196f3;stroke-width:1}` +
+		`.placeholder text{fill:#0d47a1;font-family:sans-serif}.estimated rect{stroke-dasharray:4 2}</style>`)
+
+	for _, box := range o.Boxes {
+		class := "placeholder"
+		if !box.Measured {
+			class += " estimated"
+		}
+		label := html.EscapeString(box.Placeholder)
+		fontSize := math.Max(6, math.Min(box.Height*0.7, 14*o.DPI/96))
+
+		fmt.Fprintf(&buf, `<g class="%s" data-placeholder="%s" data-index="%d">`, class, label, box.Index)
+		fmt.Fprintf(&buf, `<title>%s</title>`, label)
+		fmt.Fprintf(&buf, `<rect x="%s" y="%s" width="%s" height="%s"/>`,
+			svgNumber(box.X), svgNumber(box.Y), svgNumber(box.Width), svgNumber(box.Height))
+		fmt.Fprintf(&buf, `<text x="%s" y="%s" font-size="%s">%s</text>`,
+			svgNumber(box.X+1), svgNumber(box.Y+fontSize), svgNumber(fontSize), label)
+		buf.WriteString(`</g>`)
+	}
+
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// PNG draws the boxes without labels on a transparent page-sized image
+func (o PageOverlay) PNG() ([]byte, error) {
+	width, height := int(math.Ceil(o.Width)), int(math.Ceil(o.Height))
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid overlay size %dx%d", width, height)
+	}
+
+	palette := color.Palette{
+		color.NRGBA{0, 0, 0, 0},
+		color.NRGBA{33, 150, 243, 40},
+		color.NRGBA{33, 150, 243, 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	border := int(math.Max(1, math.Round(o.DPI/96)))
+	for _, box := range o.Boxes {
+		rect := image.Rect(int(box.X), int(box.Y), int(math.Ceil(box.X+box.Width)), int(math.Ceil(box.Y+box.Height))).Intersect(img.Rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				edge := x < rect.Min.X+border || x >= rect.Max.X-border || y < rect.Min.Y+border || y >= rect.Max.Y-border
+				if edge {
+					img.SetColorIndex(x, y, 2)
+				} else if img.ColorIndexAt(x, y) == 0 {
+					img.SetColorIndex(x, y, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode overlay: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func svgNumber(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
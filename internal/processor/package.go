@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Office files are zip packages. These helpers work on a package unzipped into a directory and
+// are shared by the processors of every format.
+
+// unzipPackage extracts every file of the zip package inputFile into dir
+func unzipPackage(inputFile, dir string) error {
+	reader, err := zip.OpenReader(inputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open package: %w", err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	for _, file := range reader.File {
+		if err := extractPackageFile(dir, file); err != nil {
+			return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// extractPackageFile writes one zip entry below dir. Entries named to land outside dir, such as
+// "../../etc/cron.d/x", are refused.
+func extractPackageFile(dir string, file *zip.File) error {
+	path, err := packagePath(dir, file.Name)
+	if err != nil {
+		return err
+	}
+
+	if file.FileInfo().IsDir() {
+		return os.MkdirAll(path, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.FileInfo().Mode())
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	_, err = io.Copy(outFile, rc)
+	return err
+}
+
+// zipPackage zips the contents of dir to path. An OpenDocument mimetype file is written first
+// and uncompressed, as the format requires.
+func zipPackage(dir, path string) error {
+	outputFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	zipWriter := zip.NewWriter(outputFile)
+	defer zipWriter.Close()
+
+	if mimetype, err := os.ReadFile(filepath.Join(dir, "mimetype")); err == nil {
+		zipFile, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := zipFile.Write(mimetype); err != nil {
+			return err
+		}
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "mimetype" {
+			return nil
+		}
+
+		zipFile, err := zipWriter.Create(relPath)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(zipFile, file)
+		return err
+	})
+}
+
+// readPackagePart returns the content of a part such as word/settings.xml
+func readPackagePart(dir, partName string) (string, error) {
+	fullPath, err := packagePath(dir, partName)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", partName, err)
+	}
+	return string(content), nil
+}
+
+// writePackagePart stores a part, creating its folder if needed
+func writePackagePart(dir, partName string, content []byte) error {
+	fullPath, err := packagePath(dir, partName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fullPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", partName, err)
+	}
+	return nil
+}
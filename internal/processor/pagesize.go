@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PageSize is a paper size and margins in points. A zero Width and Height keep the paper of
+// each section, and nil Margins keep its margins.
+type PageSize struct {
+	Width   float64
+	Height  float64
+	Margins *PageMargins
+}
+
+// PageMargins are the margins of a PageSize in points
+type PageMargins struct {
+	Top    float64
+	Bottom float64
+	Left   float64
+	Right  float64
+}
+
+// Children of w:sectPr that come after w:pgSz and w:pgMar in schema order
+var (
+	afterPageSize    = []string{"w:pgMar", "w:paperSrc", "w:pgBorders", "w:lnNumType", "w:pgNumType", "w:cols", "w:formProt", "w:vAlign", "w:noEndnote", "w:titlePg", "w:textDirection", "w:bidi", "w:rtlGutter", "w:docGrid", "w:printerSettings"}
+	afterPageMargins = afterPageSize[1:]
+)
+
+// SetPageSize applies a paper size and margins to every section of the document. Landscape
+// sections stay landscape, with the long edge of the paper across the page.
+func (dp *DocxProcessor) SetPageSize(size PageSize) error {
+	documentXML, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return err
+	}
+
+	sections := outermostElements(findElements(documentXML, "w:sectPr"))
+	if len(sections) == 0 {
+		return fmt.Errorf("document has no section properties")
+	}
+	// Replace from the end so earlier offsets stay valid
+	for i := len(sections) - 1; i >= 0; i-- {
+		section := sections[i]
+		documentXML = documentXML[:section.Start] + setSectionPageSize(section.Outer(documentXML), size) + documentXML[section.End:]
+	}
+
+	return dp.writePart("word/document.xml", []byte(documentXML))
+}
+
+// setSectionPageSize rewrites the w:pgSz and w:pgMar of one w:sectPr
+func setSectionPageSize(sectPr string, size PageSize) string {
+	if strings.HasSuffix(sectPr, "/>") {
+		sectPr = strings.TrimSuffix(sectPr, "/>") + "></w:sectPr>"
+	}
+	// The previous properties of a tracked change are left as they were
+	split := strings.Index(sectPr, "<w:sectPrChange")
+	if split == -1 {
+		split = strings.LastIndex(sectPr, "</w:sectPr>")
+	}
+	head, tail := sectPr[:split], sectPr[split:]
+
+	if size.Width > 0 && size.Height > 0 {
+		pgSz, found := firstTag(head, "w:pgSz")
+		landscape := found && (tagAttr(pgSz, "w:orient") == "landscape" || twipsAttr(pgSz, "w:w") > twipsAttr(pgSz, "w:h"))
+		width, height := size.Width, size.Height
+		if landscape && width < height {
+			width, height = height, width
+		}
+
+		tag := fmt.Sprintf(`<w:pgSz w:w="%d" w:h="%d"/>`, toTwips(width), toTwips(height))
+		if width > height {
+			tag = setTagAttr(tag, "w:orient", "landscape")
+		}
+		head = setSectionChild(head, pgSz, found, tag, afterPageSize)
+	}
+
+	if size.Margins != nil {
+		pgMar, found := firstTag(head, "w:pgMar")
+		tag := pgMar
+		if !found {
+			// Header, footer and gutter are required; these are Word's defaults
+			tag = `<w:pgMar w:header="720" w:footer="720" w:gutter="0"/>`
+		}
+		tag = setTagAttr(tag, "w:top", strconv.Itoa(toTwips(size.Margins.Top)))
+		tag = setTagAttr(tag, "w:bottom", strconv.Itoa(toTwips(size.Margins.Bottom)))
+		tag = setTagAttr(tag, "w:left", strconv.Itoa(toTwips(size.Margins.Left)))
+		tag = setTagAttr(tag, "w:right", strconv.Itoa(toTwips(size.Margins.Right)))
+		head = setSectionChild(head, pgMar, found, tag, afterPageMargins)
+	}
+
+	return head + tail
+}
+
+// setSectionChild replaces the child start tag old of a section with tag, or inserts tag before
+// the first of the children that follow it
+func setSectionChild(head, old string, found bool, tag string, following []string) string {
+	if found {
+		return strings.Replace(head, old, tag, 1)
+	}
+	insertAt := len(head)
+	for _, name := range following {
+		for pos := 0; pos < insertAt; {
+			idx := strings.Index(head[pos:], "<"+name)
+			if idx == -1 {
+				break
+			}
+			pos += idx
+			if isTagAt(head, pos, name) {
+				insertAt = pos
+				break
+			}
+			pos++
+		}
+	}
+	return head[:insertAt] + tag + head[insertAt:]
+}
+
+func toTwips(points float64) int {
+	return int(math.Round(points * 20))
+}
+
+func twipsAttr(tag, name string) int {
+	value, _ := strconv.Atoi(tagAttr(tag, name))
+	return value
+}
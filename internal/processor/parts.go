@@ -0,0 +1,369 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Relationship types and content types used when adding parts to a package
+const (
+	RelTypeImage          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	RelTypeHeader         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/header"
+	RelTypeNumbering      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering"
+	RelTypeCustomProps    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties"
+	RelTypeCustomXML      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXml"
+	RelTypeCustomXMLProps = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXmlProps"
+
+	ContentTypeHeader         = "application/vnd.openxmlformats-officedocument.wordprocessingml.header+xml"
+	ContentTypeNumbering      = "application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"
+	ContentTypeCustomProps    = "application/vnd.openxmlformats-officedocument.custom-properties+xml"
+	ContentTypeCustomXMLProps = "application/vnd.openxmlformats-officedocument.customXmlProperties+xml"
+)
+
+// Relationship is one entry of a .rels part
+type Relationship struct {
+	ID         string
+	Type       string
+	Target     string
+	TargetMode string
+}
+
+// relsPathFor returns the .rels part that belongs to a package part, e.g. word/document.xml -> word/_rels/document.xml.rels
+func relsPathFor(partName string) string {
+	dir, file := path.Split(partName)
+	return path.Join(dir, "_rels", file+".rels")
+}
+
+// resolvePartTarget resolves a relationship target relative to the part that owns the relationship
+func resolvePartTarget(sourcePart, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Clean(path.Join(path.Dir(sourcePart), target))
+}
+
+// partTarget resolves a relationship target that names a part of the package. Targets come
+// from uploaded files, so ok is false when one leaves the package, e.g. "../../etc/passwd".
+func partTarget(sourcePart, target string) (string, bool) {
+	partName := path.Clean(resolvePartTarget(sourcePart, target))
+	if partName == "." || partName == ".." || strings.HasPrefix(partName, "../") || path.IsAbs(partName) {
+		return "", false
+	}
+	return partName, true
+}
+
+// packagePath returns where a part is stored in the package unzipped into dir. Part names come
+// from uploaded files, so a name that leads outside dir is refused.
+func packagePath(dir, partName string) (string, error) {
+	fullPath := filepath.Join(dir, filepath.FromSlash(partName))
+	rel, err := filepath.Rel(dir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("part %s is outside the package", partName)
+	}
+	return fullPath, nil
+}
+
+// removePackagePart deletes a part and its relationships part, when both are inside the package
+func removePackagePart(dir, partName string) error {
+	for _, name := range []string{partName, relsPathFor(partName)} {
+		fullPath, err := packagePath(dir, name)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func readRelationships(dir, relsPart string) ([]Relationship, error) {
+	fullPath, err := packagePath(dir, relsPart)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", relsPart, err)
+	}
+
+	return parseRelationships(string(content)), nil
+}
+
+// parseRelationships reads the entries of a .rels part's XML
+func parseRelationships(content string) []Relationship {
+	var rels []Relationship
+	for _, element := range findElements(content, "Relationship") {
+		tag := element.StartTag(content)
+		rels = append(rels, Relationship{
+			ID:         tagAttr(tag, "Id"),
+			Type:       tagAttr(tag, "Type"),
+			Target:     tagAttr(tag, "Target"),
+			TargetMode: tagAttr(tag, "TargetMode"),
+		})
+	}
+	return rels
+}
+
+// addRelationship appends a relationship to a .rels part, creating the part if needed, and returns the new ID
+func addRelationship(dir, relsPart, relType, target, targetMode string) (string, error) {
+	return addRelationshipWithID(dir, relsPart, "", relType, target, targetMode)
+}
+
+// addRelationshipWithID is addRelationship that keeps preferredID when it is still free
+func addRelationshipWithID(dir, relsPart, preferredID, relType, target, targetMode string) (string, error) {
+	fullPath, err := packagePath(dir, relsPart)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", relsPart, err)
+		}
+		content = []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`)
+	}
+	contentStr := string(content)
+
+	// Pick the first free rIdN
+	used := make(map[string]bool)
+	for _, element := range findElements(contentStr, "Relationship") {
+		used[tagAttr(element.StartTag(contentStr), "Id")] = true
+	}
+	id := preferredID
+	for n := len(used) + 1; id == "" || used[id]; n++ {
+		id = "rId" + strconv.Itoa(n)
+	}
+
+	entry := fmt.Sprintf(`<Relationship Id="%s" Type="%s" Target="%s"`, id, relType, EscapeXMLText(target))
+	if targetMode != "" {
+		entry += fmt.Sprintf(` TargetMode="%s"`, targetMode)
+	}
+	entry += "/>"
+
+	closeIdx := strings.LastIndex(contentStr, "</Relationships>")
+	if closeIdx == -1 {
+		return "", fmt.Errorf("malformed relationships part %s", relsPart)
+	}
+	contentStr = contentStr[:closeIdx] + entry + contentStr[closeIdx:]
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(fullPath, []byte(contentStr), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", relsPart, err)
+	}
+	return id, nil
+}
+
+// contentTypeFor looks up the content type of a part in [Content_Types].xml
+func contentTypeFor(dir, partName string) string {
+	content, err := os.ReadFile(filepath.Join(dir, "[Content_Types].xml"))
+	if err != nil {
+		return ""
+	}
+	contentStr := string(content)
+
+	for _, element := range findElements(contentStr, "Override") {
+		tag := element.StartTag(contentStr)
+		if strings.EqualFold(strings.TrimPrefix(tagAttr(tag, "PartName"), "/"), partName) {
+			return tagAttr(tag, "ContentType")
+		}
+	}
+
+	return defaultContentTypeFor(dir, strings.TrimPrefix(path.Ext(partName), "."))
+}
+
+// defaultContentTypeFor looks up the Default content type registered for a file extension
+func defaultContentTypeFor(dir, ext string) string {
+	content, err := os.ReadFile(filepath.Join(dir, "[Content_Types].xml"))
+	if err != nil {
+		return ""
+	}
+	contentStr := string(content)
+
+	for _, element := range findElements(contentStr, "Default") {
+		tag := element.StartTag(contentStr)
+		if strings.EqualFold(tagAttr(tag, "Extension"), ext) {
+			return tagAttr(tag, "ContentType")
+		}
+	}
+	return ""
+}
+
+// ensureContentType registers a part in [Content_Types].xml unless its extension default already matches
+func ensureContentType(dir, partName, contentType string) error {
+	if contentType == "" || contentTypeFor(dir, partName) == contentType {
+		return nil
+	}
+
+	fullPath := filepath.Join(dir, "[Content_Types].xml")
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to read [Content_Types].xml: %w", err)
+	}
+	contentStr := string(content)
+
+	entry := fmt.Sprintf(`<Override PartName="/%s" ContentType="%s"/>`, partName, contentType)
+	closeIdx := strings.LastIndex(contentStr, "</Types>")
+	if closeIdx == -1 {
+		return fmt.Errorf("malformed [Content_Types].xml")
+	}
+	contentStr = contentStr[:closeIdx] + entry + contentStr[closeIdx:]
+
+	return os.WriteFile(fullPath, []byte(contentStr), 0644)
+}
+
+// ensureDefaultContentType registers a file extension such as png in [Content_Types].xml
+func ensureDefaultContentType(dir, ext, contentType string) error {
+	if ext == "" || contentType == "" {
+		return nil
+	}
+
+	fullPath := filepath.Join(dir, "[Content_Types].xml")
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to read [Content_Types].xml: %w", err)
+	}
+	contentStr := string(content)
+
+	for _, element := range findElements(contentStr, "Default") {
+		if strings.EqualFold(tagAttr(element.StartTag(contentStr), "Extension"), ext) {
+			return nil
+		}
+	}
+
+	entry := fmt.Sprintf(`<Default Extension="%s" ContentType="%s"/>`, ext, contentType)
+	typesIdx := strings.Index(contentStr, "<Types")
+	if typesIdx == -1 {
+		return fmt.Errorf("malformed [Content_Types].xml")
+	}
+	insertAt := tagEnd(contentStr, typesIdx)
+	contentStr = contentStr[:insertAt] + entry + contentStr[insertAt:]
+
+	return os.WriteFile(fullPath, []byte(contentStr), 0644)
+}
+
+// removeContentType drops the Override entry for a part
+func removeContentType(dir, partName string) error {
+	fullPath := filepath.Join(dir, "[Content_Types].xml")
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to read [Content_Types].xml: %w", err)
+	}
+	contentStr := string(content)
+
+	elements := findElements(contentStr, "Override")
+	for i := len(elements) - 1; i >= 0; i-- {
+		tag := elements[i].StartTag(contentStr)
+		if strings.EqualFold(strings.TrimPrefix(tagAttr(tag, "PartName"), "/"), partName) {
+			contentStr = contentStr[:elements[i].Start] + contentStr[elements[i].End:]
+		}
+	}
+
+	return os.WriteFile(fullPath, []byte(contentStr), 0644)
+}
+
+// removeRelationships drops every relationship of the given type from a .rels part and returns their targets
+func removeRelationships(dir, relsPart, relType string) ([]string, error) {
+	fullPath, err := packagePath(dir, relsPart)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", relsPart, err)
+	}
+	contentStr := string(content)
+
+	var targets []string
+	elements := findElements(contentStr, "Relationship")
+	for i := len(elements) - 1; i >= 0; i-- {
+		tag := elements[i].StartTag(contentStr)
+		if tagAttr(tag, "Type") == relType {
+			targets = append(targets, tagAttr(tag, "Target"))
+			contentStr = contentStr[:elements[i].Start] + contentStr[elements[i].End:]
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	return targets, os.WriteFile(fullPath, []byte(contentStr), 0644)
+}
+
+// removeRelationshipByID drops the relationship with the given ID from a .rels part
+func removeRelationshipByID(dir, relsPart, id string) error {
+	content, err := readPackagePart(dir, relsPart)
+	if err != nil {
+		return err
+	}
+
+	elements := findElements(content, "Relationship")
+	for i := len(elements) - 1; i >= 0; i-- {
+		if tagAttr(elements[i].StartTag(content), "Id") == id {
+			content = content[:elements[i].Start] + content[elements[i].End:]
+		}
+	}
+	return writePackagePart(dir, relsPart, []byte(content))
+}
+
+// documentPart returns the first part the main document links to with relType
+func (dp *DocxProcessor) documentPart(relType string) (string, bool) {
+	rels, err := readRelationships(dp.tempDir, relsPathFor("word/document.xml"))
+	if err != nil {
+		return "", false
+	}
+	for _, rel := range rels {
+		if rel.Type == relType && rel.TargetMode != "External" {
+			return partTarget("word/document.xml", rel.Target)
+		}
+	}
+	return "", false
+}
+
+// readPart returns the content of a package part such as word/settings.xml
+func (dp *DocxProcessor) readPart(partName string) (string, error) {
+	return readPackagePart(dp.tempDir, partName)
+}
+
+// writePart stores a package part, creating its folder if needed
+func (dp *DocxProcessor) writePart(partName string, content []byte) error {
+	return writePackagePart(dp.tempDir, partName, content)
+}
+
+// uniquePartName returns partName, or partName with a numeric suffix if that part already exists
+func uniquePartName(dir, partName string) string {
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(partName))); os.IsNotExist(err) {
+		return partName
+	}
+
+	ext := path.Ext(partName)
+	base := strings.TrimSuffix(partName, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(candidate))); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// relativeTarget expresses targetPart relative to the folder of sourcePart
+func relativeTarget(sourcePart, targetPart string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(sourcePart)), filepath.FromSlash(targetPart))
+	if err != nil {
+		return "/" + targetPart
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,348 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Relationship and content types of presentation parts
+const (
+	RelTypeSlide      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide"
+	RelTypeNotesSlide = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide"
+
+	ContentTypeSlide = "application/vnd.openxmlformats-officedocument.presentationml.slide+xml"
+)
+
+// PptxProcessor fills {{placeholders}} in the slides of a .pptx presentation
+type PptxProcessor struct {
+	inputFile  string
+	outputFile string
+	tempDir    string
+}
+
+func NewPptxProcessor(inputFile, outputFile string) *PptxProcessor {
+	return &PptxProcessor{
+		inputFile:  inputFile,
+		outputFile: outputFile,
+		tempDir:    fmt.Sprintf("temp_pptx_%d", time.Now().UnixNano()),
+	}
+}
+
+func (pp *PptxProcessor) UnzipPptx() error {
+	return unzipPackage(pp.inputFile, pp.tempDir)
+}
+
+func (pp *PptxProcessor) ReZipPptx() error {
+	return zipPackage(pp.tempDir, pp.outputFile)
+}
+
+func (pp *PptxProcessor) Cleanup() {
+	os.RemoveAll(pp.tempDir)
+}
+
+// presentation holds the presentation part and its slides in show order
+type presentation struct {
+	part    string
+	content string
+	slides  []presentationSlide
+}
+
+// presentationSlide is a p:sldId entry of the slide list and the slide part it points to
+type presentationSlide struct {
+	id    string
+	relID string
+	part  string
+}
+
+func (pp *PptxProcessor) openPresentation() (*presentation, error) {
+	pres := &presentation{part: "ppt/presentation.xml"}
+	rootRels, err := readRelationships(pp.tempDir, "_rels/.rels")
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rootRels {
+		if part, ok := partTarget("", rel.Target); ok && rel.Type == RelTypeOfficeDocument {
+			pres.part = part
+		}
+	}
+
+	content, err := readPackagePart(pp.tempDir, pres.part)
+	if err != nil {
+		return nil, err
+	}
+	pres.content = content
+
+	rels, err := readRelationships(pp.tempDir, relsPathFor(pres.part))
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels {
+		if part, ok := partTarget(pres.part, rel.Target); ok && rel.Type == RelTypeSlide {
+			targets[rel.ID] = part
+		}
+	}
+
+	for _, sldID := range findElements(content, "p:sldId") {
+		tag := sldID.StartTag(content)
+		relID := tagAttr(tag, "r:id")
+		if target, ok := targets[relID]; ok {
+			pres.slides = append(pres.slides, presentationSlide{id: tagAttr(tag, "id"), relID: relID, part: target})
+		}
+	}
+	return pres, nil
+}
+
+// ExtractPlaceholders returns the distinct placeholders in the text of the slides, including
+// shapes, tables and grouped shapes, slide by slide
+func (pp *PptxProcessor) ExtractPlaceholders() ([]string, error) {
+	pres, err := pp.openPresentation()
+	if err != nil {
+		return nil, err
+	}
+
+	var placeholders []string
+	seen := make(map[string]bool)
+	for _, slide := range pres.slides {
+		content, err := readPackagePart(pp.tempDir, slide.part)
+		if err != nil {
+			return nil, err
+		}
+		for _, placeholder := range slidePlaceholders(content) {
+			if !seen[placeholder] {
+				placeholders = append(placeholders, placeholder)
+				seen[placeholder] = true
+			}
+		}
+	}
+	return placeholders, nil
+}
+
+// FillSlides replaces placeholders with values keyed by placeholder, also where a placeholder
+// is split across runs; the value takes the formatting of the placeholder's first character.
+// A slide with placeholders whose value is a []interface{} is duplicated once per item, each
+// copy taking its item, and a slide whose arrays are all empty is removed. Placeholders missing
+// from values are left as they are.
+func (pp *PptxProcessor) FillSlides(values map[string]interface{}) error {
+	pres, err := pp.openPresentation()
+	if err != nil {
+		return err
+	}
+
+	nextID := 256 // Slide ids start at 256
+	for _, sldID := range findElements(pres.content, "p:sldId") {
+		if id, err := strconv.Atoi(tagAttr(sldID.StartTag(pres.content), "id")); err == nil && id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	for _, slide := range pres.slides {
+		content, err := readPackagePart(pp.tempDir, slide.part)
+		if err != nil {
+			return err
+		}
+
+		// The longest array decides how many copies the slide gets
+		copies, repeated := 1, false
+		for _, placeholder := range slidePlaceholders(content) {
+			if items, isArray := values[placeholder].([]interface{}); isArray {
+				if !repeated {
+					copies, repeated = len(items), true
+				}
+				copies = max(copies, len(items))
+			}
+		}
+		if copies == 0 {
+			fmt.Printf("[DEBUG] Removing slide %s, its arrays are empty\n", slide.part)
+			if err := pp.removeSlide(pres, slide); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := writePackagePart(pp.tempDir, slide.part, []byte(fillSlide(content, values, 0))); err != nil {
+			return err
+		}
+
+		// Copies follow the original in the show, in item order
+		after := slide.id
+		for item := 1; item < copies; item++ {
+			id := strconv.Itoa(nextID)
+			nextID++
+			if err := pp.duplicateSlide(pres, slide, after, id, fillSlide(content, values, item)); err != nil {
+				return err
+			}
+			after = id
+		}
+		if copies > 1 {
+			fmt.Printf("[DEBUG] Repeated slide %s %d times\n", slide.part, copies)
+		}
+	}
+
+	return writePackagePart(pp.tempDir, pres.part, []byte(pres.content))
+}
+
+// slidePlaceholders returns the distinct placeholders in the paragraphs of a slide
+func slidePlaceholders(content string) []string {
+	var placeholders []string
+	seen := make(map[string]bool)
+	for _, paragraph := range findElements(content, "a:p") {
+		text := ""
+		for _, t := range findElementsIn(content, paragraph.InnerStart, paragraph.InnerEnd, "a:t") {
+			text += unescapeXMLText(t.Inner(content))
+		}
+		for _, placeholder := range placeholderSpanPattern.FindAllString(text, -1) {
+			if !seen[placeholder] && !IsInclude(placeholder) {
+				placeholders = append(placeholders, placeholder)
+				seen[placeholder] = true
+			}
+		}
+	}
+	return placeholders
+}
+
+// fillSlide replaces the placeholders of a slide with the values for array item number item.
+// Placeholders may span the a:t elements of one paragraph.
+func fillSlide(content string, values map[string]interface{}, item int) string {
+	paragraphs := findElements(content, "a:p")
+	for i := len(paragraphs) - 1; i >= 0; i-- {
+		paragraph := paragraphs[i]
+		var segments []textSegment
+		text := ""
+		for _, t := range findElementsIn(content, paragraph.InnerStart, paragraph.InnerEnd, "a:t") {
+			segment := textSegment{element: t, text: unescapeXMLText(t.Inner(content))}
+			segments = append(segments, segment)
+			text += segment.text
+		}
+
+		changed := false
+		seen := make(map[string]bool)
+		for _, placeholder := range placeholderSpanPattern.FindAllString(text, -1) {
+			if seen[placeholder] {
+				continue
+			}
+			seen[placeholder] = true
+			if value, ok := itemValue(values, placeholder, item); ok {
+				replaceInSegments(segments, placeholder, cellText(value))
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		// Rewrite from the end so earlier offsets stay valid
+		for j := len(segments) - 1; j >= 0; j-- {
+			t := segments[j].element
+			if segments[j].text == unescapeXMLText(t.Inner(content)) {
+				continue
+			}
+			startTag := strings.TrimSuffix(strings.TrimSuffix(t.StartTag(content), "/>"), " ")
+			if !strings.HasSuffix(startTag, ">") {
+				startTag += ">"
+			}
+			content = content[:t.Start] + startTag + EscapeXMLText(segments[j].text) + "</a:t>" + content[t.End:]
+		}
+	}
+	return content
+}
+
+// duplicateSlide adds a slide with content after the slide list entry with id after. The copy
+// shares the original's layout and media; speaker notes stay with the original.
+func (pp *PptxProcessor) duplicateSlide(pres *presentation, slide presentationSlide, after, id, content string) error {
+	part := nextSlidePart(pp.tempDir, slide.part)
+	if err := writePackagePart(pp.tempDir, part, []byte(content)); err != nil {
+		return err
+	}
+	if err := ensureContentType(pp.tempDir, part, ContentTypeSlide); err != nil {
+		return err
+	}
+
+	rels, err := readPackagePart(pp.tempDir, relsPathFor(slide.part))
+	if err == nil {
+		elements := findElements(rels, "Relationship")
+		for i := len(elements) - 1; i >= 0; i-- {
+			if tagAttr(elements[i].StartTag(rels), "Type") == RelTypeNotesSlide {
+				rels = rels[:elements[i].Start] + rels[elements[i].End:]
+			}
+		}
+		if err := writePackagePart(pp.tempDir, relsPathFor(part), []byte(rels)); err != nil {
+			return err
+		}
+	}
+
+	relID, err := addRelationship(pp.tempDir, relsPathFor(pres.part), RelTypeSlide, relativeTarget(pres.part, part), "")
+	if err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf(`<p:sldId id="%s" r:id="%s"/>`, id, relID)
+	if !insertAfterID(&pres.content, "p:sldId", after, entry) {
+		return fmt.Errorf("slide %s is missing from the slide list", slide.part)
+	}
+	// Presentations with sections list every slide in one of them
+	insertAfterID(&pres.content, "p14:sldId", after, fmt.Sprintf(`<p14:sldId id="%s"/>`, id))
+	return nil
+}
+
+// removeSlide drops a slide and its speaker notes from the presentation
+func (pp *PptxProcessor) removeSlide(pres *presentation, slide presentationSlide) error {
+	for _, name := range []string{"p:sldId", "p14:sldId"} {
+		elements := findElements(pres.content, name)
+		for i := len(elements) - 1; i >= 0; i-- {
+			if tagAttr(elements[i].StartTag(pres.content), "id") == slide.id {
+				pres.content = pres.content[:elements[i].Start] + pres.content[elements[i].End:]
+			}
+		}
+	}
+	if err := removeRelationshipByID(pp.tempDir, relsPathFor(pres.part), slide.relID); err != nil {
+		return err
+	}
+
+	rels, err := readRelationships(pp.tempDir, relsPathFor(slide.part))
+	if err != nil {
+		return err
+	}
+	parts := []string{slide.part}
+	for _, rel := range rels {
+		if part, ok := partTarget(slide.part, rel.Target); ok && rel.Type == RelTypeNotesSlide {
+			parts = append(parts, part)
+		}
+	}
+	for _, part := range parts {
+		if err := removeContentType(pp.tempDir, part); err != nil {
+			return err
+		}
+		if err := removePackagePart(pp.tempDir, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextSlidePart returns the first free slideN.xml name in the folder of slidePart
+func nextSlidePart(dir, slidePart string) string {
+	folder := slidePart[:strings.LastIndex(slidePart, "/")+1]
+	for n := 1; ; n++ {
+		part := fmt.Sprintf("%sslide%d.xml", folder, n)
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(part))); os.IsNotExist(err) {
+			return part
+		}
+	}
+}
+
+// insertAfterID inserts entry after the element name whose id attribute is id and reports
+// whether it was found
+func insertAfterID(content *string, name, id, entry string) bool {
+	for _, element := range findElements(*content, name) {
+		if tagAttr(element.StartTag(*content), "id") == id {
+			*content = (*content)[:element.End] + entry + (*content)[element.End:]
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RelTypeCoreProps = "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties"
+
+	ContentTypeCoreProps = "application/vnd.openxmlformats-package.core-properties+xml"
+
+	// customPropertyFmtID is the format ID Word uses for user-defined properties
+	customPropertyFmtID = "{D5CDD505-2E9C-101B-9397-08002B2CF9AE}"
+)
+
+// CoreProperties are the docProps/core.xml fields the processor can set; empty fields keep the template's value
+type CoreProperties struct {
+	Title          string
+	Subject        string
+	Creator        string
+	Keywords       string
+	Description    string
+	Category       string
+	LastModifiedBy string
+	Created        time.Time
+	Modified       time.Time
+}
+
+// SetCoreProperties writes title, author and the other core properties, creating docProps/core.xml if the package has none
+func (dp *DocxProcessor) SetCoreProperties(props CoreProperties) error {
+	partName, err := dp.packagePart(RelTypeCoreProps, "docProps/core.xml", ContentTypeCoreProps,
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+
+			`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" `+
+			`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" `+
+			`xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></cp:coreProperties>`)
+	if err != nil {
+		return err
+	}
+
+	contentStr, err := dp.readPart(partName)
+	if err != nil {
+		return err
+	}
+
+	rootIdx := strings.Index(contentStr, "<cp:coreProperties")
+	if rootIdx == -1 {
+		return fmt.Errorf("malformed %s", partName)
+	}
+	rootEnd := tagEnd(contentStr, rootIdx)
+	rootTag := mergeNamespaces(contentStr[rootIdx:rootEnd],
+		`<cp:coreProperties xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`)
+	contentStr = contentStr[:rootIdx] + rootTag + contentStr[rootEnd:]
+
+	fields := []struct {
+		element string
+		value   string
+	}{
+		{"dc:title", props.Title},
+		{"dc:subject", props.Subject},
+		{"dc:creator", props.Creator},
+		{"cp:keywords", props.Keywords},
+		{"dc:description", props.Description},
+		{"cp:category", props.Category},
+		{"cp:lastModifiedBy", props.LastModifiedBy},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			contentStr = setChildElement(contentStr, "cp:coreProperties", field.element, "", EscapeXMLText(field.value))
+		}
+	}
+
+	dateAttr := ` xsi:type="dcterms:W3CDTF"`
+	if !props.Created.IsZero() {
+		contentStr = setChildElement(contentStr, "cp:coreProperties", "dcterms:created", dateAttr, props.Created.UTC().Format(time.RFC3339))
+	}
+	if !props.Modified.IsZero() {
+		contentStr = setChildElement(contentStr, "cp:coreProperties", "dcterms:modified", dateAttr, props.Modified.UTC().Format(time.RFC3339))
+	}
+
+	return dp.writePart(partName, []byte(contentStr))
+}
+
+// SetCustomProperties adds or replaces user-defined text properties in docProps/custom.xml
+func (dp *DocxProcessor) SetCustomProperties(props map[string]string) error {
+	if len(props) == 0 {
+		return nil
+	}
+
+	partName, err := dp.packagePart(RelTypeCustomProps, "docProps/custom.xml", ContentTypeCustomProps,
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"+
+			`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" `+
+			`xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes"></Properties>`)
+	if err != nil {
+		return err
+	}
+
+	contentStr, err := dp.readPart(partName)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Drop existing properties with the same names so each is written once with the new value
+	elements := findElements(contentStr, "property")
+	for i := len(elements) - 1; i >= 0; i-- {
+		name := unescapeXMLText(tagAttr(elements[i].StartTag(contentStr), "name"))
+		if _, replaced := props[name]; replaced {
+			contentStr = contentStr[:elements[i].Start] + contentStr[elements[i].End:]
+		}
+	}
+
+	// Property IDs start at 2 and must be unique within the part
+	pid := maxAttrValue(contentStr, "property", "pid")
+	if pid < 1 {
+		pid = 1
+	}
+
+	var sb strings.Builder
+	for _, name := range names {
+		pid++
+		sb.WriteString(fmt.Sprintf(`<property fmtid="%s" pid="%d" name="%s"><vt:lpwstr>%s</vt:lpwstr></property>`,
+			customPropertyFmtID, pid, EscapeXMLText(name), EscapeXMLText(props[name])))
+	}
+
+	closeIdx := strings.LastIndex(contentStr, "</Properties>")
+	if closeIdx == -1 {
+		return fmt.Errorf("malformed %s", partName)
+	}
+	contentStr = contentStr[:closeIdx] + sb.String() + contentStr[closeIdx:]
+
+	return dp.writePart(partName, []byte(contentStr))
+}
+
+// EmbedCustomXML stores an XML document as a customXml data part linked from the main document,
+// where Word keeps it and other tools can read it back. It returns the part name.
+func (dp *DocxProcessor) EmbedCustomXML(data []byte, namespace string) (string, error) {
+	itemPart := uniquePartName(dp.tempDir, "customXml/item1.xml")
+	base := strings.TrimSuffix(path.Base(itemPart), ".xml")
+	propsPart := path.Join("customXml", strings.Replace(base, "item", "itemProps", 1)+".xml")
+
+	itemProps := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>`+"\n"+
+		`<ds:datastoreItem ds:itemID="{%s}" xmlns:ds="http://schemas.openxmlformats.org/officeDocument/2006/customXml">`+
+		`<ds:schemaRefs>%s</ds:schemaRefs></ds:datastoreItem>`,
+		strings.ToUpper(uuid.New().String()), schemaRef(namespace))
+
+	if err := dp.writePart(itemPart, data); err != nil {
+		return "", err
+	}
+	if err := dp.writePart(propsPart, []byte(itemProps)); err != nil {
+		return "", err
+	}
+
+	if _, err := addRelationship(dp.tempDir, relsPathFor(itemPart), RelTypeCustomXMLProps, path.Base(propsPart), ""); err != nil {
+		return "", err
+	}
+	if err := ensureContentType(dp.tempDir, propsPart, ContentTypeCustomXMLProps); err != nil {
+		return "", err
+	}
+	if err := ensureDefaultContentType(dp.tempDir, "xml", "application/xml"); err != nil {
+		return "", err
+	}
+	if _, err := addRelationship(dp.tempDir, relsPathFor("word/document.xml"), RelTypeCustomXML, relativeTarget("word/document.xml", itemPart), ""); err != nil {
+		return "", err
+	}
+
+	return itemPart, nil
+}
+
+func schemaRef(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return fmt.Sprintf(`<ds:schemaRef ds:uri="%s"/>`, EscapeXMLText(namespace))
+}
+
+// packagePart returns the package-level part linked with relType from _rels/.rels,
+// creating it from emptyContent when the package does not have one yet
+func (dp *DocxProcessor) packagePart(relType, defaultName, contentType, emptyContent string) (string, error) {
+	rels, err := readRelationships(dp.tempDir, "_rels/.rels")
+	if err != nil {
+		return "", err
+	}
+	outside := false
+	for _, rel := range rels {
+		if rel.Type != relType {
+			continue
+		}
+		partName, ok := partTarget("", rel.Target)
+		if !ok {
+			outside = true
+			continue
+		}
+		if _, err := dp.readPart(partName); err == nil {
+			return partName, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// The relationship points at a missing part; recreate it there
+		if err := dp.writePart(partName, []byte(emptyContent)); err != nil {
+			return "", err
+		}
+		return partName, ensureContentType(dp.tempDir, partName, contentType)
+	}
+
+	// A target outside the package is dropped so the package links one part of this type
+	if outside {
+		if _, err := removeRelationships(dp.tempDir, "_rels/.rels", relType); err != nil {
+			return "", err
+		}
+	}
+	partName := uniquePartName(dp.tempDir, defaultName)
+	if err := dp.writePart(partName, []byte(emptyContent)); err != nil {
+		return "", err
+	}
+	if _, err := addRelationship(dp.tempDir, "_rels/.rels", relType, partName, ""); err != nil {
+		return "", err
+	}
+	return partName, ensureContentType(dp.tempDir, partName, contentType)
+}
+
+// setChildElement replaces the text of the first child element called name inside root,
+// appending the element before root's end tag when it does not exist
+func setChildElement(content, root, name, attrs, value string) string {
+	element := "<" + name + attrs + ">" + value + "</" + name + ">"
+
+	if existing := findElements(content, name); len(existing) > 0 {
+		return content[:existing[0].Start] + element + content[existing[0].End:]
+	}
+
+	closeIdx := strings.LastIndex(content, "</"+root+">")
+	if closeIdx == -1 {
+		return content
+	}
+	return content[:closeIdx] + element + content[closeIdx:]
+}
@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	RelTypeSettings     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/settings"
+	ContentTypeSettings = "application/vnd.openxmlformats-officedocument.wordprocessingml.settings+xml"
+
+	// Protection modes accepted by ProtectDocument
+	ProtectionReadOnly = "readOnly"
+	ProtectionForms    = "forms"
+
+	// protectionSpinCount matches what Word writes for SHA-512 protection hashes
+	protectionSpinCount = 100000
+	// protectionAlgorithmSID identifies SHA-512 in w:cryptAlgorithmSid
+	protectionAlgorithmSID = 14
+)
+
+// settingsBeforeProtection lists the w:settings children that the schema places before w:documentProtection.
+// Word rejects settings.xml when its children are out of order.
+var settingsBeforeProtection = []string{
+	"w:writeProtection", "w:view", "w:zoom", "w:removePersonalInformation", "w:removeDateAndTime",
+	"w:doNotDisplayPageBoundaries", "w:displayBackgroundShape", "w:printPostScriptOverText",
+	"w:printFractionalCharacterWidth", "w:printFormsData", "w:embedTrueTypeFonts", "w:embedSystemFonts",
+	"w:saveSubsetFonts", "w:saveFormsData", "w:mirrorMargins", "w:alignBordersAndEdges",
+	"w:bordersDoNotSurroundHeader", "w:bordersDoNotSurroundFooter", "w:gutterAtTop", "w:hideSpellingErrors",
+	"w:hideGrammaticalErrors", "w:activeWritingStyle", "w:proofState", "w:formsDesign", "w:attachedTemplate",
+	"w:linkStyles", "w:stylePaneFormatFilter", "w:stylePaneSortMethod", "w:documentType", "w:mailMerge",
+	"w:revisionView", "w:trackRevisions", "w:doNotTrackMoves", "w:doNotTrackFormatting",
+}
+
+// Tables of the legacy Word password key derivation (ECMA-376 Part 4, 2.15.1.32)
+var (
+	protectionInitialCodes = []uint16{
+		0xE1F0, 0x1D0F, 0xCC9C, 0x84C0, 0x110C, 0x0E10, 0xF1CE, 0x313E,
+		0x1872, 0xE139, 0xD40F, 0x84F9, 0x280C, 0xA96A, 0x4EC3,
+	}
+	protectionEncryptionMatrix = [15][7]uint16{
+		{0xAEFC, 0x4DD9, 0x9BB2, 0x2745, 0x4E8A, 0x9D14, 0x2A09},
+		{0x7B61, 0xF6C2, 0xFDA5, 0xEB6B, 0xC6F7, 0x9DCF, 0x2BBF},
+		{0x4563, 0x8AC6, 0x05AD, 0x0B5A, 0x16B4, 0x2D68, 0x5AD0},
+		{0x0375, 0x06EA, 0x0DD4, 0x1BA8, 0x3750, 0x6EA0, 0xDD40},
+		{0xD849, 0xA0B3, 0x5147, 0xA28E, 0x553D, 0xAA7A, 0x44D5},
+		{0x6F45, 0xDE8A, 0xAD35, 0x4A4B, 0x9496, 0x390D, 0x721A},
+		{0xEB23, 0xC667, 0x9CEF, 0x29FF, 0x53FE, 0xA7FC, 0x5FD9},
+		{0x47D3, 0x8FA6, 0x0F6D, 0x1EDA, 0x3DB4, 0x7B68, 0xF6D0},
+		{0xB861, 0x60E3, 0xC1C6, 0x93AD, 0x377B, 0x6EF6, 0xDDEC},
+		{0x45A0, 0x8B40, 0x06A1, 0x0D42, 0x1A84, 0x3508, 0x6A10},
+		{0xAA51, 0x4483, 0x8906, 0x022D, 0x045A, 0x08B4, 0x1168},
+		{0x76B4, 0xED68, 0xCAF1, 0x85C3, 0x1BA7, 0x374E, 0x6E9C},
+		{0x3730, 0x6E60, 0xDCC0, 0xA9A1, 0x4363, 0x86C6, 0x1DAD},
+		{0x3331, 0x6662, 0xCCC4, 0x89A9, 0x0373, 0x06E6, 0x0DCC},
+		{0x1021, 0x2042, 0x4084, 0x8108, 0x1231, 0x2462, 0x48C4},
+	}
+)
+
+// ProtectDocument enforces read-only or forms-only editing through w:documentProtection in settings.xml.
+// With a password, Word asks for it before protection can be switched off; without one anyone can stop protection.
+func (dp *DocxProcessor) ProtectDocument(mode, password string) error {
+	if mode != ProtectionReadOnly && mode != ProtectionForms {
+		return fmt.Errorf("unsupported protection mode %q", mode)
+	}
+
+	partName, err := dp.settingsPart()
+	if err != nil {
+		return err
+	}
+	contentStr, err := dp.readPart(partName)
+	if err != nil {
+		return err
+	}
+
+	element := fmt.Sprintf(`<w:documentProtection w:edit="%s" w:enforcement="1"`, mode)
+	if password != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		hash := protectionHash(password, salt, protectionSpinCount)
+		element += fmt.Sprintf(` w:cryptProviderType="rsaAES" w:cryptAlgorithmClass="hash" w:cryptAlgorithmType="typeAny"`+
+			` w:cryptAlgorithmSid="%d" w:cryptSpinCount="%d" w:hash="%s" w:salt="%s"`,
+			protectionAlgorithmSID, protectionSpinCount,
+			base64.StdEncoding.EncodeToString(hash), base64.StdEncoding.EncodeToString(salt))
+	}
+	element += "/>"
+
+	// Replace any protection the template already had
+	existing := findElements(contentStr, "w:documentProtection")
+	for i := len(existing) - 1; i >= 0; i-- {
+		contentStr = contentStr[:existing[i].Start] + contentStr[existing[i].End:]
+	}
+
+	rootIdx := strings.Index(contentStr, "<w:settings")
+	if rootIdx == -1 {
+		return fmt.Errorf("malformed %s", partName)
+	}
+	insertAt := tagEnd(contentStr, rootIdx)
+	for _, name := range settingsBeforeProtection {
+		for _, e := range findElements(contentStr, name) {
+			if e.End > insertAt {
+				insertAt = e.End
+			}
+		}
+	}
+	contentStr = contentStr[:insertAt] + element + contentStr[insertAt:]
+
+	return dp.writePart(partName, []byte(contentStr))
+}
+
+// settingsPart returns word/settings.xml, creating it when the document has no settings part
+func (dp *DocxProcessor) settingsPart() (string, error) {
+	if partName, ok := dp.documentPart(RelTypeSettings); ok {
+		return partName, nil
+	}
+
+	partName := uniquePartName(dp.tempDir, "word/settings.xml")
+	content := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<w:settings xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"></w:settings>`
+	if err := dp.writePart(partName, []byte(content)); err != nil {
+		return "", err
+	}
+	if _, err := addRelationship(dp.tempDir, relsPathFor("word/document.xml"), RelTypeSettings, relativeTarget("word/document.xml", partName), ""); err != nil {
+		return "", err
+	}
+	return partName, ensureContentType(dp.tempDir, partName, ContentTypeSettings)
+}
+
+// protectionHash computes the w:hash value Word checks when protection is removed: the password is reduced
+// to the legacy 32-bit key, whose hex form is hashed with the salt and then re-hashed spinCount times
+func protectionHash(password string, salt []byte, spinCount int) []byte {
+	key := legacyPasswordKey(password)
+
+	var keyHex strings.Builder
+	for _, b := range key {
+		keyHex.WriteString(strings.ToUpper(fmt.Sprintf("%x", b)))
+	}
+	var keyBytes []byte
+	for _, unit := range utf16.Encode([]rune(keyHex.String())) {
+		keyBytes = binary.LittleEndian.AppendUint16(keyBytes, unit)
+	}
+
+	sum := sha512.Sum512(append(append([]byte{}, salt...), keyBytes...))
+	hash := sum[:]
+	iterator := make([]byte, 4)
+	for i := 0; i < spinCount; i++ {
+		binary.LittleEndian.PutUint32(iterator, uint32(i))
+		sum = sha512.Sum512(append(append([]byte{}, iterator...), hash...))
+		hash = sum[:]
+	}
+	return hash
+}
+
+// legacyPasswordKey derives the 4-byte key of the pre-2007 Word protection algorithm, low byte first
+func legacyPasswordKey(password string) []byte {
+	runes := []rune(password)
+	if len(runes) > 15 {
+		runes = runes[:15]
+	}
+	if len(runes) == 0 {
+		return make([]byte, 4)
+	}
+
+	chars := make([]byte, len(runes))
+	for i, r := range runes {
+		chars[i] = byte(r & 0xFF)
+		if chars[i] == 0 {
+			chars[i] = byte((r & 0xFF00) >> 8)
+		}
+	}
+
+	high := protectionInitialCodes[len(chars)-1]
+	for i, ch := range chars {
+		row := 15 - len(chars) + i
+		for bit := 0; bit < 7; bit++ {
+			if ch&(1<<bit) != 0 {
+				high ^= protectionEncryptionMatrix[row][bit]
+			}
+		}
+	}
+
+	var low uint16
+	for i := len(chars) - 1; i >= 0; i-- {
+		low = (((low >> 14) & 0x0001) | ((low << 1) & 0x7FFF)) ^ uint16(chars[i])
+	}
+	low = (((low >> 14) & 0x0001) | ((low << 1) & 0x7FFF)) ^ uint16(len(chars)) ^ 0xCE4B
+
+	key := make([]byte, 4)
+	binary.LittleEndian.PutUint32(key, uint32(high)<<16|uint32(low))
+	return key
+}
@@ -0,0 +1,286 @@
+package processor
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RelTypeComments           = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments"
+	RelTypeCommentsExtended   = "http://schemas.microsoft.com/office/2011/relationships/commentsExtended"
+	RelTypeCommentsIds        = "http://schemas.microsoft.com/office/2016/09/relationships/commentsIds"
+	RelTypeCommentsExtensible = "http://schemas.microsoft.com/office/2018/08/relationships/commentsExtensible"
+)
+
+// formatChangeElements record the previous formatting of changed properties; accepting keeps the current formatting
+var formatChangeElements = []string{
+	"w:rPrChange", "w:pPrChange", "w:sectPrChange", "w:tblPrChange", "w:tblPrExChange",
+	"w:trPrChange", "w:tcPrChange", "w:tblGridChange", "w:numberingChange",
+}
+
+// revisionMarkers are range and cell markers that carry no content of their own
+var revisionMarkers = []string{
+	"w:moveFromRangeStart", "w:moveFromRangeEnd", "w:moveToRangeStart", "w:moveToRangeEnd",
+	"w:customXmlInsRangeStart", "w:customXmlInsRangeEnd", "w:customXmlDelRangeStart", "w:customXmlDelRangeEnd",
+	"w:customXmlMoveFromRangeStart", "w:customXmlMoveFromRangeEnd", "w:customXmlMoveToRangeStart", "w:customXmlMoveToRangeEnd",
+	"w:cellIns", "w:cellMerge",
+}
+
+// RevisionReport counts the tracked changes and comments left in a document
+type RevisionReport struct {
+	Insertions    int  `json:"insertions"`
+	Deletions     int  `json:"deletions"`
+	Moves         int  `json:"moves"`
+	FormatChanges int  `json:"format_changes"`
+	Comments      int  `json:"comments"`
+	Accepted      bool `json:"accepted"` // Changes were accepted and comments removed before the template was stored
+}
+
+// HasRevisions reports whether any tracked change or comment was found
+func (r RevisionReport) HasRevisions() bool {
+	return r.Insertions+r.Deletions+r.Moves+r.FormatChanges+r.Comments > 0
+}
+
+// storyParts returns the parts that hold document text: the body, headers, footers, footnotes and endnotes
+func (dp *DocxProcessor) storyParts() []string {
+	parts := []string{"word/document.xml"}
+	entries, err := os.ReadDir(filepath.Join(dp.tempDir, "word"))
+	if err != nil {
+		return parts
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".xml" {
+			continue
+		}
+		if strings.HasPrefix(name, "header") || strings.HasPrefix(name, "footer") || name == "footnotes.xml" || name == "endnotes.xml" {
+			parts = append(parts, "word/"+name)
+		}
+	}
+	return parts
+}
+
+// InspectRevisions counts tracked insertions, deletions, moves, formatting changes and comments
+func (dp *DocxProcessor) InspectRevisions() (RevisionReport, error) {
+	var report RevisionReport
+	commentRefs := 0
+
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return report, err
+		}
+		report.Insertions += len(findElements(content, "w:ins")) + len(findElements(content, "w:cellIns"))
+		report.Deletions += len(findElements(content, "w:del")) + len(findElements(content, "w:cellDel"))
+		report.Moves += len(findElements(content, "w:moveFrom")) + len(findElements(content, "w:moveTo"))
+		for _, name := range formatChangeElements {
+			report.FormatChanges += len(findElements(content, name))
+		}
+		commentRefs += len(findElements(content, "w:commentReference"))
+	}
+
+	report.Comments = commentRefs
+	if partName, ok := dp.documentPart(RelTypeComments); ok {
+		if content, err := dp.readPart(partName); err == nil {
+			if count := len(findElements(content, "w:comment")); count > report.Comments {
+				report.Comments = count
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// AcceptAllChanges applies every tracked change as Word's "Accept All Changes" does: inserted and moved-to
+// content stays, deleted and moved-from content goes, and recorded previous formatting is dropped
+func (dp *DocxProcessor) AcceptAllChanges() error {
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return err
+		}
+
+		updated := acceptChanges(content)
+		if updated != content {
+			if err := dp.writePart(part, []byte(updated)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func acceptChanges(content string) string {
+	for _, name := range formatChangeElements {
+		content = removeElements(content, name)
+	}
+
+	// Deleted table rows and cells
+	content = removeEnclosingIf(content, "w:trPr", "w:tr", func(trPr, _ string) bool {
+		return len(findElements(trPr, "w:del")) > 0
+	})
+	content = removeEnclosingIf(content, "w:cellDel", "w:tc", func(_, _ string) bool { return true })
+
+	content = mergeDeletedParagraphMarks(content)
+
+	content = removeElements(content, "w:del")
+	content = removeElements(content, "w:moveFrom")
+	for _, name := range revisionMarkers {
+		content = removeElements(content, name)
+	}
+
+	content = unwrapElements(content, "w:ins")
+	content = unwrapElements(content, "w:moveTo")
+
+	return content
+}
+
+// mergeDeletedParagraphMarks joins a paragraph whose mark was deleted with the paragraph after it.
+// The merged paragraph keeps the properties of the following paragraph, whose mark survives.
+func mergeDeletedParagraphMarks(content string) string {
+	paragraphs := findElements(content, "w:p")
+	for i := len(paragraphs) - 1; i >= 0; i-- {
+		p := paragraphs[i]
+		pPr, hasPPr := directChild(content, p, "w:pPr")
+		if !hasPPr {
+			continue
+		}
+		rPr, hasRPr := directChild(content, pPr, "w:rPr")
+		if !hasRPr || len(findElementsIn(content, rPr.InnerStart, rPr.InnerEnd, "w:del")) == 0 {
+			continue
+		}
+
+		nextStart := p.End
+		for nextStart < len(content) && strings.ContainsRune(" \t\r\n", rune(content[nextStart])) {
+			nextStart++
+		}
+		if nextStart >= len(content) || !isTagAt(content, nextStart, "w:p") {
+			continue // The last paragraph of a cell or body cannot be merged away
+		}
+		next, ok := matchElement(content, nextStart, len(content), "w:p")
+		if !ok || next.InnerStart == next.End {
+			continue
+		}
+
+		nextPPr := ""
+		nextBodyStart := next.InnerStart
+		if nextProps, ok := directChild(content, next, "w:pPr"); ok {
+			nextPPr = nextProps.Outer(content)
+			nextBodyStart = nextProps.End
+		}
+
+		merged := next.StartTag(content) + nextPPr +
+			content[pPr.End:p.InnerEnd] +
+			content[nextBodyStart:next.InnerEnd] + "</w:p>"
+		content = content[:p.Start] + merged + content[next.End:]
+	}
+	return content
+}
+
+// directChild returns the first child element called name, looking only at the start of the parent's content
+func directChild(content string, parent xmlElement, name string) (xmlElement, bool) {
+	pos := parent.InnerStart
+	for pos < parent.InnerEnd && strings.ContainsRune(" \t\r\n", rune(content[pos])) {
+		pos++
+	}
+	if pos >= parent.InnerEnd || !isTagAt(content, pos, name) {
+		return xmlElement{}, false
+	}
+	return matchElement(content, pos, parent.InnerEnd, name)
+}
+
+// removeElements deletes every element called name together with its content
+func removeElements(content, name string) string {
+	elements := outermostElements(findElements(content, name))
+	for i := len(elements) - 1; i >= 0; i-- {
+		content = content[:elements[i].Start] + content[elements[i].End:]
+	}
+	return content
+}
+
+// unwrapElements replaces every element called name with its content
+func unwrapElements(content, name string) string {
+	type span struct{ start, end int }
+	var tags []span
+	for _, e := range findElements(content, name) {
+		if e.InnerStart == e.End {
+			tags = append(tags, span{e.Start, e.End})
+			continue
+		}
+		tags = append(tags, span{e.Start, e.InnerStart}, span{e.InnerEnd, e.End})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].start > tags[j].start })
+
+	for _, tag := range tags {
+		content = content[:tag.start] + content[tag.end:]
+	}
+	return content
+}
+
+// removeEnclosingIf removes the innermost container around every marker element for which match,
+// given the marker and the container XML, returns true
+func removeEnclosingIf(content, marker, container string, match func(marker, container string) bool) string {
+	var targets []xmlElement
+	for _, e := range findElements(content, marker) {
+		enclosing, ok := enclosingElement(content, e.Start, container)
+		if ok && match(e.Outer(content), enclosing.Outer(content)) {
+			targets = append(targets, enclosing)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Start < targets[j].Start })
+	targets = outermostElements(targets)
+
+	for i := len(targets) - 1; i >= 0; i-- {
+		content = content[:targets[i].Start] + content[targets[i].End:]
+	}
+	return content
+}
+
+// StripComments removes comment anchors and references from the text and deletes the comment parts
+func (dp *DocxProcessor) StripComments() error {
+	for _, part := range dp.storyParts() {
+		content, err := dp.readPart(part)
+		if err != nil {
+			return err
+		}
+
+		updated := removeElements(content, "w:commentRangeStart")
+		updated = removeElements(updated, "w:commentRangeEnd")
+		// Reference runs only hold the comment mark; drop the mark alone when a run also has text
+		updated = removeEnclosingIf(updated, "w:commentReference", "w:r", func(_, run string) bool {
+			return len(findElements(run, "w:t")) == 0
+		})
+		updated = removeElements(updated, "w:commentReference")
+
+		if updated != content {
+			if err := dp.writePart(part, []byte(updated)); err != nil {
+				return err
+			}
+		}
+	}
+
+	documentRels := relsPathFor("word/document.xml")
+	for _, relType := range []string{RelTypeComments, RelTypeCommentsExtended, RelTypeCommentsIds, RelTypeCommentsExtensible} {
+		targets, err := removeRelationships(dp.tempDir, documentRels, relType)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			partName, ok := partTarget("word/document.xml", target)
+			if !ok {
+				continue
+			}
+			if err := removePackagePart(dp.tempDir, partName); err != nil {
+				return err
+			}
+			if err := removeContentType(dp.tempDir, partName); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Section is one section of the document body: the page setup of a w:sectPr and the part of
+// document.xml it applies to
+type Section struct {
+	Number    int            `json:"number"`     // 1-based
+	Type      string         `json:"type"`       // How the section starts: nextPage, continuous, evenPage, oddPage or nextColumn
+	FirstPage int            `json:"first_page"` // Estimated page the section starts on
+	Layout    DocumentLayout `json:"layout"`
+
+	start, end       int     // document.xml range governed by the section
+	paragraphsBefore int     // Body paragraphs before the section
+	startY           float64 // Estimated top of the section's first line on FirstPage
+}
+
+// Sections returns the sections of the document body in order
+func (dp *DocxProcessor) Sections() ([]Section, error) {
+	content, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	return dp.parseSections(content), nil
+}
+
+// MixedOrientation reports whether the sections do not all share one orientation
+func MixedOrientation(sections []Section) bool {
+	for _, section := range sections {
+		if section.Layout.Landscape != sections[0].Layout.Landscape {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSections reads every w:sectPr of the body. A section's properties sit in the last paragraph
+// of the section, except for the final section whose w:sectPr is the last child of w:body.
+// There is always at least one section.
+func (dp *DocxProcessor) parseSections(content string) []Section {
+	bodyStart, bodyEnd := 0, len(content)
+	if bodies := findElements(content, "w:body"); len(bodies) > 0 {
+		bodyStart, bodyEnd = bodies[0].InnerStart, bodies[0].InnerEnd
+	}
+	floating := floatingContentRanges(content)
+
+	var sections []Section
+	start := bodyStart
+	for _, sectPr := range outermostElements(findElementsIn(content, bodyStart, bodyEnd, "w:sectPr")) {
+		if inRanges(floating, sectPr.Start) {
+			continue
+		}
+		end := bodyEnd
+		if paragraph, ok := enclosingElement(content, sectPr.Start, "w:p"); ok {
+			end = paragraph.End
+		}
+
+		section := Section{
+			Number: len(sections) + 1,
+			Type:   "nextPage",
+			Layout: dp.parseSectionLayout(sectPr.Outer(content)),
+			start:  start,
+			end:    end,
+		}
+		if sectionType, ok := childElement(content, sectPr, "w:type"); ok {
+			if val := tagAttr(sectionType.StartTag(content), "w:val"); val != "" {
+				section.Type = val
+			}
+		}
+		sections = append(sections, section)
+		start = end
+	}
+
+	if len(sections) == 0 {
+		layout := dp.getDefaultLayout()
+		layout.Landscape = layout.PageWidth > layout.PageHeight
+		sections = []Section{{Number: 1, Type: "nextPage", Layout: layout, start: bodyStart, end: bodyEnd}}
+	}
+	sections[len(sections)-1].end = bodyEnd
+
+	dp.estimateSectionPages(content, sections, floating)
+	return sections
+}
+
+// estimateSectionPages sets the first page of each section by flowing its paragraphs at the
+// section's line height. Continuous sections carry on where the previous one stopped.
+func (dp *DocxProcessor) estimateSectionPages(content string, sections []Section, floating []xmlElement) {
+	page := 1
+	y := sections[0].Layout.TopMargin
+	paragraphs := 0
+
+	for i := range sections {
+		section := &sections[i]
+		if i > 0 {
+			switch section.Type {
+			case "continuous", "nextColumn":
+			default:
+				page++
+				if (section.Type == "evenPage" && page%2 == 1) || (section.Type == "oddPage" && page%2 == 0) {
+					page++
+				}
+				y = section.Layout.TopMargin
+			}
+		}
+		section.FirstPage = page
+		section.startY = y
+		section.paragraphsBefore = paragraphs
+
+		count := countBodyParagraphs(content, section.start, section.end, floating)
+		paragraphs += count
+		y, page = section.flow(float64(count) * section.Layout.LineHeight)
+	}
+}
+
+// flow returns the page and the Y position offset points below the top of the section,
+// moving to the next page whenever the bottom margin is reached
+func (s Section) flow(offset float64) (float64, int) {
+	layout := s.Layout
+	y := s.startY + offset
+	page := s.FirstPage
+
+	bottom := layout.PageHeight - layout.BottomMargin
+	contentHeight := bottom - layout.TopMargin
+	if contentHeight <= 0 {
+		contentHeight = layout.PageHeight
+	}
+	if y > bottom {
+		overflow := math.Ceil((y - bottom) / contentHeight)
+		y -= overflow * contentHeight
+		page += int(overflow)
+	}
+	return y, page
+}
+
+// sectionAt returns the section governing document.xml position pos
+func sectionAt(sections []Section, pos int) Section {
+	for _, section := range sections {
+		if pos < section.end {
+			return section
+		}
+	}
+	return sections[len(sections)-1]
+}
+
+// countBodyParagraphs counts paragraphs in content[from:to] the way findContainingParagraph does
+func countBodyParagraphs(content string, from, to int, floating []xmlElement) int {
+	return len(bodyParagraphStarts(content, from, to, floating))
+}
+
+// bodyParagraphStarts returns where the paragraphs in content[from:to] start, leaving out
+// paragraphs in text boxes
+func bodyParagraphStarts(content string, from, to int, floating []xmlElement) []int {
+	var starts []int
+	for pos := from; pos < to; pos++ {
+		idx := strings.Index(content[pos:to], "<w:p")
+		if idx == -1 {
+			break
+		}
+		pos += idx
+		if isTagAt(content, pos, "w:p") && !inRanges(floating, pos) {
+			starts = append(starts, pos)
+		}
+	}
+	return starts
+}
+
+// parseSectionLayout reads page size, margins, orientation and columns from a w:sectPr element
+func (dp *DocxProcessor) parseSectionLayout(sectPr string) DocumentLayout {
+	layout := dp.getDefaultLayout()
+
+	if pgSz, ok := firstTag(sectPr, "w:pgSz"); ok {
+		if width := dp.parseFloatFromTwips(tagAttr(pgSz, "w:w")); width > 0 {
+			layout.PageWidth = width
+		}
+		if height := dp.parseFloatFromTwips(tagAttr(pgSz, "w:h")); height > 0 {
+			layout.PageHeight = height
+		}
+		layout.Landscape = tagAttr(pgSz, "w:orient") == "landscape"
+	}
+
+	if pgMar, ok := firstTag(sectPr, "w:pgMar"); ok {
+		margins := map[string]*float64{
+			"left":   &layout.LeftMargin,
+			"right":  &layout.RightMargin,
+			"top":    &layout.TopMargin,
+			"bottom": &layout.BottomMargin,
+		}
+		for attr, ptr := range margins {
+			if value := dp.parseFloatFromTwips(tagAttr(pgMar, fmt.Sprintf("w:%s", attr))); value > 0 {
+				*ptr = value
+			}
+		}
+	}
+
+	if cols, ok := firstTag(sectPr, "w:cols"); ok {
+		if num, err := strconv.Atoi(tagAttr(cols, "w:num")); err == nil && num > 1 {
+			layout.Columns = num
+		}
+		if space := tagAttr(cols, "w:space"); space != "" {
+			layout.ColumnSpace = dp.parseFloatFromTwips(space)
+		} else if layout.Columns > 1 {
+			layout.ColumnSpace = 36 // Word's default half inch
+		}
+	}
+
+	// Without an explicit orientation, a page wider than it is high is landscape
+	if !layout.Landscape {
+		layout.Landscape = layout.PageWidth > layout.PageHeight
+	}
+
+	return layout
+}
+
+// firstTag returns the first start tag of an element called name in fragment
+func firstTag(fragment, name string) (string, bool) {
+	for pos := 0; ; {
+		idx := strings.Index(fragment[pos:], "<"+name)
+		if idx == -1 {
+			return "", false
+		}
+		pos += idx
+		if isTagAt(fragment, pos, name) {
+			return fragment[pos:tagEnd(fragment, pos)], true
+		}
+		pos++
+	}
+}
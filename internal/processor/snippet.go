@@ -0,0 +1,509 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// includePattern matches {{> snippetName}} in document text (">" may still be escaped as &gt;)
+var includePattern = regexp.MustCompile(`\{\{\s*(?:>|&gt;)\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+var (
+	relIDAttrPattern   = regexp.MustCompile(`\b(r:[A-Za-z]+|o:relid)="([^"]+)"`)
+	numIDPattern       = regexp.MustCompile(`<w:numId w:val="(\d+)"\s*/>`)
+	styleRefPattern    = regexp.MustCompile(`<w:(?:pStyle|rStyle|tblStyle) w:val="([^"]+)"`)
+	styleLinkPattern   = regexp.MustCompile(`<w:(?:basedOn|link|next) w:val="([^"]+)"`)
+	wordIDAttrPattern  = regexp.MustCompile(` w14:(?:paraId|textId)="[^"]*"`)
+	snippetNamePattern = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// IsInclude reports whether a placeholder is a {{> snippet}} include rather than a data field
+func IsInclude(placeholder string) bool {
+	return includePattern.MatchString(placeholder)
+}
+
+// ExtractIncludes returns the distinct snippet names referenced by {{> name}} in document order
+func (dp *DocxProcessor) ExtractIncludes() ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(dp.tempDir, "word", "document.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document.xml: %w", err)
+	}
+
+	cleanText := dp.removeXMLTags(string(content))
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range includePattern.FindAllStringSubmatch(cleanText, -1) {
+		if !seen[match[1]] {
+			names = append(names, match[1])
+			seen[match[1]] = true
+		}
+	}
+	return names, nil
+}
+
+// MergeSnippet replaces every {{> name}} include with the body of an unzipped snippet document,
+// carrying over the styles, numbering definitions and related parts (images, links) it uses
+func (dp *DocxProcessor) MergeSnippet(name string, snippet *DocxProcessor) error {
+	documentPath := filepath.Join(dp.tempDir, "word", "document.xml")
+	content, err := os.ReadFile(documentPath)
+	if err != nil {
+		return fmt.Errorf("failed to read document.xml: %w", err)
+	}
+	contentStr := string(content)
+
+	body, snippetRootTag, err := snippet.snippetBody()
+	if err != nil {
+		return fmt.Errorf("failed to read snippet %s: %w", name, err)
+	}
+
+	prefix := "snippet_" + snippetNamePattern.ReplaceAllString(name, "_") + "_"
+	body, err = dp.importSnippetRelationships(snippet, body, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to import relationships of snippet %s: %w", name, err)
+	}
+
+	styles := dp.collectSnippetStyles(snippet, body)
+
+	numMap, err := dp.importSnippetNumbering(snippet, body+styles)
+	if err != nil {
+		return fmt.Errorf("failed to import numbering of snippet %s: %w", name, err)
+	}
+	body = remapNumIDs(body, numMap)
+	styles = remapNumIDs(styles, numMap)
+
+	if err := dp.appendStyles(styles); err != nil {
+		return fmt.Errorf("failed to import styles of snippet %s: %w", name, err)
+	}
+
+	// Make namespace prefixes used by the snippet available in the target document
+	if rootIdx := strings.Index(contentStr, "<w:document"); rootIdx != -1 {
+		rootEnd := tagEnd(contentStr, rootIdx)
+		rootTag := mergeNamespaces(contentStr[rootIdx:rootEnd], snippetRootTag)
+		contentStr = contentStr[:rootIdx] + rootTag + contentStr[rootEnd:]
+	}
+
+	contentStr = dp.replaceIncludeParagraphs(contentStr, name, body)
+
+	if err := os.WriteFile(documentPath, []byte(contentStr), 0644); err != nil {
+		return fmt.Errorf("failed to write document.xml: %w", err)
+	}
+	return nil
+}
+
+// snippetBody returns the block content of the snippet's w:body without section properties
+func (dp *DocxProcessor) snippetBody() (string, string, error) {
+	content, err := os.ReadFile(filepath.Join(dp.tempDir, "word", "document.xml"))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read document.xml: %w", err)
+	}
+	contentStr := string(content)
+
+	rootTag := ""
+	if rootIdx := strings.Index(contentStr, "<w:document"); rootIdx != -1 {
+		rootTag = contentStr[rootIdx:tagEnd(contentStr, rootIdx)]
+	}
+
+	bodies := findElements(contentStr, "w:body")
+	if len(bodies) == 0 {
+		return "", "", fmt.Errorf("document has no body")
+	}
+	body := bodies[0].Inner(contentStr)
+
+	// Section breaks belong to the including document
+	sections := findElements(body, "w:sectPr")
+	for i := len(sections) - 1; i >= 0; i-- {
+		body = body[:sections[i].Start] + body[sections[i].End:]
+	}
+	body = wordIDAttrPattern.ReplaceAllString(body, "")
+
+	// A table cell or body must not end with a table
+	if strings.HasSuffix(strings.TrimSpace(body), "</w:tbl>") {
+		body += "<w:p/>"
+	}
+
+	return body, rootTag, nil
+}
+
+// replaceIncludeParagraphs swaps paragraphs holding only the include for the snippet body.
+// Includes that share a paragraph with other text are removed and the body follows the paragraph.
+func (dp *DocxProcessor) replaceIncludeParagraphs(content, name, body string) string {
+	paragraphs := findElements(content, "w:p")
+
+	var targets []xmlElement
+	for i, paragraph := range paragraphs {
+		if !paragraphIncludes(paragraph.Outer(content), name) {
+			continue
+		}
+		// Prefer the innermost paragraph when paragraphs nest (text boxes)
+		nested := false
+		for _, inner := range paragraphs[i+1:] {
+			if inner.Start >= paragraph.End {
+				break
+			}
+			if paragraphIncludes(inner.Outer(content), name) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			targets = append(targets, paragraph)
+		}
+	}
+
+	for i := len(targets) - 1; i >= 0; i-- {
+		paragraph := targets[i]
+		paragraphXML := paragraph.Outer(content)
+		text := strings.TrimSpace(dp.removeXMLTags(paragraphXML))
+
+		replacement := body
+		if !isOnlyInclude(text, name) {
+			cleaned := paragraphXML
+			for _, match := range includePattern.FindAllStringSubmatch(text, -1) {
+				if match[1] == name {
+					cleaned = dp.replaceXMLSafeSlow(cleaned, match[0], "")
+				}
+			}
+			replacement = cleaned + body
+		}
+		content = content[:paragraph.Start] + replacement + content[paragraph.End:]
+	}
+
+	return content
+}
+
+func paragraphIncludes(paragraphXML, name string) bool {
+	for _, match := range includePattern.FindAllStringSubmatch(elementText(paragraphXML), -1) {
+		if match[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isOnlyInclude(text, name string) bool {
+	match := includePattern.FindStringSubmatch(text)
+	return match != nil && match[1] == name && strings.TrimSpace(strings.Replace(text, match[0], "", 1)) == ""
+}
+
+// importSnippetRelationships copies the parts and links referenced by the body and rewrites its relationship IDs
+func (dp *DocxProcessor) importSnippetRelationships(snippet *DocxProcessor, body, prefix string) (string, error) {
+	const sourcePart = "word/document.xml"
+	rels, err := readRelationships(snippet.tempDir, relsPathFor(sourcePart))
+	if err != nil {
+		return "", err
+	}
+	relByID := make(map[string]Relationship, len(rels))
+	for _, rel := range rels {
+		relByID[rel.ID] = rel
+	}
+
+	idMap := make(map[string]string)
+	copied := make(map[string]string)
+	for _, match := range relIDAttrPattern.FindAllStringSubmatch(body, -1) {
+		oldID := match[2]
+		if _, done := idMap[oldID]; done {
+			continue
+		}
+		rel, ok := relByID[oldID]
+		if !ok {
+			continue
+		}
+
+		target := rel.Target
+		if rel.TargetMode != "External" {
+			partName, ok := partTarget(sourcePart, rel.Target)
+			if !ok {
+				return "", fmt.Errorf("snippet relationship %s points outside the package: %s", rel.ID, rel.Target)
+			}
+			newPart, err := dp.copySnippetPart(snippet, partName, prefix, copied)
+			if err != nil {
+				return "", err
+			}
+			target = relativeTarget(sourcePart, newPart)
+		}
+
+		newID, err := addRelationship(dp.tempDir, relsPathFor(sourcePart), rel.Type, target, rel.TargetMode)
+		if err != nil {
+			return "", err
+		}
+		idMap[oldID] = newID
+	}
+
+	return relIDAttrPattern.ReplaceAllStringFunc(body, func(attr string) string {
+		match := relIDAttrPattern.FindStringSubmatch(attr)
+		if newID, ok := idMap[match[2]]; ok {
+			return fmt.Sprintf(`%s="%s"`, match[1], newID)
+		}
+		return attr
+	}), nil
+}
+
+// copySnippetPart copies one part (and, recursively, the parts it links to) into the target package
+func (dp *DocxProcessor) copySnippetPart(snippet *DocxProcessor, partName, prefix string, copied map[string]string) (string, error) {
+	if newPart, ok := copied[partName]; ok {
+		return newPart, nil
+	}
+
+	data, err := readPackagePart(snippet.tempDir, partName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read snippet part: %w", err)
+	}
+
+	dir, file := path.Split(partName)
+	newPart := uniquePartName(dp.tempDir, path.Join(dir, prefix+file))
+	copied[partName] = newPart
+
+	// Copy the part's own relationships first so their targets can be rewritten
+	rels, err := readRelationships(snippet.tempDir, relsPathFor(partName))
+	if err != nil {
+		return "", err
+	}
+	for _, rel := range rels {
+		target := rel.Target
+		if rel.TargetMode != "External" {
+			childName, ok := partTarget(partName, rel.Target)
+			if !ok {
+				return "", fmt.Errorf("snippet relationship %s of %s points outside the package: %s", rel.ID, partName, rel.Target)
+			}
+			childPart, err := dp.copySnippetPart(snippet, childName, prefix, copied)
+			if err != nil {
+				return "", err
+			}
+			target = relativeTarget(newPart, childPart)
+		}
+		// The copied part has a fresh .rels part, so its relationship IDs are kept as they are
+		if _, err := addRelationshipWithID(dp.tempDir, relsPathFor(newPart), rel.ID, rel.Type, target, rel.TargetMode); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writePackagePart(dp.tempDir, newPart, []byte(data)); err != nil {
+		return "", err
+	}
+
+	ext := strings.TrimPrefix(path.Ext(partName), ".")
+	if err := ensureDefaultContentType(dp.tempDir, ext, defaultContentTypeFor(snippet.tempDir, ext)); err != nil {
+		return "", err
+	}
+	if err := ensureContentType(dp.tempDir, newPart, contentTypeFor(snippet.tempDir, partName)); err != nil {
+		return "", err
+	}
+
+	return newPart, nil
+}
+
+// collectSnippetStyles returns the snippet style definitions used by the body that the target document lacks
+func (dp *DocxProcessor) collectSnippetStyles(snippet *DocxProcessor, body string) string {
+	snippetStyles, err := os.ReadFile(filepath.Join(snippet.tempDir, "word", "styles.xml"))
+	if err != nil {
+		return ""
+	}
+	targetStyles, err := os.ReadFile(filepath.Join(dp.tempDir, "word", "styles.xml"))
+	if err != nil {
+		return ""
+	}
+	snippetStr := string(snippetStyles)
+	targetStr := string(targetStyles)
+
+	definitions := make(map[string]string)
+	for _, element := range findElements(snippetStr, "w:style") {
+		id := tagAttr(element.StartTag(snippetStr), "w:styleId")
+		definitions[id] = element.Outer(snippetStr)
+	}
+
+	var queue []string
+	for _, match := range styleRefPattern.FindAllStringSubmatch(body, -1) {
+		queue = append(queue, match[1])
+	}
+
+	visited := make(map[string]bool)
+	var copiedIDs []string
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		// Existing definitions in the target document win
+		if strings.Contains(targetStr, `w:styleId="`+id+`"`) {
+			continue
+		}
+		definition, ok := definitions[id]
+		if !ok {
+			continue
+		}
+		copiedIDs = append(copiedIDs, id)
+		for _, match := range styleLinkPattern.FindAllStringSubmatch(definition, -1) {
+			queue = append(queue, match[1])
+		}
+	}
+
+	sort.Strings(copiedIDs)
+	var sb strings.Builder
+	for _, id := range copiedIDs {
+		sb.WriteString(definitions[id])
+	}
+	return sb.String()
+}
+
+func (dp *DocxProcessor) appendStyles(styles string) error {
+	if styles == "" {
+		return nil
+	}
+
+	stylesPath := filepath.Join(dp.tempDir, "word", "styles.xml")
+	content, err := os.ReadFile(stylesPath)
+	if err != nil {
+		return fmt.Errorf("failed to read styles.xml: %w", err)
+	}
+	contentStr := string(content)
+
+	closeIdx := strings.LastIndex(contentStr, "</w:styles>")
+	if closeIdx == -1 {
+		return fmt.Errorf("malformed styles.xml")
+	}
+	contentStr = contentStr[:closeIdx] + styles + contentStr[closeIdx:]
+
+	return os.WriteFile(stylesPath, []byte(contentStr), 0644)
+}
+
+// importSnippetNumbering copies the list definitions used by the fragment and returns old->new numId
+func (dp *DocxProcessor) importSnippetNumbering(snippet *DocxProcessor, fragment string) (map[string]string, error) {
+	used := numIDPattern.FindAllStringSubmatch(fragment, -1)
+	if len(used) == 0 {
+		return nil, nil
+	}
+
+	snippetNumbering, err := os.ReadFile(filepath.Join(snippet.tempDir, "word", "numbering.xml"))
+	if err != nil {
+		return nil, nil
+	}
+	snippetStr := string(snippetNumbering)
+
+	numberingPath := filepath.Join(dp.tempDir, "word", "numbering.xml")
+	targetNumbering, err := os.ReadFile(numberingPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read numbering.xml: %w", err)
+		}
+		// The target has no lists yet; start an empty numbering part with the snippet's namespaces
+		rootIdx := strings.Index(snippetStr, "<w:numbering")
+		if rootIdx == -1 {
+			return nil, fmt.Errorf("malformed snippet numbering.xml")
+		}
+		targetNumbering = []byte(snippetStr[:tagEnd(snippetStr, rootIdx)] + "</w:numbering>")
+		if _, err := addRelationship(dp.tempDir, relsPathFor("word/document.xml"), RelTypeNumbering, "numbering.xml", ""); err != nil {
+			return nil, err
+		}
+		if err := ensureContentType(dp.tempDir, "word/numbering.xml", ContentTypeNumbering); err != nil {
+			return nil, err
+		}
+	}
+	targetStr := string(targetNumbering)
+
+	nextAbstract := maxAttrValue(targetStr, "w:abstractNum", "w:abstractNumId") + 1
+	nextNum := maxAttrValue(targetStr, "w:num", "w:numId") + 1
+
+	snippetNums := make(map[string]xmlElement)
+	for _, element := range findElements(snippetStr, "w:num") {
+		snippetNums[tagAttr(element.StartTag(snippetStr), "w:numId")] = element
+	}
+	snippetAbstracts := make(map[string]xmlElement)
+	for _, element := range findElements(snippetStr, "w:abstractNum") {
+		snippetAbstracts[tagAttr(element.StartTag(snippetStr), "w:abstractNumId")] = element
+	}
+
+	numMap := make(map[string]string)
+	abstractMap := make(map[string]string)
+	var newAbstracts, newNums strings.Builder
+
+	for _, match := range used {
+		oldNum := match[1]
+		if oldNum == "0" {
+			continue
+		}
+		if _, done := numMap[oldNum]; done {
+			continue
+		}
+		num, ok := snippetNums[oldNum]
+		if !ok {
+			continue
+		}
+		numXML := num.Outer(snippetStr)
+
+		oldAbstract := ""
+		if refs := findElements(numXML, "w:abstractNumId"); len(refs) > 0 {
+			oldAbstract = tagAttr(refs[0].StartTag(numXML), "w:val")
+		}
+		newAbstract, done := abstractMap[oldAbstract]
+		if !done {
+			abstract, ok := snippetAbstracts[oldAbstract]
+			if !ok {
+				continue
+			}
+			newAbstract = strconv.Itoa(nextAbstract)
+			nextAbstract++
+			abstractMap[oldAbstract] = newAbstract
+
+			abstractXML := abstract.Outer(snippetStr)
+			startTag := abstract.StartTag(snippetStr)
+			newAbstracts.WriteString(setTagAttr(startTag, "w:abstractNumId", newAbstract) + abstractXML[len(startTag):])
+		}
+
+		newNum := strconv.Itoa(nextNum)
+		nextNum++
+		numMap[oldNum] = newNum
+
+		startTag := num.StartTag(snippetStr)
+		numBody := strings.Replace(numXML[len(startTag):], `<w:abstractNumId w:val="`+oldAbstract+`"`, `<w:abstractNumId w:val="`+newAbstract+`"`, 1)
+		newNums.WriteString(setTagAttr(startTag, "w:numId", newNum) + numBody)
+	}
+
+	// Schema order requires every abstractNum before the first num
+	insertAbstractAt := strings.LastIndex(targetStr, "</w:numbering>")
+	for _, element := range findElements(targetStr, "w:num") {
+		insertAbstractAt = element.Start
+		break
+	}
+	targetStr = targetStr[:insertAbstractAt] + newAbstracts.String() + targetStr[insertAbstractAt:]
+
+	closeIdx := strings.LastIndex(targetStr, "</w:numbering>")
+	targetStr = targetStr[:closeIdx] + newNums.String() + targetStr[closeIdx:]
+
+	if err := os.WriteFile(numberingPath, []byte(targetStr), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write numbering.xml: %w", err)
+	}
+	return numMap, nil
+}
+
+func remapNumIDs(fragment string, numMap map[string]string) string {
+	if len(numMap) == 0 {
+		return fragment
+	}
+	return numIDPattern.ReplaceAllStringFunc(fragment, func(tag string) string {
+		match := numIDPattern.FindStringSubmatch(tag)
+		if newID, ok := numMap[match[1]]; ok {
+			return `<w:numId w:val="` + newID + `"/>`
+		}
+		return tag
+	})
+}
+
+func maxAttrValue(content, element, attr string) int {
+	maxValue := 0
+	for _, e := range findElements(content, element) {
+		if value, err := strconv.Atoi(tagAttr(e.StartTag(content), attr)); err == nil && value > maxValue {
+			maxValue = value
+		}
+	}
+	return maxValue
+}
@@ -0,0 +1,342 @@
+package processor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DocumentStructure is a JSON model of the document body for visual editors
+type DocumentStructure struct {
+	Sections []StructureSection `json:"sections"`
+}
+
+// StructureSection is one section with its page setup and the blocks it contains
+type StructureSection struct {
+	Number int              `json:"number"`
+	Type   string           `json:"type"`
+	Layout DocumentLayout   `json:"layout"`
+	Blocks []StructureBlock `json:"blocks"`
+}
+
+// StructureBlock is either a paragraph or a table
+type StructureBlock struct {
+	Type      string              `json:"type"` // "paragraph" or "table"
+	Paragraph *StructureParagraph `json:"paragraph,omitempty"`
+	Table     *StructureTable     `json:"table,omitempty"`
+}
+
+// StructureParagraph is a body paragraph. ID matches the paragraph_id of placeholder positions.
+type StructureParagraph struct {
+	ID           string                 `json:"id"`
+	Style        string                 `json:"style,omitempty"`
+	Alignment    string                 `json:"alignment,omitempty"`
+	Text         string                 `json:"text"`
+	Runs         []StructureRun         `json:"runs"`
+	Placeholders []StructurePlaceholder `json:"placeholders,omitempty"`
+}
+
+// StructureRun is a run of text with its direct formatting
+type StructureRun struct {
+	Index     int     `json:"index"` // 0-based within the paragraph
+	Text      string  `json:"text"`
+	Style     string  `json:"style,omitempty"`
+	Bold      bool    `json:"bold,omitempty"`
+	Italic    bool    `json:"italic,omitempty"`
+	Underline bool    `json:"underline,omitempty"`
+	Font      string  `json:"font,omitempty"`
+	Size      float64 `json:"size,omitempty"` // Points
+	Color     string  `json:"color,omitempty"`
+}
+
+// StructurePlaceholder anchors a placeholder occurrence to a run. Offsets count characters
+// of the run and paragraph text.
+type StructurePlaceholder struct {
+	Placeholder     string `json:"placeholder"`
+	Occurrence      int    `json:"occurrence"` // Index in the template's position list
+	Run             int    `json:"run"`
+	Offset          int    `json:"offset"`           // Within the run
+	ParagraphOffset int    `json:"paragraph_offset"` // Within the paragraph
+}
+
+// StructureTable is a table with its rows
+type StructureTable struct {
+	Rows []StructureRow `json:"rows"`
+}
+
+// StructureRow is one table row
+type StructureRow struct {
+	Index int             `json:"index"`
+	Cells []StructureCell `json:"cells"`
+}
+
+// StructureCell is a table cell at its grid coordinates; merged cells report their span
+type StructureCell struct {
+	Row     int              `json:"row"`
+	Column  int              `json:"column"` // Grid column, counting spans of earlier cells
+	ColSpan int              `json:"col_span"`
+	VMerge  string           `json:"vmerge,omitempty"` // "restart" or "continue" for vertically merged cells
+	Blocks  []StructureBlock `json:"blocks"`
+}
+
+// structureBuilder walks document.xml once
+type structureBuilder struct {
+	content         string
+	floating        []xmlElement
+	paragraphStarts []int // Paragraph starts as counted by findContainingParagraph
+	positions       []PlaceholderPosition
+	order           []int // Indexes into positions sorted by XMLStartPos
+}
+
+// Structure models the body of the document. Placeholders are taken from positions, as returned
+// by ExtractPlaceholdersWithPositions for the same content. Text boxes are not part of the model.
+func (dp *DocxProcessor) Structure(positions []PlaceholderPosition) (*DocumentStructure, error) {
+	content, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	floating := floatingContentRanges(content)
+	b := &structureBuilder{
+		content:         content,
+		floating:        floating,
+		paragraphStarts: bodyParagraphStarts(content, 0, len(content), floating),
+		positions:       positions,
+	}
+	for i, position := range positions {
+		if position.XMLStartPos >= 0 {
+			b.order = append(b.order, i)
+		}
+	}
+	sort.SliceStable(b.order, func(i, j int) bool {
+		return positions[b.order[i]].XMLStartPos < positions[b.order[j]].XMLStartPos
+	})
+
+	sections := dp.parseSections(content)
+	structure := &DocumentStructure{}
+	for _, section := range sections {
+		structure.Sections = append(structure.Sections, StructureSection{
+			Number: section.Number,
+			Type:   section.Type,
+			Layout: section.Layout,
+			Blocks: []StructureBlock{},
+		})
+	}
+
+	bodies := findElements(content, "w:body")
+	if len(bodies) == 0 {
+		return structure, nil
+	}
+	for _, block := range b.blocks(bodies[0].InnerStart, bodies[0].InnerEnd) {
+		section := sectionAt(sections, block.start)
+		s := &structure.Sections[section.Number-1]
+		s.Blocks = append(s.Blocks, block.StructureBlock)
+	}
+	return structure, nil
+}
+
+type positionedBlock struct {
+	StructureBlock
+	start int
+}
+
+// blocks reads the paragraphs and tables among the direct children of content[from:to],
+// looking through content controls
+func (b *structureBuilder) blocks(from, to int) []positionedBlock {
+	var blocks []positionedBlock
+	for _, child := range childElementsIn(b.content, from, to) {
+		switch child.name {
+		case "w:p":
+			blocks = append(blocks, positionedBlock{StructureBlock{Type: "paragraph", Paragraph: b.paragraph(child.xmlElement)}, child.Start})
+		case "w:tbl":
+			blocks = append(blocks, positionedBlock{StructureBlock{Type: "table", Table: b.table(child.xmlElement)}, child.Start})
+		case "w:sdt":
+			if sdtContent, ok := childElement(b.content, child.xmlElement, "w:sdtContent"); ok {
+				blocks = append(blocks, b.blocks(sdtContent.InnerStart, sdtContent.InnerEnd)...)
+			}
+		}
+	}
+	return blocks
+}
+
+func (b *structureBuilder) paragraph(p xmlElement) *StructureParagraph {
+	content := b.content
+	paragraph := &StructureParagraph{
+		ID:   "p" + strconv.Itoa(sort.SearchInts(b.paragraphStarts, p.Start+1)),
+		Runs: []StructureRun{},
+	}
+	if paragraph.ID == "p0" {
+		paragraph.ID = "p1"
+	}
+	if pPr, ok := childElement(content, p, "w:pPr"); ok {
+		paragraph.Style = childVal(content, pPr, "w:pStyle")
+		paragraph.Alignment = childVal(content, pPr, "w:jc")
+	}
+
+	var text strings.Builder
+	textLength := 0
+	next := sort.Search(len(b.order), func(i int) bool { return b.positions[b.order[i]].XMLStartPos >= p.Start })
+
+	for _, r := range findElementsIn(content, p.InnerStart, p.InnerEnd, "w:r") {
+		if inRanges(b.floating, r.Start) {
+			continue
+		}
+		run := StructureRun{Index: len(paragraph.Runs), Text: b.runText(r, r.End)}
+		if rPr, ok := childElement(content, r, "w:rPr"); ok {
+			b.runFormatting(rPr, &run)
+		}
+
+		// Placeholders starting in this run
+		for ; next < len(b.order) && b.positions[b.order[next]].XMLStartPos < r.End; next++ {
+			position := b.positions[b.order[next]]
+			if position.XMLStartPos < r.Start || inRanges(b.floating, position.XMLStartPos) {
+				continue
+			}
+			offset := utf8.RuneCountInString(b.runText(r, position.XMLStartPos))
+			paragraph.Placeholders = append(paragraph.Placeholders, StructurePlaceholder{
+				Placeholder:     position.Placeholder,
+				Occurrence:      b.order[next],
+				Run:             run.Index,
+				Offset:          offset,
+				ParagraphOffset: textLength + offset,
+			})
+		}
+
+		text.WriteString(run.Text)
+		textLength += utf8.RuneCountInString(run.Text)
+		paragraph.Runs = append(paragraph.Runs, run)
+	}
+	paragraph.Text = text.String()
+	return paragraph
+}
+
+// runText returns the w:t text of run r that comes before limit, leaving out text boxes
+func (b *structureBuilder) runText(r xmlElement, limit int) string {
+	var sb strings.Builder
+	for _, t := range findElementsIn(b.content, r.InnerStart, r.InnerEnd, "w:t") {
+		if t.Start >= limit {
+			break
+		}
+		if inRanges(b.floating, t.Start) {
+			continue
+		}
+		end := min(t.InnerEnd, max(limit, t.InnerStart))
+		sb.WriteString(unescapeXMLText(b.content[t.InnerStart:end]))
+	}
+	return sb.String()
+}
+
+func (b *structureBuilder) runFormatting(rPr xmlElement, run *StructureRun) {
+	content := b.content
+	run.Style = childVal(content, rPr, "w:rStyle")
+	run.Bold = toggleOn(content, rPr, "w:b")
+	run.Italic = toggleOn(content, rPr, "w:i")
+	if u, ok := childElement(content, rPr, "w:u"); ok {
+		run.Underline = tagAttr(u.StartTag(content), "w:val") != "none"
+	}
+	if fonts, ok := childElement(content, rPr, "w:rFonts"); ok {
+		run.Font = tagAttr(fonts.StartTag(content), "w:ascii")
+		if run.Font == "" {
+			run.Font = tagAttr(fonts.StartTag(content), "w:cs")
+		}
+	}
+	if size, err := strconv.ParseFloat(childVal(content, rPr, "w:sz"), 64); err == nil {
+		run.Size = size / 2
+	}
+	run.Color = childVal(content, rPr, "w:color")
+}
+
+func (b *structureBuilder) table(tbl xmlElement) *StructureTable {
+	content := b.content
+	table := &StructureTable{Rows: []StructureRow{}}
+
+	for _, tr := range childElementsIn(content, tbl.InnerStart, tbl.InnerEnd) {
+		if tr.name != "w:tr" {
+			continue
+		}
+		row := StructureRow{Index: len(table.Rows), Cells: []StructureCell{}}
+		column := 0
+		for _, tc := range childElementsIn(content, tr.InnerStart, tr.InnerEnd) {
+			if tc.name != "w:tc" {
+				continue
+			}
+			cell := StructureCell{Row: row.Index, Column: column, ColSpan: 1}
+			if tcPr, ok := childElement(content, tc.xmlElement, "w:tcPr"); ok {
+				if span, err := strconv.Atoi(childVal(content, tcPr, "w:gridSpan")); err == nil && span > 1 {
+					cell.ColSpan = span
+				}
+				if vMerge, ok := childElement(content, tcPr, "w:vMerge"); ok {
+					cell.VMerge = tagAttr(vMerge.StartTag(content), "w:val")
+					if cell.VMerge == "" {
+						cell.VMerge = "continue"
+					}
+				}
+			}
+			for _, block := range b.blocks(tc.InnerStart, tc.InnerEnd) {
+				cell.Blocks = append(cell.Blocks, block.StructureBlock)
+			}
+			row.Cells = append(row.Cells, cell)
+			column += cell.ColSpan
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+type namedElement struct {
+	xmlElement
+	name string
+}
+
+// childElementsIn lists the elements directly inside content[from:to]
+func childElementsIn(content string, from, to int) []namedElement {
+	var children []namedElement
+	pos := from
+	for pos < to {
+		idx := strings.IndexByte(content[pos:to], '<')
+		if idx == -1 || strings.HasPrefix(content[pos+idx:], "</") {
+			break
+		}
+		pos += idx
+		if strings.HasPrefix(content[pos:], "<!--") || strings.HasPrefix(content[pos:], "<?") {
+			pos = tagEnd(content, pos)
+			continue
+		}
+
+		nameEnd := pos + 1
+		for nameEnd < to && !strings.ContainsRune(" \t\r\n/>", rune(content[nameEnd])) {
+			nameEnd++
+		}
+		name := content[pos+1 : nameEnd]
+		element, ok := matchElement(content, pos, to, name)
+		if !ok {
+			break
+		}
+		children = append(children, namedElement{element, name})
+		pos = element.End
+	}
+	return children
+}
+
+// childVal reads the w:val attribute of parent's direct child called name
+func childVal(content string, parent xmlElement, name string) string {
+	child, ok := childElement(content, parent, name)
+	if !ok {
+		return ""
+	}
+	return tagAttr(child.StartTag(content), "w:val")
+}
+
+// toggleOn reports whether an on/off property such as w:b is present and not switched off
+func toggleOn(content string, parent xmlElement, name string) bool {
+	child, ok := childElement(content, parent, name)
+	if !ok {
+		return false
+	}
+	switch tagAttr(child.StartTag(content), "w:val") {
+	case "0", "false", "off":
+		return false
+	}
+	return true
+}
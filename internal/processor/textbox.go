@@ -0,0 +1,354 @@
+package processor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	emuPerPoint = 12700
+
+	// Default text box insets used by Word when wps:bodyPr does not set them (0.1" and 0.05")
+	defaultTextBoxInsetX = 91440
+	defaultTextBoxInsetY = 45720
+)
+
+// frameRange is a span along one page axis in points
+type frameRange struct {
+	start float64
+	size  float64
+}
+
+// floatingContentRanges returns the text box contents and the VML fallbacks that duplicate them.
+// Paragraphs inside these ranges are not part of the body flow.
+func floatingContentRanges(content string) []xmlElement {
+	return append(findElements(content, "w:txbxContent"), findElements(content, "mc:Fallback")...)
+}
+
+func inRanges(ranges []xmlElement, pos int) bool {
+	for _, r := range ranges {
+		if pos >= r.Start && pos < r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// isInFallback reports whether pos lies in an mc:Fallback block. Word stores every DrawingML
+// text box a second time as VML there, so placeholders inside it are duplicates.
+func isInFallback(content string, pos int) bool {
+	_, ok := enclosingElement(content, pos, "mc:Fallback")
+	return ok
+}
+
+// textBoxCoordinates returns the page position of text at xmlPos when it sits inside a text box.
+// The box is placed from its anchor (wp:positionH/wp:positionV, or the VML style for legacy shapes),
+// moved by any enclosing group or canvas, and offset by the text insets and preceding lines in the box.
+// anchorY is the body position of the paragraph that holds the drawing.
+func (dp *DocxProcessor) textBoxCoordinates(content string, xmlPos int, layout DocumentLayout, anchorY float64) (float64, float64, bool) {
+	txbx, ok := enclosingElement(content, xmlPos, "w:txbxContent")
+	if !ok {
+		return 0, 0, false
+	}
+
+	// Lines above the placeholder inside the box
+	lines := 0
+	for _, p := range findElementsIn(content, txbx.InnerStart, xmlPos, "w:p") {
+		if p.End <= xmlPos {
+			lines++
+		}
+	}
+	lineOffset := float64(lines) * layout.LineHeight
+
+	if anchor, ok := enclosingElement(content, xmlPos, "wp:anchor"); ok {
+		x, y := dp.drawingFrameOrigin(content, anchor, layout, anchorY)
+		dx, dy := drawingChildOffset(content, xmlPos, anchor)
+		insetX, insetY := drawingInsets(content, txbx)
+		return x + dx + insetX, y + dy + insetY + lineOffset, true
+	}
+
+	if inline, ok := enclosingElement(content, xmlPos, "wp:inline"); ok {
+		// Inline canvases and groups flow with the text of their paragraph
+		dx, dy := drawingChildOffset(content, xmlPos, inline)
+		insetX, insetY := drawingInsets(content, txbx)
+		return layout.LeftMargin + dx + insetX, anchorY + dy + insetY + lineOffset, true
+	}
+
+	if x, y, ok := vmlShapeOrigin(content, xmlPos, layout, anchorY); ok {
+		return x, y + lineOffset, true
+	}
+
+	return 0, 0, false
+}
+
+// drawingFrameOrigin resolves the top-left corner of an anchored drawing in page points
+func (dp *DocxProcessor) drawingFrameOrigin(content string, anchor xmlElement, layout DocumentLayout, anchorY float64) (float64, float64) {
+	var extentX, extentY float64
+	if extents := findElementsIn(content, anchor.InnerStart, anchor.InnerEnd, "wp:extent"); len(extents) > 0 {
+		tag := extents[0].StartTag(content)
+		extentX = emuAttr(tag, "cx")
+		extentY = emuAttr(tag, "cy")
+	}
+
+	x := layout.LeftMargin
+	if positions := findElementsIn(content, anchor.InnerStart, anchor.InnerEnd, "wp:positionH"); len(positions) > 0 {
+		frame := horizontalFrame(tagAttr(positions[0].StartTag(content), "relativeFrom"), layout)
+		x = resolveAnchorOffset(content, positions[0], frame, extentX)
+	}
+
+	y := anchorY
+	if positions := findElementsIn(content, anchor.InnerStart, anchor.InnerEnd, "wp:positionV"); len(positions) > 0 {
+		frame := verticalFrame(tagAttr(positions[0].StartTag(content), "relativeFrom"), layout, anchorY)
+		y = resolveAnchorOffset(content, positions[0], frame, extentY)
+	}
+
+	return x, y
+}
+
+func horizontalFrame(relativeFrom string, layout DocumentLayout) frameRange {
+	switch relativeFrom {
+	case "page":
+		return frameRange{0, layout.PageWidth}
+	case "leftMargin", "insideMargin":
+		return frameRange{0, layout.LeftMargin}
+	case "rightMargin", "outsideMargin":
+		return frameRange{layout.PageWidth - layout.RightMargin, layout.RightMargin}
+	default: // margin, column, character
+		return frameRange{layout.LeftMargin, layout.PageWidth - layout.LeftMargin - layout.RightMargin}
+	}
+}
+
+func verticalFrame(relativeFrom string, layout DocumentLayout, anchorY float64) frameRange {
+	switch relativeFrom {
+	case "page":
+		return frameRange{0, layout.PageHeight}
+	case "margin":
+		return frameRange{layout.TopMargin, layout.PageHeight - layout.TopMargin - layout.BottomMargin}
+	case "topMargin", "insideMargin":
+		return frameRange{0, layout.TopMargin}
+	case "bottomMargin", "outsideMargin":
+		return frameRange{layout.PageHeight - layout.BottomMargin, layout.BottomMargin}
+	default: // paragraph, line
+		return frameRange{anchorY, layout.LineHeight}
+	}
+}
+
+// resolveAnchorOffset applies a wp:posOffset (EMU from the frame start) or wp:align (left/center/right, top/center/bottom)
+func resolveAnchorOffset(content string, position xmlElement, frame frameRange, extent float64) float64 {
+	if offsets := findElementsIn(content, position.InnerStart, position.InnerEnd, "wp:posOffset"); len(offsets) > 0 {
+		value, _ := strconv.ParseFloat(strings.TrimSpace(offsets[0].Inner(content)), 64)
+		return frame.start + value/emuPerPoint
+	}
+
+	if aligns := findElementsIn(content, position.InnerStart, position.InnerEnd, "wp:align"); len(aligns) > 0 {
+		switch strings.TrimSpace(aligns[0].Inner(content)) {
+		case "center":
+			return frame.start + (frame.size-extent)/2
+		case "right", "bottom", "outside":
+			return frame.start + frame.size - extent
+		}
+	}
+
+	return frame.start
+}
+
+// drawingChildOffset returns where the shape holding xmlPos sits inside its group or canvas, in points.
+// Group children use the group's child coordinate space, which is scaled onto the group's extent.
+func drawingChildOffset(content string, xmlPos int, drawing xmlElement) (float64, float64) {
+	shape, ok := enclosingElement(content, xmlPos, "wps:wsp")
+	if !ok || shape.Start < drawing.Start {
+		return 0, 0
+	}
+
+	var groups []xmlElement
+	for _, name := range []string{"wpg:grpSp", "wpg:wgp", "wpc:wpc"} {
+		for _, g := range findElementsIn(content, drawing.InnerStart, drawing.InnerEnd, name) {
+			if g.Start < shape.Start && shape.End <= g.End {
+				groups = append(groups, g)
+			}
+		}
+	}
+	if len(groups) == 0 {
+		// A lone shape fills the anchor frame
+		return 0, 0
+	}
+
+	x, y := xfrmOffset(content, shape, "wps:spPr")
+
+	// Map through the innermost group first
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Start > groups[j].Start })
+	for _, group := range groups {
+		if isTagAt(content, group.Start, "wpc:wpc") {
+			continue // Canvas children are positioned directly from the canvas origin
+		}
+
+		xfrm, ok := firstChildXfrm(content, group, "wpg:grpSpPr")
+		if !ok {
+			continue
+		}
+		tag := func(name string) string {
+			if elements := findElementsIn(content, xfrm.InnerStart, xfrm.InnerEnd, name); len(elements) > 0 {
+				return elements[0].StartTag(content)
+			}
+			return ""
+		}
+		off, ext, chOff, chExt := tag("a:off"), tag("a:ext"), tag("a:chOff"), tag("a:chExt")
+
+		scaleX, scaleY := 1.0, 1.0
+		if cx := emuAttr(chExt, "cx"); cx > 0 {
+			scaleX = emuAttr(ext, "cx") / cx
+		}
+		if cy := emuAttr(chExt, "cy"); cy > 0 {
+			scaleY = emuAttr(ext, "cy") / cy
+		}
+
+		// The outermost group is placed by the anchor, so its own offset does not count
+		groupX, groupY := 0.0, 0.0
+		if isTagAt(content, group.Start, "wpg:grpSp") {
+			groupX, groupY = emuAttr(off, "x"), emuAttr(off, "y")
+		}
+		x = groupX + (x-emuAttr(chOff, "x"))*scaleX
+		y = groupY + (y-emuAttr(chOff, "y"))*scaleY
+	}
+
+	return x, y
+}
+
+// xfrmOffset reads a:off from the shape's own properties element, in points
+func xfrmOffset(content string, shape xmlElement, properties string) (float64, float64) {
+	xfrm, ok := firstChildXfrm(content, shape, properties)
+	if !ok {
+		return 0, 0
+	}
+	offs := findElementsIn(content, xfrm.InnerStart, xfrm.InnerEnd, "a:off")
+	if len(offs) == 0 {
+		return 0, 0
+	}
+	tag := offs[0].StartTag(content)
+	return emuAttr(tag, "x"), emuAttr(tag, "y")
+}
+
+// firstChildXfrm finds the a:xfrm of the first properties element (wps:spPr or wpg:grpSpPr) in an element
+func firstChildXfrm(content string, element xmlElement, properties string) (xmlElement, bool) {
+	props := findElementsIn(content, element.InnerStart, element.InnerEnd, properties)
+	if len(props) == 0 {
+		return xmlElement{}, false
+	}
+	xfrms := findElementsIn(content, props[0].InnerStart, props[0].InnerEnd, "a:xfrm")
+	if len(xfrms) == 0 {
+		return xmlElement{}, false
+	}
+	return xfrms[0], true
+}
+
+// drawingInsets reads the text insets from the wps:bodyPr that follows the text box
+func drawingInsets(content string, txbx xmlElement) (float64, float64) {
+	insetX, insetY := float64(defaultTextBoxInsetX)/emuPerPoint, float64(defaultTextBoxInsetY)/emuPerPoint
+
+	shape, ok := enclosingElement(content, txbx.Start, "wps:wsp")
+	if !ok {
+		return insetX, insetY
+	}
+	bodies := findElementsIn(content, shape.InnerStart, shape.InnerEnd, "wps:bodyPr")
+	if len(bodies) == 0 {
+		return insetX, insetY
+	}
+	tag := bodies[0].StartTag(content)
+	if value := tagAttr(tag, "lIns"); value != "" {
+		insetX = emuAttr(tag, "lIns")
+	}
+	if value := tagAttr(tag, "tIns"); value != "" {
+		insetY = emuAttr(tag, "tIns")
+	}
+	return insetX, insetY
+}
+
+// vmlShapeOrigin places a legacy VML text box from its CSS-like style attribute
+func vmlShapeOrigin(content string, xmlPos int, layout DocumentLayout, anchorY float64) (float64, float64, bool) {
+	textbox, ok := enclosingElement(content, xmlPos, "v:textbox")
+	if !ok {
+		return 0, 0, false
+	}
+
+	var style string
+	for _, name := range []string{"v:shape", "v:rect", "v:roundrect"} {
+		if shape, ok := enclosingElement(content, xmlPos, name); ok && shape.Start < textbox.Start {
+			style = tagAttr(shape.StartTag(content), "style")
+			break
+		}
+	}
+	if style == "" {
+		return 0, 0, false
+	}
+	props := parseVMLStyle(style)
+
+	x := layout.LeftMargin
+	if props["mso-position-horizontal-relative"] == "page" {
+		x = 0
+	}
+	x += cssLength(props["margin-left"]) + cssLength(props["left"])
+
+	y := anchorY
+	switch props["mso-position-vertical-relative"] {
+	case "page":
+		y = 0
+	case "margin":
+		y = layout.TopMargin
+	}
+	y += cssLength(props["margin-top"]) + cssLength(props["top"])
+
+	// VML insets default to 0.1" left/right and 0.05" top/bottom
+	insetX, insetY := 7.2, 3.6
+	if inset := tagAttr(textbox.StartTag(content), "inset"); inset != "" {
+		parts := strings.Split(inset, ",")
+		if len(parts) > 0 && strings.TrimSpace(parts[0]) != "" {
+			insetX = cssLength(parts[0])
+		}
+		if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+			insetY = cssLength(parts[1])
+		}
+	}
+
+	return x + insetX, y + insetY, true
+}
+
+func parseVMLStyle(style string) map[string]string {
+	props := make(map[string]string)
+	for _, declaration := range strings.Split(style, ";") {
+		name, value, found := strings.Cut(declaration, ":")
+		if found {
+			props[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return props
+}
+
+// cssLength converts a VML length such as "12.5pt", "1in" or "2cm" to points; bare numbers are pixels
+func cssLength(value string) float64 {
+	value = strings.TrimSpace(value)
+	units := map[string]float64{"pt": 1, "in": 72, "cm": 72 / 2.54, "mm": 72 / 25.4, "px": 0.75, "pc": 12, "emu": 1.0 / emuPerPoint}
+	for suffix, factor := range units {
+		if strings.HasSuffix(value, suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+			if err != nil {
+				return 0
+			}
+			return number * factor
+		}
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return number * 0.75
+}
+
+// emuAttr reads an EMU attribute and converts it to points
+func emuAttr(tag, name string) float64 {
+	value, err := strconv.ParseFloat(tagAttr(tag, name), 64)
+	if err != nil {
+		return 0
+	}
+	return value / emuPerPoint
+}
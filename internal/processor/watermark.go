@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// watermarkNamespaces are declared on every header that receives a watermark
+const watermarkNamespaces = `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+	`xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office">`
+
+// watermarkShapeType is the VML WordArt shape Word uses for text watermarks
+const watermarkShapeType = `<v:shapetype id="_x0000_t136" coordsize="21600,21600" o:spt="136" adj="10800" path="m@7,l@8,m@5,21600l@6,21600e">` +
+	`<v:formulas><v:f eqn="sum #0 0 10800"/><v:f eqn="prod #0 2 1"/><v:f eqn="sum 21600 0 @1"/><v:f eqn="sum 0 0 @2"/>` +
+	`<v:f eqn="sum 21600 0 @3"/><v:f eqn="if @0 @3 0"/><v:f eqn="if @0 21600 @1"/><v:f eqn="if @0 0 @2"/>` +
+	`<v:f eqn="if @0 @4 21600"/><v:f eqn="mid @5 @6"/><v:f eqn="mid @8 @5"/><v:f eqn="mid @7 @8"/>` +
+	`<v:f eqn="mid @6 @7"/><v:f eqn="sum @6 0 @5"/></v:formulas>` +
+	`<v:path textpathok="t" o:connecttype="custom" o:connectlocs="@9,0;@10,10800;@11,21600;@12,10800" o:connectangles="270,180,90,0"/>` +
+	`<v:textpath on="t" fitshape="t"/><v:handles><v:h position="#0,bottomRight" xrange="6629,14971"/></v:handles>` +
+	`<o:lock v:ext="edit" text="t" shapetype="t"/></v:shapetype>`
+
+// Watermark describes a diagonal text watermark drawn behind the page content
+type Watermark struct {
+	Text  string
+	Color string // VML color such as "silver" or "#FF0000"; defaults to silver
+	Font  string // Defaults to Calibri
+}
+
+// AddWatermark draws the watermark in every header of the document. Sections of the first
+// page that have no header of their own get a new header that carries only the watermark.
+func (dp *DocxProcessor) AddWatermark(watermark Watermark) error {
+	if strings.TrimSpace(watermark.Text) == "" {
+		return fmt.Errorf("watermark text is required")
+	}
+	if watermark.Color == "" {
+		watermark.Color = "silver"
+	}
+	if watermark.Font == "" {
+		watermark.Font = "Calibri"
+	}
+
+	documentXML, err := dp.readPart("word/document.xml")
+	if err != nil {
+		return err
+	}
+	layout := dp.parseDocumentLayout(documentXML)
+
+	// The shape spans most of the text area and keeps roughly the proportions of the text
+	width := (layout.PageWidth - layout.LeftMargin - layout.RightMargin) * 0.9
+	if width <= 0 {
+		width = 400
+	}
+	height := width * 1.6 / float64(utf8.RuneCountInString(watermark.Text))
+	height = math.Max(40, math.Min(height, width/2))
+
+	sections := outermostElements(findElements(documentXML, "w:sectPr"))
+	if len(sections) == 0 {
+		return fmt.Errorf("document has no section properties")
+	}
+
+	// Give the first section a header of each type in use; later sections inherit missing ones
+	if documentXML, err = dp.ensureWatermarkHeaders(documentXML, sections[0]); err != nil {
+		return err
+	}
+	if err := dp.writePart("word/document.xml", []byte(documentXML)); err != nil {
+		return err
+	}
+
+	rels, err := readRelationships(dp.tempDir, relsPathFor("word/document.xml"))
+	if err != nil {
+		return err
+	}
+	headerParts := make(map[string]string)
+	for _, rel := range rels {
+		if part, ok := partTarget("word/document.xml", rel.Target); ok && rel.Type == RelTypeHeader {
+			headerParts[rel.ID] = part
+		}
+	}
+
+	done := make(map[string]bool)
+	shapeNumber := 0
+	for _, ref := range findElements(documentXML, "w:headerReference") {
+		partName, ok := headerParts[tagAttr(ref.StartTag(documentXML), "r:id")]
+		if !ok || done[partName] {
+			continue
+		}
+		done[partName] = true
+		shapeNumber++
+
+		if err := dp.addWatermarkToHeader(partName, watermarkParagraph(watermark, shapeNumber, width, height)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureWatermarkHeaders adds header references to the first section for the header types
+// that would show on its pages but that the template does not define
+func (dp *DocxProcessor) ensureWatermarkHeaders(documentXML string, section xmlElement) (string, error) {
+	sectPr := section.Outer(documentXML)
+
+	needed := []string{"default"}
+	if strings.Contains(sectPr, "<w:titlePg") && !strings.Contains(sectPr, `<w:titlePg w:val="0"`) && !strings.Contains(sectPr, `<w:titlePg w:val="false"`) {
+		needed = append(needed, "first")
+	}
+	if settingsPart, ok := dp.documentPart(RelTypeSettings); ok {
+		if settings, err := dp.readPart(settingsPart); err == nil && strings.Contains(settings, "<w:evenAndOddHeaders") {
+			needed = append(needed, "even")
+		}
+	}
+
+	var missing []string
+	for _, headerType := range needed {
+		if !hasHeaderReference(sectPr, headerType) {
+			missing = append(missing, headerType)
+		}
+	}
+	if len(missing) == 0 {
+		return documentXML, nil
+	}
+
+	partName := uniquePartName(dp.tempDir, "word/header1.xml")
+	content := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + watermarkNamespaces + `<w:p/></w:hdr>`
+	if err := dp.writePart(partName, []byte(content)); err != nil {
+		return "", err
+	}
+	relID, err := addRelationship(dp.tempDir, relsPathFor("word/document.xml"), RelTypeHeader, relativeTarget("word/document.xml", partName), "")
+	if err != nil {
+		return "", err
+	}
+	if err := ensureContentType(dp.tempDir, partName, ContentTypeHeader); err != nil {
+		return "", err
+	}
+
+	// Header references come first in w:sectPr
+	var refs strings.Builder
+	for _, headerType := range missing {
+		refs.WriteString(fmt.Sprintf(`<w:headerReference w:type="%s" r:id="%s"/>`, headerType, relID))
+	}
+	if section.InnerStart == section.End {
+		// Expand a self-closing <w:sectPr/>
+		startTag := strings.TrimSuffix(strings.TrimSuffix(sectPr, "/>"), " ") + ">"
+		documentXML = documentXML[:section.Start] + startTag + refs.String() + "</w:sectPr>" + documentXML[section.End:]
+	} else {
+		documentXML = documentXML[:section.InnerStart] + refs.String() + documentXML[section.InnerStart:]
+	}
+
+	// The r: prefix must be declared for the new references
+	if rootIdx := strings.Index(documentXML, "<w:document"); rootIdx != -1 {
+		rootEnd := tagEnd(documentXML, rootIdx)
+		rootTag := mergeNamespaces(documentXML[rootIdx:rootEnd], watermarkNamespaces)
+		documentXML = documentXML[:rootIdx] + rootTag + documentXML[rootEnd:]
+	}
+
+	return documentXML, nil
+}
+
+func hasHeaderReference(sectPr, headerType string) bool {
+	for _, ref := range findElements(sectPr, "w:headerReference") {
+		if tagAttr(ref.StartTag(sectPr), "w:type") == headerType {
+			return true
+		}
+	}
+	return false
+}
+
+// addWatermarkToHeader inserts the watermark paragraph at the top of a header part
+func (dp *DocxProcessor) addWatermarkToHeader(partName, paragraph string) error {
+	content, err := dp.readPart(partName)
+	if err != nil {
+		return err
+	}
+
+	rootIdx := strings.Index(content, "<w:hdr")
+	if rootIdx == -1 {
+		return fmt.Errorf("malformed header %s", partName)
+	}
+	rootEnd := tagEnd(content, rootIdx)
+	rootTag := mergeNamespaces(content[rootIdx:rootEnd], watermarkNamespaces)
+
+	if strings.HasSuffix(rootTag, "/>") {
+		rootTag = strings.TrimSuffix(rootTag, "/>") + ">"
+		content = content[:rootIdx] + rootTag + paragraph + "</w:hdr>" + content[rootEnd:]
+	} else {
+		content = content[:rootIdx] + rootTag + paragraph + content[rootEnd:]
+	}
+
+	return dp.writePart(partName, []byte(content))
+}
+
+func watermarkParagraph(watermark Watermark, shapeNumber int, width, height float64) string {
+	return fmt.Sprintf(`<w:p><w:pPr><w:pStyle w:val="Header"/></w:pPr><w:r><w:rPr><w:noProof/></w:rPr><w:pict>%s`+
+		`<v:shape id="PowerPlusWaterMarkObject%d" o:spid="_x0000_s%d" type="#_x0000_t136" `+
+		`style="position:absolute;margin-left:0;margin-top:0;width:%.1fpt;height:%.1fpt;rotation:315;z-index:-251657216;`+
+		`mso-position-horizontal:center;mso-position-horizontal-relative:margin;mso-position-vertical:center;mso-position-vertical-relative:margin" `+
+		`o:allowincell="f" fillcolor="%s" stroked="f"><v:fill opacity=".5"/>`+
+		`<v:textpath style="font-family:&quot;%s&quot;;font-size:1pt" string="%s"/></v:shape></w:pict></w:r></w:p>`,
+		watermarkShapeType, shapeNumber, 2048+shapeNumber, width, height,
+		EscapeXMLText(watermark.Color), EscapeXMLText(watermark.Font), EscapeXMLText(watermark.Text))
+}
@@ -0,0 +1,964 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Relationship types of workbook parts
+const (
+	RelTypeOfficeDocument = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+	RelTypeSharedStrings  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings"
+	RelTypeStyles         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles"
+	RelTypeCalcChain      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/calcChain"
+)
+
+// XlsxProcessor fills {{placeholders}} in the cells of an .xlsx workbook
+type XlsxProcessor struct {
+	inputFile  string
+	outputFile string
+	tempDir    string
+}
+
+func NewXlsxProcessor(inputFile, outputFile string) *XlsxProcessor {
+	return &XlsxProcessor{
+		inputFile:  inputFile,
+		outputFile: outputFile,
+		tempDir:    fmt.Sprintf("temp_xlsx_%d", time.Now().UnixNano()),
+	}
+}
+
+func (xp *XlsxProcessor) UnzipXlsx() error {
+	return unzipPackage(xp.inputFile, xp.tempDir)
+}
+
+func (xp *XlsxProcessor) ReZipXlsx() error {
+	return zipPackage(xp.tempDir, xp.outputFile)
+}
+
+func (xp *XlsxProcessor) Cleanup() {
+	os.RemoveAll(xp.tempDir)
+}
+
+// sheetCell is a cell of a worksheet row
+type sheetCell struct {
+	xmlElement
+	column int    // 1-based
+	text   string // Text of string cells, shared or inline
+}
+
+// sheetRow is a row of a worksheet with its cells
+type sheetRow struct {
+	xmlElement
+	number int
+	cells  []sheetCell
+	copies int // How many rows the row becomes; rows holding array values are repeated
+}
+
+// ExtractPlaceholders returns the distinct placeholders in string cells, sheet by sheet
+func (xp *XlsxProcessor) ExtractPlaceholders() ([]string, error) {
+	workbook, err := xp.openWorkbook()
+	if err != nil {
+		return nil, err
+	}
+
+	var placeholders []string
+	seen := make(map[string]bool)
+	for _, sheet := range workbook.sheets {
+		content, err := readPackagePart(xp.tempDir, sheet)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range workbook.rows(content) {
+			for _, cell := range row.cells {
+				for _, placeholder := range placeholderSpanPattern.FindAllString(cell.text, -1) {
+					if !seen[placeholder] && !IsInclude(placeholder) {
+						placeholders = append(placeholders, placeholder)
+						seen[placeholder] = true
+					}
+				}
+			}
+		}
+	}
+	return placeholders, nil
+}
+
+// FillCells replaces placeholders with values keyed by placeholder. A cell holding nothing but
+// one placeholder takes the value's type: numbers and booleans are written as such, and
+// time.Time values or ISO 8601 date strings become dates. Placeholders inside longer text are
+// replaced as text. A row with placeholders whose value is a []interface{} is repeated once per
+// item, and rows below it move down. Placeholders missing from values are left as they are.
+func (xp *XlsxProcessor) FillCells(values map[string]interface{}) error {
+	workbook, err := xp.openWorkbook()
+	if err != nil {
+		return err
+	}
+
+	// Row moves by sheet name, for the references made from elsewhere in the workbook
+	moved := make(map[string]rowMapper)
+	for i, sheet := range workbook.sheets {
+		content, err := readPackagePart(xp.tempDir, sheet)
+		if err != nil {
+			return err
+		}
+		updated, shifts := workbook.fillSheet(content, values)
+		if shifts.moves() {
+			moved[workbook.names[i]] = shifts
+			if err := xp.shiftTables(sheet, shifts); err != nil {
+				return err
+			}
+		}
+		if err := writePackagePart(xp.tempDir, sheet, []byte(updated)); err != nil {
+			return err
+		}
+	}
+	repeated := len(moved) > 0
+	if repeated {
+		if err := xp.shiftSheetReferences(workbook, moved); err != nil {
+			return err
+		}
+	}
+
+	if workbook.styles != nil && workbook.styles.changed {
+		if err := writePackagePart(xp.tempDir, workbook.stylesPart, []byte(workbook.styles.content)); err != nil {
+			return err
+		}
+	}
+
+	// Cells moved, so the calculation chain no longer matches
+	if repeated {
+		if err := xp.removeCalcChain(workbook.part); err != nil {
+			return err
+		}
+	}
+	return xp.recalculateOnLoad(workbook.part)
+}
+
+// workbook holds what filling the sheets of a workbook needs
+type workbook struct {
+	part          string
+	sheets        []string // Worksheet parts in workbook order
+	names         []string // Sheet names, as sheets
+	sharedStrings []string
+	stylesPart    string
+	styles        *xlsxStyles
+	date1904      bool
+}
+
+func (xp *XlsxProcessor) openWorkbook() (*workbook, error) {
+	wb := &workbook{part: "xl/workbook.xml"}
+	rootRels, err := readRelationships(xp.tempDir, "_rels/.rels")
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rootRels {
+		if part, ok := partTarget("", rel.Target); ok && rel.Type == RelTypeOfficeDocument {
+			wb.part = part
+		}
+	}
+
+	content, err := readPackagePart(xp.tempDir, wb.part)
+	if err != nil {
+		return nil, err
+	}
+	if workbookPr, ok := firstTag(content, "workbookPr"); ok {
+		date1904 := tagAttr(workbookPr, "date1904")
+		wb.date1904 = date1904 == "1" || date1904 == "true"
+	}
+
+	rels, err := readRelationships(xp.tempDir, relsPathFor(wb.part))
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels {
+		target, ok := partTarget(wb.part, rel.Target)
+		if !ok {
+			continue
+		}
+		switch rel.Type {
+		case RelTypeWorksheet:
+			targets[rel.ID] = target
+		case RelTypeSharedStrings:
+			shared, err := readPackagePart(xp.tempDir, target)
+			if err != nil {
+				return nil, err
+			}
+			wb.sharedStrings = parseSharedStrings(shared)
+		case RelTypeStyles:
+			styles, err := readPackagePart(xp.tempDir, target)
+			if err != nil {
+				return nil, err
+			}
+			wb.stylesPart = target
+			wb.styles = &xlsxStyles{content: styles, dateStyles: make(map[string]int)}
+		}
+	}
+
+	for _, sheet := range findElements(content, "sheet") {
+		tag := sheet.StartTag(content)
+		if target, ok := targets[tagAttr(tag, "r:id")]; ok {
+			wb.sheets = append(wb.sheets, target)
+			wb.names = append(wb.names, unescapeXMLText(tagAttr(tag, "name")))
+		}
+	}
+	return wb, nil
+}
+
+// parseSharedStrings returns the text of every shared string item, leaving out phonetic hints
+func parseSharedStrings(content string) []string {
+	var items []string
+	for _, si := range outermostElements(findElements(content, "si")) {
+		phonetic := findElementsIn(content, si.InnerStart, si.InnerEnd, "rPh")
+		var sb strings.Builder
+		for _, t := range findElementsIn(content, si.InnerStart, si.InnerEnd, "t") {
+			if !inRanges(phonetic, t.Start) {
+				sb.WriteString(unescapeXMLText(t.Inner(content)))
+			}
+		}
+		items = append(items, sb.String())
+	}
+	return items
+}
+
+// rows reads the rows of a worksheet with the text of their string cells
+func (wb *workbook) rows(content string) []sheetRow {
+	sheetData, ok := firstElement(content, "sheetData")
+	if !ok {
+		return nil
+	}
+
+	var rows []sheetRow
+	number := 0
+	for _, child := range childElementsIn(content, sheetData.InnerStart, sheetData.InnerEnd) {
+		if child.name != "row" {
+			continue
+		}
+		tag := child.StartTag(content)
+		if r, err := strconv.Atoi(tagAttr(tag, "r")); err == nil {
+			number = r
+		} else {
+			number++
+		}
+		row := sheetRow{xmlElement: child.xmlElement, number: number, copies: 1}
+
+		column := 0
+		for _, c := range childElementsIn(content, child.InnerStart, child.InnerEnd) {
+			if c.name != "c" {
+				continue
+			}
+			cellTag := c.StartTag(content)
+			if col, _, ok := splitCellRef(tagAttr(cellTag, "r")); ok {
+				column = col
+			} else {
+				column++
+			}
+			cell := sheetCell{xmlElement: c.xmlElement, column: column}
+			switch tagAttr(cellTag, "t") {
+			case "s":
+				if v, ok := childElement(content, c.xmlElement, "v"); ok {
+					if index, err := strconv.Atoi(strings.TrimSpace(v.Inner(content))); err == nil && index >= 0 && index < len(wb.sharedStrings) {
+						cell.text = wb.sharedStrings[index]
+					}
+				}
+			case "inlineStr":
+				if is, ok := childElement(content, c.xmlElement, "is"); ok {
+					cell.text = parseSharedStrings("<si>" + is.Inner(content) + "</si>")[0]
+				}
+			}
+			row.cells = append(row.cells, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// fillSheet fills one worksheet and returns how its rows moved
+func (wb *workbook) fillSheet(content string, values map[string]interface{}) (string, rowMapper) {
+	sheetData, ok := firstElement(content, "sheetData")
+	if !ok {
+		return content, nil
+	}
+	rows := wb.rows(content)
+
+	// Rows with array values are repeated once per item; an empty array leaves one blank row
+	var shifts rowMapper
+	for i := range rows {
+		for _, cell := range rows[i].cells {
+			for _, placeholder := range placeholderSpanPattern.FindAllString(cell.text, -1) {
+				if items, ok := values[placeholder].([]interface{}); ok {
+					rows[i].copies = max(rows[i].copies, len(items))
+				}
+			}
+		}
+		if rows[i].copies > 1 {
+			shifts = shifts.add(rows[i].number, rows[i].copies-1)
+		}
+	}
+
+	var sb strings.Builder
+	last := sheetData.InnerStart
+	for _, row := range rows {
+		sb.WriteString(content[last:row.Start])
+		last = row.End
+		for item := 0; item < row.copies; item++ {
+			sb.WriteString(wb.fillRow(content, row, item, shifts, values))
+		}
+	}
+	sb.WriteString(content[last:sheetData.InnerEnd])
+	content = content[:sheetData.InnerStart] + sb.String() + content[sheetData.InnerEnd:]
+
+	if !shifts.moves() {
+		return content, nil
+	}
+	return shiftSheetRanges(content, shifts), shifts
+}
+
+// fillRow writes the copy of row for array item number item, with row numbers moved by shifts
+func (wb *workbook) fillRow(content string, row sheetRow, item int, shifts rowMapper, values map[string]interface{}) string {
+	number := shifts.row(row.number) + item
+	tag := setTagAttr(row.StartTag(content), "r", strconv.Itoa(number))
+	if row.InnerStart == row.End {
+		return tag
+	}
+
+	var sb strings.Builder
+	sb.WriteString(tag)
+	last := row.InnerStart
+	for _, cell := range row.cells {
+		sb.WriteString(content[last:cell.Start])
+		last = cell.End
+		ref := columnName(cell.column-1) + strconv.Itoa(number)
+		if placeholderSpanPattern.MatchString(cell.text) {
+			sb.WriteString(wb.fillCell(content, cell, ref, item, values))
+		} else {
+			sb.WriteString(copyCell(content, cell, ref, row.number, item, shifts))
+		}
+	}
+	sb.WriteString(content[last:row.End])
+	return sb.String()
+}
+
+// fillCell writes a string cell with its placeholders replaced by the values for array item number item
+func (wb *workbook) fillCell(content string, cell sheetCell, ref string, item int, values map[string]interface{}) string {
+	style := tagAttr(cell.StartTag(content), "s")
+
+	if value, ok := itemValue(values, cell.text, item); ok {
+		switch v := value.(type) {
+		case nil:
+			return cellXML(ref, style, "", "")
+		case bool:
+			if v {
+				return cellXML(ref, style, "b", "<v>1</v>")
+			}
+			return cellXML(ref, style, "b", "<v>0</v>")
+		case string:
+			if date, withTime, ok := parseCellDate(v); ok {
+				return wb.dateCell(ref, style, date, withTime)
+			}
+		case time.Time:
+			return wb.dateCell(ref, style, v, v.Hour() != 0 || v.Minute() != 0 || v.Second() != 0)
+		}
+		if number, ok := cellNumber(value); ok {
+			return cellXML(ref, style, "", "<v>"+strconv.FormatFloat(number, 'f', -1, 64)+"</v>")
+		}
+	}
+
+	text := placeholderSpanPattern.ReplaceAllStringFunc(cell.text, func(placeholder string) string {
+		value, ok := itemValue(values, placeholder, item)
+		if !ok {
+			return placeholder
+		}
+		return cellText(value)
+	})
+	if text == "" {
+		return cellXML(ref, style, "", "")
+	}
+	return cellXML(ref, style, "inlineStr", `<is><t xml:space="preserve">`+EscapeXMLText(text)+`</t></is>`)
+}
+
+// dateCell writes a date as a serial number in a date format
+func (wb *workbook) dateCell(ref, style string, date time.Time, withTime bool) string {
+	if wb.styles != nil {
+		index, _ := strconv.Atoi(style)
+		style = strconv.Itoa(wb.styles.dateStyle(index, withTime))
+	}
+	serial := excelSerial(date, wb.date1904)
+	return cellXML(ref, style, "", "<v>"+strconv.FormatFloat(serial, 'f', -1, 64)+"</v>")
+}
+
+// copyCell rewrites a cell that has no placeholders at ref. Formula references move with the
+// rows; in copies of a repeated row, relative references to the row itself follow the copy.
+// Cached formula results are dropped so the workbook recalculates them.
+func copyCell(content string, cell sheetCell, ref string, rowNumber, item int, shifts rowMapper) string {
+	tag := setTagAttr(cell.StartTag(content), "r", ref)
+	if cell.InnerStart == cell.End {
+		return tag
+	}
+	f, ok := childElement(content, cell.xmlElement, "f")
+	if !ok {
+		return tag + content[cell.InnerStart:cell.End]
+	}
+
+	fTag := f.StartTag(content)
+	formula := f.Inner(content)
+	if item > 0 && tagAttr(fTag, "t") == "shared" {
+		// Only the first row keeps its place in a shared formula
+		if strings.TrimSpace(formula) == "" {
+			return cellXML(ref, tagAttr(cell.StartTag(content), "s"), "", "")
+		}
+		fTag = removeTagAttr(removeTagAttr(removeTagAttr(fTag, "t"), "ref"), "si")
+	}
+	if fRef := tagAttr(fTag, "ref"); fRef != "" {
+		// The range of a shared or array formula only moves; copies do not join it
+		fTag = setTagAttr(fTag, "ref", shiftFormula(fRef, func(row int, _, _ bool) int { return shifts.row(row) }))
+	}
+	mapRow := func(row int, absolute, end bool) int {
+		if item > 0 && row == rowNumber && !absolute {
+			return shifts.row(row) + item
+		}
+		if end {
+			return shifts.rangeEnd(row)
+		}
+		return shifts.row(row)
+	}
+	if !strings.HasSuffix(fTag, "/>") {
+		fTag += EscapeXMLText(shiftFormula(unescapeXMLText(formula), mapRow)) + "</f>"
+	}
+	return tag + fTag + "</c>"
+}
+
+// cellXML builds a cell element; an empty body makes an empty, styled cell
+func cellXML(ref, style, cellType, body string) string {
+	var sb strings.Builder
+	sb.WriteString(`<c r="` + ref + `"`)
+	if style != "" {
+		sb.WriteString(` s="` + style + `"`)
+	}
+	if cellType != "" {
+		sb.WriteString(` t="` + cellType + `"`)
+	}
+	if body == "" {
+		sb.WriteString("/>")
+		return sb.String()
+	}
+	sb.WriteString(">" + body + "</c>")
+	return sb.String()
+}
+
+// itemValue returns the value of placeholder in the copy of a row for array item number item.
+// Array values give their item, or nil past the end of the array; other values are the same in
+// every copy.
+func itemValue(values map[string]interface{}, placeholder string, item int) (interface{}, bool) {
+	value, ok := values[placeholder]
+	if !ok {
+		return nil, false
+	}
+	if items, isArray := value.([]interface{}); isArray {
+		if item < len(items) {
+			return items[item], true
+		}
+		return nil, true
+	}
+	return value, true
+}
+
+// cellNumber reports the numeric value of numbers
+func cellNumber(value interface{}) (float64, bool) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case float32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	default:
+		return 0, false
+	}
+	return number, !math.IsNaN(number) && !math.IsInf(number, 0)
+}
+
+// cellText formats a value placed inside text
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02")
+	}
+	if number, ok := cellNumber(value); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// cellDateLayouts are the ISO 8601 forms written as dates
+var cellDateLayouts = []struct {
+	layout   string
+	withTime bool
+}{
+	{"2006-01-02", false},
+	{"2006-01-02T15:04:05Z07:00", true},
+	{"2006-01-02T15:04:05", true},
+	{"2006-01-02 15:04:05", true},
+	{"2006-01-02T15:04", true},
+	{"2006-01-02 15:04", true},
+}
+
+func parseCellDate(s string) (time.Time, bool, bool) {
+	for _, layout := range cellDateLayouts {
+		if date, err := time.Parse(layout.layout, s); err == nil {
+			return date, layout.withTime, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// excelSerial converts the wall clock time of t to a spreadsheet serial date
+func excelSerial(t time.Time, date1904 bool) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := wall.Sub(epoch).Hours() / 24
+	return math.Round(days*86400) / 86400
+}
+
+// rowMapper moves row numbers below repeated rows
+type rowMapper []rowShift
+
+// rowShift adds extra rows after row
+type rowShift struct {
+	row   int
+	extra int
+}
+
+func (m rowMapper) add(row, extra int) rowMapper {
+	for _, shift := range m {
+		if shift.row == row {
+			return m
+		}
+	}
+	m = append(m, rowShift{row, extra})
+	sort.Slice(m, func(i, j int) bool { return m[i].row < m[j].row })
+	return m
+}
+
+// moves reports whether any row changes number
+func (m rowMapper) moves() bool {
+	for _, shift := range m {
+		if shift.extra != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// row returns the new number of row, or of the first copy of a repeated row
+func (m rowMapper) row(row int) int {
+	number := row
+	for _, shift := range m {
+		if shift.row < row {
+			number += shift.extra
+		}
+	}
+	return number
+}
+
+// rangeEnd is row for the end of a range, which takes in every copy of a repeated row
+func (m rowMapper) rangeEnd(row int) int {
+	number := m.row(row)
+	for _, shift := range m {
+		if shift.row == row {
+			number += shift.extra
+		}
+	}
+	return number
+}
+
+// cellRefPattern matches A1 style references and ranges such as $B$2 or A1:C10
+var cellRefPattern = regexp.MustCompile(`(\$?)([A-Z]{1,3})(\$?)([0-9]+)(?::(\$?)([A-Z]{1,3})(\$?)([0-9]+))?`)
+
+// shiftFormula rewrites the cell references of formula with mapRow, leaving string literals,
+// function names and references to other sheets alone
+func shiftFormula(formula string, mapRow func(row int, absolute, end bool) int) string {
+	var sb strings.Builder
+	inString := false
+	last := 0
+	for _, m := range cellRefPattern.FindAllStringSubmatchIndex(formula, -1) {
+		start, end := m[0], m[1]
+		if strings.Count(formula[last:start], `"`)%2 == 1 {
+			inString = !inString
+		}
+		sb.WriteString(formula[last:start])
+		last = end
+		if inString || !isReferenceBoundary(formula, start, end) {
+			sb.WriteString(formula[start:end])
+			continue
+		}
+
+		match := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return formula[m[2*i]:m[2*i+1]]
+		}
+		row, _ := strconv.Atoi(match(4))
+		isRange := match(8) != ""
+		sb.WriteString(match(1) + match(2) + match(3) + strconv.Itoa(mapRow(row, match(3) == "$", false)))
+		if isRange {
+			endRow, _ := strconv.Atoi(match(8))
+			sb.WriteString(":" + match(5) + match(6) + match(7) + strconv.Itoa(mapRow(endRow, match(7) == "$", true)))
+		}
+	}
+	sb.WriteString(formula[last:])
+	return sb.String()
+}
+
+// isReferenceBoundary reports whether formula[start:end] stands alone as a reference of this
+// sheet rather than being part of a name, a function call or a reference to another sheet
+func isReferenceBoundary(formula string, start, end int) bool {
+	if start > 0 {
+		prev := formula[start-1]
+		if prev == '!' || prev == '_' || prev == '.' || prev == '\'' || isAlphaNumeric(prev) {
+			return false
+		}
+	}
+	if end < len(formula) {
+		next := formula[end]
+		if next == '(' || next == '_' || next == '.' || next == '!' || isAlphaNumeric(next) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphaNumeric(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// shiftRangeList moves a space separated list of references such as an sqref
+func shiftRangeList(refs string, shifts rowMapper) string {
+	return shiftFormula(refs, func(row int, _, end bool) int {
+		if end {
+			return shifts.rangeEnd(row)
+		}
+		return shifts.row(row)
+	})
+}
+
+// shiftSheetRanges moves the references outside sheetData after rows were repeated. Merged
+// cells within a repeated row are merged again in every copy.
+func shiftSheetRanges(content string, shifts rowMapper) string {
+	for _, spec := range []struct{ element, attr string }{
+		{"dimension", "ref"},
+		{"autoFilter", "ref"},
+		{"hyperlink", "ref"},
+		{"conditionalFormatting", "sqref"},
+		{"dataValidation", "sqref"},
+	} {
+		elements := findElements(content, spec.element)
+		for i := len(elements) - 1; i >= 0; i-- {
+			tag := elements[i].StartTag(content)
+			value := tagAttr(tag, spec.attr)
+			if value == "" {
+				continue
+			}
+			updated := setTagAttr(tag, spec.attr, shiftRangeList(value, shifts))
+			content = content[:elements[i].Start] + updated + content[elements[i].Start+len(tag):]
+		}
+	}
+
+	mergeCells, ok := firstElement(content, "mergeCells")
+	if !ok {
+		return content
+	}
+	var merges []string
+	for _, merge := range findElementsIn(content, mergeCells.InnerStart, mergeCells.InnerEnd, "mergeCell") {
+		ref := tagAttr(merge.StartTag(content), "ref")
+		startCol, startRow, okStart := splitCellRef(strings.Split(ref, ":")[0])
+		endCol, endRow, okEnd := splitCellRef(ref[strings.LastIndex(ref, ":")+1:])
+		copies := 1 + shifts.rangeEnd(startRow) - shifts.row(startRow)
+		if !okStart || !okEnd || startRow != endRow || copies == 1 {
+			merges = append(merges, `<mergeCell ref="`+shiftRangeList(ref, shifts)+`"/>`)
+			continue
+		}
+		for item := 0; item < copies; item++ {
+			row := strconv.Itoa(shifts.row(startRow) + item)
+			merges = append(merges, `<mergeCell ref="`+columnName(startCol-1)+row+":"+columnName(endCol-1)+row+`"/>`)
+		}
+	}
+	tag := setTagAttr(mergeCells.StartTag(content), "count", strconv.Itoa(len(merges)))
+	return content[:mergeCells.Start] + tag + strings.Join(merges, "") + "</mergeCells>" + content[mergeCells.End:]
+}
+
+// shiftTables moves the ranges of the tables on a worksheet whose rows were repeated. A table
+// ending at a repeated row grows to take in every copy.
+func (xp *XlsxProcessor) shiftTables(sheetPart string, shifts rowMapper) error {
+	rels, err := readRelationships(xp.tempDir, relsPathFor(sheetPart))
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		tablePart, ok := partTarget(sheetPart, rel.Target)
+		if !ok || rel.Type != RelTypeTable {
+			continue
+		}
+		content, err := readPackagePart(xp.tempDir, tablePart)
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"table", "autoFilter", "sortState"} {
+			elements := findElements(content, name)
+			for i := len(elements) - 1; i >= 0; i-- {
+				tag := elements[i].StartTag(content)
+				if value := tagAttr(tag, "ref"); value != "" {
+					updated := setTagAttr(tag, "ref", shiftRangeList(value, shifts))
+					content = content[:elements[i].Start] + updated + content[elements[i].Start+len(tag):]
+				}
+			}
+		}
+		if err := writePackagePart(xp.tempDir, tablePart, []byte(content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftSheetReferences moves the references to sheets whose rows were repeated that are made
+// by name: in the formulas of every sheet and in the workbook's defined names, such as print
+// areas. moved holds the row moves by sheet name.
+func (xp *XlsxProcessor) shiftSheetReferences(wb *workbook, moved map[string]rowMapper) error {
+	parts := append([]string{wb.part}, wb.sheets...)
+	for _, part := range parts {
+		content, err := readPackagePart(xp.tempDir, part)
+		if err != nil {
+			return err
+		}
+		name := "f"
+		if part == wb.part {
+			name = "definedName"
+		}
+		changed := false
+		elements := findElements(content, name)
+		for i := len(elements) - 1; i >= 0; i-- {
+			if elements[i].InnerStart == elements[i].End {
+				continue // Self-closing, as shared formulas past their first cell
+			}
+			formula := unescapeXMLText(elements[i].Inner(content))
+			updated := shiftSheetFormula(formula, moved)
+			if updated == formula {
+				continue
+			}
+			content = content[:elements[i].InnerStart] + EscapeXMLText(updated) + content[elements[i].InnerEnd:]
+			changed = true
+		}
+		if changed {
+			if err := writePackagePart(xp.tempDir, part, []byte(content)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sheetRefPattern matches a reference to another sheet such as Totals!B2 or 'Q1 Sales'!$A$1:$D$9
+var sheetRefPattern = regexp.MustCompile(`('(?:[^']|'')+'|[A-Za-z_][A-Za-z0-9_.]*)!(\$?[A-Z]{1,3}\$?[0-9]+(?::\$?[A-Z]{1,3}\$?[0-9]+)?)`)
+
+// shiftSheetFormula rewrites the references of formula to the sheets in moved, leaving string
+// literals, other workbooks and references spanning several sheets alone
+func shiftSheetFormula(formula string, moved map[string]rowMapper) string {
+	var sb strings.Builder
+	inString := false
+	last := 0
+	for _, m := range sheetRefPattern.FindAllStringSubmatchIndex(formula, -1) {
+		start, end := m[0], m[1]
+		if strings.Count(formula[last:start], `"`)%2 == 1 {
+			inString = !inString
+		}
+		sb.WriteString(formula[last:start])
+		last = end
+
+		sheet := formula[m[2]:m[3]]
+		if strings.HasPrefix(sheet, "'") {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		}
+		shifts, ok := moved[sheet]
+		standsAlone := (start == 0 || !strings.ContainsRune("]:!_.'", rune(formula[start-1])) && !isAlphaNumeric(formula[start-1])) &&
+			(end == len(formula) || !strings.ContainsRune("(_.!", rune(formula[end])) && !isAlphaNumeric(formula[end]))
+		if inString || !ok || !standsAlone {
+			sb.WriteString(formula[start:end])
+			continue
+		}
+		sb.WriteString(formula[m[2]:m[3]] + "!" + shiftRangeList(formula[m[4]:m[5]], shifts))
+	}
+	sb.WriteString(formula[last:])
+	return sb.String()
+}
+
+// splitCellRef splits a reference such as $B$12 into its 1-based column and row
+func splitCellRef(ref string) (int, int, bool) {
+	ref = strings.ReplaceAll(ref, "$", "")
+	i := 0
+	column := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		column = column*26 + int(ref[i]-'A'+1)
+		i++
+	}
+	row, err := strconv.Atoi(ref[i:])
+	if i == 0 || err != nil {
+		return 0, 0, false
+	}
+	return column, row, true
+}
+
+// xlsxStyles adds cell formats to styles.xml as dates need them
+type xlsxStyles struct {
+	content    string
+	changed    bool
+	dateStyles map[string]int // Date variant of a cell format, keyed by index and time flag
+}
+
+// Built-in number formats for dates: m/d/yyyy and m/d/yyyy h:mm
+const (
+	numFmtDate     = 14
+	numFmtDateTime = 22
+)
+
+// dateStyle returns a cell format showing dates that otherwise looks like format index
+func (st *xlsxStyles) dateStyle(index int, withTime bool) int {
+	key := fmt.Sprintf("%d/%v", index, withTime)
+	if style, ok := st.dateStyles[key]; ok {
+		return style
+	}
+
+	cellXfs, ok := firstElement(st.content, "cellXfs")
+	if !ok {
+		return index
+	}
+	var xfs []namedElement
+	for _, child := range childElementsIn(st.content, cellXfs.InnerStart, cellXfs.InnerEnd) {
+		if child.name == "xf" {
+			xfs = append(xfs, child)
+		}
+	}
+	if index < 0 || index >= len(xfs) {
+		index = 0
+	}
+	if len(xfs) == 0 {
+		return index
+	}
+
+	xf := xfs[index]
+	xfTag := xf.StartTag(st.content)
+	numFmtID, _ := strconv.Atoi(tagAttr(xfTag, "numFmtId"))
+	if st.isDateFormat(numFmtID) {
+		st.dateStyles[key] = index
+		return index
+	}
+
+	numFmt := numFmtDate
+	if withTime {
+		numFmt = numFmtDateTime
+	}
+	tag := setTagAttr(setTagAttr(xfTag, "numFmtId", strconv.Itoa(numFmt)), "applyNumberFormat", "1")
+	clone := tag + st.content[xf.Start+len(xfTag):xf.End]
+	updatedTag := setTagAttr(cellXfs.StartTag(st.content), "count", strconv.Itoa(len(xfs)+1))
+
+	st.content = st.content[:cellXfs.Start] + updatedTag + st.content[cellXfs.Start+len(cellXfs.StartTag(st.content)):cellXfs.InnerEnd] + clone + st.content[cellXfs.InnerEnd:]
+	st.changed = true
+	st.dateStyles[key] = len(xfs)
+	return len(xfs)
+}
+
+// isDateFormat reports whether a number format shows dates or times
+func (st *xlsxStyles) isDateFormat(numFmtID int) bool {
+	switch {
+	case numFmtID >= 14 && numFmtID <= 22, numFmtID >= 27 && numFmtID <= 36, numFmtID >= 45 && numFmtID <= 47, numFmtID >= 50 && numFmtID <= 58:
+		return true
+	case numFmtID < 164:
+		return false
+	}
+	for _, numFmt := range findElements(st.content, "numFmt") {
+		tag := numFmt.StartTag(st.content)
+		if tagAttr(tag, "numFmtId") != strconv.Itoa(numFmtID) {
+			continue
+		}
+		code := unescapeXMLText(tagAttr(tag, "formatCode"))
+		code = quotedFormatText.ReplaceAllString(code, "")
+		return strings.ContainsAny(strings.ToLower(code), "ymdhs")
+	}
+	return false
+}
+
+// quotedFormatText matches literal text, escapes and bracketed sections of a format code
+var quotedFormatText = regexp.MustCompile(`"[^"]*"|\\.|\[[^\]]*\]`)
+
+// removeCalcChain deletes the calculation chain, which Excel rebuilds when it is missing
+func (xp *XlsxProcessor) removeCalcChain(workbookPart string) error {
+	targets, err := removeRelationships(xp.tempDir, relsPathFor(workbookPart), RelTypeCalcChain)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		part, ok := partTarget(workbookPart, target)
+		if !ok {
+			continue
+		}
+		if err := removePackagePart(xp.tempDir, part); err != nil {
+			return err
+		}
+		if err := removeContentType(xp.tempDir, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recalculateOnLoad asks spreadsheet applications to recalculate every formula when the
+// workbook is opened, as their cached results predate the filled values
+func (xp *XlsxProcessor) recalculateOnLoad(workbookPart string) error {
+	content, err := readPackagePart(xp.tempDir, workbookPart)
+	if err != nil {
+		return err
+	}
+
+	if calcPr, ok := firstElement(content, "calcPr"); ok {
+		tag := calcPr.StartTag(content)
+		content = content[:calcPr.Start] + setTagAttr(tag, "fullCalcOnLoad", "1") + content[calcPr.Start+len(tag):]
+	} else {
+		// calcPr follows these elements in the schema
+		insertAt := -1
+		for _, name := range []string{"sheets", "functionGroups", "externalReferences", "definedNames"} {
+			if element, ok := firstElement(content, name); ok {
+				insertAt = max(insertAt, element.End)
+			}
+		}
+		if insertAt == -1 {
+			return nil
+		}
+		content = content[:insertAt] + `<calcPr fullCalcOnLoad="1"/>` + content[insertAt:]
+	}
+	return writePackagePart(xp.tempDir, workbookPart, []byte(content))
+}
+
+// firstElement returns the first element called name in content
+func firstElement(content, name string) (xmlElement, bool) {
+	elements := findElements(content, name)
+	if len(elements) == 0 {
+		return xmlElement{}, false
+	}
+	return elements[0], true
+}
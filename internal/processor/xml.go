@@ -0,0 +1,338 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// xmlElement marks the byte range of one element inside an XML string
+type xmlElement struct {
+	Start      int // Index of the opening '<'
+	End        int // Index just past the closing '>'
+	InnerStart int // First byte after the start tag (equals End for self-closing elements)
+	InnerEnd   int // Index of the end tag's '<' (equals End for self-closing elements)
+}
+
+// StartTag returns the element's start tag, e.g. `<w:p w:rsidR="00AB">`
+func (e xmlElement) StartTag(content string) string {
+	if e.InnerStart == e.End && e.InnerEnd == e.End {
+		return content[e.Start:e.End]
+	}
+	return content[e.Start:e.InnerStart]
+}
+
+// Inner returns the element content between its start and end tags
+func (e xmlElement) Inner(content string) string {
+	return content[e.InnerStart:e.InnerEnd]
+}
+
+// Outer returns the whole element including its tags
+func (e xmlElement) Outer(content string) string {
+	return content[e.Start:e.End]
+}
+
+// isTagAt reports whether an element called name starts at pos (pos points at '<')
+func isTagAt(content string, pos int, name string) bool {
+	if !strings.HasPrefix(content[pos:], "<"+name) {
+		return false
+	}
+	next := pos + 1 + len(name)
+	if next >= len(content) {
+		return false
+	}
+	switch content[next] {
+	case ' ', '>', '/', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// tagEnd returns the index just past the '>' that closes the tag starting at pos
+func tagEnd(content string, pos int) int {
+	inQuote := byte(0)
+	for i := pos; i < len(content); i++ {
+		ch := content[i]
+		if inQuote != 0 {
+			if ch == inQuote {
+				inQuote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			inQuote = ch
+		case '>':
+			return i + 1
+		}
+	}
+	return len(content)
+}
+
+// findElements returns every element called name in document order, including nested ones
+func findElements(content, name string) []xmlElement {
+	return findElementsIn(content, 0, len(content), name)
+}
+
+// findElementsIn is findElements restricted to content[from:to]
+func findElementsIn(content string, from, to int, name string) []xmlElement {
+	var elements []xmlElement
+	open := "<" + name
+	pos := from
+
+	for pos < to {
+		idx := strings.Index(content[pos:to], open)
+		if idx == -1 {
+			break
+		}
+		start := pos + idx
+		if !isTagAt(content, start, name) {
+			pos = start + len(open)
+			continue
+		}
+
+		element, ok := matchElement(content, start, to, name)
+		if !ok {
+			break
+		}
+		elements = append(elements, element)
+		pos = element.InnerStart
+	}
+
+	return elements
+}
+
+// matchElement finds the end tag that balances the start tag at start
+func matchElement(content string, start, limit int, name string) (xmlElement, bool) {
+	startEnd := tagEnd(content, start)
+	if startEnd > limit {
+		return xmlElement{}, false
+	}
+	if content[startEnd-2] == '/' {
+		return xmlElement{Start: start, End: startEnd, InnerStart: startEnd, InnerEnd: startEnd}, true
+	}
+
+	open := "<" + name
+	closeTag := "</" + name + ">"
+	depth := 1
+	pos := startEnd
+
+	for pos < limit {
+		nextClose := strings.Index(content[pos:limit], closeTag)
+		if nextClose == -1 {
+			return xmlElement{}, false
+		}
+		nextClose += pos
+
+		// Count nested openings of the same element before this close tag
+		searchPos := pos
+		for {
+			nextOpen := strings.Index(content[searchPos:nextClose], open)
+			if nextOpen == -1 {
+				break
+			}
+			nextOpen += searchPos
+			if isTagAt(content, nextOpen, name) {
+				openEnd := tagEnd(content, nextOpen)
+				if content[openEnd-2] != '/' {
+					depth++
+				}
+				searchPos = openEnd
+			} else {
+				searchPos = nextOpen + len(open)
+			}
+		}
+
+		depth--
+		if depth == 0 {
+			return xmlElement{
+				Start:      start,
+				End:        nextClose + len(closeTag),
+				InnerStart: startEnd,
+				InnerEnd:   nextClose,
+			}, true
+		}
+		pos = nextClose + len(closeTag)
+	}
+
+	return xmlElement{}, false
+}
+
+// outermostElements drops elements nested inside an earlier element of the list
+func outermostElements(elements []xmlElement) []xmlElement {
+	var result []xmlElement
+	lastEnd := -1
+	for _, element := range elements {
+		if element.Start < lastEnd {
+			continue
+		}
+		result = append(result, element)
+		lastEnd = element.End
+	}
+	return result
+}
+
+// enclosingElement returns the innermost element called name that contains pos
+func enclosingElement(content string, pos int, name string) (xmlElement, bool) {
+	var found xmlElement
+	ok := false
+	for _, element := range findElements(content, name) {
+		if element.Start > pos {
+			break
+		}
+		if pos < element.End {
+			found = element
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// childElement returns the first direct child of parent called name
+func childElement(content string, parent xmlElement, name string) (xmlElement, bool) {
+	pos := parent.InnerStart
+	for pos < parent.InnerEnd {
+		idx := strings.IndexByte(content[pos:parent.InnerEnd], '<')
+		if idx == -1 || strings.HasPrefix(content[pos+idx:], "</") {
+			break
+		}
+		pos += idx
+		if strings.HasPrefix(content[pos:], "<!--") {
+			commentEnd := strings.Index(content[pos:parent.InnerEnd], "-->")
+			if commentEnd == -1 {
+				break
+			}
+			pos += commentEnd + 3
+			continue
+		}
+
+		nameEnd := pos + 1
+		for nameEnd < parent.InnerEnd && !strings.ContainsRune(" \t\r\n/>", rune(content[nameEnd])) {
+			nameEnd++
+		}
+		childName := content[pos+1 : nameEnd]
+		child, ok := matchElement(content, pos, parent.InnerEnd, childName)
+		if !ok {
+			break
+		}
+		if childName == name {
+			return child, true
+		}
+		pos = child.End
+	}
+	return xmlElement{}, false
+}
+
+// tagAttr reads an attribute value from a start tag
+func tagAttr(tag, name string) string {
+	search := " " + name + `="`
+	idx := strings.Index(tag, search)
+	if idx == -1 {
+		search = " " + name + `='`
+		idx = strings.Index(tag, search)
+		if idx == -1 {
+			return ""
+		}
+	}
+	start := idx + len(search)
+	quote := search[len(search)-1]
+	end := strings.IndexByte(tag[start:], quote)
+	if end == -1 {
+		return ""
+	}
+	return tag[start : start+end]
+}
+
+// setTagAttr sets or adds an attribute on a start tag
+func setTagAttr(tag, name, value string) string {
+	search := " " + name + `="`
+	if idx := strings.Index(tag, search); idx != -1 {
+		start := idx + len(search)
+		end := strings.IndexByte(tag[start:], '"')
+		if end != -1 {
+			return tag[:start] + value + tag[start+end:]
+		}
+	}
+
+	insertAt := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		insertAt = len(tag) - 2
+	}
+	return tag[:insertAt] + fmt.Sprintf(` %s="%s"`, name, value) + tag[insertAt:]
+}
+
+// removeTagAttr removes an attribute from a start tag
+func removeTagAttr(tag, name string) string {
+	for _, quote := range []string{`"`, `'`} {
+		search := " " + name + "=" + quote
+		idx := strings.Index(tag, search)
+		if idx == -1 {
+			continue
+		}
+		end := strings.Index(tag[idx+len(search):], quote)
+		if end == -1 {
+			return tag
+		}
+		return tag[:idx] + tag[idx+len(search)+end+1:]
+	}
+	return tag
+}
+
+// elementText concatenates the text of every w:t element inside the fragment
+func elementText(fragment string) string {
+	var sb strings.Builder
+	for _, t := range findElements(fragment, "w:t") {
+		sb.WriteString(unescapeXMLText(t.Inner(fragment)))
+	}
+	return sb.String()
+}
+
+var xmlnsPattern = regexp.MustCompile(`xmlns:([A-Za-z0-9_]+)="([^"]*)"`)
+
+// mergeNamespaces copies namespace declarations from src's root tag that are missing in dst's root tag
+func mergeNamespaces(dstRootTag, srcRootTag string) string {
+	for _, match := range xmlnsPattern.FindAllStringSubmatch(srcRootTag, -1) {
+		if !strings.Contains(dstRootTag, "xmlns:"+match[1]+"=") {
+			dstRootTag = setTagAttr(dstRootTag, "xmlns:"+match[1], match[2])
+		}
+	}
+	return dstRootTag
+}
+
+// EscapeXMLText escapes text for element content and attribute values, dropping characters
+// that XML 1.0 does not allow, such as the vertical tab, which would make the part unreadable
+func EscapeXMLText(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if !isXMLChar(r) {
+			continue
+		}
+		switch r {
+		case '&':
+			sb.WriteString("&amp;")
+		case '<':
+			sb.WriteString("&lt;")
+		case '>':
+			sb.WriteString("&gt;")
+		case '"':
+			sb.WriteString("&quot;")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// isXMLChar reports whether XML 1.0 allows r in a document
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || (r >= 0x10000 && r <= 0x10FFFF)
+}
+
+func unescapeXMLText(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	replacer := strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&amp;", "&")
+	return replacer.Replace(s)
+}
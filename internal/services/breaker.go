@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the converter while it is considered down
+var ErrCircuitOpen = errors.New("PDF converter is unavailable")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Requests pass
+	BreakerOpen     = "open"      // Requests fail fast until the cooldown ends
+	BreakerHalfOpen = "half-open" // One probe request decides whether to close or reopen
+)
+
+// BreakerState is a snapshot of a circuit breaker for /health
+type BreakerState struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// circuitBreaker opens after threshold consecutive failures and lets a single probe through
+// once cooldown has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// Allow reports whether a request may be sent. Every allowed request must end with Success,
+// Failure or Release.
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		retryAt := b.openedAt.Add(b.cooldown)
+		if time.Now().Before(retryAt) {
+			return fmt.Errorf("%w after %d failures; retrying after %s", ErrCircuitOpen, b.failures, retryAt.UTC().Format(time.RFC3339))
+		}
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probing {
+			return fmt.Errorf("%w; a probe request is in progress", ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success records that the converter answered
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		fmt.Printf("[DEBUG] PDF converter is back; circuit closed\n")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records that the converter could not be reached or was overloaded
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			fmt.Printf("Warning: PDF converter failed %d times in a row; circuit open for %v\n", b.failures, b.cooldown)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends an allowed request that says nothing about the converter, such as one the
+// caller cancelled
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) Snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := BreakerState{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state == BreakerOpen && time.Now().After(b.openedAt.Add(b.cooldown)) {
+		snapshot.State = BreakerHalfOpen // The next request probes
+	}
+	if b.state != BreakerClosed {
+		openedAt, retryAt := b.openedAt.UTC(), b.openedAt.Add(b.cooldown).UTC()
+		snapshot.OpenedAt, snapshot.RetryAt = &openedAt, &retryAt
+	}
+	return snapshot
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, 20*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		b.Failure()
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to be open, got %v", err)
+	}
+
+	// After the cooldown a single probe is let through
+	time.Sleep(30 * time.Millisecond)
+	if state := b.Snapshot().State; state != BreakerHalfOpen {
+		t.Errorf("breaker is %s after the cooldown, want half-open", state)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a probe, got %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a second probe to be refused, got %v", err)
+	}
+
+	// A failed probe reopens the circuit and a successful one closes it
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a failed probe to reopen the circuit, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expected a probe, got %v", err)
+	}
+	b.Success()
+	if snapshot := b.Snapshot(); snapshot.State != BreakerClosed || snapshot.ConsecutiveFailures != 0 {
+		t.Errorf("got %+v after a successful probe, want closed", snapshot)
+	}
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	b := newCircuitBreaker(1, time.Millisecond)
+	b.Allow()
+	b.Failure()
+	time.Sleep(5 * time.Millisecond)
+
+	// A cancelled probe says nothing about the converter, so another may follow
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Release()
+	if err := b.Allow(); err != nil {
+		t.Errorf("expected a new probe after a released one, got %v", err)
+	}
+}
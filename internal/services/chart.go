@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"DF-PLCH/internal/processor"
+)
+
+// ErrInvalidChartData wraps chart values that cannot be plotted so handlers can answer 400
+var ErrInvalidChartData = errors.New("invalid chart data")
+
+// applyChartBindings fills the charts bound to placeholders with the submitted values.
+// Charts whose placeholder has no value keep the template's data.
+func applyChartBindings(proc *processor.DocxProcessor, data map[string]interface{}) error {
+	placeholders, err := proc.ChartPlaceholders()
+	if err != nil {
+		return fmt.Errorf("failed to find chart bindings: %w", err)
+	}
+	if len(placeholders) == 0 {
+		return nil
+	}
+
+	values := make(map[string]processor.ChartData)
+	for _, placeholder := range placeholders {
+		value, exists := lookupValue(data, placeholder)
+		if !exists || value == nil {
+			continue
+		}
+		chartData, err := parseChartData(placeholderName(placeholder), value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidChartData, placeholder, err)
+		}
+		values[placeholder] = chartData
+	}
+
+	updated, err := proc.ApplyChartData(values)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[DEBUG] Updated %d charts\n", updated)
+	return nil
+}
+
+// parseChartData accepts either
+//
+//	{"categories": ["Q1", "Q2"], "series": [{"name": "Revenue", "values": [10, 12]}]}
+//
+// or, for a single series named after the placeholder, an array of points
+//
+//	[{"label": "Q1", "value": 10}, {"label": "Q2", "value": 12}]
+func parseChartData(name string, value interface{}) (processor.ChartData, error) {
+	var chartData processor.ChartData
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		categories, ok := v["categories"].([]interface{})
+		if !ok {
+			return chartData, fmt.Errorf("categories must be an array")
+		}
+		for _, category := range categories {
+			chartData.Categories = append(chartData.Categories, fmt.Sprint(category))
+		}
+
+		series, ok := v["series"].([]interface{})
+		if !ok || len(series) == 0 {
+			return chartData, fmt.Errorf("series must be a non-empty array")
+		}
+		for i, raw := range series {
+			entry, ok := raw.(map[string]interface{})
+			if !ok {
+				return chartData, fmt.Errorf("series %d must be an object", i+1)
+			}
+			s := processor.ChartSeries{Name: fmt.Sprint(entry["name"])}
+			if entry["name"] == nil {
+				s.Name = fmt.Sprintf("Series %d", i+1)
+			}
+			points, ok := entry["values"].([]interface{})
+			if !ok {
+				return chartData, fmt.Errorf("series %d values must be an array", i+1)
+			}
+			for j, point := range points {
+				number, err := chartNumber(point)
+				if err != nil {
+					return chartData, fmt.Errorf("series %d value %d: %v", i+1, j+1, err)
+				}
+				s.Values = append(s.Values, number)
+			}
+			chartData.Series = append(chartData.Series, s)
+		}
+
+	case []interface{}:
+		if len(v) == 0 {
+			return chartData, fmt.Errorf("at least one point is required")
+		}
+		s := processor.ChartSeries{Name: name}
+		for i, raw := range v {
+			point, ok := raw.(map[string]interface{})
+			if !ok {
+				return chartData, fmt.Errorf("point %d must be an object with label and value", i+1)
+			}
+			number, err := chartNumber(point["value"])
+			if err != nil {
+				return chartData, fmt.Errorf("point %d: %v", i+1, err)
+			}
+			chartData.Categories = append(chartData.Categories, fmt.Sprint(point["label"]))
+			s.Values = append(s.Values, number)
+		}
+		chartData.Series = []processor.ChartSeries{s}
+
+	default:
+		return chartData, fmt.Errorf("value must be an object with categories and series or an array of points")
+	}
+
+	return chartData, nil
+}
+
+// chartNumber reads a plotted value from a JSON number or numeric string
+func chartNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		number, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("value must be a number")
+}
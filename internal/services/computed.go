@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"DF-PLCH/internal/expression"
+	"DF-PLCH/internal/models"
+)
+
+// placeholderName strips the {{ }} delimiters so "{{firstName}}" and "firstName" refer to the same value
+func placeholderName(key string) string {
+	name := strings.TrimSpace(key)
+	if strings.HasPrefix(name, "{{") && strings.HasSuffix(name, "}}") {
+		name = strings.TrimSpace(name[2 : len(name)-2])
+	}
+	return name
+}
+
+// placeholderKey wraps a bare name in {{ }} delimiters
+func placeholderKey(name string) string {
+	return "{{" + placeholderName(name) + "}}"
+}
+
+// lookupValue finds the submitted value for a placeholder, accepting keys with or without delimiters
+func lookupValue(data map[string]interface{}, placeholder string) (interface{}, bool) {
+	if value, exists := data[placeholder]; exists {
+		return value, true
+	}
+	value, exists := data[placeholderName(placeholder)]
+	return value, exists
+}
+
+// maxComputedFields bounds the fields of a template; with the expression language's limits it
+// bounds the work and memory of every render
+const maxComputedFields = 100
+
+// ValidateComputedFields normalizes field names and compiles every expression
+func ValidateComputedFields(fields []models.ComputedField) ([]models.ComputedField, error) {
+	if len(fields) > maxComputedFields {
+		return nil, fmt.Errorf("a template may have at most %d computed fields, got %d", maxComputedFields, len(fields))
+	}
+	normalized := make([]models.ComputedField, 0, len(fields))
+	seen := make(map[string]bool)
+
+	for i, field := range fields {
+		name := placeholderName(field.Name)
+		if name == "" {
+			return nil, fmt.Errorf("computed field %d: name is required", i+1)
+		}
+		if strings.ContainsAny(name, "{} ") {
+			return nil, fmt.Errorf("computed field %q: name must not contain braces or spaces", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("computed field %q is defined more than once", name)
+		}
+		seen[name] = true
+
+		if _, err := expression.Parse(field.Expression); err != nil {
+			return nil, fmt.Errorf("computed field %q: %w", name, err)
+		}
+
+		normalized = append(normalized, models.ComputedField{Name: name, Expression: field.Expression})
+	}
+
+	return normalized, nil
+}
+
+// ParseComputedFields decodes the JSON stored on a template
+func ParseComputedFields(raw string) ([]models.ComputedField, error) {
+	var fields []models.ComputedField
+	if raw == "" {
+		return fields, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal computed fields: %w", err)
+	}
+	return fields, nil
+}
+
+// applyComputedFields evaluates computed fields in declaration order, so later fields
+// may use earlier ones, and stores each result under its {{name}} key
+func applyComputedFields(fields []models.ComputedField, data map[string]interface{}) (map[string]interface{}, error) {
+	if len(fields) > maxComputedFields {
+		return nil, fmt.Errorf("template has %d computed fields, more than the %d allowed", len(fields), maxComputedFields)
+	}
+	result := make(map[string]interface{}, len(data)+len(fields))
+	vars := make(map[string]interface{}, len(data)+len(fields))
+	for key, value := range data {
+		result[key] = value
+		vars[placeholderName(key)] = value
+	}
+
+	for _, field := range fields {
+		expr, err := expression.Parse(field.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("computed field %q: %w", field.Name, err)
+		}
+
+		value, err := expr.Evaluate(vars)
+		if err != nil {
+			return nil, fmt.Errorf("computed field %q: %w", field.Name, err)
+		}
+
+		vars[field.Name] = value
+		delete(result, field.Name)
+		result[placeholderKey(field.Name)] = value
+	}
+
+	return result, nil
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+)
+
+// ErrConversionFailed is returned when a file cannot be converted to another format
+var ErrConversionFailed = errors.New("document conversion failed")
+
+// libreOfficeFilters are the LibreOffice export filters of the formats documents convert to
+var libreOfficeFilters = map[string]string{
+	processor.FormatDocx: "docx:MS Word 2007 XML",
+	processor.FormatOdt:  "odt:writer8",
+	processor.FormatDoc:  "doc:MS Word 97",
+	processor.FormatRtf:  "rtf:Rich Text Format",
+	processor.FormatTxt:  "txt:Text (encoded):UTF8",
+	"pdf":                "pdf", // LibreOffice picks the Writer, Calc or Impress export
+}
+
+// LibreOfficeConverter converts between word processing formats with a local LibreOffice, and
+// renders PDF pages as PNG images with pdftoppm. Gotenberg's LibreOffice route only produces
+// PDF, so it cannot stand in here. It is also a PDFConverter for hosts without Gotenberg,
+// merging PDFs with pdfunite.
+type LibreOfficeConverter struct {
+	path     string
+	pdftoppm string
+	pdfunite string
+	timeout  time.Duration
+}
+
+func NewLibreOfficeConverter(path, pdftoppm, pdfunite, timeoutStr string) *LibreOfficeConverter {
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		timeout = 60 * time.Second
+		fmt.Printf("Warning: failed to parse LibreOffice timeout '%s', using default 60s: %v\n", timeoutStr, err)
+	}
+	return &LibreOfficeConverter{path: path, pdftoppm: pdftoppm, pdfunite: pdfunite, timeout: timeout}
+}
+
+// Available reports whether the LibreOffice binary can be found
+func (c *LibreOfficeConverter) Available() bool {
+	_, err := exec.LookPath(c.path)
+	return err == nil
+}
+
+// ConvertToDocx converts inputPath and returns the path of the DOCX, in a folder the caller
+// removes with the returned function
+func (c *LibreOfficeConverter) ConvertToDocx(ctx context.Context, inputPath string) (string, func(), error) {
+	return c.Convert(ctx, inputPath, processor.FormatDocx)
+}
+
+// Convert converts inputPath to format (docx, odt, doc, rtf or txt) and returns the path of
+// the result, in a folder the caller removes with the returned function
+func (c *LibreOfficeConverter) Convert(ctx context.Context, inputPath, format string) (string, func(), error) {
+	filter, ok := libreOfficeFilters[format]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: cannot convert to %s", ErrConversionFailed, format)
+	}
+	return c.convert(ctx, inputPath, format, filter)
+}
+
+// convert runs LibreOffice with an export filter that writes format
+func (c *LibreOfficeConverter) convert(ctx context.Context, inputPath, format, filter string) (string, func(), error) {
+	outDir, err := os.MkdirTemp("", "convert_*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(outDir) }
+
+	// A profile per run lets conversions run side by side
+	profile := "file://" + filepath.ToSlash(filepath.Join(outDir, "profile"))
+	start := time.Now()
+	if err := c.run(ctx, c.path,
+		"-env:UserInstallation="+profile,
+		"--headless", "--norestore",
+		"--convert-to", filter,
+		"--outdir", outDir,
+		inputPath); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath)) + "." + format
+	outputPath := filepath.Join(outDir, name)
+	if _, err := os.Stat(outputPath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("%w: LibreOffice produced no %s output", ErrConversionFailed, format)
+	}
+	fmt.Printf("[DEBUG] Converted %s to %s in %v\n", filepath.Base(inputPath), strings.ToUpper(format), time.Since(start))
+	return outputPath, cleanup, nil
+}
+
+func (c *LibreOfficeConverter) Name() string {
+	return "libreoffice"
+}
+
+// ConvertToPDF converts an office document with the page orientation saved in it; landscape
+// is only needed by Gotenberg
+func (c *LibreOfficeConverter) ConvertToPDF(ctx context.Context, documentReader io.Reader, filename, outputPath string, landscape bool, options models.PDFOptions) error {
+	// LibreOffice picks the import filter from the extension
+	inputFile, err := os.CreateTemp("", "*"+filepath.Ext(filename))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(inputFile.Name())
+	_, err = io.Copy(inputFile, documentReader)
+	inputFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	pdfPath, cleanup, err := c.convert(ctx, inputFile.Name(), "pdf", pdfExportFilter(processor.FileFormat(filename), options))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return copyFile(pdfPath, outputPath)
+}
+
+// pdfExportFilters are the PDF export filters of LibreOffice's applications
+var pdfExportFilters = map[string]string{
+	processor.FormatXlsx: "calc_pdf_Export",
+	processor.FormatPptx: "impress_pdf_Export",
+}
+
+// pdfExportFilter builds the --convert-to argument that exports a document in format to PDF
+// with options, which LibreOffice 7.4 and later read as JSON filter properties
+func pdfExportFilter(format string, options models.PDFOptions) string {
+	properties := map[string]map[string]string{}
+	if options.PDFA != "" {
+		// SelectPdfVersion 1, 2 and 3 are PDF/A-1b, PDF/A-2b and PDF/A-3b
+		level := strings.TrimSuffix(strings.TrimPrefix(options.PDFA, "PDF/A-"), "b")
+		properties["SelectPdfVersion"] = map[string]string{"type": "long", "value": level}
+	}
+	if options.PDFUA != nil {
+		properties["PDFUACompliance"] = map[string]string{"type": "boolean", "value": strconv.FormatBool(*options.PDFUA)}
+	}
+	if options.PageRanges != "" {
+		properties["PageRange"] = map[string]string{"type": "string", "value": options.PageRanges}
+	}
+	if options.ExportBookmarks != nil {
+		properties["ExportBookmarks"] = map[string]string{"type": "boolean", "value": strconv.FormatBool(*options.ExportBookmarks)}
+	}
+	if options.LosslessImages != nil {
+		properties["UseLosslessCompression"] = map[string]string{"type": "boolean", "value": strconv.FormatBool(*options.LosslessImages)}
+	}
+	if len(properties) == 0 {
+		return libreOfficeFilters["pdf"]
+	}
+
+	filter, ok := pdfExportFilters[format]
+	if !ok {
+		filter = "writer_pdf_Export"
+	}
+	propertiesJSON, _ := json.Marshal(properties)
+	return "pdf:" + filter + ":" + string(propertiesJSON)
+}
+
+// ConvertHTMLToPDF is not supported: LibreOffice ignores the page setup and most of the CSS
+// that HTML templates are written for
+func (c *LibreOfficeConverter) ConvertHTMLToPDF(ctx context.Context, bundle *processor.HTMLBundle, setup models.PageSetup, outputPath string, options models.PDFOptions) error {
+	return ErrHTMLNotSupported
+}
+
+// MergePDFs joins PDFs in order with pdfunite
+func (c *LibreOfficeConverter) MergePDFs(ctx context.Context, inputPaths []string, outputPath string) error {
+	args := append(append([]string{}, inputPaths...), outputPath)
+	return c.run(ctx, c.pdfunite, args...)
+}
+
+func (c *LibreOfficeConverter) Health() ConverterHealth {
+	return ConverterHealth{Name: c.Name()}
+}
+
+func (c *LibreOfficeConverter) Close() error {
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// RenderPages renders every page of a PDF as a PNG image and returns their paths in page
+// order, in a folder the caller removes with the returned function
+func (c *LibreOfficeConverter) RenderPages(ctx context.Context, pdfPath string, dpi int) ([]string, func(), error) {
+	outDir, err := os.MkdirTemp("", "pages_*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(outDir) }
+
+	start := time.Now()
+	if err := c.run(ctx, c.pdftoppm, "-png", "-r", strconv.Itoa(dpi), pdfPath, filepath.Join(outDir, "page")); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	// pdftoppm pads page numbers to the same width, so the names sort in page order
+	pages, err := filepath.Glob(filepath.Join(outDir, "page-*.png"))
+	if err != nil || len(pages) == 0 {
+		cleanup()
+		return nil, nil, fmt.Errorf("%w: pdftoppm produced no pages", ErrConversionFailed)
+	}
+	sort.Strings(pages)
+	fmt.Printf("[DEBUG] Rendered %d pages as PNG in %v\n", len(pages), time.Since(start))
+	return pages, cleanup, nil
+}
+
+// run executes a conversion command within the converter's timeout
+func (c *LibreOfficeConverter) run(ctx context.Context, name string, args ...string) error {
+	runCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, name, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(output.String()); detail != "" {
+			return fmt.Errorf("%w: %v: %s", ErrConversionFailed, err, detail)
+		}
+		return fmt.Errorf("%w: %v", ErrConversionFailed, err)
+	}
+	return nil
+}
+
+// uploadConvertedTemplate converts a .doc, .rtf or .odt upload to DOCX and stores it as a DOCX
+// template. The uploaded file is kept next to it for reference.
+func (s *TemplateService) uploadConvertedTemplate(ctx context.Context, file multipart.File, header *multipart.FileHeader, fileName, description, author, format string, options UploadOptions) (*models.Template, error) {
+	if s.converter == nil {
+		return nil, fmt.Errorf("%w: no converter is configured", ErrConversionFailed)
+	}
+
+	// LibreOffice picks the import filter from the extension
+	tempFile, err := os.CreateTemp("", "*."+format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer s.cleanupTempFile(tempFile.Name())
+	_, err = io.Copy(tempFile, file)
+	tempFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	docxPath, cleanup, err := s.converter.ConvertToDocx(ctx, tempFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	docxFile, err := os.Open(docxPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open converted document: %w", err)
+	}
+	defer docxFile.Close()
+	info, err := docxFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open converted document: %w", err)
+	}
+
+	docxHeader := &multipart.FileHeader{
+		Filename: strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)) + ".docx",
+		Header:   textproto.MIMEHeader{"Content-Type": {processor.MimeType(processor.FormatDocx)}},
+		Size:     info.Size(),
+	}
+	options.ConvertToDocx = false
+	template, err := s.UploadTemplateWithMetadata(ctx, docxFile, docxHeader, fileName, description, author, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the original; the template stays usable without it
+	file.Seek(0, 0)
+	originalPath := storage.GenerateOriginalObjectName(template.ID, header.Filename)
+	if _, err := s.gcsClient.UploadFile(ctx, file, originalPath, processor.MimeType(format)); err != nil {
+		fmt.Printf("Warning: failed to store original %s of template %s: %v\n", header.Filename, template.ID, err)
+		originalPath = ""
+	}
+
+	updates := map[string]interface{}{"original_name": header.Filename, "gcs_path_original": originalPath}
+	if err := internal.DB.Model(template).Updates(updates).Error; err != nil {
+		fmt.Printf("Warning: failed to record original of template %s: %v\n", template.ID, err)
+	} else {
+		template.OriginalName = header.Filename
+		template.OriginalPath = originalPath
+	}
+	fmt.Printf("[DEBUG] Stored %s as DOCX template %s\n", header.Filename, template.ID)
+
+	return template, nil
+}
+
+// GetOriginalReader opens the file a converted template was uploaded as
+func (s *TemplateService) GetOriginalReader(ctx context.Context, templateID string) (io.ReadCloser, string, string, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if template.OriginalPath == "" {
+		return nil, "", "", fmt.Errorf("template %s was not converted from another format", templateID)
+	}
+	reader, err := s.gcsClient.ReadFile(ctx, template.OriginalPath)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read original: %w", err)
+	}
+	return reader, template.OriginalName, processor.MimeType(processor.FileFormat(template.OriginalName)), nil
+}
@@ -7,8 +7,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"DF-PLCH/internal"
+	"DF-PLCH/internal/expression"
 	"DF-PLCH/internal/models"
 	"DF-PLCH/internal/processor"
 	"DF-PLCH/internal/storage"
@@ -19,20 +21,30 @@ import (
 type DocumentService struct {
 	gcsClient       *storage.GCSClient
 	templateService *TemplateService
-	pdfService      *PDFService
+	snippetService  *SnippetService
+	pdfConverter    PDFConverter
+	converter       *LibreOfficeConverter
+	pdfQueue        *pdfQueue
 }
 
-func NewDocumentService(gcsClient *storage.GCSClient, templateService *TemplateService, pdfService *PDFService) *DocumentService {
+func NewDocumentService(gcsClient *storage.GCSClient, templateService *TemplateService, snippetService *SnippetService, pdfConverter PDFConverter, converter *LibreOfficeConverter) *DocumentService {
 	return &DocumentService{
 		gcsClient:       gcsClient,
 		templateService: templateService,
-		pdfService:      pdfService,
+		snippetService:  snippetService,
+		pdfConverter:    pdfConverter,
+		converter:       converter,
+		pdfQueue:        newPDFQueue(),
 	}
 }
 
-func (s *DocumentService) ProcessDocument(ctx context.Context, templateID string, data map[string]string) (*models.Document, error) {
+func (s *DocumentService) ProcessDocument(ctx context.Context, templateID string, data map[string]interface{}, options RenderOptions) (*models.Document, error) {
 	fmt.Printf("[DEBUG] Starting ProcessDocument for template %s\n", templateID)
 
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRenderOptions, err)
+	}
+
 	// Get template
 	fmt.Printf("[DEBUG] Fetching template metadata from database...\n")
 	template, err := s.templateService.GetTemplate(templateID)
@@ -41,9 +53,57 @@ func (s *DocumentService) ProcessDocument(ctx context.Context, templateID string
 	}
 	fmt.Printf("[DEBUG] Template found: %s, GCS path: %s\n", template.Filename, template.GCSPath)
 
+	format := processor.FileFormat(template.Filename)
+	if format != processor.FormatDocx && (options.Protection != nil || options.Watermark != nil) {
+		return nil, fmt.Errorf("%w: protection and watermarks are only supported for DOCX templates", ErrInvalidRenderOptions)
+	}
+	if err := checkOutputs(format, options.Outputs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRenderOptions, err)
+	}
+	pdfOptions, err := pdfOptionsFor(template, format, options.PDF)
+	if err != nil {
+		return nil, err
+	}
+	options.PDF = &pdfOptions
+
+	// Allocate server-side sequential numbers
+	numberingRules, err := ParseNumberingRules(template.NumberingRules)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	var sequenceNumbers map[string]string
+	if len(numberingRules) > 0 {
+		fmt.Printf("[DEBUG] Allocating %d sequential numbers...\n", len(numberingRules))
+		sequenceNumbers, err = allocateNumbers(templateID, numberingRules, data, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Evaluate computed fields before rendering
+	computedFields, err := ParseComputedFields(template.ComputedFields)
+	if err != nil {
+		return nil, err
+	}
+	if len(computedFields) > 0 {
+		fmt.Printf("[DEBUG] Evaluating %d computed fields...\n", len(computedFields))
+		data, err = applyComputedFields(computedFields, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate computed fields: %w", err)
+		}
+	}
+
 	// Download template from GCS
+	// The normalized copy keeps every placeholder in a single run
+	templatePath := template.GCSPath
+	if template.NormalizedPath != "" {
+		templatePath = template.NormalizedPath
+	}
 	fmt.Printf("[DEBUG] Downloading template from GCS...\n")
-	reader, err := s.gcsClient.ReadFile(ctx, template.GCSPath)
+	reader, err := s.gcsClient.ReadFile(ctx, templatePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read template from GCS: %w", err)
 	}
@@ -61,157 +121,180 @@ func (s *DocumentService) ProcessDocument(ctx context.Context, templateID string
 
 	// Create temp output file
 	documentID := uuid.New().String()
-	tempOutputFile := filepath.Join(os.TempDir(), documentID+".docx")
+	tempOutputFile := filepath.Join(os.TempDir(), documentID+"."+format)
+	defer os.Remove(tempOutputFile)
 	fmt.Printf("[DEBUG] Created document ID: %s, temp output file: %s\n", documentID, tempOutputFile)
 
+	var completeData map[string]string
+	landscape := false
+	switch format {
+	case processor.FormatXlsx:
+		completeData, err = fillSpreadsheet(tempInputFile, tempOutputFile, data)
+	case processor.FormatPptx:
+		completeData, err = fillPresentation(tempInputFile, tempOutputFile, data)
+	case processor.FormatOdt:
+		completeData, err = fillOpenDocument(tempInputFile, tempOutputFile, data)
+	case processor.FormatHTML, processor.FormatZip:
+		completeData, err = renderHTMLTemplate(tempInputFile, tempOutputFile, format, data)
+	default:
+		completeData, landscape, err = s.renderDocx(ctx, template, documentID, tempInputFile, tempOutputFile, data, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storeDocument(ctx, template, documentID, tempOutputFile, format, completeData, sequenceNumbers, landscape, options.Outputs, pdfOptions)
+}
+
+// renderDocx fills a DOCX template into outputFile. It returns the text each placeholder was
+// replaced with and whether the document is landscape.
+func (s *DocumentService) renderDocx(ctx context.Context, template *models.Template, documentID, inputFile, outputFile string, data map[string]interface{}, options RenderOptions) (map[string]string, bool, error) {
 	// Process document
-	fmt.Printf("[DEBUG] Creating DOCX processor with input: %s, output: %s\n", tempInputFile, tempOutputFile)
-	proc := processor.NewDocxProcessor(tempInputFile, tempOutputFile)
+	fmt.Printf("[DEBUG] Creating DOCX processor with input: %s, output: %s\n", inputFile, outputFile)
+	proc := processor.NewDocxProcessor(inputFile, outputFile)
 	fmt.Printf("[DEBUG] DOCX processor created successfully, starting unzip...\n")
 	if err := proc.UnzipDocx(); err != nil {
-		return nil, fmt.Errorf("failed to unzip document: %w", err)
+		return nil, false, fmt.Errorf("failed to unzip document: %w", err)
 	}
 	fmt.Printf("[DEBUG] DOCX unzip completed successfully\n")
 	defer proc.Cleanup()
 
+	// Merge {{> snippet}} includes so shared fragments render with their latest version
+	if s.snippetService != nil {
+		merged, err := s.snippetService.ResolveIncludes(ctx, proc)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to resolve snippet includes: %w", err)
+		}
+		if len(merged) > 0 {
+			fmt.Printf("[DEBUG] Merged %d snippet includes\n", len(merged))
+		}
+	}
+
 	// Get placeholders and prepare complete data
 	fmt.Printf("[DEBUG] Starting placeholder extraction...\n")
 	placeholders, err := proc.ExtractPlaceholders()
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+		return nil, false, fmt.Errorf("failed to extract placeholders: %w", err)
 	}
 	fmt.Printf("[DEBUG] Placeholder extraction completed, found %d placeholders\n", len(placeholders))
 
 	fmt.Printf("[DEBUG] Preparing data for %d placeholders...\n", len(placeholders))
 	completeData := make(map[string]string)
 	for i, placeholder := range placeholders {
-		if value, exists := data[placeholder]; exists {
-			completeData[placeholder] = value
+		if value, exists := lookupValue(data, placeholder); exists {
+			completeData[placeholder] = expression.FormatValue(value)
 		} else {
 			completeData[placeholder] = ""
 		}
 		fmt.Printf("[DEBUG] Placeholder %d/%d: %s -> '%s'\n", i+1, len(placeholders), placeholder, completeData[placeholder])
 	}
 
+	// Charts bound through their alt text take array values and are not replaced as text
+	if err := applyChartBindings(proc, data); err != nil {
+		return nil, false, err
+	}
+
 	// Replace placeholders
 	fmt.Printf("[DEBUG] Starting placeholder replacement for %d placeholders...\n", len(completeData))
 	if err := proc.FindAndReplaceInDocument(completeData); err != nil {
-		return nil, fmt.Errorf("failed to replace placeholders: %w", err)
+		return nil, false, fmt.Errorf("failed to replace placeholders: %w", err)
 	}
 	fmt.Printf("[DEBUG] Placeholder replacement completed successfully\n")
 
+	// Stamp document properties so the file no longer carries the template author's metadata
+	if err := applyDocumentProperties(proc, template, documentID, data, time.Now()); err != nil {
+		return nil, false, err
+	}
+
+	// Watermark and protection go on last so they cover snippet and placeholder content
+	if err := applyRenderOptions(proc, options); err != nil {
+		return nil, false, err
+	}
+
 	// Re-zip document
 	if err := proc.ReZipDocx(); err != nil {
-		return nil, fmt.Errorf("failed to create output document: %w", err)
+		return nil, false, fmt.Errorf("failed to create output document: %w", err)
 	}
 
-	// Upload processed DOCX document to GCS
+	// Detect orientation from the processed DOCX
+	landscape := false
+	if orientation, err := proc.DetectOrientation(); err == nil {
+		landscape = orientation
+		fmt.Printf("[DEBUG] Detected orientation: landscape=%v\n", landscape)
+	} else {
+		fmt.Printf("Warning: failed to detect orientation: %v\n", err)
+	}
+	return completeData, landscape, nil
+}
+
+// storeDocument uploads a filled document and records it, then queues its PDF and extra formats
+// so that the document is returned without waiting for them
+func (s *DocumentService) storeDocument(ctx context.Context, template *models.Template, documentID, tempOutputFile, format string, completeData map[string]string, sequenceNumbers map[string]string, landscape bool, outputs []string, pdfOptions models.PDFOptions) (*models.Document, error) {
+	mimeType := processor.MimeType(format)
+
+	// Upload processed document to GCS
 	outputFile, err := os.Open(tempOutputFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open output file: %w", err)
 	}
 	defer outputFile.Close()
-	defer os.Remove(tempOutputFile)
 
 	objectName := storage.GenerateDocumentObjectName(documentID, template.Filename)
-	result, err := s.gcsClient.UploadFile(ctx, outputFile, objectName, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	result, err := s.gcsClient.UploadFile(ctx, outputFile, objectName, mimeType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload processed document to GCS: %w", err)
 	}
 
-	// Generate PDF using optimized Gotenberg and upload to GCS quickly
-	var pdfObjectName string
-	var pdfGCSPath string
-	fmt.Printf("[DEBUG] Starting optimized PDF generation for document %s\n", documentID)
-	if s.pdfService != nil {
-		fmt.Printf("[DEBUG] PDF service is available, proceeding with fast conversion\n")
-		// Re-open the DOCX file for PDF conversion
-		docxFile, err := os.Open(tempOutputFile)
-		if err == nil {
-			defer docxFile.Close()
-			fmt.Printf("[DEBUG] Successfully opened DOCX file for PDF conversion: %s\n", tempOutputFile)
-
-			// Detect orientation from the processed DOCX
-			landscape := false
-			if orientation, err := proc.DetectOrientation(); err == nil {
-				landscape = orientation
-				fmt.Printf("[DEBUG] Detected orientation: landscape=%v\n", landscape)
-			} else {
-				fmt.Printf("Warning: failed to detect orientation: %v\n", err)
-			}
-
-			// Convert DOCX to PDF with super-fast optimized Gotenberg (~200ms)
-			fmt.Printf("[DEBUG] Starting lightning-fast PDF conversion and upload...\n")
-			tempPDFPath := filepath.Join(os.TempDir(), documentID+"_output.pdf")
-
-			// Use Gotenberg's Store method to save directly to temp file (ultra-fast)
-			err = s.pdfService.ConvertDocxToPDFToFileWithOrientation(ctx, docxFile, template.Filename, tempPDFPath, landscape)
-			if err != nil {
-				fmt.Printf("[ERROR] Failed to convert DOCX to PDF: %v\n", err)
-			} else {
-				fmt.Printf("[DEBUG] PDF conversion successful in ~200ms, uploading from temp file...\n")
-				defer os.Remove(tempPDFPath) // Clean up temp file
-
-				// Open the temp PDF file and upload to GCS
-				pdfFile, err := os.Open(tempPDFPath)
-				if err != nil {
-					fmt.Printf("[ERROR] Failed to open temp PDF file: %v\n", err)
-				} else {
-					defer pdfFile.Close()
-
-					// Upload PDF to GCS from file - much more reliable than streaming
-					pdfObjectName = storage.GenerateDocumentPDFObjectName(documentID, template.Filename)
-					fmt.Printf("[DEBUG] Generated PDF object name: %s\n", pdfObjectName)
-
-					_, err = s.gcsClient.UploadFile(ctx, pdfFile, pdfObjectName, "application/pdf")
-					if err != nil {
-						fmt.Printf("[ERROR] Failed to upload PDF to GCS: %v\n", err)
-						// Don't set pdfObjectName if upload failed
-						pdfObjectName = ""
-					} else {
-						pdfGCSPath = pdfObjectName
-						fmt.Printf("[DEBUG] PDF successfully uploaded to GCS: %s\n", pdfGCSPath)
-					}
-				}
-			}
-		} else {
-			fmt.Printf("[ERROR] Failed to reopen DOCX file for PDF conversion: %v\n", err)
-		}
-	} else {
-		fmt.Printf("[DEBUG] PDF service is nil, skipping PDF generation\n")
-	}
-
 	// Convert data to JSON
 	dataJSON, err := json.Marshal(completeData)
 	if err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		if pdfObjectName != "" {
-			s.gcsClient.DeleteFile(ctx, pdfObjectName)
-		}
 		return nil, fmt.Errorf("failed to marshal data: %w", err)
 	}
 
+	numbersJSON, err := json.Marshal(sequenceNumbers)
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to marshal sequence numbers: %w", err)
+	}
+
+	// The worker converts its own copy; the caller removes tempOutputFile on return
+	jobFile := filepath.Join(os.TempDir(), documentID+"_job."+format)
+	if err := copyFile(tempOutputFile, jobFile); err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to keep document for PDF conversion: %w", err)
+	}
+
 	// Save document metadata
 	document := &models.Document{
-		ID:          documentID,
-		TemplateID:  templateID,
-		Filename:    template.Filename,
-		GCSPathDocx: objectName,
-		GCSPathPdf:  pdfGCSPath,
-		FileSize:    result.Size,
-		MimeType:    "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-		Data:        string(dataJSON),
-		Status:      "completed",
+		ID:              documentID,
+		TemplateID:      template.ID,
+		Filename:        template.Filename,
+		GCSPathDocx:     objectName,
+		FileSize:        result.Size,
+		MimeType:        mimeType,
+		Data:            string(dataJSON),
+		SequenceNumbers: string(numbersJSON),
+		Outputs:         "{}",
+		Status:          "completed",
+		PDFStatus:       models.PDFStatusPending,
 	}
 
 	if err := internal.DB.Create(document).Error; err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		if pdfObjectName != "" {
-			s.gcsClient.DeleteFile(ctx, pdfObjectName)
-		}
+		os.Remove(jobFile)
 		return nil, fmt.Errorf("failed to save document metadata: %w", err)
 	}
 
+	s.queuePDF(document, pdfJob{
+		documentID:   documentID,
+		template:     template,
+		documentFile: jobFile,
+		format:       format,
+		landscape:    landscape,
+		outputs:      outputs,
+		pdfOptions:   pdfOptions,
+	})
 	return document, nil
 }
 
@@ -220,31 +303,21 @@ func (s *DocumentService) GetDocument(documentID string) (*models.Document, erro
 	if err := internal.DB.First(&document, "id = ?", documentID).Error; err != nil {
 		return nil, fmt.Errorf("document not found: %w", err)
 	}
+	s.failStalePDF(&document)
+	document.PDFReady = document.GCSPathPdf != ""
 	return &document, nil
 }
 
-func (s *DocumentService) GetDocumentReader(ctx context.Context, documentID string, format string) (io.ReadCloser, string, string, error) {
+// GetDocumentReader opens a stored file of a document in format; page picks the page of PNG output
+func (s *DocumentService) GetDocumentReader(ctx context.Context, documentID string, format string, page int) (io.ReadCloser, string, string, error) {
 	document, err := s.GetDocument(documentID)
 	if err != nil {
 		return nil, "", "", err
 	}
 
-	var gcsPath, filename, mimeType string
-
-	switch format {
-	case "pdf":
-		if document.GCSPathPdf == "" {
-			return nil, "", "", fmt.Errorf("PDF version not available")
-		}
-		gcsPath = document.GCSPathPdf
-		filename = document.Filename[:len(document.Filename)-5] + ".pdf" // Remove .docx and add .pdf
-		mimeType = "application/pdf"
-	case "docx":
-		fallthrough
-	default:
-		gcsPath = document.GCSPathDocx
-		filename = document.Filename
-		mimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	gcsPath, filename, mimeType, err := documentFile(document, format, page)
+	if err != nil {
+		return nil, "", "", err
 	}
 
 	reader, err := s.gcsClient.ReadFile(ctx, gcsPath)
@@ -272,6 +345,17 @@ func (s *DocumentService) DeleteDocument(ctx context.Context, documentID string)
 			fmt.Printf("Warning: failed to delete GCS PDF file %s: %v\n", document.GCSPathPdf, err)
 		}
 	}
+	outputs, err := ParseDocumentOutputs(document.Outputs)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	for _, files := range outputs {
+		for _, file := range files {
+			if err := s.gcsClient.DeleteFile(ctx, file); err != nil {
+				fmt.Printf("Warning: failed to delete GCS file %s: %v\n", file, err)
+			}
+		}
+	}
 
 	// Soft delete from database
 	return internal.DB.Delete(document).Error
@@ -279,21 +363,14 @@ func (s *DocumentService) DeleteDocument(ctx context.Context, documentID string)
 
 // DeleteProcessedFile deletes only the specified format file from GCS
 // but keeps the document record with user data in the database
-func (s *DocumentService) DeleteProcessedFile(ctx context.Context, documentID string, format string) error {
+func (s *DocumentService) DeleteProcessedFile(ctx context.Context, documentID string, format string, page int) error {
 	document, err := s.GetDocument(documentID)
 	if err != nil {
 		return err
 	}
 
-	var gcsPath string
-	switch format {
-	case "pdf":
-		gcsPath = document.GCSPathPdf
-	default:
-		gcsPath = document.GCSPathDocx
-	}
-
-	if gcsPath == "" {
+	gcsPath, _, _, err := documentFile(document, format, page)
+	if err != nil || gcsPath == "" {
 		return fmt.Errorf("file path not found for format %s", format)
 	}
 
@@ -329,4 +406,3 @@ func (s *DocumentService) createTempFile(reader io.Reader) (string, error) {
 func (s *DocumentService) cleanupTempFile(filePath string) {
 	os.Remove(filePath)
 }
-
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Template edit types
+const (
+	EditInsertPlaceholder = "insert_placeholder"
+	EditRenamePlaceholder = "rename_placeholder"
+	EditReplaceText       = "replace_text"
+)
+
+var (
+	// ErrInvalidEdit wraps edits that cannot be applied so handlers can answer 400
+	ErrInvalidEdit = errors.New("invalid edit")
+	// ErrEditConflict is returned when the template changed while edits were being applied
+	ErrEditConflict = errors.New("template was edited concurrently")
+)
+
+// TemplateEdit is one change to a stored template. Paragraph ids, runs and offsets are those of
+// the template structure.
+type TemplateEdit struct {
+	Type        string `json:"type"`
+	ParagraphID string `json:"paragraph_id,omitempty"` // insert_placeholder
+	Run         int    `json:"run,omitempty"`          // insert_placeholder
+	Offset      int    `json:"offset,omitempty"`       // insert_placeholder: characters into the run
+	Placeholder string `json:"placeholder,omitempty"`  // insert_placeholder, replace_text: the placeholder to write
+	From        string `json:"from,omitempty"`         // rename_placeholder
+	To          string `json:"to,omitempty"`           // rename_placeholder
+	Text        string `json:"text,omitempty"`         // replace_text: literal text replaced by the placeholder
+}
+
+// EditTemplate applies edits in order to the stored template and stores the result as a new
+// version, with placeholders, positions and sections recomputed
+func (s *TemplateService) EditTemplate(ctx context.Context, templateID string, edits []TemplateEdit) (*models.Template, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("%w: no edits given", ErrInvalidEdit)
+	}
+	for i := range edits {
+		if err := edits[i].normalize(); err != nil {
+			return nil, fmt.Errorf("%w: edit %d: %v", ErrInvalidEdit, i+1, err)
+		}
+	}
+
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, cleanup, err := s.openTemplate(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	for i, edit := range edits {
+		count := 1
+		switch edit.Type {
+		case EditInsertPlaceholder:
+			err = proc.InsertText(edit.ParagraphID, edit.Run, edit.Offset, edit.Placeholder)
+		case EditRenamePlaceholder:
+			count, err = proc.RenamePlaceholder(edit.From, edit.To)
+		case EditReplaceText:
+			count, err = proc.ReplaceText(edit.Text, edit.Placeholder)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: edit %d: %v", ErrInvalidEdit, i+1, err)
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: edit %d: %s not found in the template", ErrInvalidEdit, i+1, edit.target())
+		}
+		fmt.Printf("[DEBUG] Applied %s to template %s (%d changes)\n", edit.Type, templateID, count)
+	}
+
+	editedFile, err := os.CreateTemp("", "*.docx")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	editedFile.Close()
+	defer s.cleanupTempFile(editedFile.Name())
+	if err := proc.ReZipDocxTo(editedFile.Name()); err != nil {
+		return nil, fmt.Errorf("failed to write edited template: %w", err)
+	}
+
+	// Analysis resolves includes into the working copy, so it runs after the file is written
+	analysis, err := s.analyzeTemplate(ctx, proc)
+	if err != nil {
+		return nil, err
+	}
+
+	version := template.Version + 1
+	objectName := storage.GenerateVersionObjectName(templateID, version, template.Filename)
+	result, err := s.uploadLocalFile(ctx, editedFile.Name(), objectName, template.MimeType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload edited template: %w", err)
+	}
+
+	editsJSON, err := json.Marshal(edits)
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to marshal edits: %w", err)
+	}
+
+	err = internal.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the version that was edited may be replaced
+		update := tx.Model(&models.Template{}).
+			Where("id = ? AND version = ?", templateID, template.Version).
+			Updates(map[string]interface{}{
+				"gcs_path_normalized": objectName,
+				"file_size":           result.Size,
+				"placeholders":        analysis.placeholders,
+				"positions":           analysis.positions,
+				"sections":            analysis.sections,
+				"version":             version,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return ErrEditConflict
+		}
+
+		// The first edit records the uploaded copy as version 1, so it is listed and deleted with the rest
+		if template.Version == 1 && template.NormalizedPath != "" {
+			err := tx.Create(&models.TemplateVersion{
+				ID:         uuid.New().String(),
+				TemplateID: templateID,
+				Version:    1,
+				GCSPath:    template.NormalizedPath,
+				FileSize:   template.FileSize,
+				Edits:      "[]",
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.TemplateVersion{
+			ID:         uuid.New().String(),
+			TemplateID: templateID,
+			Version:    version,
+			GCSPath:    objectName,
+			FileSize:   result.Size,
+			Edits:      string(editsJSON),
+		}).Error
+	})
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		if errors.Is(err, ErrEditConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to save template version: %w", err)
+	}
+
+	return s.GetTemplate(templateID)
+}
+
+// GetTemplateVersions lists the versions of an edited template, oldest first. Version 1, the
+// uploaded template, is recorded by the first edit.
+func (s *TemplateService) GetTemplateVersions(templateID string) ([]models.TemplateVersion, error) {
+	if _, err := s.GetTemplate(templateID); err != nil {
+		return nil, err
+	}
+
+	var versions []models.TemplateVersion
+	if err := internal.DB.Where("template_id = ?", templateID).Order("version").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// normalize checks the fields an edit type needs and wraps placeholder names in {{ }}
+func (e *TemplateEdit) normalize() error {
+	switch e.Type {
+	case EditInsertPlaceholder:
+		if e.ParagraphID == "" {
+			return fmt.Errorf("paragraph_id is required")
+		}
+		if e.Run < 0 || e.Offset < 0 {
+			return fmt.Errorf("run and offset must not be negative")
+		}
+		return normalizeEditPlaceholder(&e.Placeholder, "placeholder")
+	case EditRenamePlaceholder:
+		if err := normalizeEditPlaceholder(&e.From, "from"); err != nil {
+			return err
+		}
+		if err := normalizeEditPlaceholder(&e.To, "to"); err != nil {
+			return err
+		}
+		if e.From == e.To {
+			return fmt.Errorf("from and to are the same placeholder")
+		}
+		return nil
+	case EditReplaceText:
+		if e.Text == "" {
+			return fmt.Errorf("text is required")
+		}
+		return normalizeEditPlaceholder(&e.Placeholder, "placeholder")
+	default:
+		return fmt.Errorf("type must be %q, %q or %q", EditInsertPlaceholder, EditRenamePlaceholder, EditReplaceText)
+	}
+}
+
+// target describes what an edit looks for, for error messages
+func (e TemplateEdit) target() string {
+	if e.Type == EditRenamePlaceholder {
+		return e.From
+	}
+	return fmt.Sprintf("%q", e.Text)
+}
+
+// normalizeEditPlaceholder turns name or {{name}} into {{name}}. Snippet includes cannot be
+// written through edits.
+func normalizeEditPlaceholder(value *string, field string) error {
+	name := placeholderName(*value)
+	if name == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if strings.ContainsAny(name, "{}") {
+		return fmt.Errorf("%s %q is not a valid placeholder name", field, *value)
+	}
+	if strings.HasPrefix(name, ">") {
+		return fmt.Errorf("%s cannot be a snippet include", field)
+	}
+	*value = placeholderKey(name)
+	return nil
+}
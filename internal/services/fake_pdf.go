@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/pdftext"
+	"DF-PLCH/internal/processor"
+)
+
+// FakePDFConverter writes a one-page PDF naming the converted file instead of converting it,
+// and merges PDFs into placeholder pages naming each input. It stands in for Gotenberg in tests
+// and on machines without any converter, and ignores PDF options. Err, when set, is returned by
+// every conversion.
+type FakePDFConverter struct {
+	Err error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func NewFakePDFConverter() *FakePDFConverter {
+	return &FakePDFConverter{}
+}
+
+func (f *FakePDFConverter) Name() string {
+	return "fake"
+}
+
+func (f *FakePDFConverter) ConvertToPDF(ctx context.Context, documentReader io.Reader, filename, outputPath string, landscape bool, options models.PDFOptions) error {
+	if _, err := io.Copy(io.Discard, documentReader); err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	return f.write(filename, outputPath, landscape)
+}
+
+func (f *FakePDFConverter) ConvertHTMLToPDF(ctx context.Context, bundle *processor.HTMLBundle, setup models.PageSetup, outputPath string, options models.PDFOptions) error {
+	return f.write(processor.HTMLIndex, outputPath, setup.Landscape)
+}
+
+func (f *FakePDFConverter) MergePDFs(ctx context.Context, inputPaths []string, outputPath string) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, "merge")
+	f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+
+	var pages []fakePage
+	for _, path := range inputPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		count, err := pdftext.PageCount(data)
+		if err != nil {
+			return fmt.Errorf("failed to count pages of %s: %w", path, err)
+		}
+		for page := 1; page <= count; page++ {
+			pages = append(pages, fakePage{text: fmt.Sprintf("%s page %d", filepath.Base(path), page)})
+		}
+	}
+	return os.WriteFile(outputPath, fakePDF(pages...), 0644)
+}
+
+func (f *FakePDFConverter) Health() ConverterHealth {
+	return ConverterHealth{Name: f.Name()}
+}
+
+func (f *FakePDFConverter) Close() error {
+	return nil
+}
+
+// Calls returns the names of the files converted so far, with "merge" for each merge
+func (f *FakePDFConverter) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *FakePDFConverter) write(filename, outputPath string, landscape bool) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, filename)
+	f.mu.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	return os.WriteFile(outputPath, fakePDF(fakePage{text: filename, landscape: landscape}), 0644)
+}
+
+// fakePage is one page of a fake PDF
+type fakePage struct {
+	text      string
+	landscape bool
+}
+
+// fakePDF builds A4 pages with text, with the cross-reference table readers expect
+func fakePDF(pages ...fakePage) []byte {
+	// The catalog, page tree and font come first, then a page and its contents for each page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	for i, page := range pages {
+		width, height := 595, 842
+		if page.landscape {
+			width, height = height, width
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(page.text)
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 %d Td (%s) Tj ET", height-72, escaped)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", width, height, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/pdftext"
+)
+
+func TestFakePDFConverter(t *testing.T) {
+	dir := t.TempDir()
+	converter := NewFakePDFConverter()
+	ctx := context.Background()
+
+	first, second := filepath.Join(dir, "first.pdf"), filepath.Join(dir, "second.pdf")
+	if err := converter.ConvertToPDF(ctx, strings.NewReader("docx"), "letter.docx", first, false, models.PDFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := converter.ConvertToPDF(ctx, strings.NewReader("docx"), "receipt.docx", second, true, models.PDFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	merged := filepath.Join(dir, "merged.pdf")
+	if err := converter.MergePDFs(ctx, []string{first, second}, merged); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls, want := converter.Calls(), []string{"letter.docx", "receipt.docx", "merge"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Calls() = %v, want %v", calls, want)
+	}
+
+	data, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := pdftext.Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Width != 842 || pages[0].Height != 595 {
+		t.Errorf("expected one landscape A4 page, got %+v", pages)
+	}
+
+	data, err = os.ReadFile(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := pdftext.PageCount(data); err != nil || count != 2 {
+		t.Errorf("merged PDF has %d pages (%v), want 2", count, err)
+	}
+}
+
+func TestFakePDFConverterErr(t *testing.T) {
+	dir := t.TempDir()
+	converter := NewFakePDFConverter()
+	converter.Err = errors.New("converter down")
+
+	output := filepath.Join(dir, "out.pdf")
+	if err := converter.ConvertToPDF(context.Background(), strings.NewReader("docx"), "letter.docx", output, false, models.PDFOptions{}); !errors.Is(err, converter.Err) {
+		t.Errorf("ConvertToPDF returned %v, want %v", err, converter.Err)
+	}
+	if err := converter.MergePDFs(context.Background(), []string{output}, output); !errors.Is(err, converter.Err) {
+		t.Errorf("MergePDFs returned %v, want %v", err, converter.Err)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a failed conversion wrote a file")
+	}
+	if calls := converter.Calls(); len(calls) != 2 {
+		t.Errorf("Calls() = %v, want the failed conversion and merge", calls)
+	}
+}
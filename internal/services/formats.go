@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/expression"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnsupportedFormat is returned for operations that only work on DOCX templates
+var ErrUnsupportedFormat = errors.New("operation is not supported for this template format")
+
+// uploadPackageTemplate stores a template in a format other than DOCX. Only placeholders are
+// recorded; positions, sections and revisions are DOCX features. For HTML templates the
+// placeholders are the data fields the page uses.
+func (s *TemplateService) uploadPackageTemplate(ctx context.Context, file multipart.File, header *multipart.FileHeader, fileName, description, author, format string) (*models.Template, error) {
+	templateID := uuid.New().String()
+	objectName := storage.GenerateObjectName(templateID, header.Filename)
+
+	// Upload to GCS
+	result, err := s.gcsClient.UploadFile(ctx, file, objectName, processor.MimeType(format))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload to GCS: %w", err)
+	}
+
+	file.Seek(0, 0) // Reset file pointer
+	tempFile, err := s.createTempFile(file)
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer s.cleanupTempFile(tempFile)
+
+	placeholders, err := extractPackagePlaceholders(tempFile, format)
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, err
+	}
+	fmt.Printf("[DEBUG] Found %d placeholders in %s template\n", len(placeholders), format)
+
+	placeholdersJSON, err := json.Marshal(placeholders)
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to marshal placeholders: %w", err)
+	}
+
+	// Save to database
+	template := &models.Template{
+		ID:             templateID,
+		Filename:       header.Filename,
+		OriginalName:   header.Filename,
+		DisplayName:    fileName,
+		Description:    description,
+		Author:         author,
+		GCSPath:        objectName,
+		FileSize:       result.Size,
+		MimeType:       processor.MimeType(format),
+		Placeholders:   string(placeholdersJSON),
+		Positions:      "[]",
+		Sections:       "[]",
+		ComputedFields: "[]",
+		NumberingRules: "[]",
+		DocProps:       "{}",
+		Revisions:      "{}",
+		PageSetup:      "{}",
+		PDFOptions:     "{}",
+		Version:        1,
+	}
+
+	if err := internal.DB.Create(template).Error; err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to save template metadata: %w", err)
+	}
+
+	return template, nil
+}
+
+// extractPackagePlaceholders lists the placeholders of a template file in format
+func extractPackagePlaceholders(path, format string) ([]string, error) {
+	var placeholders []string
+	switch format {
+	case processor.FormatXlsx:
+		proc := processor.NewXlsxProcessor(path, path+".out")
+		if err := proc.UnzipXlsx(); err != nil {
+			return nil, fmt.Errorf("failed to process workbook: %w", err)
+		}
+		defer proc.Cleanup()
+
+		var err error
+		if placeholders, err = proc.ExtractPlaceholders(); err != nil {
+			return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+		}
+	case processor.FormatPptx:
+		proc := processor.NewPptxProcessor(path, path+".out")
+		if err := proc.UnzipPptx(); err != nil {
+			return nil, fmt.Errorf("failed to process presentation: %w", err)
+		}
+		defer proc.Cleanup()
+
+		var err error
+		if placeholders, err = proc.ExtractPlaceholders(); err != nil {
+			return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+		}
+	case processor.FormatOdt:
+		proc := processor.NewOdtProcessor(path, path+".out")
+		if err := proc.UnzipOdt(); err != nil {
+			return nil, fmt.Errorf("failed to process document: %w", err)
+		}
+		defer proc.Cleanup()
+
+		var err error
+		if placeholders, err = proc.ExtractPlaceholders(); err != nil {
+			return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+		}
+	case processor.FormatHTML, processor.FormatZip:
+		var err error
+		if placeholders, err = htmlPlaceholders(path, format); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if placeholders == nil {
+		placeholders = []string{}
+	}
+	return placeholders, nil
+}
+
+// fillSpreadsheet fills an XLSX template into outputFile and returns the text each placeholder
+// was replaced with
+func fillSpreadsheet(inputFile, outputFile string, data map[string]interface{}) (map[string]string, error) {
+	proc := processor.NewXlsxProcessor(inputFile, outputFile)
+	if err := proc.UnzipXlsx(); err != nil {
+		return nil, fmt.Errorf("failed to unzip workbook: %w", err)
+	}
+	defer proc.Cleanup()
+
+	placeholders, err := proc.ExtractPlaceholders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+	}
+	fmt.Printf("[DEBUG] Workbook has %d placeholders\n", len(placeholders))
+
+	values := itemValues(placeholders, data)
+	if err := proc.FillCells(values); err != nil {
+		return nil, fmt.Errorf("failed to fill cells: %w", err)
+	}
+	if err := proc.ReZipXlsx(); err != nil {
+		return nil, fmt.Errorf("failed to create output workbook: %w", err)
+	}
+	return formatItemValues(values), nil
+}
+
+// fillPresentation fills a PPTX template into outputFile and returns the text each placeholder
+// was replaced with
+func fillPresentation(inputFile, outputFile string, data map[string]interface{}) (map[string]string, error) {
+	proc := processor.NewPptxProcessor(inputFile, outputFile)
+	if err := proc.UnzipPptx(); err != nil {
+		return nil, fmt.Errorf("failed to unzip presentation: %w", err)
+	}
+	defer proc.Cleanup()
+
+	placeholders, err := proc.ExtractPlaceholders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+	}
+	fmt.Printf("[DEBUG] Presentation has %d placeholders\n", len(placeholders))
+
+	values := itemValues(placeholders, data)
+	if err := proc.FillSlides(values); err != nil {
+		return nil, fmt.Errorf("failed to fill slides: %w", err)
+	}
+	if err := proc.ReZipPptx(); err != nil {
+		return nil, fmt.Errorf("failed to create output presentation: %w", err)
+	}
+	return formatItemValues(values), nil
+}
+
+// fillOpenDocument fills an ODT template into outputFile and returns the text each placeholder
+// was replaced with. Values are written as text, as in DOCX templates.
+func fillOpenDocument(inputFile, outputFile string, data map[string]interface{}) (map[string]string, error) {
+	proc := processor.NewOdtProcessor(inputFile, outputFile)
+	if err := proc.UnzipOdt(); err != nil {
+		return nil, fmt.Errorf("failed to unzip document: %w", err)
+	}
+	defer proc.Cleanup()
+
+	placeholders, err := proc.ExtractPlaceholders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+	}
+	fmt.Printf("[DEBUG] Document has %d placeholders\n", len(placeholders))
+
+	completeData := make(map[string]string, len(placeholders))
+	for _, placeholder := range placeholders {
+		if value, exists := lookupValue(data, placeholder); exists {
+			completeData[placeholder] = expression.FormatValue(value)
+		} else {
+			completeData[placeholder] = ""
+		}
+	}
+	if err := proc.FindAndReplaceInDocument(completeData); err != nil {
+		return nil, fmt.Errorf("failed to replace placeholders: %w", err)
+	}
+	if err := proc.ReZipOdt(); err != nil {
+		return nil, fmt.Errorf("failed to create output document: %w", err)
+	}
+	return completeData, nil
+}
+
+// formatItemValues formats the values written into a document for its stored data
+func formatItemValues(values map[string]interface{}) map[string]string {
+	completeData := make(map[string]string, len(values))
+	for placeholder, value := range values {
+		completeData[placeholder] = expression.FormatValue(value)
+	}
+	return completeData
+}
+
+// itemValues picks the value of each placeholder from data. {{items.field}} takes field from
+// every object of the items array, which repeats the spreadsheet row or slide holding the
+// placeholder once per item. Objects are written as text and missing values are left empty.
+func itemValues(placeholders []string, data map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(placeholders))
+	for _, placeholder := range placeholders {
+		if value, exists := lookupValue(data, placeholder); exists {
+			values[placeholder] = cellValue(value)
+			continue
+		}
+
+		name := placeholderName(placeholder)
+		array, field, found := strings.Cut(name, ".")
+		items, isArray := data[array].([]interface{})
+		if !found || !isArray {
+			values[placeholder] = nil
+			continue
+		}
+		column := make([]interface{}, len(items))
+		for i, item := range items {
+			if object, ok := item.(map[string]interface{}); ok {
+				column[i] = cellValue(object[field])
+			}
+		}
+		values[placeholder] = column
+	}
+	return values
+}
+
+// cellValue keeps values a cell or slide can hold as they are and formats the rest as text
+func cellValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return expression.FormatValue(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			if _, isArray := item.([]interface{}); isArray {
+				items[i] = expression.FormatValue(item)
+			} else {
+				items[i] = cellValue(item)
+			}
+		}
+		return items
+	default:
+		return value
+	}
+}
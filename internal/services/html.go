@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+)
+
+// ErrInvalidHTMLTemplate wraps HTML templates that do not parse or cannot render the submitted data
+var ErrInvalidHTMLTemplate = errors.New("invalid HTML template")
+
+// pageUnits are the length units of a page setup
+var pageUnits = []string{"in", "mm", "cm", "pt"}
+
+// ValidatePageSetup checks a page setup and fills in its unit
+func ValidatePageSetup(setup models.PageSetup) (models.PageSetup, error) {
+	setup.Unit = strings.ToLower(strings.TrimSpace(setup.Unit))
+	if setup.Unit == "" {
+		setup.Unit = "mm"
+	}
+	validUnit := false
+	for _, unit := range pageUnits {
+		validUnit = validUnit || setup.Unit == unit
+	}
+	if !validUnit {
+		return setup, fmt.Errorf("unit must be one of %s", strings.Join(pageUnits, ", "))
+	}
+
+	setup.Paper = strings.TrimSpace(setup.Paper)
+	if _, ok := paperSizes[strings.ToUpper(setup.Paper)]; setup.Paper != "" && !ok {
+		return setup, fmt.Errorf("paper %q is not supported; use A3, A4, A5, A6, Letter, Legal or Tabloid", setup.Paper)
+	}
+	if setup.Width < 0 || setup.Height < 0 || (setup.Width > 0) != (setup.Height > 0) {
+		return setup, fmt.Errorf("width and height must both be positive when either is set")
+	}
+	if m := setup.Margins; m != nil && (m.Top < 0 || m.Bottom < 0 || m.Left < 0 || m.Right < 0) {
+		return setup, fmt.Errorf("margins must not be negative")
+	}
+	if setup.Scale != 0 && (setup.Scale < 0.1 || setup.Scale > 2) {
+		return setup, fmt.Errorf("scale must be between 0.1 and 2")
+	}
+	return setup, nil
+}
+
+// ParsePageSetup decodes the page setup stored on a template
+func ParsePageSetup(raw string) (models.PageSetup, error) {
+	var setup models.PageSetup
+	if raw == "" {
+		return setup, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &setup); err != nil {
+		return setup, fmt.Errorf("failed to unmarshal page setup: %w", err)
+	}
+	return setup, nil
+}
+
+func (s *TemplateService) GetPageSetup(templateID string) (models.PageSetup, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return models.PageSetup{}, err
+	}
+	return ParsePageSetup(template.PageSetup)
+}
+
+// UpdatePageSetup replaces the paper size and margins of an HTML template
+func (s *TemplateService) UpdatePageSetup(templateID string, setup models.PageSetup) (*models.Template, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if format := processor.FileFormat(template.Filename); !processor.IsHTMLFormat(format) {
+		return nil, fmt.Errorf("%w: page setup applies to HTML templates, not %s", ErrUnsupportedFormat, format)
+	}
+
+	normalized, err := ValidatePageSetup(setup)
+	if err != nil {
+		return nil, err
+	}
+
+	setupJSON, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal page setup: %w", err)
+	}
+
+	if err := internal.DB.Model(template).Update("page_setup", string(setupJSON)).Error; err != nil {
+		return nil, fmt.Errorf("failed to save page setup: %w", err)
+	}
+	template.PageSetup = string(setupJSON)
+
+	return template, nil
+}
+
+// htmlPlaceholders lists the data fields an HTML template uses
+func htmlPlaceholders(path, format string) ([]string, error) {
+	bundle, err := processor.ReadHTMLBundle(path, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHTMLTemplate, err)
+	}
+	placeholders, err := bundle.Placeholders()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHTMLTemplate, err)
+	}
+	return placeholders, nil
+}
+
+// renderHTMLTemplate executes an HTML template against data into outputFile, in the template's
+// format, and returns the text of each field it uses
+func renderHTMLTemplate(inputFile, outputFile, format string, data map[string]interface{}) (map[string]string, error) {
+	bundle, err := processor.ReadHTMLBundle(inputFile, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHTMLTemplate, err)
+	}
+	placeholders, err := bundle.Placeholders()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHTMLTemplate, err)
+	}
+	fmt.Printf("[DEBUG] HTML template uses %d fields and %d assets\n", len(placeholders), len(bundle.Assets))
+
+	rendered, err := bundle.Render(htmlTemplateData(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHTMLTemplate, err)
+	}
+	if err := rendered.Write(outputFile, format); err != nil {
+		return nil, fmt.Errorf("failed to write rendered page: %w", err)
+	}
+	return formatItemValues(itemValues(placeholders, data)), nil
+}
+
+// htmlTemplateData keys the submitted values by field name, so that "{{name}}" and "name" are
+// both read as {{.name}}
+func htmlTemplateData(data map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		name := placeholderName(key)
+		if _, exists := fields[name]; exists && key != name {
+			continue
+		}
+		fields[name] = value
+	}
+	return fields
+}
+
+// convertHTMLToPDF prints a rendered HTML document with its template's page setup
+func (s *DocumentService) convertHTMLToPDF(ctx context.Context, template *models.Template, documentFile, format, outputPath string, options models.PDFOptions) error {
+	bundle, err := processor.ReadHTMLBundle(documentFile, format)
+	if err != nil {
+		return err
+	}
+	setup, err := ParsePageSetup(template.PageSetup)
+	if err != nil {
+		return err
+	}
+	return s.pdfConverter.ConvertHTMLToPDF(ctx, bundle, setup, outputPath, options)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/expression"
+	"DF-PLCH/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxNumberPadding = 12
+
+// ValidateNumberingRules normalizes placeholder names and checks rule settings
+func ValidateNumberingRules(rules []models.NumberingRule) ([]models.NumberingRule, error) {
+	normalized := make([]models.NumberingRule, 0, len(rules))
+	seen := make(map[string]bool)
+
+	for i, rule := range rules {
+		rule.Placeholder = placeholderName(rule.Placeholder)
+		if rule.Placeholder == "" {
+			return nil, fmt.Errorf("numbering rule %d: placeholder is required", i+1)
+		}
+		if seen[rule.Placeholder] {
+			return nil, fmt.Errorf("numbering rule for %q is defined more than once", rule.Placeholder)
+		}
+		seen[rule.Placeholder] = true
+
+		if rule.Padding < 0 || rule.Padding > maxNumberPadding {
+			return nil, fmt.Errorf("numbering rule %q: padding must be between 0 and %d", rule.Placeholder, maxNumberPadding)
+		}
+		if rule.Start < 0 {
+			return nil, fmt.Errorf("numbering rule %q: start must not be negative", rule.Placeholder)
+		}
+		if rule.Start == 0 {
+			rule.Start = 1
+		}
+		rule.ScopeField = placeholderName(rule.ScopeField)
+		rule.CounterName = strings.TrimSpace(rule.CounterName)
+
+		normalized = append(normalized, rule)
+	}
+
+	return normalized, nil
+}
+
+// ParseNumberingRules decodes the JSON stored on a template
+func ParseNumberingRules(raw string) ([]models.NumberingRule, error) {
+	var rules []models.NumberingRule
+	if raw == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal numbering rules: %w", err)
+	}
+	return rules, nil
+}
+
+// allocateNumbers reserves the next number for every rule and writes it into the data.
+// Numbers are taken before rendering, so a failed render leaves a gap rather than a duplicate.
+func allocateNumbers(templateID string, rules []models.NumberingRule, data map[string]interface{}, now time.Time) (map[string]string, error) {
+	allocated := make(map[string]string, len(rules))
+
+	for _, rule := range rules {
+		scope := ""
+		if rule.ScopeField != "" {
+			value, _ := lookupValue(data, rule.ScopeField)
+			scope = expression.FormatValue(value)
+		}
+
+		period := ""
+		if rule.YearReset {
+			period = strconv.Itoa(now.Year())
+		}
+
+		value, err := nextCounterValue(templateID, rule, scope, period)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate %s: %w", rule.Placeholder, err)
+		}
+
+		number := formatNumber(rule, period, value)
+		allocated[rule.Placeholder] = number
+
+		delete(data, rule.Placeholder)
+		data[placeholderKey(rule.Placeholder)] = number
+	}
+
+	return allocated, nil
+}
+
+// nextCounterValue increments the counter under a row lock so concurrent requests never share a value
+func nextCounterValue(templateID string, rule models.NumberingRule, scope, period string) (int64, error) {
+	owner := templateID
+	if rule.CounterName != "" {
+		owner = "name:" + rule.CounterName
+	}
+	key := strings.Join([]string{owner, rule.Placeholder, scope, period}, "|")
+	if len(key) > 191 {
+		return 0, fmt.Errorf("counter key is too long")
+	}
+
+	var value int64
+	err := internal.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		seed := models.DocumentCounter{
+			CounterKey:  key,
+			TemplateID:  templateID,
+			Placeholder: rule.Placeholder,
+			Scope:       scope,
+			Period:      period,
+			Value:       rule.Start - 1,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seed).Error; err != nil {
+			return err
+		}
+
+		var counter models.DocumentCounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counter, "counter_key = ?", key).Error; err != nil {
+			return err
+		}
+
+		value = counter.Value + 1
+		return tx.Model(&counter).Updates(map[string]interface{}{
+			"value":      value,
+			"updated_at": now,
+		}).Error
+	})
+
+	return value, err
+}
+
+func formatNumber(rule models.NumberingRule, period string, value int64) string {
+	var sb strings.Builder
+	sb.WriteString(rule.Prefix)
+	if period != "" {
+		sb.WriteString(period)
+		sb.WriteString("-")
+	}
+	sb.WriteString(fmt.Sprintf("%0*d", rule.Padding, value))
+	return sb.String()
+}
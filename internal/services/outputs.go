@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+)
+
+// outputFormats are the formats a document can be converted to besides its own and PDF
+var outputFormats = []string{processor.FormatOdt, processor.FormatDoc, processor.FormatRtf, processor.FormatTxt, processor.FormatPng}
+
+// pageImageDPI is the resolution of PNG page images
+const pageImageDPI = 150
+
+// checkOutputs rejects output formats a document in format cannot be converted to. Word
+// processing formats only convert from DOCX and ODT documents; PNG pages are rendered from
+// the PDF of any document.
+func checkOutputs(format string, outputs []string) error {
+	for _, output := range outputs {
+		if output == format {
+			return fmt.Errorf("output format %q is the document's own format", output)
+		}
+		if output != processor.FormatPng && format != processor.FormatDocx && format != processor.FormatOdt {
+			return fmt.Errorf("output format %q applies to DOCX and ODT templates only", output)
+		}
+	}
+	return nil
+}
+
+// ParseDocumentOutputs decodes the extra output files stored on a document
+func ParseDocumentOutputs(raw string) (map[string][]string, error) {
+	outputs := map[string][]string{}
+	if raw == "" || raw == "null" {
+		return outputs, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &outputs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// storeOutputs converts a filled document to the requested formats and uploads the results.
+// pdfPath is the document's PDF, or empty when none was made. A format that fails is logged
+// and left out, as with the PDF.
+func (s *DocumentService) storeOutputs(ctx context.Context, documentID, filename, documentPath, pdfPath string, outputs []string) map[string][]string {
+	stored := map[string][]string{}
+	if len(outputs) == 0 {
+		return stored
+	}
+	if s.converter == nil {
+		fmt.Printf("[ERROR] No converter configured, skipping outputs %v\n", outputs)
+		return stored
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, format := range outputs {
+		var files []string
+		var cleanup func()
+		var err error
+		if format == processor.FormatPng {
+			if pdfPath == "" {
+				fmt.Printf("[ERROR] No PDF to render PNG pages of document %s from\n", documentID)
+				continue
+			}
+			files, cleanup, err = s.converter.RenderPages(ctx, pdfPath, pageImageDPI)
+		} else {
+			// LibreOffice names the result after its input
+			var file string
+			file, cleanup, err = s.converter.Convert(ctx, documentPath, format)
+			files = []string{file}
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] Failed to convert document %s to %s: %v\n", documentID, format, err)
+			continue
+		}
+
+		var objectNames []string
+		for i, file := range files {
+			name := base + "." + format
+			if format == processor.FormatPng {
+				name = fmt.Sprintf("%s_page%d.png", base, i+1)
+			}
+			objectName := storage.GenerateDocumentObjectName(documentID, name)
+			if err := s.uploadOutput(ctx, file, objectName, processor.MimeType(format)); err != nil {
+				fmt.Printf("[ERROR] Failed to upload %s to GCS: %v\n", name, err)
+				for _, uploaded := range objectNames {
+					s.gcsClient.DeleteFile(ctx, uploaded)
+				}
+				objectNames = nil
+				break
+			}
+			objectNames = append(objectNames, objectName)
+		}
+		cleanup()
+		if len(objectNames) > 0 {
+			stored[format] = objectNames
+			fmt.Printf("[DEBUG] Stored %d %s file(s) for document %s\n", len(objectNames), format, documentID)
+		}
+	}
+	return stored
+}
+
+func (s *DocumentService) uploadOutput(ctx context.Context, filePath, objectName, contentType string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = s.gcsClient.UploadFile(ctx, f, objectName, contentType)
+	return err
+}
+
+// documentFile locates a stored file of a document: the filled document for its own format
+// (or "docx", the historical default), its PDF, or an extra output. page picks the PNG page,
+// counting from 1.
+func documentFile(document *models.Document, format string, page int) (gcsPath, filename, mimeType string, err error) {
+	base := strings.TrimSuffix(document.Filename, filepath.Ext(document.Filename))
+	switch {
+	case format == "pdf":
+		if document.GCSPathPdf == "" && document.PDFStatus == models.PDFStatusPending {
+			return "", "", "", fmt.Errorf("PDF is still being generated")
+		}
+		if document.GCSPathPdf == "" {
+			return "", "", "", fmt.Errorf("PDF version not available")
+		}
+		return document.GCSPathPdf, base + ".pdf", "application/pdf", nil
+	case format == "" || format == processor.FormatDocx || format == processor.FileFormat(document.Filename):
+		// The filled document keeps the template's format
+		mimeType = document.MimeType
+		if mimeType == "" {
+			mimeType = processor.MimeType(processor.FormatDocx)
+		}
+		return document.GCSPathDocx, document.Filename, mimeType, nil
+	}
+
+	outputs, err := ParseDocumentOutputs(document.Outputs)
+	if err != nil {
+		return "", "", "", err
+	}
+	files := outputs[format]
+	if len(files) == 0 {
+		return "", "", "", fmt.Errorf("%s version not available", strings.ToUpper(format))
+	}
+	if format != processor.FormatPng {
+		return files[0], base + "." + format, processor.MimeType(format), nil
+	}
+	if page < 1 || page > len(files) {
+		return "", "", "", fmt.Errorf("page %d not available; the document has %d pages", page, len(files))
+	}
+	return files[page-1], fmt.Sprintf("%s_page%d.png", base, page), processor.MimeType(format), nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+
+	"DF-PLCH/internal/processor"
+)
+
+// ErrPageNotFound is returned for overlays of pages the template is not known to have
+var ErrPageNotFound = errors.New("page not found")
+
+// GetPageOverlay returns the placeholder rectangles of one page scaled to dpi
+func (s *TemplateService) GetPageOverlay(templateID string, page int, dpi float64) (*processor.PageOverlay, error) {
+	positions, err := s.GetPlaceholderPositions(templateID)
+	if err != nil {
+		return nil, err
+	}
+	sections, err := s.GetSections(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, ok := pageLayout(sections, positions, page)
+	if !ok {
+		return nil, ErrPageNotFound
+	}
+
+	proc := processor.NewDocxProcessor("", "")
+	overlay := proc.NewPageOverlay(page, layout, positions, dpi)
+	return &overlay, nil
+}
+
+// pageLayout finds the page setup of page: the section of a placeholder on that page, otherwise
+// the last section starting on or before it. Templates stored before sections were recorded
+// use the default layout.
+func pageLayout(sections []processor.Section, positions []processor.PlaceholderPosition, page int) (processor.DocumentLayout, bool) {
+	lastPage := 1
+	for _, section := range sections {
+		lastPage = max(lastPage, section.FirstPage)
+	}
+	for _, position := range positions {
+		lastPage = max(lastPage, position.PageNumber)
+	}
+	if page < 1 || page > lastPage {
+		return processor.DocumentLayout{}, false
+	}
+
+	for _, position := range positions {
+		if position.PageNumber == page && position.Section >= 1 && position.Section <= len(sections) {
+			return sections[position.Section-1].Layout, true
+		}
+	}
+
+	var layout processor.DocumentLayout
+	found := false
+	for _, section := range sections {
+		if section.FirstPage <= page {
+			layout = section.Layout
+			found = true
+		}
+	}
+	if !found {
+		layout = processor.DefaultLayout()
+	}
+	return layout, true
+}
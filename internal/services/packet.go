@@ -0,0 +1,649 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/pdftext"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPacketTemplates = 20
+	// A packet waits for the PDFs of its forms before merging them, so it gets longer than a job
+	packetBuildTimeout = 3 * pdfJobTimeout
+	// A packet still pending after this was built on an instance that stopped
+	stalePacketAfter = packetBuildTimeout + stalePDFAfter
+)
+
+var (
+	// ErrPacketNotFound is returned for packets that do not exist
+	ErrPacketNotFound = errors.New("packet not found")
+	// ErrSubmissionNotFound is returned for packet submissions that do not exist
+	ErrSubmissionNotFound = errors.New("packet submission not found")
+	// ErrInvalidPacket is returned when a packet definition is rejected
+	ErrInvalidPacket = errors.New("invalid packet")
+)
+
+// unsafeFilenameChars are replaced in the file name of a packet PDF
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+// PacketDefinition describes a packet to create. Templates are rendered in order.
+type PacketDefinition struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Templates   []models.PacketTemplate `json:"templates"`
+	CoverPage   bool                    `json:"cover_page"`
+	Bookmarks   bool                    `json:"bookmarks"`
+}
+
+// PacketService renders every template of a packet from one submission and merges their PDFs
+// into one, in the background
+type PacketService struct {
+	gcsClient       *storage.GCSClient
+	templateService *TemplateService
+	documentService *DocumentService
+	pdfConverter    PDFConverter
+
+	mu      sync.Mutex
+	stopped bool
+	builds  sync.WaitGroup
+}
+
+func NewPacketService(gcsClient *storage.GCSClient, templateService *TemplateService, documentService *DocumentService, pdfConverter PDFConverter) *PacketService {
+	return &PacketService{
+		gcsClient:       gcsClient,
+		templateService: templateService,
+		documentService: documentService,
+		pdfConverter:    pdfConverter,
+	}
+}
+
+// CreatePacket checks that every template of a packet exists and stores it. Forms without a
+// title are named after their template.
+func (s *PacketService) CreatePacket(definition PacketDefinition) (*models.Packet, error) {
+	name := strings.TrimSpace(definition.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidPacket)
+	}
+	if len(definition.Templates) == 0 || len(definition.Templates) > maxPacketTemplates {
+		return nil, fmt.Errorf("%w: a packet holds 1 to %d templates", ErrInvalidPacket, maxPacketTemplates)
+	}
+
+	templates := make([]models.PacketTemplate, len(definition.Templates))
+	for i, form := range definition.Templates {
+		if form.TemplateID == "" {
+			return nil, fmt.Errorf("%w: template %d has no template_id", ErrInvalidPacket, i+1)
+		}
+		tmpl, err := s.templateService.GetTemplate(form.TemplateID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: template %s not found", ErrInvalidPacket, form.TemplateID)
+		}
+		form.Title = strings.TrimSpace(form.Title)
+		if form.Title == "" {
+			form.Title = templateTitle(tmpl)
+		}
+		templates[i] = form
+	}
+
+	templatesJSON, err := json.Marshal(templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal packet templates: %w", err)
+	}
+
+	packet := &models.Packet{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: definition.Description,
+		Templates:   string(templatesJSON),
+		CoverPage:   definition.CoverPage,
+		Bookmarks:   definition.Bookmarks,
+	}
+	if err := internal.DB.Create(packet).Error; err != nil {
+		return nil, fmt.Errorf("failed to save packet: %w", err)
+	}
+	return packet, nil
+}
+
+// templateTitle names a template for people: its display name, else the uploaded file name
+func templateTitle(tmpl *models.Template) string {
+	for _, name := range []string{tmpl.DisplayName, tmpl.OriginalName, tmpl.Filename} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return tmpl.ID
+}
+
+func (s *PacketService) GetPacket(packetID string) (*models.Packet, error) {
+	var packet models.Packet
+	if err := internal.DB.First(&packet, "id = ?", packetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrPacketNotFound, packetID)
+		}
+		return nil, fmt.Errorf("failed to get packet: %w", err)
+	}
+	return &packet, nil
+}
+
+func (s *PacketService) GetAllPackets() ([]models.Packet, error) {
+	var packets []models.Packet
+	if err := internal.DB.Order("created_at desc").Find(&packets).Error; err != nil {
+		return nil, fmt.Errorf("failed to get packets: %w", err)
+	}
+	return packets, nil
+}
+
+// DeletePacket removes a packet definition; documents and PDFs already made from it are kept
+func (s *PacketService) DeletePacket(packetID string) error {
+	packet, err := s.GetPacket(packetID)
+	if err != nil {
+		return err
+	}
+	return internal.DB.Delete(packet).Error
+}
+
+// ParsePacketTemplates decodes the templates stored on a packet
+func ParsePacketTemplates(raw string) ([]models.PacketTemplate, error) {
+	var templates []models.PacketTemplate
+	if raw == "" || raw == "null" {
+		return templates, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &templates); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal packet templates: %w", err)
+	}
+	return templates, nil
+}
+
+// ParsePacketDocuments decodes the document IDs stored on a packet submission
+func ParsePacketDocuments(raw string) ([]string, error) {
+	var documentIDs []string
+	if raw == "" || raw == "null" {
+		return documentIDs, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &documentIDs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal packet documents: %w", err)
+	}
+	return documentIDs, nil
+}
+
+// ProcessPacket records a submission of a packet and builds it in the background: every
+// template is rendered from the same data, then their PDFs are merged. A packet holds up to
+// maxPacketTemplates forms, more than a request should wait for.
+func (s *PacketService) ProcessPacket(ctx context.Context, packetID string, data map[string]interface{}) (*models.PacketSubmission, error) {
+	packet, err := s.GetPacket(packetID)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := ParsePacketTemplates(packet.Templates)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("[DEBUG] Processing packet %s with %d templates\n", packet.ID, len(templates))
+
+	submission := &models.PacketSubmission{
+		ID:        uuid.New().String(),
+		PacketID:  packet.ID,
+		Documents: "[]",
+		PDFStatus: models.PDFStatusPending,
+		Status:    "completed",
+	}
+	if err := internal.DB.Create(submission).Error; err != nil {
+		return nil, fmt.Errorf("failed to save packet submission: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		s.recordPacketPDF(context.Background(), submission, "", "server is shutting down")
+		return submission, nil
+	}
+	s.builds.Add(1)
+	go func() {
+		defer s.builds.Done()
+		s.buildPacket(packet, templates, submission.ID, data)
+	}()
+	return submission, nil
+}
+
+// Stop stops accepting packets and waits for the packets being built until ctx is done
+func (s *PacketService) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.builds.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("packet builds did not finish: %w", ctx.Err())
+	}
+}
+
+// renderForms renders every template of a packet from the same data and returns the documents
+// in order. If a form cannot be rendered, the forms already rendered are deleted and the reason
+// is returned.
+func (s *PacketService) renderForms(ctx context.Context, templates []models.PacketTemplate, data map[string]interface{}) ([]string, string) {
+	documentIDs := make([]string, 0, len(templates))
+	for i, form := range templates {
+		// Each form gets its own copy, as its sequence numbers are written into the data
+		document, err := s.documentService.ProcessDocument(ctx, form.TemplateID, maps.Clone(data), RenderOptions{})
+		if err != nil {
+			fmt.Printf("[ERROR] Failed to render form %d of packet: %v\n", i+1, err)
+			s.deleteDocuments(documentIDs)
+			return nil, fmt.Sprintf("form %d (%s) could not be rendered: %v", i+1, form.Title, err)
+		}
+		documentIDs = append(documentIDs, document.ID)
+	}
+	return documentIDs, ""
+}
+
+// deleteDocuments removes the documents of a packet that failed. It runs on its own context, as
+// the build's may be what ran out.
+func (s *PacketService) deleteDocuments(documentIDs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, documentID := range documentIDs {
+		if err := s.documentService.DeleteDocument(ctx, documentID); err != nil {
+			fmt.Printf("Warning: failed to delete packet document %s: %v\n", documentID, err)
+		}
+	}
+}
+
+// buildPacket renders the forms of a submission, merges their PDFs and records the result
+func (s *PacketService) buildPacket(packet *models.Packet, templates []models.PacketTemplate, submissionID string, data map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), packetBuildTimeout)
+	defer cancel()
+
+	start := time.Now()
+	submission := &models.PacketSubmission{ID: submissionID}
+	documentIDs, renderError := s.renderForms(ctx, templates, data)
+	if renderError != "" {
+		s.recordPacketPDF(ctx, submission, "", renderError)
+		return
+	}
+
+	documentsJSON, err := json.Marshal(documentIDs)
+	if err != nil {
+		documentsJSON = []byte("[]")
+	}
+	if err := internal.DB.Model(submission).Update("documents", string(documentsJSON)).Error; err != nil {
+		fmt.Printf("Warning: failed to record documents of packet submission %s: %v\n", submissionID, err)
+	}
+
+	objectName, pdfError := s.mergePacket(ctx, packet, templates, submissionID, documentIDs)
+	if !s.recordPacketPDF(ctx, submission, objectName, pdfError) {
+		return
+	}
+	fmt.Printf("[DEBUG] PDF of packet submission %s is %s after %v\n", submissionID, submission.PDFStatus, time.Since(start))
+}
+
+// recordPacketPDF stores the PDF of a submission, or why there is none. It reports whether the
+// submission could be updated; if not, the PDF is deleted.
+func (s *PacketService) recordPacketPDF(ctx context.Context, submission *models.PacketSubmission, objectName, pdfError string) bool {
+	status := models.PDFStatusReady
+	if pdfError != "" {
+		status = models.PDFStatusFailed
+	}
+	updates := map[string]interface{}{
+		"gcs_path_pdf": objectName,
+		"pdf_status":   status,
+		"pdf_error":    pdfError,
+	}
+	result := internal.DB.Model(&models.PacketSubmission{}).Where("id = ?", submission.ID).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		fmt.Printf("Warning: failed to record PDF of packet submission %s: %v\n", submission.ID, result.Error)
+		if objectName != "" {
+			s.gcsClient.DeleteFile(ctx, objectName)
+		}
+		return false
+	}
+	submission.GCSPathPdf = objectName
+	submission.PDFStatus = status
+	submission.PDFError = pdfError
+	return true
+}
+
+// mergePacket waits for the PDF of every form, merges them behind an optional cover page, adds
+// bookmarks and uploads the result. It returns the object name of the PDF, or why there is none.
+func (s *PacketService) mergePacket(ctx context.Context, packet *models.Packet, templates []models.PacketTemplate, submissionID string, documentIDs []string) (string, string) {
+	if s.pdfConverter == nil {
+		return "", "no PDF converter is configured"
+	}
+
+	workDir, err := os.MkdirTemp("", "packet_*")
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to create packet directory: %v\n", err)
+		return "", "packet could not be prepared"
+	}
+	defer os.RemoveAll(workDir)
+
+	inputs := make([]string, 0, len(documentIDs)+1)
+	pageCounts := make([]int, len(documentIDs))
+	titles := make([]string, len(documentIDs))
+	for i, documentID := range documentIDs {
+		titles[i] = fmt.Sprintf("Form %d", i+1)
+		if i < len(templates) {
+			titles[i] = templates[i].Title
+		}
+
+		document, err := s.documentService.WaitForDocument(ctx, documentID, packetBuildTimeout)
+		if err != nil {
+			return "", fmt.Sprintf("form %q was deleted", titles[i])
+		}
+		switch {
+		case document.PDFStatus == models.PDFStatusPending:
+			return "", fmt.Sprintf("form %q was not converted in time", titles[i])
+		case document.PDFStatus == models.PDFStatusFailed:
+			return "", fmt.Sprintf("form %q has no PDF: %s", titles[i], document.PDFError)
+		case document.GCSPathPdf == "":
+			return "", fmt.Sprintf("form %q has no PDF", titles[i])
+		}
+
+		formPath := filepath.Join(workDir, fmt.Sprintf("form_%02d.pdf", i+1))
+		pageCounts[i], err = s.downloadPDF(ctx, document.GCSPathPdf, formPath)
+		if err != nil {
+			fmt.Printf("[ERROR] Failed to read PDF of document %s: %v\n", documentID, err)
+			return "", fmt.Sprintf("PDF of form %q could not be read", titles[i])
+		}
+		inputs = append(inputs, formPath)
+	}
+
+	coverPages := 0
+	if packet.CoverPage {
+		coverPath := filepath.Join(workDir, "cover.pdf")
+		coverPages, err = s.writeCover(ctx, packet, titles, pageCounts, coverPath)
+		if err != nil {
+			fmt.Printf("[ERROR] Failed to print cover of packet %s: %v\n", packet.ID, err)
+			return "", fmt.Sprintf("cover page could not be printed: %v", err)
+		}
+		inputs = append([]string{coverPath}, inputs...)
+	}
+
+	mergedPath := filepath.Join(workDir, "packet.pdf")
+	if err := s.pdfConverter.MergePDFs(ctx, inputs, mergedPath); err != nil {
+		fmt.Printf("[ERROR] Failed to merge packet %s with %s: %v\n", packet.ID, s.pdfConverter.Name(), err)
+		return "", fmt.Sprintf("PDF merge with %s failed: %v", s.pdfConverter.Name(), err)
+	}
+
+	if packet.Bookmarks {
+		starts := formStartPages(coverPages, pageCounts)
+		entries := make([]pdftext.OutlineEntry, len(titles))
+		for i, title := range titles {
+			entries[i] = pdftext.OutlineEntry{Title: title, Page: starts[i]}
+		}
+		// A packet without bookmarks is still worth delivering
+		if err := addBookmarks(mergedPath, entries); err != nil {
+			fmt.Printf("Warning: failed to add bookmarks to packet %s: %v\n", packet.ID, err)
+		}
+	}
+
+	mergedFile, err := os.Open(mergedPath)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to open merged packet: %v\n", err)
+		return "", "merged PDF could not be read"
+	}
+	defer mergedFile.Close()
+
+	objectName := storage.GeneratePacketPDFObjectName(submissionID, packetFilename(packet.Name))
+	if _, err := s.gcsClient.UploadFile(ctx, mergedFile, objectName, "application/pdf"); err != nil {
+		fmt.Printf("[ERROR] Failed to upload packet PDF to GCS: %v\n", err)
+		return "", "PDF could not be stored"
+	}
+	fmt.Printf("[DEBUG] Packet PDF successfully uploaded to GCS: %s\n", objectName)
+	return objectName, ""
+}
+
+// downloadPDF copies a stored PDF to path and returns its number of pages
+func (s *PacketService) downloadPDF(ctx context.Context, objectName, path string) (int, error) {
+	reader, err := s.gcsClient.ReadFile(ctx, objectName)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, err
+	}
+	return pdftext.PageCount(data)
+}
+
+// addBookmarks replaces the bookmarks of the PDF at path
+func addBookmarks(path string, entries []pdftext.OutlineEntry) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data, err = pdftext.AddOutline(data, entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// formStartPages returns the first page of each form in the merged PDF
+func formStartPages(coverPages int, pageCounts []int) []int {
+	starts := make([]int, len(pageCounts))
+	next := coverPages + 1
+	for i, count := range pageCounts {
+		starts[i] = next
+		next += count
+	}
+	return starts
+}
+
+// maxCoverAttempts bounds how often a cover is printed again to fix its page numbers
+const maxCoverAttempts = 3
+
+// writeCover prints the cover page listing each form and the page it starts on, and returns its
+// number of pages. The page numbers assume a one-page cover, so a longer cover is printed again
+// with the numbers shifted.
+func (s *PacketService) writeCover(ctx context.Context, packet *models.Packet, titles []string, pageCounts []int, outputPath string) (int, error) {
+	coverPages := 1
+	for attempt := 1; ; attempt++ {
+		var page bytes.Buffer
+		if err := coverTemplate.Execute(&page, coverData{
+			Name:        packet.Name,
+			Description: packet.Description,
+			Date:        time.Now().Format("2 January 2006"),
+			Forms:       coverForms(titles, formStartPages(coverPages, pageCounts)),
+		}); err != nil {
+			return 0, fmt.Errorf("failed to render cover page: %w", err)
+		}
+		if err := s.printHTML(ctx, page.String(), outputPath); err != nil {
+			return 0, err
+		}
+
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			return 0, err
+		}
+		printed, err := pdftext.PageCount(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count cover pages: %w", err)
+		}
+		if printed == coverPages || attempt == maxCoverAttempts {
+			return printed, nil
+		}
+		coverPages = printed
+	}
+}
+
+// printHTML prints a page with Chromium, or with LibreOffice when the converter cannot
+func (s *PacketService) printHTML(ctx context.Context, page, outputPath string) error {
+	err := s.pdfConverter.ConvertHTMLToPDF(ctx, &processor.HTMLBundle{Index: page}, models.PageSetup{}, outputPath, models.PDFOptions{})
+	if errors.Is(err, ErrHTMLNotSupported) {
+		err = s.pdfConverter.ConvertToPDF(ctx, strings.NewReader(page), "cover.html", outputPath, false, models.PDFOptions{})
+	}
+	return err
+}
+
+// coverData fills coverTemplate
+type coverData struct {
+	Name        string
+	Description string
+	Date        string
+	Forms       []coverForm
+}
+
+type coverForm struct {
+	Title string
+	Page  int
+}
+
+func coverForms(titles []string, starts []int) []coverForm {
+	forms := make([]coverForm, len(titles))
+	for i, title := range titles {
+		forms[i] = coverForm{Title: title, Page: starts[i]}
+	}
+	return forms
+}
+
+var coverTemplate = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 0 2cm; color: #222; }
+h1 { margin-top: 4cm; font-size: 26pt; }
+p.description { font-size: 12pt; }
+p.date { color: #666; font-size: 10pt; }
+table { width: 100%; margin-top: 2cm; border-collapse: collapse; font-size: 12pt; }
+td { padding: 6pt 0; border-bottom: 1px solid #ccc; }
+td.page { text-align: right; width: 3cm; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p class="description">{{.Description}}</p>{{end}}
+<p class="date">{{.Date}}</p>
+<table>
+{{range .Forms}}<tr><td>{{.Title}}</td><td class="page">{{.Page}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// packetFilename names the PDF of a packet after the packet
+func packetFilename(name string) string {
+	base := strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "_"), "_.")
+	if base == "" {
+		base = "packet"
+	}
+	return base + ".pdf"
+}
+
+func (s *PacketService) GetSubmission(submissionID string) (*models.PacketSubmission, error) {
+	var submission models.PacketSubmission
+	if err := internal.DB.First(&submission, "id = ?", submissionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrSubmissionNotFound, submissionID)
+		}
+		return nil, fmt.Errorf("failed to get packet submission: %w", err)
+	}
+	failStalePacket(&submission)
+	return &submission, nil
+}
+
+// failStalePacket marks a submission failed when its PDF has been pending for longer than any
+// build runs, which happens when the instance building it stopped
+func failStalePacket(submission *models.PacketSubmission) {
+	if submission.PDFStatus != models.PDFStatusPending || time.Since(submission.CreatedAt) < stalePacketAfter {
+		return
+	}
+	reason := "packet PDF did not finish; the server may have restarted"
+	updates := map[string]interface{}{"pdf_status": models.PDFStatusFailed, "pdf_error": reason}
+	if err := internal.DB.Model(submission).Updates(updates).Error; err != nil {
+		fmt.Printf("Warning: failed to record PDF failure of packet submission %s: %v\n", submission.ID, err)
+	}
+	submission.PDFStatus = models.PDFStatusFailed
+	submission.PDFError = reason
+}
+
+// WaitForSubmission returns a submission once its PDF is no longer pending, or as it is after wait
+func (s *PacketService) WaitForSubmission(ctx context.Context, submissionID string, wait time.Duration) (*models.PacketSubmission, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		submission, err := s.GetSubmission(submissionID)
+		if err != nil || submission.PDFStatus != models.PDFStatusPending || time.Now().After(deadline) {
+			return submission, err
+		}
+		select {
+		case <-ctx.Done():
+			return submission, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// GetSubmissionReader opens the merged PDF of a submission
+func (s *PacketService) GetSubmissionReader(ctx context.Context, submissionID string) (io.ReadCloser, string, error) {
+	submission, err := s.GetSubmission(submissionID)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case submission.Status == "downloaded":
+		return nil, "", fmt.Errorf("packet PDF was already downloaded")
+	case submission.GCSPathPdf == "":
+		return nil, "", fmt.Errorf("packet PDF is %s", submission.PDFStatus)
+	}
+
+	reader, err := s.gcsClient.ReadFile(ctx, submission.GCSPathPdf)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read packet PDF from GCS: %w", err)
+	}
+	// Object names end in <timestamp>_<filename>
+	_, filename, _ := strings.Cut(filepath.Base(submission.GCSPathPdf), "_")
+	return reader, filename, nil
+}
+
+// DeleteSubmissionPDF deletes the merged PDF of a submission once it has been downloaded, and
+// keeps the submission and its documents
+func (s *PacketService) DeleteSubmissionPDF(ctx context.Context, submissionID string) error {
+	submission, err := s.GetSubmission(submissionID)
+	if err != nil {
+		return err
+	}
+	if submission.GCSPathPdf == "" {
+		return fmt.Errorf("packet submission %s has no PDF", submissionID)
+	}
+
+	if err := s.gcsClient.DeleteFile(ctx, submission.GCSPathPdf); err != nil {
+		return fmt.Errorf("failed to delete packet PDF from GCS: %w", err)
+	}
+
+	updates := map[string]interface{}{"gcs_path_pdf": "", "status": "downloaded"}
+	if err := internal.DB.Model(submission).Updates(updates).Error; err != nil {
+		fmt.Printf("Warning: failed to update packet submission status: %v\n", err)
+	}
+	return nil
+}
@@ -1,19 +1,83 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+
 	"github.com/starwalkn/gotenberg-go-client/v8"
 	"github.com/starwalkn/gotenberg-go-client/v8/document"
 )
 
+// PDFConverter turns filled documents into PDF. PDFService sends them to Gotenberg,
+// LibreOfficeConverter runs a local soffice and FakePDFConverter writes a placeholder PDF.
+type PDFConverter interface {
+	// Name identifies the converter in logs and health checks
+	Name() string
+	// ConvertToPDF converts an office document named filename into a PDF at outputPath
+	ConvertToPDF(ctx context.Context, documentReader io.Reader, filename, outputPath string, landscape bool, options models.PDFOptions) error
+	// ConvertHTMLToPDF prints an HTML page and its assets with the paper size and margins of setup
+	ConvertHTMLToPDF(ctx context.Context, bundle *processor.HTMLBundle, setup models.PageSetup, outputPath string, options models.PDFOptions) error
+	// MergePDFs joins PDFs into one at outputPath, in the order given
+	MergePDFs(ctx context.Context, inputPaths []string, outputPath string) error
+	// Health reports the converter's state for /health
+	Health() ConverterHealth
+	Close() error
+}
+
+// ErrHTMLNotSupported is returned by converters that cannot print HTML templates
+var ErrHTMLNotSupported = errors.New("HTML templates are printed through Gotenberg's Chromium")
+
+// ConverterHealth reports a PDF converter in /health
+type ConverterHealth struct {
+	Name    string        `json:"name"`
+	Breaker *BreakerState `json:"breaker,omitempty"`
+}
+
+// Available reports whether documents are being sent to the converter
+func (h ConverterHealth) Available() bool {
+	return h.Breaker == nil || h.Breaker.State != BreakerOpen
+}
+
+const (
+	pdfMaxAttempts   = 3
+	pdfBackoffBase   = 500 * time.Millisecond
+	pdfBackoffMax    = 8 * time.Second
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// gotenbergStatusError is a response from Gotenberg other than 200
+type gotenbergStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *gotenbergStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Gotenberg answered %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Gotenberg answered %d: %s", e.StatusCode, e.Message)
+}
+
+// PDFService converts documents through a Gotenberg container: office files with its
+// LibreOffice route and HTML pages with its Chromium route. Transient failures are retried
+// with backoff, and a circuit breaker fails fast while Gotenberg is down.
 type PDFService struct {
 	client  *gotenberg.Client
 	timeout time.Duration
+	breaker *circuitBreaker
 }
 
 func NewPDFService(gotenbergURL string, timeoutStr string) (*PDFService, error) {
@@ -25,7 +89,7 @@ func NewPDFService(gotenbergURL string, timeoutStr string) (*PDFService, error)
 		fmt.Printf("Warning: failed to parse timeout '%s', using optimized default 30s: %v\n", timeoutStr, err)
 	}
 
-	// Create HTTP client with the configured timeout
+	// Create HTTP client with the configured timeout, which applies to each attempt
 	httpClient := &http.Client{
 		Timeout: timeout,
 	}
@@ -38,6 +102,7 @@ func NewPDFService(gotenbergURL string, timeoutStr string) (*PDFService, error)
 	return &PDFService{
 		client:  client,
 		timeout: timeout,
+		breaker: newCircuitBreaker(breakerThreshold, breakerCooldown),
 	}, nil
 }
 
@@ -46,19 +111,59 @@ func (s *PDFService) ConvertDocxToPDF(ctx context.Context, docxReader io.Reader,
 }
 
 func (s *PDFService) ConvertDocxToPDFWithOrientation(ctx context.Context, docxReader io.Reader, filename string, landscape bool) (io.ReadCloser, error) {
-	return s.convertWithRetry(ctx, docxReader, filename, landscape, 3)
+	content, err := io.ReadAll(docxReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	pdf, err := s.convertOffice(ctx, content, filename, landscape, models.PDFOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(pdf)), nil
 }
 
-func (s *PDFService) convertWithRetry(ctx context.Context, docxReader io.Reader, filename string, landscape bool, maxRetries int) (io.ReadCloser, error) {
-	var lastErr error
+func (s *PDFService) ConvertDocxToPDFFromFile(ctx context.Context, docxFilePath string) (io.ReadCloser, error) {
+	content, err := os.ReadFile(docxFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	pdf, err := s.convertOffice(ctx, content, "document.docx", false, models.PDFOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(pdf)), nil
+}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Create a new context with extended timeout for each attempt
-		convertCtx, cancel := context.WithTimeout(ctx, s.timeout)
-		defer cancel()
+func (s *PDFService) ConvertDocxToPDFToFile(ctx context.Context, docxReader io.Reader, filename string, outputPath string) error {
+	return s.ConvertDocxToPDFToFileWithOrientation(ctx, docxReader, filename, outputPath, false)
+}
+
+func (s *PDFService) ConvertDocxToPDFToFileWithOrientation(ctx context.Context, docxReader io.Reader, filename string, outputPath string, landscape bool) error {
+	return s.ConvertToPDF(ctx, docxReader, filename, outputPath, landscape, models.PDFOptions{})
+}
+
+// ConvertToPDF converts an office document with the LibreOffice route. The paper size and
+// margins of options are already in the document; the rest map onto the route's properties.
+func (s *PDFService) ConvertToPDF(ctx context.Context, documentReader io.Reader, filename, outputPath string, landscape bool, options models.PDFOptions) error {
+	content, err := io.ReadAll(documentReader)
+	if err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	pdf, err := s.convertOffice(ctx, content, filename, landscape, options)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, pdf, 0644); err != nil {
+		return fmt.Errorf("failed to store converted document: %w", err)
+	}
+	return nil
+}
 
-		// Create document from reader
-		doc, err := document.FromReader(filename, docxReader)
+// convertOffice converts an office document with Gotenberg's LibreOffice route. The content
+// is kept in memory so that every attempt sends it in full.
+func (s *PDFService) convertOffice(ctx context.Context, content []byte, filename string, landscape bool, options models.PDFOptions) ([]byte, error) {
+	return s.send(ctx, func(ctx context.Context) (*http.Response, error) {
+		doc, err := document.FromBytes(filename, content)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create document from reader: %w", err)
 		}
@@ -72,74 +177,178 @@ func (s *PDFService) convertWithRetry(ctx context.Context, docxReader io.Reader,
 		}
 		// If landscape is false, default to portrait (don't call Landscape())
 
-		// Convert document
-		resp, err := s.client.Send(convertCtx, req)
-		if err == nil {
-			return resp.Body, nil
+		if options.PDFA != "" {
+			req.PdfA(gotenberg.PdfAFormat(options.PDFA))
+		}
+		if options.PDFUA != nil && *options.PDFUA {
+			req.PdfUA()
+		}
+		if options.PageRanges != "" {
+			req.NativePageRanges(options.PageRanges)
+		}
+		if options.ExportBookmarks != nil {
+			req.ExportBookmarks(*options.ExportBookmarks)
+		}
+		if options.LosslessImages != nil && *options.LosslessImages {
+			req.LosslessImageCompression()
+		}
+
+		return s.client.Send(ctx, req)
+	})
+}
+
+// send runs a Gotenberg request built by attempt, retrying transient failures with exponential
+// backoff and jitter, and returns the converted file
+func (s *PDFService) send(ctx context.Context, attempt func(context.Context) (*http.Response, error)) ([]byte, error) {
+	var lastErr error
+	for n := 1; n <= pdfMaxAttempts; n++ {
+		if err := s.breaker.Allow(); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (last error: %v)", err, lastErr)
+			}
+			return nil, err
+		}
+
+		pdf, err := s.sendOnce(ctx, attempt)
+		switch {
+		case err == nil:
+			s.breaker.Success()
+			return pdf, nil
+		case ctx.Err() != nil:
+			s.breaker.Release()
+			return nil, fmt.Errorf("PDF conversion cancelled: %w", err)
+		case gotenbergUnavailable(err):
+			s.breaker.Failure()
+		case gotenbergAnswered(err):
+			// Gotenberg answered, so it is up even though this document failed
+			s.breaker.Success()
+		default:
+			// The request could not be built or sent, which says nothing about Gotenberg
+			s.breaker.Release()
 		}
 
 		lastErr = err
-		fmt.Printf("PDF conversion attempt %d/%d failed: %v\n", attempt, maxRetries, err)
+		if !retryableConversion(err) {
+			return nil, fmt.Errorf("failed to convert document: %w", err)
+		}
+		fmt.Printf("PDF conversion attempt %d/%d failed: %v\n", n, pdfMaxAttempts, err)
+		if n == pdfMaxAttempts {
+			break
+		}
 
-		// If this is not the last attempt, wait before retrying
-		if attempt < maxRetries {
-			time.Sleep(time.Duration(attempt) * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("PDF conversion cancelled: %w", lastErr)
+		case <-time.After(backoff(n)):
 		}
 	}
-
-	return nil, fmt.Errorf("failed to convert document after %d attempts: %w", maxRetries, lastErr)
+	return nil, fmt.Errorf("failed to convert document after %d attempts: %w", pdfMaxAttempts, lastErr)
 }
 
-func (s *PDFService) ConvertDocxToPDFFromFile(ctx context.Context, docxFilePath string) (io.ReadCloser, error) {
-	// Create document from file path
-	doc, err := document.FromPath("document.docx", docxFilePath)
+// sendOnce sends one request and reads the converted file
+func (s *PDFService) sendOnce(ctx context.Context, attempt func(context.Context) (*http.Response, error)) ([]byte, error) {
+	resp, err := attempt(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create document from path: %w", err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Create LibreOffice request for DOCX conversion
-	req := gotenberg.NewLibreOfficeRequest(doc)
-
-	// Default to portrait orientation
-
-	// Convert document
-	resp, err := s.client.Send(ctx, req)
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &gotenbergStatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	pdf, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert document: %w", err)
+		return nil, fmt.Errorf("failed to read converted document: %w", err)
 	}
+	return pdf, nil
+}
 
-	return resp.Body, nil
+// gotenbergAnswered reports whether a failure is Gotenberg's answer
+func gotenbergAnswered(err error) bool {
+	var statusErr *gotenbergStatusError
+	return errors.As(err, &statusErr)
 }
 
-func (s *PDFService) ConvertDocxToPDFToFile(ctx context.Context, docxReader io.Reader, filename string, outputPath string) error {
-	return s.ConvertDocxToPDFToFileWithOrientation(ctx, docxReader, filename, outputPath, false)
+// networkFailure reports whether a request was sent but got no answer. Failures to build it,
+// such as a missing input file, are not.
+func networkFailure(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
 
-func (s *PDFService) ConvertDocxToPDFToFileWithOrientation(ctx context.Context, docxReader io.Reader, filename string, outputPath string, landscape bool) error {
-	// Create document from reader
-	doc, err := document.FromReader(filename, docxReader)
-	if err != nil {
-		return fmt.Errorf("failed to create document from reader: %w", err)
+// retryableConversion reports whether a failed conversion may succeed when sent again.
+// Gotenberg answers 4xx for documents it will never convert.
+func retryableConversion(err error) bool {
+	var statusErr *gotenbergStatusError
+	if !errors.As(err, &statusErr) {
+		return networkFailure(err)
 	}
+	switch statusErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
 
-	// Create LibreOffice request for DOCX conversion
-	req := gotenberg.NewLibreOfficeRequest(doc)
+// gotenbergUnavailable reports whether a failure means Gotenberg is down or overloaded, which
+// counts towards opening the circuit. A 500 is left out: it is usually one document crashing
+// LibreOffice.
+func gotenbergUnavailable(err error) bool {
+	var statusErr *gotenbergStatusError
+	if !errors.As(err, &statusErr) {
+		return networkFailure(err)
+	}
+	switch statusErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
 
-	// Set orientation based on parameter
-	if landscape {
-		req.Landscape()
+// backoff is the wait before attempt n+1: up to pdfBackoffBase doubled n-1 times, at most
+// pdfBackoffMax, with full jitter so that workers retrying together spread out
+func backoff(n int) time.Duration {
+	limit := pdfBackoffBase << (n - 1)
+	if limit > pdfBackoffMax || limit <= 0 {
+		limit = pdfBackoffMax
 	}
-	// If landscape is false, default to portrait (don't call Landscape())
+	return time.Duration(rand.Int64N(int64(limit))) + time.Millisecond
+}
 
-	// Store the result to file
-	err = s.client.Store(ctx, req, outputPath)
+// MergePDFs joins PDFs with Gotenberg's PDF engines
+func (s *PDFService) MergePDFs(ctx context.Context, inputPaths []string, outputPath string) error {
+	pdf, err := s.send(ctx, func(ctx context.Context) (*http.Response, error) {
+		pdfs := make([]document.Document, 0, len(inputPaths))
+		for i, path := range inputPaths {
+			// Gotenberg merges in the alphanumeric order of the file names
+			pdf, err := document.FromPath(fmt.Sprintf("%04d.pdf", i+1), path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create document from %s: %w", path, err)
+			}
+			pdfs = append(pdfs, pdf)
+		}
+		return s.client.Send(ctx, gotenberg.NewMergeRequest(pdfs...))
+	})
 	if err != nil {
-		return fmt.Errorf("failed to store converted document: %w", err)
+		return err
+	}
+	if err := os.WriteFile(outputPath, pdf, 0644); err != nil {
+		return fmt.Errorf("failed to store merged document: %w", err)
 	}
-
 	return nil
 }
 
+func (s *PDFService) Name() string {
+	return "gotenberg"
+}
+
+func (s *PDFService) Health() ConverterHealth {
+	breaker := s.breaker.Snapshot()
+	return ConverterHealth{Name: s.Name(), Breaker: &breaker}
+}
+
 func (s *PDFService) GetClient() *gotenberg.Client {
 	return s.client
 }
@@ -148,4 +357,97 @@ func (s *PDFService) Close() error {
 	// Gotenberg client doesn't need explicit closing
 	// The HTTP client will be cleaned up automatically
 	return nil
+}
+
+// paperSizes are the named paper sizes of a page setup
+var paperSizes = map[string]gotenberg.PaperDimensions{
+	"A3":      gotenberg.A3,
+	"A4":      gotenberg.A4,
+	"A5":      gotenberg.A5,
+	"A6":      gotenberg.A6,
+	"LETTER":  gotenberg.Letter,
+	"LEGAL":   gotenberg.Legal,
+	"TABLOID": gotenberg.Tabloid,
+}
+
+// ConvertHTMLToPDFToFile prints an HTML page and its assets through Chromium with the paper
+// size and margins of setup
+func (s *PDFService) ConvertHTMLToPDFToFile(ctx context.Context, bundle *processor.HTMLBundle, setup models.PageSetup, outputPath string) error {
+	return s.ConvertHTMLToPDF(ctx, bundle, setup, outputPath, models.PDFOptions{})
+}
+
+// ConvertHTMLToPDF prints with the Chromium route, which takes the PDF/A, PDF/UA and page range
+// options
+func (s *PDFService) ConvertHTMLToPDF(ctx context.Context, bundle *processor.HTMLBundle, setup models.PageSetup, outputPath string, options models.PDFOptions) error {
+	pdf, err := s.send(ctx, func(ctx context.Context) (*http.Response, error) {
+		req, err := newHTMLRequest(bundle, setup, options)
+		if err != nil {
+			return nil, err
+		}
+		return s.client.Send(ctx, req)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, pdf, 0644); err != nil {
+		return fmt.Errorf("failed to store converted page: %w", err)
+	}
+	return nil
+}
+
+// newHTMLRequest builds a Chromium request for a page; each attempt needs its own
+func newHTMLRequest(bundle *processor.HTMLBundle, setup models.PageSetup, options models.PDFOptions) (*gotenberg.HTMLRequest, error) {
+	index, err := document.FromString(processor.HTMLIndex, bundle.Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create document from page: %w", err)
+	}
+
+	req := gotenberg.NewHTMLRequest(index)
+	assets := make([]document.Document, 0, len(bundle.Assets))
+	for name, content := range bundle.Assets {
+		asset, err := document.FromBytes(name, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create document from asset %s: %w", name, err)
+		}
+		assets = append(assets, asset)
+	}
+	req.Assets(assets...)
+
+	unit := gotenberg.SizeUnit(setup.Unit)
+	if setup.Width > 0 && setup.Height > 0 {
+		req.PaperSize(gotenberg.PaperDimensions{Width: setup.Width, Height: setup.Height, Unit: unit})
+	} else if size, ok := paperSizes[strings.ToUpper(setup.Paper)]; ok {
+		req.PaperSize(size)
+	} else {
+		req.PaperSize(gotenberg.A4)
+	}
+	if setup.Margins != nil {
+		req.Margins(gotenberg.PageMargins{
+			Top:    setup.Margins.Top,
+			Bottom: setup.Margins.Bottom,
+			Left:   setup.Margins.Left,
+			Right:  setup.Margins.Right,
+			Unit:   unit,
+		})
+	}
+	if setup.Landscape {
+		req.Landscape()
+	}
+	if setup.Scale > 0 {
+		req.Scale(setup.Scale)
+	}
+	// Receipts and letters rely on their background colors
+	req.PrintBackground()
+
+	if options.PDFA != "" {
+		req.PdfA(gotenberg.PdfAFormat(options.PDFA))
+	}
+	if options.PDFUA != nil && *options.PDFUA {
+		req.PdfUA()
+	}
+	if options.PageRanges != "" {
+		req.NativePageRanges(options.PageRanges)
+	}
+
+	return req, nil
 }
\ No newline at end of file
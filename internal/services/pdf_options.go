@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+
+	"github.com/starwalkn/gotenberg-go-client/v8"
+)
+
+// pdfAFormats are the PDF/A conformance levels Gotenberg and LibreOffice produce
+var pdfAFormats = []gotenberg.PdfAFormat{gotenberg.PdfA1b, gotenberg.PdfA2b, gotenberg.PdfA3b}
+
+var pageRangesPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// pointsPerUnit converts page setup lengths to points
+var pointsPerUnit = map[string]float64{"in": 72, "mm": 72 / 25.4, "cm": 72 / 2.54, "pt": 1}
+
+// ValidatePDFOptions checks PDF options and normalizes the PDF/A level, page ranges and unit
+func ValidatePDFOptions(options models.PDFOptions) (models.PDFOptions, error) {
+	if options.PDFA != "" {
+		level := ""
+		for _, format := range pdfAFormats {
+			if strings.EqualFold(strings.TrimSpace(options.PDFA), string(format)) {
+				level = string(format)
+			}
+		}
+		if level == "" {
+			return options, fmt.Errorf("pdfa must be one of PDF/A-1b, PDF/A-2b or PDF/A-3b")
+		}
+		options.PDFA = level
+	}
+
+	if options.PageRanges != "" {
+		ranges := strings.ReplaceAll(options.PageRanges, " ", "")
+		if !pageRangesPattern.MatchString(ranges) {
+			return options, fmt.Errorf("page_ranges must list pages and ranges such as \"1-3,5\"")
+		}
+		for _, part := range strings.Split(ranges, ",") {
+			first, last, _ := strings.Cut(part, "-")
+			from, _ := strconv.Atoi(first)
+			to := from
+			if last != "" {
+				to, _ = strconv.Atoi(last)
+			}
+			if from < 1 || to < from {
+				return options, fmt.Errorf("page range %q is not valid; pages count from 1", part)
+			}
+		}
+		options.PageRanges = ranges
+	}
+
+	// Paper size and margins follow the rules of an HTML page setup
+	setup, err := ValidatePageSetup(models.PageSetup{
+		Paper:   options.Paper,
+		Width:   options.Width,
+		Height:  options.Height,
+		Margins: options.Margins,
+		Unit:    options.Unit,
+	})
+	if err != nil {
+		return options, err
+	}
+	options.Paper, options.Unit = setup.Paper, setup.Unit
+	if !hasPDFPageSize(options) && options.Margins == nil {
+		options.Unit = ""
+	}
+	return options, nil
+}
+
+func hasPDFPageSize(options models.PDFOptions) bool {
+	return options.Paper != "" || (options.Width > 0 && options.Height > 0)
+}
+
+// CheckPDFOptions rejects options a template in format cannot be converted with. Only DOCX
+// sections carry a paper size LibreOffice honours, and Chromium has no bookmark or image settings.
+func CheckPDFOptions(format string, options models.PDFOptions) error {
+	if format != processor.FormatDocx && (hasPDFPageSize(options) || options.Margins != nil) {
+		if processor.IsHTMLFormat(format) {
+			return fmt.Errorf("paper size and margins of HTML templates are set by their page setup")
+		}
+		return fmt.Errorf("paper size and margins apply to DOCX templates only")
+	}
+	if processor.IsHTMLFormat(format) && (options.ExportBookmarks != nil || options.LosslessImages != nil) {
+		return fmt.Errorf("export_bookmarks and lossless_images apply to office templates only")
+	}
+	return nil
+}
+
+// mergePDFOptions applies the options of a request over a template's defaults. Paper size,
+// margins and unit go together, so a request that sets any of them replaces all three.
+func mergePDFOptions(defaults models.PDFOptions, request *models.PDFOptions) models.PDFOptions {
+	if request == nil {
+		return defaults
+	}
+	merged := defaults
+	if request.PDFA != "" {
+		merged.PDFA = request.PDFA
+	}
+	if request.PDFUA != nil {
+		merged.PDFUA = request.PDFUA
+	}
+	if request.PageRanges != "" {
+		merged.PageRanges = request.PageRanges
+	}
+	if hasPDFPageSize(*request) || request.Margins != nil {
+		merged.Paper, merged.Width, merged.Height = request.Paper, request.Width, request.Height
+		merged.Margins, merged.Unit = request.Margins, request.Unit
+	}
+	if request.ExportBookmarks != nil {
+		merged.ExportBookmarks = request.ExportBookmarks
+	}
+	if request.LosslessImages != nil {
+		merged.LosslessImages = request.LosslessImages
+	}
+	return merged
+}
+
+// pdfOptionsFor combines a template's default PDF options with those of a request and checks
+// them against the template's format
+func pdfOptionsFor(template *models.Template, format string, request *models.PDFOptions) (models.PDFOptions, error) {
+	defaults, err := ParsePDFOptions(template.PDFOptions)
+	if err != nil {
+		return models.PDFOptions{}, err
+	}
+	options, err := ValidatePDFOptions(mergePDFOptions(defaults, request))
+	if err != nil {
+		return options, fmt.Errorf("%w: %v", ErrInvalidRenderOptions, err)
+	}
+	if err := CheckPDFOptions(format, options); err != nil {
+		return options, fmt.Errorf("%w: %v", ErrInvalidRenderOptions, err)
+	}
+	return options, nil
+}
+
+// pdfPageSize converts the paper size and margins of PDF options to points
+func pdfPageSize(options models.PDFOptions) (processor.PageSize, bool) {
+	var size processor.PageSize
+	if !hasPDFPageSize(options) && options.Margins == nil {
+		return size, false
+	}
+	scale := pointsPerUnit[options.Unit]
+	if options.Width > 0 && options.Height > 0 {
+		size.Width, size.Height = options.Width*scale, options.Height*scale
+	} else if paper, ok := paperSizes[strings.ToUpper(options.Paper)]; ok {
+		// Gotenberg's paper sizes are in inches
+		size.Width, size.Height = paper.Width*72, paper.Height*72
+	}
+	if m := options.Margins; m != nil {
+		size.Margins = &processor.PageMargins{Top: m.Top * scale, Bottom: m.Bottom * scale, Left: m.Left * scale, Right: m.Right * scale}
+	}
+	return size, true
+}
+
+// pageSizedCopy writes a copy of a DOCX with the paper size and margins of PDF options. The copy
+// is converted, so the DOCX that is downloaded keeps the page setup of its template.
+func pageSizedCopy(inputFile string, size processor.PageSize) (string, error) {
+	outputFile := strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + "_sized.docx"
+	proc := processor.NewDocxProcessor(inputFile, outputFile)
+	if err := proc.UnzipDocx(); err != nil {
+		return "", fmt.Errorf("failed to unzip document: %w", err)
+	}
+	defer proc.Cleanup()
+
+	fmt.Printf("[DEBUG] Setting paper size %.0fx%.0fpt (margins: %v)\n", size.Width, size.Height, size.Margins != nil)
+	if err := proc.SetPageSize(size); err != nil {
+		return "", fmt.Errorf("failed to set paper size: %w", err)
+	}
+	if err := proc.ReZipDocx(); err != nil {
+		os.Remove(outputFile)
+		return "", fmt.Errorf("failed to create sized document: %w", err)
+	}
+	return outputFile, nil
+}
+
+// ParsePDFOptions decodes the default PDF options stored on a template
+func ParsePDFOptions(raw string) (models.PDFOptions, error) {
+	var options models.PDFOptions
+	if raw == "" || raw == "null" {
+		return options, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &options); err != nil {
+		return options, fmt.Errorf("failed to unmarshal PDF options: %w", err)
+	}
+	return options, nil
+}
+
+func (s *TemplateService) GetPDFOptions(templateID string) (models.PDFOptions, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return models.PDFOptions{}, err
+	}
+	return ParsePDFOptions(template.PDFOptions)
+}
+
+// UpdatePDFOptions replaces the default PDF options of a template
+func (s *TemplateService) UpdatePDFOptions(templateID string, options models.PDFOptions) (*models.Template, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := ValidatePDFOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPDFOptions(processor.FileFormat(template.Filename), normalized); err != nil {
+		return nil, err
+	}
+
+	optionsJSON, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PDF options: %w", err)
+	}
+
+	if err := internal.DB.Model(template).Update("pdf_options", string(optionsJSON)).Error; err != nil {
+		return nil, fmt.Errorf("failed to save PDF options: %w", err)
+	}
+	template.PDFOptions = string(optionsJSON)
+
+	return template, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestPDFService points a PDFService at a server answering with the given status codes in
+// turn, then 200, and counts the requests it gets
+func newTestPDFService(t *testing.T, statuses ...int) (*PDFService, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			http.Error(w, http.StatusText(statuses[n-1]), statuses[n-1])
+			return
+		}
+		w.Write([]byte("%PDF-1.4 converted"))
+	}))
+	t.Cleanup(server.Close)
+
+	service, err := NewPDFService(server.URL, "5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, &requests
+}
+
+func convert(t *testing.T, service *PDFService) error {
+	output := filepath.Join(t.TempDir(), "output.pdf")
+	return service.ConvertDocxToPDFToFile(context.Background(), strings.NewReader("document"), "document.docx", output)
+}
+
+func TestSendRetriesTransientFailures(t *testing.T) {
+	service, requests := newTestPDFService(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	if err := convert(t, service); err != nil {
+		t.Fatalf("expected the third attempt to succeed: %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+	if state := service.Health().Breaker.State; state != BreakerClosed {
+		t.Errorf("breaker is %s after a success, want closed", state)
+	}
+}
+
+func TestSendDoesNotRetryRejectedDocuments(t *testing.T) {
+	service, requests := newTestPDFService(t, http.StatusBadRequest)
+	err := convert(t, service)
+	var statusErr *gotenbergStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the 400 to be returned, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestSendOpensCircuit(t *testing.T) {
+	statuses := make([]int, breakerThreshold)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	service, requests := newTestPDFService(t, statuses...)
+	service.breaker = newCircuitBreaker(2, breakerCooldown)
+
+	// The second failure opens the circuit, so the third attempt is never sent
+	if err := convert(t, service); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to open, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	if err := convert(t, service); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected an open circuit to fail fast, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("got %d requests while the circuit was open, want 2", n)
+	}
+}
+
+func TestSendDoesNotCountRequestsItCannotBuild(t *testing.T) {
+	service, requests := newTestPDFService(t)
+	service.breaker = newCircuitBreaker(1, breakerCooldown)
+
+	missing := filepath.Join(t.TempDir(), "missing.pdf")
+	output := filepath.Join(t.TempDir(), "merged.pdf")
+	if err := service.MergePDFs(context.Background(), []string{missing}, output); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the missing input to be reported, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("got %d requests, want 0", n)
+	}
+	if snapshot := service.Health().Breaker; snapshot.State != BreakerClosed || snapshot.ConsecutiveFailures != 0 {
+		t.Errorf("got %+v after a request that was never sent, want closed", snapshot)
+	}
+}
+
+func TestRetryClassification(t *testing.T) {
+	tests := []struct {
+		err         error
+		retryable   bool
+		unavailable bool
+	}{
+		{&url.Error{Op: "Post", URL: "http://gotenberg", Err: errors.New("connection refused")}, true, true},
+		{errors.New("file 0001.pdf does not exist"), false, false},
+		{&gotenbergStatusError{StatusCode: http.StatusServiceUnavailable}, true, true},
+		{&gotenbergStatusError{StatusCode: http.StatusTooManyRequests}, true, true},
+		{&gotenbergStatusError{StatusCode: http.StatusInternalServerError}, true, false},
+		{&gotenbergStatusError{StatusCode: http.StatusBadRequest}, false, false},
+	}
+	for _, tt := range tests {
+		if got := retryableConversion(tt.err); got != tt.retryable {
+			t.Errorf("retryableConversion(%v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+		if got := gotenbergUnavailable(tt.err); got != tt.unavailable {
+			t.Errorf("gotenbergUnavailable(%v) = %v, want %v", tt.err, got, tt.unavailable)
+		}
+	}
+}
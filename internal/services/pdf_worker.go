@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+)
+
+const (
+	pdfQueueSize  = 256
+	pdfJobTimeout = 5 * time.Minute
+	// A conversion still pending this long after it could have finished was on an instance that stopped
+	stalePDFAfter = 15 * time.Minute
+	// pollInterval is how often a long-polling request checks its document
+	pollInterval = 500 * time.Millisecond
+)
+
+// pdfJob converts a stored document to PDF and its extra formats. documentFile is a copy of
+// the filled document that the job removes when done.
+type pdfJob struct {
+	documentID   string
+	template     *models.Template
+	documentFile string
+	format       string
+	landscape    bool
+	outputs      []string
+	pdfOptions   models.PDFOptions
+}
+
+// pdfQueue holds the jobs waiting for a worker
+type pdfQueue struct {
+	jobs    chan pdfJob
+	mu      sync.Mutex
+	stopped bool
+	workers sync.WaitGroup
+	// size is the number of workers, which with a job's place in the queue bounds how long it waits
+	size int
+}
+
+func newPDFQueue() *pdfQueue {
+	return &pdfQueue{jobs: make(chan pdfJob, pdfQueueSize)}
+}
+
+// StartPDFWorkers starts the goroutines that convert queued documents
+func (s *DocumentService) StartPDFWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	s.pdfQueue.size = workers
+	for i := 0; i < workers; i++ {
+		s.pdfQueue.workers.Add(1)
+		go func() {
+			defer s.pdfQueue.workers.Done()
+			for job := range s.pdfQueue.jobs {
+				s.runPDFJob(job)
+			}
+		}()
+	}
+	fmt.Printf("[DEBUG] Started %d PDF workers\n", workers)
+}
+
+// StopPDFWorkers stops accepting jobs and waits for the queued ones until ctx is done
+func (s *DocumentService) StopPDFWorkers(ctx context.Context) error {
+	s.pdfQueue.mu.Lock()
+	if !s.pdfQueue.stopped {
+		s.pdfQueue.stopped = true
+		close(s.pdfQueue.jobs)
+	}
+	s.pdfQueue.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.pdfQueue.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("PDF workers did not finish: %w", ctx.Err())
+	}
+}
+
+// queuePDF hands a job to the workers, or records on the document why it could not
+func (s *DocumentService) queuePDF(document *models.Document, job pdfJob) {
+	s.pdfQueue.mu.Lock()
+	defer s.pdfQueue.mu.Unlock()
+
+	reason := "PDF queue is full"
+	if !s.pdfQueue.stopped {
+		ahead := len(s.pdfQueue.jobs)
+		select {
+		case s.pdfQueue.jobs <- job:
+			fmt.Printf("[DEBUG] Queued PDF conversion for document %s (%d waiting)\n", job.documentID, ahead+1)
+			s.recordQueueDeadline(job.documentID, ahead)
+			return
+		default:
+		}
+	} else {
+		reason = "server is shutting down"
+	}
+
+	fmt.Printf("[ERROR] Cannot queue PDF conversion for document %s: %s\n", job.documentID, reason)
+	os.Remove(job.documentFile)
+	updates := map[string]interface{}{"pdf_status": models.PDFStatusFailed, "pdf_error": reason}
+	if err := internal.DB.Model(document).Updates(updates).Error; err != nil {
+		fmt.Printf("Warning: failed to record PDF failure of document %s: %v\n", job.documentID, err)
+	}
+	document.PDFStatus = models.PDFStatusFailed
+	document.PDFError = reason
+}
+
+// recordQueueDeadline stores when a queued document is given up on if no worker takes it up:
+// once every job ahead of it could have run. A worker that already took it up has set its own.
+func (s *DocumentService) recordQueueDeadline(documentID string, ahead int) {
+	wait := time.Duration(ahead/max(s.pdfQueue.size, 1)+1)*pdfJobTimeout + stalePDFAfter
+	err := internal.DB.Model(&models.Document{}).
+		Where("id = ? AND pdf_stale_at IS NULL", documentID).
+		Update("pdf_stale_at", time.Now().Add(wait)).Error
+	if err != nil {
+		fmt.Printf("Warning: failed to record queue deadline of document %s: %v\n", documentID, err)
+	}
+}
+
+// runPDFJob converts a document to PDF and its extra formats and records the result
+func (s *DocumentService) runPDFJob(job pdfJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), pdfJobTimeout)
+	defer cancel()
+	defer os.Remove(job.documentFile)
+
+	// From now on the job is given up on stalePDFAfter after it could have timed out
+	start := time.Now()
+	result := internal.DB.Model(&models.Document{}).
+		Where("id = ? AND pdf_status = ?", job.documentID, models.PDFStatusPending).
+		Update("pdf_stale_at", start.Add(pdfJobTimeout+stalePDFAfter))
+	if result.Error == nil && result.RowsAffected == 0 {
+		fmt.Printf("[DEBUG] Document %s is no longer pending, skipping its PDF\n", job.documentID)
+		return
+	}
+
+	pdfObjectName, pdfPath, pdfError := s.generatePDF(ctx, job)
+	if pdfPath != "" {
+		defer os.Remove(pdfPath)
+	}
+	storedOutputs := s.storeOutputs(ctx, job.documentID, job.template.Filename, job.documentFile, pdfPath, job.outputs)
+
+	outputsJSON, err := json.Marshal(storedOutputs)
+	if err != nil {
+		outputsJSON = []byte("{}")
+	}
+	status := models.PDFStatusReady
+	if pdfError != "" {
+		status = models.PDFStatusFailed
+	}
+	updates := map[string]interface{}{
+		"gcs_path_pdf": pdfObjectName,
+		"pdf_status":   status,
+		"pdf_error":    pdfError,
+		"outputs":      string(outputsJSON),
+	}
+	// Only a pending document is updated, so one already marked stale stays failed
+	result = internal.DB.Model(&models.Document{}).
+		Where("id = ? AND pdf_status = ?", job.documentID, models.PDFStatusPending).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		// The document was deleted or failed meanwhile, or cannot be updated; drop what was made for it
+		fmt.Printf("Warning: failed to record PDF of document %s: %v\n", job.documentID, result.Error)
+		if pdfObjectName != "" {
+			s.gcsClient.DeleteFile(ctx, pdfObjectName)
+		}
+		for _, files := range storedOutputs {
+			for _, file := range files {
+				s.gcsClient.DeleteFile(ctx, file)
+			}
+		}
+		return
+	}
+	fmt.Printf("[DEBUG] PDF of document %s is %s after %v\n", job.documentID, status, time.Since(start))
+}
+
+// generatePDF converts the job's document with the configured converter and uploads the PDF.
+// It returns the object name and local path of the PDF, or why there is none.
+func (s *DocumentService) generatePDF(ctx context.Context, job pdfJob) (string, string, string) {
+	if s.pdfConverter == nil {
+		fmt.Printf("[DEBUG] PDF converter is nil, skipping PDF generation\n")
+		return "", "", "no PDF converter is configured"
+	}
+
+	documentFile := job.documentFile
+	if job.format == processor.FormatDocx {
+		if size, ok := pdfPageSize(job.pdfOptions); ok {
+			sizedFile, err := pageSizedCopy(job.documentFile, size)
+			if err != nil {
+				fmt.Printf("[ERROR] Failed to apply PDF paper size: %v\n", err)
+				return "", "", "PDF paper size could not be applied"
+			}
+			defer os.Remove(sizedFile)
+			documentFile = sizedFile
+		}
+	}
+
+	docxFile, err := os.Open(documentFile)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to reopen %s file for PDF conversion: %v\n", job.format, err)
+		return "", "", "document could not be reopened for PDF conversion"
+	}
+	defer docxFile.Close()
+
+	tempPDFPath := filepath.Join(os.TempDir(), job.documentID+"_output.pdf")
+
+	// HTML templates are printed by Chromium, office files converted by LibreOffice
+	if processor.IsHTMLFormat(job.format) {
+		err = s.convertHTMLToPDF(ctx, job.template, job.documentFile, job.format, tempPDFPath, job.pdfOptions)
+	} else {
+		err = s.pdfConverter.ConvertToPDF(ctx, docxFile, job.template.Filename, tempPDFPath, job.landscape, job.pdfOptions)
+	}
+	if err != nil {
+		os.Remove(tempPDFPath)
+		fmt.Printf("[ERROR] Failed to convert %s to PDF with %s: %v\n", job.format, s.pdfConverter.Name(), err)
+		return "", "", fmt.Sprintf("PDF conversion with %s failed: %v", s.pdfConverter.Name(), err)
+	}
+
+	pdfFile, err := os.Open(tempPDFPath)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to open temp PDF file: %v\n", err)
+		return "", "", "PDF could not be read after conversion"
+	}
+	defer pdfFile.Close()
+
+	pdfObjectName := storage.GenerateDocumentPDFObjectName(job.documentID, job.template.Filename)
+	if _, err := s.gcsClient.UploadFile(ctx, pdfFile, pdfObjectName, "application/pdf"); err != nil {
+		fmt.Printf("[ERROR] Failed to upload PDF to GCS: %v\n", err)
+		return "", tempPDFPath, "PDF could not be stored"
+	}
+	fmt.Printf("[DEBUG] PDF successfully uploaded to GCS: %s\n", pdfObjectName)
+	return pdfObjectName, tempPDFPath, ""
+}
+
+// failStalePDF marks a document failed when its PDF has been pending for longer than it can
+// take, which happens when the instance converting it stopped. The deadline comes from the
+// document's place in the queue, or from when a worker took it up; a document that never got
+// one is given up on like a job that started when it was stored.
+func (s *DocumentService) failStalePDF(document *models.Document) {
+	if document.PDFStatus != models.PDFStatusPending {
+		return
+	}
+	staleAt := document.CreatedAt.Add(pdfJobTimeout + stalePDFAfter)
+	if document.PDFStaleAt != nil {
+		staleAt = *document.PDFStaleAt
+	}
+	if time.Now().Before(staleAt) {
+		return
+	}
+	reason := "PDF conversion did not finish; the server may have restarted"
+	updates := map[string]interface{}{"pdf_status": models.PDFStatusFailed, "pdf_error": reason}
+	if err := internal.DB.Model(document).Where("pdf_status = ?", models.PDFStatusPending).Updates(updates).Error; err != nil {
+		fmt.Printf("Warning: failed to record PDF failure of document %s: %v\n", document.ID, err)
+	}
+	document.PDFStatus = models.PDFStatusFailed
+	document.PDFError = reason
+}
+
+// WaitForDocument returns a document once its PDF is no longer pending, or as it is after wait
+func (s *DocumentService) WaitForDocument(ctx context.Context, documentID string, wait time.Duration) (*models.Document, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		document, err := s.GetDocument(documentID)
+		if err != nil || document.PDFStatus != models.PDFStatusPending || time.Now().After(deadline) {
+			return document, err
+		}
+		select {
+		case <-ctx.Done():
+			return document, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/pdftext"
+	"DF-PLCH/internal/processor"
+)
+
+// measurePositions renders the template with a unique marker in place of every placeholder
+// occurrence and replaces the estimated coordinates with the boxes the markers take in the PDF.
+// Occurrences whose marker is not found keep their estimate.
+func (s *TemplateService) measurePositions(ctx context.Context, proc *processor.DocxProcessor, positions []processor.PlaceholderPosition) (int, error) {
+	if s.pdfConverter == nil {
+		return 0, fmt.Errorf("PDF converter is not available")
+	}
+	if len(positions) == 0 {
+		return 0, nil
+	}
+
+	markedFile, err := os.CreateTemp("", "marked_*.docx")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	markedPath := markedFile.Name()
+	markedFile.Close()
+	defer s.cleanupTempFile(markedPath)
+
+	if err := proc.WriteMarkedDocx(markedPath, positions); err != nil {
+		return 0, fmt.Errorf("failed to write marked template: %w", err)
+	}
+
+	landscape, err := proc.DetectOrientation()
+	if err != nil {
+		fmt.Printf("Warning: failed to detect orientation: %v\n", err)
+	}
+
+	docxFile, err := os.Open(markedPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open marked template: %w", err)
+	}
+	defer docxFile.Close()
+
+	pdfPath := markedPath + ".pdf"
+	defer s.cleanupTempFile(pdfPath)
+	if err := s.pdfConverter.ConvertToPDF(ctx, docxFile, "template.docx", pdfPath, landscape, models.PDFOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to render marked template: %w", err)
+	}
+
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rendered template: %w", err)
+	}
+
+	pages, err := pdftext.Extract(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rendered text: %w", err)
+	}
+
+	measured := 0
+	for _, page := range pages {
+		for _, match := range page.Search(processor.MarkerPattern) {
+			index, ok := processor.MarkerIndex(match.Text)
+			if !ok || index >= len(positions) || positions[index].Measured {
+				continue
+			}
+			pos := &positions[index]
+			pos.X = match.X
+			pos.Y = match.Y
+			pos.Width = match.Width
+			pos.Height = match.Height
+			pos.PageNumber = page.Number
+			pos.Measured = true
+			measured++
+		}
+	}
+
+	return measured, nil
+}
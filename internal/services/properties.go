@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"DF-PLCH/internal/expression"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+)
+
+// templateDataNamespace identifies the customXml part that carries the submitted data
+const templateDataNamespace = "urn:df-plch:template-data"
+
+var propertyPlaceholderPattern = regexp.MustCompile(`\{\{[^{}]+\}\}`)
+
+// reservedCustomProperties are always written by the server and cannot be configured
+var reservedCustomProperties = map[string]bool{
+	"DocumentID": true,
+	"TemplateID": true,
+}
+
+// ValidateDocumentProperties checks custom property names
+func ValidateDocumentProperties(props models.DocumentProperties) (models.DocumentProperties, error) {
+	custom := make(map[string]string, len(props.Custom))
+	for name, value := range props.Custom {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return props, fmt.Errorf("custom property names must not be empty")
+		}
+		if len(name) > 255 {
+			return props, fmt.Errorf("custom property %q: name is longer than 255 characters", name)
+		}
+		if reservedCustomProperties[name] {
+			return props, fmt.Errorf("custom property %q is set by the server", name)
+		}
+		custom[name] = value
+	}
+	props.Custom = custom
+	return props, nil
+}
+
+// ParseDocumentProperties decodes the JSON stored on a template
+func ParseDocumentProperties(raw string) (models.DocumentProperties, error) {
+	var props models.DocumentProperties
+	if raw == "" {
+		return props, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &props); err != nil {
+		return props, fmt.Errorf("failed to unmarshal document properties: %w", err)
+	}
+	return props, nil
+}
+
+// fillPropertyPlaceholders substitutes {{name}} references in a property value with submitted data
+func fillPropertyPlaceholders(text string, data map[string]interface{}) string {
+	return propertyPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, exists := lookupValue(data, placeholder); exists {
+			return expression.FormatValue(value)
+		}
+		return ""
+	})
+}
+
+// applyDocumentProperties writes the template's configured properties, the document and template IDs,
+// and optionally the submitted data into the unzipped document
+func applyDocumentProperties(proc *processor.DocxProcessor, template *models.Template, documentID string, data map[string]interface{}, now time.Time) error {
+	props, err := ParseDocumentProperties(template.DocProps)
+	if err != nil {
+		return err
+	}
+
+	core := processor.CoreProperties{
+		Title:       fillPropertyPlaceholders(props.Title, data),
+		Subject:     fillPropertyPlaceholders(props.Subject, data),
+		Creator:     fillPropertyPlaceholders(props.Author, data),
+		Keywords:    fillPropertyPlaceholders(props.Keywords, data),
+		Description: fillPropertyPlaceholders(props.Description, data),
+		Category:    fillPropertyPlaceholders(props.Category, data),
+		Created:     now,
+		Modified:    now,
+	}
+	if err := proc.SetCoreProperties(core); err != nil {
+		return fmt.Errorf("failed to set core properties: %w", err)
+	}
+
+	custom := map[string]string{
+		"DocumentID": documentID,
+		"TemplateID": template.ID,
+	}
+	for name, value := range props.Custom {
+		custom[name] = fillPropertyPlaceholders(value, data)
+	}
+	if err := proc.SetCustomProperties(custom); err != nil {
+		return fmt.Errorf("failed to set custom properties: %w", err)
+	}
+
+	if props.EmbedData {
+		partName, err := proc.EmbedCustomXML(buildDataXML(template.ID, documentID, data), templateDataNamespace)
+		if err != nil {
+			return fmt.Errorf("failed to embed data: %w", err)
+		}
+		fmt.Printf("[DEBUG] Embedded submitted data as %s\n", partName)
+	}
+
+	return nil
+}
+
+// buildDataXML serializes submitted data as
+//
+//	<templateData xmlns="urn:df-plch:template-data" templateId="..." documentId="...">
+//	  <field name="firstName">John</field>
+//	  <field name="items"><item><field name="amount">10</field></item></field>
+//	</templateData>
+func buildDataXML(templateID, documentID string, data map[string]interface{}) []byte {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sb.WriteString(fmt.Sprintf(`<templateData xmlns="%s" templateId="%s" documentId="%s">`,
+		templateDataNamespace, processor.EscapeXMLText(templateID), processor.EscapeXMLText(documentID)))
+
+	// Keys with and without {{ }} name the same value; keep one field per name
+	fields := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		name := placeholderName(key)
+		if _, exists := fields[name]; !exists || key == name {
+			fields[name] = value
+		}
+	}
+	writeDataFields(&sb, fields)
+
+	sb.WriteString(`</templateData>`)
+	return []byte(sb.String())
+}
+
+func writeDataFields(sb *strings.Builder, fields map[string]interface{}) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf(`<field name="%s">`, processor.EscapeXMLText(name)))
+		writeDataValue(sb, fields[name])
+		sb.WriteString(`</field>`)
+	}
+}
+
+func writeDataValue(sb *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		writeDataFields(sb, v)
+	case []interface{}:
+		for _, item := range v {
+			sb.WriteString(`<item>`)
+			writeDataValue(sb, item)
+			sb.WriteString(`</item>`)
+		}
+	default:
+		sb.WriteString(processor.EscapeXMLText(expression.FormatValue(v)))
+	}
+}
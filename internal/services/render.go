@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+)
+
+const maxWatermarkLength = 40
+
+var (
+	watermarkColorPattern = regexp.MustCompile(`^(#[0-9A-Fa-f]{6}|[A-Za-z]+)$`)
+	watermarkFontPattern  = regexp.MustCompile(`^[A-Za-z0-9 \-]+$`)
+)
+
+// ErrInvalidRenderOptions wraps validation failures of RenderOptions so handlers can answer 400
+var ErrInvalidRenderOptions = errors.New("invalid render options")
+
+// RenderOptions are per-request settings applied to the generated DOCX
+type RenderOptions struct {
+	Protection *ProtectionOptions `json:"protection,omitempty"`
+	Watermark  *WatermarkOptions  `json:"watermark,omitempty"`
+	Outputs    []string           `json:"outputs,omitempty"` // Extra formats: odt, doc, rtf, txt or png
+	PDF        *models.PDFOptions `json:"pdf,omitempty"`     // Overrides the template's PDF options
+}
+
+// ProtectionOptions restrict editing of the generated document.
+// Mode is "readOnly" or "forms"; an optional password is required to lift the restriction.
+type ProtectionOptions struct {
+	Mode     string `json:"mode"`
+	Password string `json:"password,omitempty"`
+}
+
+// WatermarkOptions draw diagonal text such as "DRAFT" or "COPY" behind every page
+type WatermarkOptions struct {
+	Text  string `json:"text"`
+	Color string `json:"color,omitempty"`
+	Font  string `json:"font,omitempty"`
+}
+
+// Validate checks the options before any number is allocated or file is rendered
+func (o RenderOptions) Validate() error {
+	if o.Protection != nil {
+		switch o.Protection.Mode {
+		case processor.ProtectionReadOnly, processor.ProtectionForms:
+		default:
+			return fmt.Errorf("protection mode must be %q or %q", processor.ProtectionReadOnly, processor.ProtectionForms)
+		}
+	}
+
+	if o.PDF != nil {
+		if _, err := ValidatePDFOptions(*o.PDF); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, output := range o.Outputs {
+		if !slices.Contains(outputFormats, output) {
+			return fmt.Errorf("output format %q is not supported; use %s", output, strings.Join(outputFormats, ", "))
+		}
+		if seen[output] {
+			return fmt.Errorf("output format %q is listed twice", output)
+		}
+		seen[output] = true
+	}
+
+	if o.Watermark != nil {
+		text := strings.TrimSpace(o.Watermark.Text)
+		if text == "" {
+			return fmt.Errorf("watermark text is required")
+		}
+		if utf8.RuneCountInString(text) > maxWatermarkLength {
+			return fmt.Errorf("watermark text must be at most %d characters", maxWatermarkLength)
+		}
+		if o.Watermark.Color != "" && !watermarkColorPattern.MatchString(o.Watermark.Color) {
+			return fmt.Errorf("watermark color must be a color name or #RRGGBB")
+		}
+		if o.Watermark.Font != "" && !watermarkFontPattern.MatchString(o.Watermark.Font) {
+			return fmt.Errorf("watermark font name contains invalid characters")
+		}
+	}
+
+	return nil
+}
+
+// applyRenderOptions adds the watermark and editing protection to the unzipped document. The
+// paper size of the PDF options is applied to the copy that is converted, see pageSizedCopy.
+func applyRenderOptions(proc *processor.DocxProcessor, options RenderOptions) error {
+	if options.Watermark != nil {
+		fmt.Printf("[DEBUG] Adding watermark %q\n", options.Watermark.Text)
+		watermark := processor.Watermark{
+			Text:  strings.TrimSpace(options.Watermark.Text),
+			Color: options.Watermark.Color,
+			Font:  options.Watermark.Font,
+		}
+		if err := proc.AddWatermark(watermark); err != nil {
+			return fmt.Errorf("failed to add watermark: %w", err)
+		}
+	}
+
+	if options.Protection != nil {
+		fmt.Printf("[DEBUG] Applying %s protection (password: %v)\n", options.Protection.Mode, options.Protection.Password != "")
+		if err := proc.ProtectDocument(options.Protection.Mode, options.Protection.Password); err != nil {
+			return fmt.Errorf("failed to protect document: %w", err)
+		}
+	}
+
+	return nil
+}
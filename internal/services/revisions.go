@@ -0,0 +1,45 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"DF-PLCH/internal/processor"
+)
+
+// ParseRevisionReport decodes the tracked changes and comments report stored on a template
+func ParseRevisionReport(raw string) (processor.RevisionReport, error) {
+	var report processor.RevisionReport
+	if raw == "" {
+		return report, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &report); err != nil {
+		return report, fmt.Errorf("failed to unmarshal revisions: %w", err)
+	}
+	return report, nil
+}
+
+// acceptRevisions accepts every tracked change, removes all comments and writes the result to the processor's output file
+func acceptRevisions(proc *processor.DocxProcessor) error {
+	fmt.Printf("[DEBUG] Accepting tracked changes and removing comments\n")
+	if err := proc.AcceptAllChanges(); err != nil {
+		return fmt.Errorf("failed to accept tracked changes: %w", err)
+	}
+	if err := proc.StripComments(); err != nil {
+		return fmt.Errorf("failed to remove comments: %w", err)
+	}
+	if err := proc.ReZipDocx(); err != nil {
+		return fmt.Errorf("failed to write accepted template: %w", err)
+	}
+	return nil
+}
+
+// RevisionWarning describes the tracked changes and comments left in a stored template, or returns "" when there are none
+func RevisionWarning(report processor.RevisionReport) string {
+	if report.Accepted || !report.HasRevisions() {
+		return ""
+	}
+	return fmt.Sprintf("Template contains %d tracked changes and %d comments that will appear in generated documents; "+
+		"upload again with acceptRevisions=true to accept all changes and remove comments",
+		report.Insertions+report.Deletions+report.Moves+report.FormatChanges, report.Comments)
+}
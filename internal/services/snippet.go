@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"regexp"
+
+	"DF-PLCH/internal"
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+	"DF-PLCH/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxIncludeDepth bounds nested includes and stops include cycles
+const maxIncludeDepth = 5
+
+var snippetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// ErrSnippetNotFound is returned when an include names a snippet that was never uploaded
+var ErrSnippetNotFound = errors.New("snippet not found")
+
+type SnippetService struct {
+	gcsClient *storage.GCSClient
+}
+
+func NewSnippetService(gcsClient *storage.GCSClient) *SnippetService {
+	return &SnippetService{
+		gcsClient: gcsClient,
+	}
+}
+
+// UploadSnippet stores a DOCX fragment under a name; uploading an existing name replaces it,
+// so every template including it picks up the change on its next render
+func (s *SnippetService) UploadSnippet(ctx context.Context, file multipart.File, header *multipart.FileHeader, name, description string) (*models.Snippet, error) {
+	if !snippetNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("snippet name may only contain letters, digits, '.', '_' and '-'")
+	}
+
+	tempFile, err := createTempFileWithExt(file, ".docx")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tempFile)
+
+	proc := processor.NewDocxProcessor(tempFile, "")
+	if err := proc.UnzipDocx(); err != nil {
+		return nil, fmt.Errorf("failed to process snippet: %w", err)
+	}
+	defer proc.Cleanup()
+
+	placeholders, err := proc.ExtractPlaceholders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+	}
+	placeholdersJSON, err := json.Marshal(placeholders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal placeholders: %w", err)
+	}
+
+	snippet, err := s.GetSnippet(name)
+	if err != nil && !errors.Is(err, ErrSnippetNotFound) {
+		return nil, err
+	}
+	isNew := snippet == nil
+	if isNew {
+		snippet = &models.Snippet{ID: uuid.New().String(), Name: name}
+	}
+	previousPath := snippet.GCSPath
+
+	upload, err := os.Open(tempFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open temp file: %w", err)
+	}
+	defer upload.Close()
+
+	objectName := storage.GenerateSnippetObjectName(snippet.ID, header.Filename)
+	result, err := s.gcsClient.UploadFile(ctx, upload, objectName, "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload to GCS: %w", err)
+	}
+
+	snippet.Filename = header.Filename
+	snippet.Description = description
+	snippet.GCSPath = objectName
+	snippet.FileSize = result.Size
+	snippet.Placeholders = string(placeholdersJSON)
+
+	if isNew {
+		err = internal.DB.Create(snippet).Error
+	} else {
+		err = internal.DB.Save(snippet).Error
+	}
+	if err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to save snippet metadata: %w", err)
+	}
+
+	if previousPath != "" && previousPath != objectName {
+		if err := s.gcsClient.DeleteFile(ctx, previousPath); err != nil {
+			fmt.Printf("Warning: failed to delete previous snippet file %s: %v\n", previousPath, err)
+		}
+	}
+
+	return snippet, nil
+}
+
+func (s *SnippetService) GetSnippet(name string) (*models.Snippet, error) {
+	var snippet models.Snippet
+	if err := internal.DB.First(&snippet, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrSnippetNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to get snippet: %w", err)
+	}
+	return &snippet, nil
+}
+
+func (s *SnippetService) GetAllSnippets() ([]models.Snippet, error) {
+	var snippets []models.Snippet
+	if err := internal.DB.Order("name").Find(&snippets).Error; err != nil {
+		return nil, fmt.Errorf("failed to get snippets: %w", err)
+	}
+	return snippets, nil
+}
+
+func (s *SnippetService) DeleteSnippet(ctx context.Context, name string) error {
+	snippet, err := s.GetSnippet(name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.gcsClient.DeleteFile(ctx, snippet.GCSPath); err != nil {
+		fmt.Printf("Warning: failed to delete GCS file %s: %v\n", snippet.GCSPath, err)
+	}
+
+	return internal.DB.Delete(snippet).Error
+}
+
+// ResolveIncludes merges every {{> name}} include into the unzipped document, following
+// includes inside snippets up to maxIncludeDepth levels. It returns the merged snippet names.
+func (s *SnippetService) ResolveIncludes(ctx context.Context, proc *processor.DocxProcessor) ([]string, error) {
+	var merged []string
+
+	for depth := 0; ; depth++ {
+		names, err := proc.ExtractIncludes()
+		if err != nil {
+			return merged, err
+		}
+		if len(names) == 0 {
+			return merged, nil
+		}
+		if depth >= maxIncludeDepth {
+			return merged, fmt.Errorf("snippet includes are nested more than %d levels deep (recursive include?)", maxIncludeDepth)
+		}
+
+		for _, name := range names {
+			fmt.Printf("[DEBUG] Merging snippet %s\n", name)
+			if err := s.mergeSnippet(ctx, proc, name); err != nil {
+				return merged, err
+			}
+			merged = append(merged, name)
+		}
+	}
+}
+
+func (s *SnippetService) mergeSnippet(ctx context.Context, proc *processor.DocxProcessor, name string) error {
+	snippet, err := s.GetSnippet(name)
+	if err != nil {
+		return err
+	}
+
+	reader, err := s.gcsClient.ReadFile(ctx, snippet.GCSPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snippet %s from GCS: %w", name, err)
+	}
+	defer reader.Close()
+
+	tempFile, err := createTempFileWithExt(reader, ".docx")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tempFile)
+
+	snippetProc := processor.NewDocxProcessor(tempFile, "")
+	if err := snippetProc.UnzipDocx(); err != nil {
+		return fmt.Errorf("failed to unzip snippet %s: %w", name, err)
+	}
+	defer snippetProc.Cleanup()
+
+	return proc.MergeSnippet(name, snippetProc)
+}
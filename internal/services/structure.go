@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"DF-PLCH/internal/models"
+	"DF-PLCH/internal/processor"
+)
+
+// GetStructure returns the JSON model of a template's body as stored, which is the file edits
+// apply to. Snippet includes are left unresolved, so placeholder occurrences line up with the
+// stored positions only in templates without includes.
+func (s *TemplateService) GetStructure(ctx context.Context, templateID string) (*processor.DocumentStructure, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, cleanup, err := s.openTemplate(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	positions, err := proc.ExtractPlaceholdersWithPositions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholder positions: %w", err)
+	}
+	structure, err := proc.Structure(positions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document structure: %w", err)
+	}
+	return structure, nil
+}
+
+// openTemplate downloads a stored template, the normalized copy when there is one, and unzips it.
+// The returned function removes the temporary files.
+func (s *TemplateService) openTemplate(ctx context.Context, template *models.Template) (*processor.DocxProcessor, func(), error) {
+	if format := processor.FileFormat(template.Filename); format != processor.FormatDocx {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	templatePath := template.GCSPath
+	if template.NormalizedPath != "" {
+		templatePath = template.NormalizedPath
+	}
+	reader, err := s.gcsClient.ReadFile(ctx, templatePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read template from GCS: %w", err)
+	}
+	defer reader.Close()
+
+	tempFile, err := s.createTempFile(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	outputFile := tempFile + ".out.docx"
+
+	proc := processor.NewDocxProcessor(tempFile, outputFile)
+	if err := proc.UnzipDocx(); err != nil {
+		s.cleanupTempFile(tempFile)
+		return nil, nil, fmt.Errorf("failed to process document: %w", err)
+	}
+
+	cleanup := func() {
+		proc.Cleanup()
+		s.cleanupTempFile(tempFile)
+		s.cleanupTempFile(outputFile)
+	}
+	return proc, cleanup, nil
+}
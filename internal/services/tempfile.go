@@ -0,0 +1,22 @@
+package services
+
+import (
+	"io"
+	"os"
+)
+
+// createTempFileWithExt copies reader into a new temp file whose name ends in ext
+func createTempFileWithExt(reader io.Reader, ext string) (string, error) {
+	tempFile, err := os.CreateTemp("", "*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, reader); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+
+	return tempFile.Name(), nil
+}
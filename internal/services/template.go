@@ -7,6 +7,7 @@ import (
 	"io"
 	"mime/multipart"
 	"os"
+	"slices"
 
 	"DF-PLCH/internal"
 	"DF-PLCH/internal/models"
@@ -17,20 +18,40 @@ import (
 )
 
 type TemplateService struct {
-	gcsClient *storage.GCSClient
+	gcsClient      *storage.GCSClient
+	snippetService *SnippetService
+	pdfConverter   PDFConverter
+	converter      *LibreOfficeConverter
 }
 
-func NewTemplateService(gcsClient *storage.GCSClient) *TemplateService {
+func NewTemplateService(gcsClient *storage.GCSClient, snippetService *SnippetService, pdfConverter PDFConverter, converter *LibreOfficeConverter) *TemplateService {
 	return &TemplateService{
-		gcsClient: gcsClient,
+		gcsClient:      gcsClient,
+		snippetService: snippetService,
+		pdfConverter:   pdfConverter,
+		converter:      converter,
 	}
 }
 
 func (s *TemplateService) UploadTemplate(ctx context.Context, file multipart.File, header *multipart.FileHeader) (*models.Template, error) {
-	return s.UploadTemplateWithMetadata(ctx, file, header, header.Filename, "", "")
+	return s.UploadTemplateWithMetadata(ctx, file, header, header.Filename, "", "", UploadOptions{})
 }
 
-func (s *TemplateService) UploadTemplateWithMetadata(ctx context.Context, file multipart.File, header *multipart.FileHeader, fileName, description, author string) (*models.Template, error) {
+// UploadOptions controls how an uploaded template is prepared before it is stored
+type UploadOptions struct {
+	AcceptRevisions bool // Accept all tracked changes and remove comments
+	ConvertToDocx   bool // Convert an .odt upload to DOCX; .doc and .rtf are always converted
+}
+
+func (s *TemplateService) UploadTemplateWithMetadata(ctx context.Context, file multipart.File, header *multipart.FileHeader, fileName, description, author string, options UploadOptions) (*models.Template, error) {
+	format := processor.FileFormat(header.Filename)
+	if processor.IsLegacyFormat(format) || (format == processor.FormatOdt && options.ConvertToDocx) {
+		return s.uploadConvertedTemplate(ctx, file, header, fileName, description, author, format, options)
+	}
+	if format != processor.FormatDocx {
+		return s.uploadPackageTemplate(ctx, file, header, fileName, description, author, format)
+	}
+
 	templateID := uuid.New().String()
 	objectName := storage.GenerateObjectName(templateID, header.Filename)
 
@@ -51,63 +72,178 @@ func (s *TemplateService) UploadTemplateWithMetadata(ctx context.Context, file m
 	defer s.cleanupTempFile(tempFile)
 
 	// Process DOCX to extract placeholders
-	proc := processor.NewDocxProcessor(tempFile, "")
+	outputFile := tempFile + ".out.docx"
+	defer s.cleanupTempFile(outputFile)
+	proc := processor.NewDocxProcessor(tempFile, outputFile)
 	if err := proc.UnzipDocx(); err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
 		return nil, fmt.Errorf("failed to process document: %w", err)
 	}
 	defer proc.Cleanup()
 
-	placeholders, err := proc.ExtractPlaceholders()
+	// Tracked changes and comments would otherwise show in generated documents
+	revisions, err := proc.InspectRevisions()
 	if err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+		return nil, fmt.Errorf("failed to inspect revisions: %w", err)
 	}
-
-	// Extract positions
-	positions, err := proc.ExtractPlaceholdersWithPositions()
+	if revisions.HasRevisions() {
+		fmt.Printf("[DEBUG] Template has %d insertions, %d deletions, %d moves, %d format changes, %d comments\n",
+			revisions.Insertions, revisions.Deletions, revisions.Moves, revisions.FormatChanges, revisions.Comments)
+
+		if options.AcceptRevisions {
+			if err := acceptRevisions(proc); err != nil {
+				s.gcsClient.DeleteFile(ctx, objectName)
+				return nil, err
+			}
+			revisions.Accepted = true
+
+			// Store the cleaned file in place of the original
+			if result, err = s.uploadLocalFile(ctx, outputFile, objectName, header.Header.Get("Content-Type")); err != nil {
+				s.gcsClient.DeleteFile(ctx, objectName)
+				return nil, fmt.Errorf("failed to upload accepted template: %w", err)
+			}
+		}
+	}
+	revisionsJSON, err := json.Marshal(revisions)
 	if err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		return nil, fmt.Errorf("failed to extract placeholder positions: %w", err)
+		return nil, fmt.Errorf("failed to marshal revisions: %w", err)
 	}
 
-	// Convert placeholders to JSON
-	placeholdersJSON, err := json.Marshal(placeholders)
+	// Keep a normalized copy for rendering, in which no placeholder is split across runs
+	collapsed, err := proc.NormalizeRuns()
 	if err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		return nil, fmt.Errorf("failed to marshal placeholders: %w", err)
+		return nil, fmt.Errorf("failed to normalize template: %w", err)
+	}
+	fmt.Printf("[DEBUG] Normalized template runs, joined %d split placeholders\n", collapsed)
+	if err := proc.ReZipDocx(); err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to write normalized template: %w", err)
 	}
 
-	// Convert positions to JSON
-	positionsJSON, err := json.Marshal(positions)
+	analysis, err := s.analyzeTemplate(ctx, proc)
 	if err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
-		return nil, fmt.Errorf("failed to marshal positions: %w", err)
+		return nil, err
+	}
+
+	normalizedName := storage.GenerateNormalizedObjectName(templateID, header.Filename)
+	if _, err := s.uploadLocalFile(ctx, outputFile, normalizedName, header.Header.Get("Content-Type")); err != nil {
+		s.gcsClient.DeleteFile(ctx, objectName)
+		return nil, fmt.Errorf("failed to upload normalized template: %w", err)
 	}
 
 	// Save to database
 	template := &models.Template{
-		ID:           templateID,
-		Filename:     header.Filename,
-		OriginalName: header.Filename,
-		DisplayName:  fileName,
-		Description:  description,
-		Author:       author,
-		GCSPath:      objectName,
-		FileSize:     result.Size,
-		MimeType:     header.Header.Get("Content-Type"),
-		Placeholders: string(placeholdersJSON),
-		Positions:    string(positionsJSON),
+		ID:             templateID,
+		Filename:       header.Filename,
+		OriginalName:   header.Filename,
+		DisplayName:    fileName,
+		Description:    description,
+		Author:         author,
+		GCSPath:        objectName,
+		NormalizedPath: normalizedName,
+		FileSize:       result.Size,
+		MimeType:       header.Header.Get("Content-Type"),
+		Placeholders:   analysis.placeholders,
+		Positions:      analysis.positions,
+		Sections:       analysis.sections,
+		ComputedFields: "[]",
+		NumberingRules: "[]",
+		DocProps:       "{}",
+		Revisions:      string(revisionsJSON),
+		PageSetup:      "{}",
+		PDFOptions:     "{}",
+		Version:        1,
 	}
 
 	if err := internal.DB.Create(template).Error; err != nil {
 		s.gcsClient.DeleteFile(ctx, objectName)
+		s.gcsClient.DeleteFile(ctx, normalizedName)
 		return nil, fmt.Errorf("failed to save template metadata: %w", err)
 	}
 
 	return template, nil
 }
 
+// templateAnalysis holds the JSON recorded about a template's placeholders and layout
+type templateAnalysis struct {
+	placeholders string
+	positions    string
+	sections     string
+}
+
+// analyzeTemplate reads the placeholders of an unzipped template, their positions and its
+// sections. Snippet includes are resolved into the working copy first, so the template must
+// already be zipped.
+func (s *TemplateService) analyzeTemplate(ctx context.Context, proc *processor.DocxProcessor) (*templateAnalysis, error) {
+	// Merge included snippets so their placeholders are listed with the template's own
+	if s.snippetService != nil {
+		if _, err := s.snippetService.ResolveIncludes(ctx, proc); err != nil {
+			fmt.Printf("Warning: failed to resolve snippet includes: %v\n", err)
+		}
+	}
+
+	placeholders, err := proc.ExtractPlaceholders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholders: %w", err)
+	}
+
+	// Charts are bound through placeholders in their alt text
+	chartPlaceholders, err := proc.ChartPlaceholders()
+	if err != nil {
+		fmt.Printf("Warning: failed to find chart bindings: %v\n", err)
+	}
+	for _, placeholder := range chartPlaceholders {
+		if !slices.Contains(placeholders, placeholder) {
+			placeholders = append(placeholders, placeholder)
+		}
+	}
+
+	// Extract positions
+	positions, err := proc.ExtractPlaceholdersWithPositions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract placeholder positions: %w", err)
+	}
+
+	// Replace the layout estimates with positions measured from a real rendering
+	if measured, err := s.measurePositions(ctx, proc, positions); err != nil {
+		fmt.Printf("Warning: failed to measure placeholder positions, keeping estimates: %v\n", err)
+	} else {
+		fmt.Printf("[DEBUG] Measured %d of %d placeholder positions\n", measured, len(positions))
+	}
+
+	// Page setup of every section, which the positions refer to
+	sections, err := proc.Sections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sections: %w", err)
+	}
+	sectionsJSON, err := json.Marshal(sections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sections: %w", err)
+	}
+
+	// Convert placeholders to JSON
+	placeholdersJSON, err := json.Marshal(placeholders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal placeholders: %w", err)
+	}
+
+	// Convert positions to JSON
+	positionsJSON, err := json.Marshal(positions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal positions: %w", err)
+	}
+
+	return &templateAnalysis{
+		placeholders: string(placeholdersJSON),
+		positions:    string(positionsJSON),
+		sections:     string(sectionsJSON),
+	}, nil
+}
+
 func (s *TemplateService) GetTemplate(templateID string) (*models.Template, error) {
 	var template models.Template
 	if err := internal.DB.First(&template, "id = ?", templateID).Error; err != nil {
@@ -154,6 +290,121 @@ func (s *TemplateService) GetPlaceholderPositions(templateID string) ([]processo
 	return positions, nil
 }
 
+func (s *TemplateService) GetSections(templateID string) ([]processor.Section, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []processor.Section
+	if template.Sections != "" {
+		if err := json.Unmarshal([]byte(template.Sections), &sections); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal sections: %w", err)
+		}
+	}
+
+	return sections, nil
+}
+
+func (s *TemplateService) GetComputedFields(templateID string) ([]models.ComputedField, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseComputedFields(template.ComputedFields)
+}
+
+func (s *TemplateService) UpdateComputedFields(templateID string, fields []models.ComputedField) (*models.Template, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := ValidateComputedFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldsJSON, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal computed fields: %w", err)
+	}
+
+	if err := internal.DB.Model(template).Update("computed_fields", string(fieldsJSON)).Error; err != nil {
+		return nil, fmt.Errorf("failed to save computed fields: %w", err)
+	}
+	template.ComputedFields = string(fieldsJSON)
+
+	return template, nil
+}
+
+func (s *TemplateService) GetNumberingRules(templateID string) ([]models.NumberingRule, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNumberingRules(template.NumberingRules)
+}
+
+func (s *TemplateService) UpdateNumberingRules(templateID string, rules []models.NumberingRule) (*models.Template, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := ValidateNumberingRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	rulesJSON, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal numbering rules: %w", err)
+	}
+
+	if err := internal.DB.Model(template).Update("numbering_rules", string(rulesJSON)).Error; err != nil {
+		return nil, fmt.Errorf("failed to save numbering rules: %w", err)
+	}
+	template.NumberingRules = string(rulesJSON)
+
+	return template, nil
+}
+
+func (s *TemplateService) GetDocumentProperties(templateID string) (models.DocumentProperties, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return models.DocumentProperties{}, err
+	}
+
+	return ParseDocumentProperties(template.DocProps)
+}
+
+func (s *TemplateService) UpdateDocumentProperties(templateID string, props models.DocumentProperties) (*models.Template, error) {
+	template, err := s.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := ValidateDocumentProperties(props)
+	if err != nil {
+		return nil, err
+	}
+
+	propsJSON, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document properties: %w", err)
+	}
+
+	if err := internal.DB.Model(template).Update("doc_props", string(propsJSON)).Error; err != nil {
+		return nil, fmt.Errorf("failed to save document properties: %w", err)
+	}
+	template.DocProps = string(propsJSON)
+
+	return template, nil
+}
+
 func (s *TemplateService) DeleteTemplate(ctx context.Context, templateID string) error {
 	template, err := s.GetTemplate(templateID)
 	if err != nil {
@@ -165,6 +416,33 @@ func (s *TemplateService) DeleteTemplate(ctx context.Context, templateID string)
 		// Log error but continue with database deletion
 		fmt.Printf("Warning: failed to delete GCS file %s: %v\n", template.GCSPath, err)
 	}
+	if template.NormalizedPath != "" {
+		if err := s.gcsClient.DeleteFile(ctx, template.NormalizedPath); err != nil {
+			fmt.Printf("Warning: failed to delete GCS file %s: %v\n", template.NormalizedPath, err)
+		}
+	}
+	if template.OriginalPath != "" {
+		if err := s.gcsClient.DeleteFile(ctx, template.OriginalPath); err != nil {
+			fmt.Printf("Warning: failed to delete GCS file %s: %v\n", template.OriginalPath, err)
+		}
+	}
+
+	// Files of earlier versions, including the uploaded copy once edited; the latest one is the normalized path
+	var versions []models.TemplateVersion
+	if err := internal.DB.Where("template_id = ?", templateID).Find(&versions).Error; err != nil {
+		fmt.Printf("Warning: failed to list versions of template %s: %v\n", templateID, err)
+	}
+	for _, version := range versions {
+		if version.GCSPath == template.NormalizedPath {
+			continue
+		}
+		if err := s.gcsClient.DeleteFile(ctx, version.GCSPath); err != nil {
+			fmt.Printf("Warning: failed to delete GCS file %s: %v\n", version.GCSPath, err)
+		}
+	}
+	if err := internal.DB.Where("template_id = ?", templateID).Delete(&models.TemplateVersion{}).Error; err != nil {
+		fmt.Printf("Warning: failed to delete versions of template %s: %v\n", templateID, err)
+	}
 
 	// Soft delete from database
 	return internal.DB.Delete(template).Error
@@ -186,6 +464,17 @@ func (s *TemplateService) createTempFile(reader io.Reader) (string, error) {
 	return tempFile.Name(), nil
 }
 
+// uploadLocalFile uploads a file from disk to objectName, replacing any existing object
+func (s *TemplateService) uploadLocalFile(ctx context.Context, filePath, objectName, contentType string) (*storage.UploadResult, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return s.gcsClient.UploadFile(ctx, f, objectName, contentType)
+}
+
 func (s *TemplateService) cleanupTempFile(filePath string) {
 	os.Remove(filePath)
-}
\ No newline at end of file
+}
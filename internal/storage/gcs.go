@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -95,6 +97,29 @@ func GenerateObjectName(templateID, filename string) string {
 	return fmt.Sprintf("templates/%s/%d_%s", templateID, timestamp, filename)
 }
 
+// GenerateNormalizedObjectName names the normalized copy stored next to an uploaded template
+func GenerateNormalizedObjectName(templateID, filename string) string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("templates/%s/normalized/%d_%s", templateID, timestamp, filename)
+}
+
+// GenerateVersionObjectName names the file of a template version produced by edits
+func GenerateVersionObjectName(templateID string, version int, filename string) string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("templates/%s/versions/%d_%d_%s", templateID, version, timestamp, filename)
+}
+
+// GenerateOriginalObjectName names the uploaded file a template was converted from
+func GenerateOriginalObjectName(templateID, filename string) string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("templates/%s/original/%d_%s", templateID, timestamp, filename)
+}
+
+func GenerateSnippetObjectName(snippetID, filename string) string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("snippets/%s/%d_%s", snippetID, timestamp, filename)
+}
+
 func GenerateDocumentObjectName(documentID, filename string) string {
 	timestamp := time.Now().Unix()
 	return fmt.Sprintf("documents/%s/%d_%s", documentID, timestamp, filename)
@@ -102,6 +127,11 @@ func GenerateDocumentObjectName(documentID, filename string) string {
 
 func GenerateDocumentPDFObjectName(documentID, filename string) string {
 	timestamp := time.Now().Unix()
-	pdfFilename := filename[:len(filename)-5] + ".pdf" // Replace .docx with .pdf
+	pdfFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".pdf" // Replace the template extension with .pdf
 	return fmt.Sprintf("documents/%s/%d_%s", documentID, timestamp, pdfFilename)
-}
\ No newline at end of file
+}
+
+func GeneratePacketPDFObjectName(submissionID, filename string) string {
+	timestamp := time.Now().Unix()
+	return fmt.Sprintf("packets/%s/%d_%s", submissionID, timestamp, filename)
+}